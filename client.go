@@ -2,20 +2,35 @@ package mqx
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/wenzuojing/mqx/internal"
 	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/producer"
+)
+
+var (
+	// ErrBufferFull is returned by SendAsync in fail-fast mode when the send buffer is full
+	ErrBufferFull = producer.ErrBufferFull
+	// ErrProducerClosed is returned by SendAsync once the client is closing
+	ErrProducerClosed = producer.ErrProducerClosed
+	// ErrInvalidTopic is wrapped by the errors of sends, including PrepareSend, to a topic whose name
+	// holds characters other than letters, digits, underscores and hyphens or is too long
+	ErrInvalidTopic = model.ErrInvalidTopic
 )
 
 // Message represents a message to be sent or received
 type Message struct {
-	Topic string        // Topic name for the message
-	Key   string        // Optional key for message routing
-	Tag   string        // Optional tag for message filtering
-	Body  []byte        // Message payload
-	Delay time.Duration // Optional delay duration for delayed messages
+	Topic   string            // Topic name for the message
+	Key     string            // Optional key for message routing
+	Tag     string            // Optional tag for message filtering
+	Body    []byte            // Message payload
+	Delay   time.Duration     // Optional delay duration for delayed messages
+	Headers map[string]string // Optional application headers stored with the message
 }
 
 // NewMessage creates a new message instance with default values
@@ -53,32 +68,114 @@ func (m *Message) WithDelay(delay time.Duration) *Message {
 	return m
 }
 
+// WithHeader sets an application header on the message
+func (m *Message) WithHeader(key string, value string) *Message {
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	m.Headers[key] = value
+	return m
+}
+
 // MessageView represents a received message with additional metadata
 type MessageView struct {
-	MessageID string    // Unique message identifier
-	BornTime  time.Time // Message creation timestamp
-	Group     string    // Consumer group
-	Topic     string    // Topic name
-	Key       string    // Message routing key
-	Tag       string    // Message tag
-	Body      []byte    // Message payload
-	Partition int       // Partition number where message is stored
+	MessageID string            // Unique message identifier
+	BornTime  time.Time         // Message creation timestamp
+	Group     string            // Consumer group
+	Topic     string            // Topic name
+	Key       string            // Message routing key
+	Tag       string            // Message tag
+	Body      []byte            // Message payload
+	Partition int               // Partition number where message is stored
+	Headers   map[string]string // Application headers stored with the message
 }
 
-// MessageHandler defines the callback function for message processing
-type MessageHandler func(msg *MessageView) error
+// CorrelationID returns the correlation ID of a request or reply message
+func (m *MessageView) CorrelationID() string {
+	return m.Headers[model.HeaderCorrelationID]
+}
+
+// ReplyTo returns the reply topic of a request message, empty for regular messages
+func (m *MessageView) ReplyTo() string {
+	return m.Headers[model.HeaderReplyTo]
+}
+
+// TransactionState is the resolution reported by a TransactionChecker
+type TransactionState = model.TransactionState
+
+const (
+	// TransactionUnknown leaves the half message pending until the next check-back
+	TransactionUnknown = model.TransactionUnknown
+	// TransactionCommit delivers the half message to its topic
+	TransactionCommit = model.TransactionCommit
+	// TransactionRollback discards the half message
+	TransactionRollback = model.TransactionRollback
+)
+
+// TransactionChecker resolves a half message whose local transaction outcome is unknown
+type TransactionChecker func(topic string, messageID string) TransactionState
+
+// MessageHandler defines the callback function for message processing.
+// ctx is cancelled when the partition is revoked or the client is closed, carries the
+// message (see MessageFromContext) and has the configured HandlerTimeout as its deadline.
+type MessageHandler func(ctx context.Context, msg *MessageView) error
+
+// RequestHandler processes a request message and returns the reply body
+type RequestHandler func(ctx context.Context, msg *MessageView) ([]byte, error)
+
+type messageContextKey struct{}
+
+// MessageFromContext returns the message being handled, if ctx is a handler context
+func MessageFromContext(ctx context.Context) (*MessageView, bool) {
+	msg, ok := ctx.Value(messageContextKey{}).(*MessageView)
+	return msg, ok
+}
 
 // MQX defines the main interface for message queue operations
 type MQX interface {
 	// SendSync sends a message synchronously and returns its ID
 	SendSync(ctx context.Context, msg *Message) (string, error)
-	// SendAsync sends a message asynchronously with a callback
+	// SendAsync buffers a message for a batched write and calls back with the result.
+	// It blocks while the buffer is full, or fails with ErrBufferFull in fail-fast mode.
 	SendAsync(ctx context.Context, msg *Message, callback func(string, error)) error
 	// GroupSubscribe creates a consumer group subscription
 	GroupSubscribe(ctx context.Context, topic string, group string, handler MessageHandler) error
 	// BroadcastSubscribe creates a broadcast subscription where each consumer receives all messages
 	BroadcastSubscribe(ctx context.Context, topic string, handler MessageHandler) error
-	// Close gracefully shuts down the message queue client
+	// PrepareSend stores a half message that stays invisible to consumers until committed
+	PrepareSend(ctx context.Context, msg *Message) (string, error)
+	// Commit delivers a prepared half message to its topic
+	Commit(ctx context.Context, messageID string) error
+	// Rollback discards a prepared half message
+	Rollback(ctx context.Context, messageID string) error
+	// RegisterTransactionChecker registers the checker called for half messages of a topic left unresolved
+	RegisterTransactionChecker(topic string, checker TransactionChecker)
+	// Request publishes a request message and waits for its reply until ctx is done
+	Request(ctx context.Context, msg *Message) (*MessageView, error)
+	// Responder wraps a request handler into a message handler that publishes its result as the reply
+	Responder(handler RequestHandler) MessageHandler
+	// UseConsumer appends middlewares wrapping the handlers of subscriptions created afterwards
+	UseConsumer(middlewares ...ConsumerMiddleware)
+	// UseProducer appends middlewares wrapping SendSync and SendAsync
+	UseProducer(middlewares ...ProducerMiddleware)
+	// RegisterMetrics registers the client's Prometheus collectors into an application registry.
+	// The same metrics are served by the console on /metrics.
+	RegisterMetrics(reg prometheus.Registerer) error
+	// TraceMessage returns the recorded lifecycle of a message in chronological order.
+	// It fails with ErrMessageTraceDisabled unless the config enables message tracing.
+	TraceMessage(ctx context.Context, messageID string) ([]*MessageTraceEvent, error)
+	// Health reports database connectivity, system tables, the delay loop and the
+	// heartbeats and partitions of this instance's subscriptions
+	Health(ctx context.Context) *HealthReport
+	// WebhookSubscribe creates or replaces the webhook subscription of a consumer group, which POSTs each message
+	// to url. It is stored in the database and run by every instance with webhooks enabled. A failed delivery,
+	// a non-2xx response or a timeout, is retried and dead lettered like a failed handler.
+	WebhookSubscribe(ctx context.Context, topic string, group string, url string, opts WebhookOptions) error
+	// WebhookUnsubscribe deletes the webhook subscription of a consumer group
+	WebhookUnsubscribe(ctx context.Context, topic string, group string) error
+	// WebhookSubscriptions returns all webhook subscriptions
+	WebhookSubscriptions(ctx context.Context) ([]*WebhookSubscription, error)
+	// Close drains in-flight handlers and async sends until the ctx deadline, then shuts the client down
 	Close(ctx context.Context) error
 }
 
@@ -95,12 +192,53 @@ func NewMQX(cfg *Config) (MQX, error) {
 		PullingSize:                       cfg.PullingSize,
 		RetryInterval:                     cfg.RetryInterval,
 		RetryTimes:                        cfg.RetryTimes,
+		HandlerTimeout:                    cfg.HandlerTimeout,
 		ClearInterval:                     cfg.ClearInterval,
+		TransactionTimeout:                cfg.TransactionTimeout,
+		TransactionCheckInterval:          cfg.TransactionCheckInterval,
+		TransactionCheckMaxTimes:          cfg.TransactionCheckMaxTimes,
+		RequestTimeout:                    cfg.RequestTimeout,
+		ReplyPollingInterval:              cfg.ReplyPollingInterval,
+		AsyncBufferSize:                   cfg.AsyncBufferSize,
+		AsyncBatchSize:                    cfg.AsyncBatchSize,
+		AsyncLinger:                       cfg.AsyncLinger,
+		AsyncFailFast:                     cfg.AsyncFailFast,
+		TracerProvider:                    cfg.TracerProvider,
+		Propagator:                        cfg.Propagator,
+		Logger:                            cfg.Logger,
+		EnableMessageTrace:                cfg.EnableMessageTrace,
+		MessageTraceRetentionDays:         cfg.MessageTraceRetentionDays,
+		AuditRetentionDays:                cfg.AuditRetentionDays,
 		RetentionDays:                     cfg.RetentionDays,
 		EnableConsole:                     cfg.EnableConsole,
 		Console: config.Console{
-			Address: cfg.Console.Address,
+			Address:        cfg.Console.Address,
+			Users:          cfg.Console.Users,
+			Tokens:         cfg.Console.Tokens,
+			Proxy:          cfg.Console.Proxy,
+			Authenticators: cfg.Console.Authenticators,
+			AllowedOrigins: cfg.Console.AllowedOrigins,
+			TLSCertFile:    cfg.Console.TLSCertFile,
+			TLSKeyFile:     cfg.Console.TLSKeyFile,
+		},
+		EnableGateway: cfg.EnableGateway,
+		Gateway: config.Gateway{
+			Address:        cfg.Gateway.Address,
+			Tokens:         cfg.Gateway.Tokens,
+			MaxBatchSize:   cfg.Gateway.MaxBatchSize,
+			MaxWait:        cfg.Gateway.MaxWait,
+			SessionTimeout: cfg.Gateway.SessionTimeout,
 		},
+		EnableGRPC: cfg.EnableGRPC,
+		GRPC: config.GRPC{
+			Address:      cfg.GRPC.Address,
+			Tokens:       cfg.GRPC.Tokens,
+			MaxBatchSize: cfg.GRPC.MaxBatchSize,
+			MaxInFlight:  cfg.GRPC.MaxInFlight,
+		},
+		EnableWebhooks:         cfg.EnableWebhooks,
+		WebhookTimeout:         cfg.WebhookTimeout,
+		WebhookRefreshInterval: cfg.WebhookRefreshInterval,
 	})
 	if err != nil {
 		return nil, err
@@ -111,70 +249,204 @@ func NewMQX(cfg *Config) (MQX, error) {
 
 	return &client{
 		messageService: messageService,
+		logger:         logging.OrDefault(cfg.Logger),
 	}, nil
 }
 
 // client implements the MQX interface
 type client struct {
-	messageService internal.MessageService
+	messageService      internal.MessageService
+	consumerMiddlewares []ConsumerMiddleware
+	producerMiddlewares []ProducerMiddleware
+	mu                  sync.RWMutex
+	logger              Logger
+}
+
+// UseConsumer appends consumer middlewares
+func (c *client) UseConsumer(middlewares ...ConsumerMiddleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.consumerMiddlewares = append(c.consumerMiddlewares, middlewares...)
+}
+
+// UseProducer appends producer middlewares
+func (c *client) UseProducer(middlewares ...ProducerMiddleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.producerMiddlewares = append(c.producerMiddlewares, middlewares...)
+}
+
+// wrapHandler applies the consumer middlewares registered so far
+func (c *client) wrapHandler(handler MessageHandler) MessageHandler {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return chainConsumer(c.consumerMiddlewares, handler)
+}
+
+// wrapSend applies the producer middlewares registered so far
+func (c *client) wrapSend(send SendFunc) SendFunc {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return chainProducer(c.producerMiddlewares, send)
 }
 
 // SendSync sends a message synchronously
 func (c *client) SendSync(ctx context.Context, msg *Message) (string, error) {
-	// Convert Message to internal model.Message
-	return c.messageService.SendSync(ctx, &model.Message{
-		Topic:    msg.Topic,
-		Key:      msg.Key,
-		Tag:      msg.Tag,
-		Body:     msg.Body,
-		BornTime: time.Now(),
-		Delay:    msg.Delay,
-	})
+	return c.wrapSend(func(ctx context.Context, msg *Message) (string, error) {
+		return c.messageService.SendSync(ctx, toModelMessage(msg))
+	})(logging.NewContext(ctx, c.logger), msg)
 }
 
-// SendAsync sends a message asynchronously
+// SendAsync sends a message asynchronously.
+// Producer middlewares observe the enqueue; the send result is reported to the callback.
 func (c *client) SendAsync(ctx context.Context, msg *Message, callback func(string, error)) error {
-	return c.messageService.SendAsync(ctx, &model.Message{
-		Topic:    msg.Topic,
-		Key:      msg.Key,
-		Tag:      msg.Tag,
-		Body:     msg.Body,
-		BornTime: time.Now(),
-		Delay:    msg.Delay,
-	}, callback)
+	_, err := c.wrapSend(func(ctx context.Context, msg *Message) (string, error) {
+		return "", c.messageService.SendAsync(ctx, toModelMessage(msg), callback)
+	})(logging.NewContext(ctx, c.logger), msg)
+	return err
 }
 
 // GroupSubscribe creates a consumer group subscription
 func (c *client) GroupSubscribe(ctx context.Context, topic string, group string, handler MessageHandler) error {
-	return c.messageService.GroupSubscribe(ctx, topic, group, func(msg *model.Message) error {
-		return handler(&MessageView{
-			MessageID: msg.MessageID,
-			Group:     group,
-			Topic:     topic,
-			BornTime:  msg.BornTime,
-			Key:       msg.Key,
-			Tag:       msg.Tag,
-			Partition: msg.Partition,
-			Body:      msg.Body,
-		})
+	handler = c.wrapHandler(handler)
+	return c.messageService.GroupSubscribe(ctx, topic, group, func(ctx context.Context, msg *model.Message) error {
+		view := toMessageView(msg, group)
+		return handler(c.handlerContext(ctx, view), view)
 	})
 }
 
 // BroadcastSubscribe creates a broadcast subscription
 func (c *client) BroadcastSubscribe(ctx context.Context, topic string, handler MessageHandler) error {
-	return c.messageService.BroadcastSubscribe(ctx, topic, func(msg *model.Message) error {
-		return handler(&MessageView{
-			MessageID: msg.MessageID,
-			BornTime:  msg.BornTime,
-			Topic:     msg.Topic,
-			Key:       msg.Key,
-			Tag:       msg.Tag,
-			Partition: msg.Partition,
-		})
+	handler = c.wrapHandler(handler)
+	return c.messageService.BroadcastSubscribe(ctx, topic, func(ctx context.Context, msg *model.Message) error {
+		view := toMessageView(msg, "")
+		return handler(c.handlerContext(ctx, view), view)
 	})
 }
 
-// Close gracefully shuts down the message queue client
+// handlerContext adds the message and the client logger to a handler context
+func (c *client) handlerContext(ctx context.Context, view *MessageView) context.Context {
+	return logging.NewContext(context.WithValue(ctx, messageContextKey{}, view), c.logger)
+}
+
+// PrepareSend stores a half message
+func (c *client) PrepareSend(ctx context.Context, msg *Message) (string, error) {
+	return c.messageService.PrepareSend(ctx, toModelMessage(msg))
+}
+
+// Commit delivers a prepared half message
+func (c *client) Commit(ctx context.Context, messageID string) error {
+	return c.messageService.Commit(ctx, messageID)
+}
+
+// Rollback discards a prepared half message
+func (c *client) Rollback(ctx context.Context, messageID string) error {
+	return c.messageService.Rollback(ctx, messageID)
+}
+
+// RegisterTransactionChecker registers a transaction checker for a topic
+func (c *client) RegisterTransactionChecker(topic string, checker TransactionChecker) {
+	c.messageService.RegisterTransactionChecker(topic, model.TransactionChecker(checker))
+}
+
+// Request publishes a request message and waits for its reply
+func (c *client) Request(ctx context.Context, msg *Message) (*MessageView, error) {
+	reply, err := c.messageService.Request(ctx, toModelMessage(msg))
+	if reply == nil {
+		return nil, err
+	}
+	return toMessageView(reply, ""), err
+}
+
+// Responder wraps a request handler so its result is published to the request's reply topic.
+// A handler error is sent back to the requester instead of triggering a retry.
+// Messages that are not requests have nowhere to reply to and are skipped.
+func (c *client) Responder(handler RequestHandler) MessageHandler {
+	return func(ctx context.Context, msg *MessageView) error {
+		if msg.Headers[model.HeaderReplyTo] == "" {
+			c.logger.Warn("Skipping message without reply-to header", "topic", msg.Topic, "group", msg.Group, "messageId", msg.MessageID)
+			return nil
+		}
+		body, err := handler(ctx, msg)
+		reply := &model.Message{Body: body, BornTime: time.Now()}
+		if err != nil {
+			reply.Headers = map[string]string{model.HeaderReplyError: err.Error()}
+		}
+		_, replyErr := c.messageService.Reply(context.WithoutCancel(ctx), &model.Message{Headers: msg.Headers}, reply)
+		return replyErr
+	}
+}
+
+// RegisterMetrics registers the client's Prometheus collectors into an application registry
+func (c *client) RegisterMetrics(reg prometheus.Registerer) error {
+	return c.messageService.Metrics().Register(reg)
+}
+
+// TraceMessage returns the recorded lifecycle of a message
+func (c *client) TraceMessage(ctx context.Context, messageID string) ([]*MessageTraceEvent, error) {
+	return c.messageService.TraceMessage(ctx, messageID)
+}
+
+// Health reports the health of this instance
+func (c *client) Health(ctx context.Context) *HealthReport {
+	return c.messageService.Health(ctx)
+}
+
+// WebhookSubscribe creates or replaces a webhook subscription
+func (c *client) WebhookSubscribe(ctx context.Context, topic string, group string, url string, opts WebhookOptions) error {
+	return c.messageService.WebhookSubscribe(ctx, &model.WebhookSubscription{
+		Topic:       topic,
+		Group:       group,
+		URL:         url,
+		Secret:      opts.Secret,
+		Concurrency: opts.Concurrency,
+		RateLimit:   opts.RateLimit,
+		TimeoutMs:   opts.Timeout.Milliseconds(),
+	})
+}
+
+// WebhookUnsubscribe deletes a webhook subscription
+func (c *client) WebhookUnsubscribe(ctx context.Context, topic string, group string) error {
+	return c.messageService.WebhookUnsubscribe(ctx, topic, group)
+}
+
+// WebhookSubscriptions returns all webhook subscriptions
+func (c *client) WebhookSubscriptions(ctx context.Context) ([]*WebhookSubscription, error) {
+	return c.messageService.WebhookSubscriptions(ctx)
+}
+
+// Close gracefully shuts down the message queue client.
+// It stops fetching, waits for in-flight handlers and async sends until the ctx deadline,
+// commits final offsets and leaves consumer groups, shuts the console down and closes the
+// database. Work still running at the deadline is abandoned and reported in the error.
 func (c *client) Close(ctx context.Context) error {
 	return c.messageService.Stop(ctx)
 }
+
+// toModelMessage converts a Message to the internal model.Message
+func toModelMessage(msg *Message) *model.Message {
+	return &model.Message{
+		Topic:    msg.Topic,
+		Key:      msg.Key,
+		Tag:      msg.Tag,
+		Body:     msg.Body,
+		Headers:  msg.Headers,
+		BornTime: time.Now(),
+		Delay:    msg.Delay,
+	}
+}
+
+// toMessageView converts an internal model.Message to a MessageView
+func toMessageView(msg *model.Message, group string) *MessageView {
+	return &MessageView{
+		MessageID: msg.MessageID,
+		Group:     group,
+		Topic:     msg.Topic,
+		BornTime:  msg.BornTime,
+		Key:       msg.Key,
+		Tag:       msg.Tag,
+		Partition: msg.Partition,
+		Body:      msg.Body,
+		Headers:   msg.Headers,
+	}
+}
@@ -0,0 +1,22 @@
+package mqx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/logging"
+)
+
+func TestResponder_SkipsPlainMessages(t *testing.T) {
+	c := &client{logger: logging.Discard()}
+	called := false
+	handler := c.Responder(func(ctx context.Context, msg *MessageView) ([]byte, error) {
+		called = true
+		return nil, nil
+	})
+
+	// Not retried nor dead-lettered, the handler never sees it
+	assert.NoError(t, handler(context.Background(), &MessageView{MessageID: "msg-1", Topic: "echo-topic"}))
+	assert.False(t, called)
+}
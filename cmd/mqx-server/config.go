@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wenzuojing/mqx"
+	"gopkg.in/yaml.v3"
+)
+
+// secretFlags hold tokens or password hashes, which are better read from the environment or the file
+var secretFlags = map[string]bool{"console-user": true, "console-token": true, "gateway-token": true, "grpc-token": true}
+
+// envPrefix prefixes the environment variables of the flags: -console-address is read from $MQX_CONSOLE_ADDRESS
+const envPrefix = "MQX_"
+
+// serverConfig is the configuration of the server. Each setting comes from, in increasing precedence,
+// the defaults of the library, the configuration file, the environment and the command line.
+type serverConfig struct {
+	DSN                       string         `yaml:"dsn"`
+	DefaultPartitionNum       int            `yaml:"defaultPartitionNum"`
+	RetentionDays             int            `yaml:"retentionDays"`
+	HeartbeatInterval         time.Duration  `yaml:"heartbeatInterval"`
+	DelayInterval             time.Duration  `yaml:"delayInterval"`
+	ClearInterval             time.Duration  `yaml:"clearInterval"`
+	EnableMessageTrace        bool           `yaml:"enableMessageTrace"`
+	MessageTraceRetentionDays int            `yaml:"messageTraceRetentionDays"`
+	AuditRetentionDays        int            `yaml:"auditRetentionDays"`
+	ShutdownTimeout           time.Duration  `yaml:"shutdownTimeout"`
+	LogLevel                  string         `yaml:"logLevel"`
+	LogFormat                 string         `yaml:"logFormat"`
+	Console                   consoleConfig  `yaml:"console"`
+	Gateway                   gatewayConfig  `yaml:"gateway"`
+	GRPC                      grpcConfig     `yaml:"grpc"`
+	Webhooks                  webhooksConfig `yaml:"webhooks"`
+	// secretFlags are the flags holding secrets that were set on the command line, visible to ps
+	secretFlags []string
+}
+
+type consoleConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Insecure       bool          `yaml:"insecure"`
+	Address        string        `yaml:"address"`
+	Users          []userConfig  `yaml:"users"`
+	Tokens         []tokenConfig `yaml:"tokens"`
+	Proxy          *proxyConfig  `yaml:"proxy"`
+	AllowedOrigins []string      `yaml:"allowedOrigins"`
+	TLSCertFile    string        `yaml:"tlsCertFile"`
+	TLSKeyFile     string        `yaml:"tlsKeyFile"`
+}
+
+type gatewayConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Insecure       bool          `yaml:"insecure"`
+	Address        string        `yaml:"address"`
+	Tokens         []tokenConfig `yaml:"tokens"`
+	MaxBatchSize   int           `yaml:"maxBatchSize"`
+	MaxWait        time.Duration `yaml:"maxWait"`
+	SessionTimeout time.Duration `yaml:"sessionTimeout"`
+}
+
+type grpcConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Insecure     bool          `yaml:"insecure"`
+	Address      string        `yaml:"address"`
+	Tokens       []tokenConfig `yaml:"tokens"`
+	MaxBatchSize int           `yaml:"maxBatchSize"`
+	MaxInFlight  int           `yaml:"maxInFlight"`
+}
+
+type webhooksConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Timeout         time.Duration `yaml:"timeout"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+type userConfig struct {
+	Username     string          `yaml:"username"`
+	PasswordHash string          `yaml:"passwordHash"`
+	Role         mqx.ConsoleRole `yaml:"role"`
+}
+
+type tokenConfig struct {
+	Name  string          `yaml:"name"`
+	Role  mqx.ConsoleRole `yaml:"role"`
+	Token string          `yaml:"token"`
+}
+
+type proxyConfig struct {
+	UserHeader     string          `yaml:"userHeader"`
+	RoleHeader     string          `yaml:"roleHeader"`
+	DefaultRole    mqx.ConsoleRole `yaml:"defaultRole"`
+	TrustedProxies []string        `yaml:"trustedProxies"`
+}
+
+// defaultServerConfig returns the defaults of the library, without DSN, with the console on and the
+// webhooks off: the server runs no subscription unless asked to
+func defaultServerConfig() *serverConfig {
+	d := mqx.NewConfig()
+	return &serverConfig{
+		DefaultPartitionNum:       d.DefaultPartitionNum,
+		RetentionDays:             d.RetentionDays,
+		HeartbeatInterval:         d.HeartbeatInterval,
+		DelayInterval:             d.DelayInterval,
+		ClearInterval:             d.ClearInterval,
+		EnableMessageTrace:        d.EnableMessageTrace,
+		MessageTraceRetentionDays: d.MessageTraceRetentionDays,
+		AuditRetentionDays:        d.AuditRetentionDays,
+		ShutdownTimeout:           30 * time.Second,
+		LogLevel:                  "info",
+		LogFormat:                 "text",
+		Console:                   consoleConfig{Enabled: true, Address: d.Console.Address},
+		Gateway: gatewayConfig{
+			Address:        d.Gateway.Address,
+			MaxBatchSize:   d.Gateway.MaxBatchSize,
+			MaxWait:        d.Gateway.MaxWait,
+			SessionTimeout: d.Gateway.SessionTimeout,
+		},
+		GRPC: grpcConfig{
+			Address:      d.GRPC.Address,
+			MaxBatchSize: d.GRPC.MaxBatchSize,
+			MaxInFlight:  d.GRPC.MaxInFlight,
+		},
+		Webhooks: webhooksConfig{Timeout: d.WebhookTimeout, RefreshInterval: d.WebhookRefreshInterval},
+	}
+}
+
+// loadConfig reads the configuration from the file named by -config or $MQX_CONFIG, then from the
+// environment and the command line
+func loadConfig(fs *flag.FlagSet, args []string, getenv func(string) string) (*serverConfig, error) {
+	cfg := defaultServerConfig()
+	path := configPath(args, getenv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	fs.String("config", path, "YAML configuration file")
+	cfg.bindFlags(fs)
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value := getenv(name)
+		if value == "" || f.Name == "config" {
+			return
+		}
+		// A repeatable flag takes a comma separated list from the environment
+		values := []string{value}
+		if _, ok := f.Value.(listFlag); ok {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if err := f.Value.Set(strings.TrimSpace(v)); err != nil {
+				errs = append(errs, fmt.Errorf("$%s: %w", name, err))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	// The command line replaces the lists of the file or the environment instead of adding to them
+	fs.VisitAll(func(f *flag.Flag) {
+		if list, ok := f.Value.(listFlag); ok {
+			list.reset()
+		}
+	})
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if secretFlags[f.Name] {
+			cfg.secretFlags = append(cfg.secretFlags, "-"+f.Name)
+		}
+	})
+	return cfg, nil
+}
+
+// configPath finds the configuration file before the other flags are defined, since the file gives
+// them their defaults
+func configPath(args []string, getenv func(string) string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return getenv(envPrefix + "CONFIG")
+}
+
+func (c *serverConfig) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.DSN, "dsn", c.DSN, "MySQL DSN")
+	fs.IntVar(&c.DefaultPartitionNum, "default-partition-num", c.DefaultPartitionNum, "partitions of the topics created on first use")
+	fs.IntVar(&c.RetentionDays, "retention-days", c.RetentionDays, "message retention days of the topics created on first use")
+	fs.DurationVar(&c.HeartbeatInterval, "heartbeat-interval", c.HeartbeatInterval, "heartbeat interval of the consumers, which decides the active instances")
+	fs.DurationVar(&c.DelayInterval, "delay-interval", c.DelayInterval, "interval of the delayed message processing")
+	fs.DurationVar(&c.ClearInterval, "clear-interval", c.ClearInterval, "interval of the deletion of expired messages")
+	fs.BoolVar(&c.EnableMessageTrace, "message-trace", c.EnableMessageTrace, "record the lifecycle of the messages")
+	fs.IntVar(&c.MessageTraceRetentionDays, "message-trace-retention-days", c.MessageTraceRetentionDays, "message trace retention days (0 for the message retention)")
+	fs.IntVar(&c.AuditRetentionDays, "audit-retention-days", c.AuditRetentionDays, "audit log retention days (0 to keep forever)")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "time to drain the servers on shutdown")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "text or json")
+
+	fs.BoolVar(&c.Console.Enabled, "console", c.Console.Enabled, "serve the console")
+	fs.StringVar(&c.Console.Address, "console-address", c.Console.Address, "console listen address")
+	fs.BoolVar(&c.Console.Insecure, "console-insecure", c.Console.Insecure, "serve the console without authentication, giving every client the admin role")
+	fs.Var(newListValue(&c.Console.Users, parseUser), "console-user", "console user as name:role:bcrypt-hash, repeatable")
+	fs.Var(newListValue(&c.Console.Tokens, parseToken), "console-token", "console bearer token as name:role:secret, repeatable")
+	fs.Var(newListValue(&c.Console.AllowedOrigins, parseString), "console-allowed-origin", "origin allowed by CORS, repeatable")
+	fs.StringVar(&c.Console.TLSCertFile, "console-tls-cert", c.Console.TLSCertFile, "console TLS certificate file")
+	fs.StringVar(&c.Console.TLSKeyFile, "console-tls-key", c.Console.TLSKeyFile, "console TLS private key file")
+
+	fs.BoolVar(&c.Gateway.Enabled, "gateway", c.Gateway.Enabled, "serve the HTTP gateway")
+	fs.StringVar(&c.Gateway.Address, "gateway-address", c.Gateway.Address, "gateway listen address (empty to serve it on the console)")
+	fs.BoolVar(&c.Gateway.Insecure, "gateway-insecure", c.Gateway.Insecure, "serve a standalone gateway without authentication")
+	fs.Var(newListValue(&c.Gateway.Tokens, parseToken), "gateway-token", "bearer token of a standalone gateway as name:role:secret, repeatable")
+	fs.IntVar(&c.Gateway.MaxBatchSize, "gateway-max-batch-size", c.Gateway.MaxBatchSize, "maximum number of messages published or fetched by a request")
+	fs.DurationVar(&c.Gateway.MaxWait, "gateway-max-wait", c.Gateway.MaxWait, "longest wait of a long-poll fetch")
+	fs.DurationVar(&c.Gateway.SessionTimeout, "gateway-session-timeout", c.Gateway.SessionTimeout, "time after which an idle gateway consumer leaves its group")
+
+	fs.BoolVar(&c.GRPC.Enabled, "grpc", c.GRPC.Enabled, "serve the gRPC services")
+	fs.StringVar(&c.GRPC.Address, "grpc-address", c.GRPC.Address, "gRPC listen address")
+	fs.BoolVar(&c.GRPC.Insecure, "grpc-insecure", c.GRPC.Insecure, "serve the gRPC services without authentication, giving every client the admin role")
+	fs.Var(newListValue(&c.GRPC.Tokens, parseToken), "grpc-token", "gRPC bearer token as name:role:secret, repeatable")
+	fs.IntVar(&c.GRPC.MaxBatchSize, "grpc-max-batch-size", c.GRPC.MaxBatchSize, "maximum number of messages of a PublishBatch call")
+	fs.IntVar(&c.GRPC.MaxInFlight, "grpc-max-in-flight", c.GRPC.MaxInFlight, "maximum number of unacknowledged messages of a subscription")
+
+	fs.BoolVar(&c.Webhooks.Enabled, "webhooks", c.Webhooks.Enabled, "run the webhook subscriptions")
+	fs.DurationVar(&c.Webhooks.Timeout, "webhook-timeout", c.Webhooks.Timeout, "default timeout of a webhook delivery")
+	fs.DurationVar(&c.Webhooks.RefreshInterval, "webhook-refresh-interval", c.Webhooks.RefreshInterval, "interval between reloads of the webhook subscriptions")
+}
+
+// mqxConfig converts the configuration to the one of the library
+func (c *serverConfig) mqxConfig() (*mqx.Config, error) {
+	logger, err := newLogger(c.LogLevel, c.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+	if c.DSN == "" {
+		return nil, errors.New("a DSN is required")
+	}
+	if c.Console.Enabled && !c.Console.Insecure && len(c.Console.Users) == 0 && len(c.Console.Tokens) == 0 && c.Console.Proxy == nil {
+		return nil, errors.New("the console has no authentication: configure console users, tokens or proxy, " +
+			"set -console-insecure to serve it to everyone as admin, or -console=false to disable it")
+	}
+	// A gateway without address is served on the console and shares its authentication
+	if c.Gateway.Enabled && c.Gateway.Address != "" && !c.Gateway.Insecure && len(c.Gateway.Tokens) == 0 {
+		return nil, errors.New("the standalone gateway has no authentication: configure gateway tokens, " +
+			"set -gateway-insecure to serve it to everyone, or serve it on the console with an empty -gateway-address")
+	}
+	if c.GRPC.Enabled && !c.GRPC.Insecure && len(c.GRPC.Tokens) == 0 {
+		return nil, errors.New("the gRPC services have no authentication: configure gRPC tokens, " +
+			"set -grpc-insecure to serve them to everyone as admin, or -grpc=false to disable them")
+	}
+	if len(c.secretFlags) > 0 {
+		logger.Warn("Secrets given on the command line are visible to other users of the host; "+
+			"set them with the environment or the configuration file instead", "flags", strings.Join(c.secretFlags, ","))
+	}
+	if !c.Console.Enabled && !c.Gateway.Enabled && !c.GRPC.Enabled {
+		logger.Warn("Console, gateway and gRPC are disabled; running the background managers only")
+	}
+
+	cfg := mqx.NewConfig()
+	cfg.DSN = c.DSN
+	cfg.DefaultPartitionNum = c.DefaultPartitionNum
+	cfg.RetentionDays = c.RetentionDays
+	cfg.HeartbeatInterval = c.HeartbeatInterval
+	cfg.DelayInterval = c.DelayInterval
+	cfg.ClearInterval = c.ClearInterval
+	cfg.EnableMessageTrace = c.EnableMessageTrace
+	cfg.MessageTraceRetentionDays = c.MessageTraceRetentionDays
+	cfg.AuditRetentionDays = c.AuditRetentionDays
+	cfg.Logger = logger
+
+	cfg.EnableConsole = c.Console.Enabled
+	cfg.Console = mqx.Console{
+		Address:        c.Console.Address,
+		Tokens:         tokens(c.Console.Tokens),
+		AllowedOrigins: c.Console.AllowedOrigins,
+		TLSCertFile:    c.Console.TLSCertFile,
+		TLSKeyFile:     c.Console.TLSKeyFile,
+	}
+	for _, u := range c.Console.Users {
+		cfg.Console.Users = append(cfg.Console.Users, mqx.ConsoleUser{Username: u.Username, PasswordHash: u.PasswordHash, Role: u.Role})
+	}
+	if p := c.Console.Proxy; p != nil {
+		cfg.Console.Proxy = &mqx.ConsoleProxyAuth{UserHeader: p.UserHeader, RoleHeader: p.RoleHeader, DefaultRole: p.DefaultRole, TrustedProxies: p.TrustedProxies}
+	}
+
+	cfg.EnableGateway = c.Gateway.Enabled
+	cfg.Gateway = mqx.Gateway{
+		Address:        c.Gateway.Address,
+		Tokens:         tokens(c.Gateway.Tokens),
+		MaxBatchSize:   c.Gateway.MaxBatchSize,
+		MaxWait:        c.Gateway.MaxWait,
+		SessionTimeout: c.Gateway.SessionTimeout,
+	}
+	cfg.EnableGRPC = c.GRPC.Enabled
+	cfg.GRPC = mqx.GRPC{
+		Address:      c.GRPC.Address,
+		Tokens:       tokens(c.GRPC.Tokens),
+		MaxBatchSize: c.GRPC.MaxBatchSize,
+		MaxInFlight:  c.GRPC.MaxInFlight,
+	}
+	cfg.EnableWebhooks = c.Webhooks.Enabled
+	cfg.WebhookTimeout = c.Webhooks.Timeout
+	cfg.WebhookRefreshInterval = c.Webhooks.RefreshInterval
+	return cfg, nil
+}
+
+// newLogger returns a slog logger writing to stderr
+func newLogger(level string, format string) (mqx.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level %q is not debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return mqx.NewSlogLogger(slog.New(slog.NewTextHandler(os.Stderr, opts))), nil
+	case "json":
+		return mqx.NewSlogLogger(slog.New(slog.NewJSONHandler(os.Stderr, opts))), nil
+	}
+	return nil, fmt.Errorf("log format %q is not text or json", format)
+}
+
+// listFlag is a repeatable flag
+type listFlag interface {
+	flag.Value
+	reset()
+}
+
+// listValue is a repeatable flag appending to a list of the configuration. The first value of each
+// source of settings replaces the list of the previous source.
+type listValue[T any] struct {
+	items    *[]T
+	parse    func(string) (T, error)
+	replaced bool
+}
+
+func newListValue[T any](items *[]T, parse func(string) (T, error)) *listValue[T] {
+	return &listValue[T]{items: items, parse: parse}
+}
+
+// String shows no default, since the lists may hold secrets
+func (l *listValue[T]) String() string {
+	return ""
+}
+
+func (l *listValue[T]) Set(value string) error {
+	item, err := l.parse(value)
+	if err != nil {
+		return err
+	}
+	if !l.replaced {
+		*l.items, l.replaced = nil, true
+	}
+	*l.items = append(*l.items, item)
+	return nil
+}
+
+func (l *listValue[T]) reset() {
+	l.replaced = false
+}
+
+func parseToken(value string) (tokenConfig, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || !mqx.ConsoleRole(parts[1]).Valid() {
+		return tokenConfig{}, fmt.Errorf("token %q is not name:role:secret with role viewer, operator or admin", parts[0])
+	}
+	return tokenConfig{Name: parts[0], Role: mqx.ConsoleRole(parts[1]), Token: parts[2]}, nil
+}
+
+func parseUser(value string) (userConfig, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || !mqx.ConsoleRole(parts[1]).Valid() {
+		return userConfig{}, fmt.Errorf("user %q is not name:role:bcrypt-hash with role viewer, operator or admin", parts[0])
+	}
+	return userConfig{Username: parts[0], Role: mqx.ConsoleRole(parts[1]), PasswordHash: parts[2]}, nil
+}
+
+func parseString(value string) (string, error) {
+	return value, nil
+}
+
+func tokens(list []tokenConfig) []mqx.ConsoleToken {
+	tokens := make([]mqx.ConsoleToken, len(list))
+	for i, token := range list {
+		tokens[i] = mqx.ConsoleToken{Name: token.Name, Role: token.Role, Token: token.Token}
+	}
+	return tokens
+}
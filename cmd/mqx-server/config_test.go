@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx"
+)
+
+func newTestFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("mqx-server", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "mqx-server.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func envOf(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	cfg, err := loadConfig(newTestFlagSet(), []string{"-dsn", "dsn"}, envOf(nil))
+	assert.NoError(t, err)
+	defaults := mqx.NewConfig()
+	assert.Equal(t, "dsn", cfg.DSN)
+	assert.Equal(t, defaults.DelayInterval, cfg.DelayInterval)
+	assert.True(t, cfg.Console.Enabled)
+	assert.Equal(t, defaults.Console.Address, cfg.Console.Address)
+	assert.False(t, cfg.Gateway.Enabled)
+	assert.False(t, cfg.GRPC.Enabled)
+	assert.False(t, cfg.Webhooks.Enabled)
+	assert.Equal(t, 30*time.Second, cfg.ShutdownTimeout)
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := writeConfigFile(t, `
+dsn: file-dsn
+retentionDays: 3
+delayInterval: 10s
+console:
+  address: :8000
+  tokens:
+    - {name: file, role: admin, token: file-secret}
+grpc:
+  enabled: true
+  address: :7000
+  tokens:
+    - {name: file, role: operator, token: file-secret}
+`)
+	env := map[string]string{
+		"MQX_CONFIG":          path,
+		"MQX_DSN":             "env-dsn",
+		"MQX_CONSOLE_ADDRESS": ":8001",
+		"MQX_CONSOLE_TOKEN":   "a:viewer:1, b:operator:2",
+		"MQX_GATEWAY":         "true",
+	}
+	cfg, err := loadConfig(newTestFlagSet(), []string{"-console-address=:8002", "-grpc-token", "cli:admin:3"}, envOf(env))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "env-dsn", cfg.DSN)
+	assert.Equal(t, 3, cfg.RetentionDays)
+	assert.Equal(t, 10*time.Second, cfg.DelayInterval)
+	assert.Equal(t, ":8002", cfg.Console.Address)
+	// The environment replaces the tokens of the file, the command line those of the environment
+	assert.Equal(t, []tokenConfig{{Name: "a", Role: mqx.ConsoleViewer, Token: "1"}, {Name: "b", Role: mqx.ConsoleOperator, Token: "2"}}, cfg.Console.Tokens)
+	assert.Equal(t, []tokenConfig{{Name: "cli", Role: mqx.ConsoleAdmin, Token: "3"}}, cfg.GRPC.Tokens)
+	assert.True(t, cfg.Gateway.Enabled)
+	assert.True(t, cfg.GRPC.Enabled)
+	assert.Equal(t, ":7000", cfg.GRPC.Address)
+	// Only the secrets of the command line are visible to ps
+	assert.Equal(t, []string{"-grpc-token"}, cfg.secretFlags)
+}
+
+func TestLoadConfig_ConfigFlag(t *testing.T) {
+	path := writeConfigFile(t, "dsn: file-dsn\n")
+	other := writeConfigFile(t, "dsn: other-dsn\n")
+	for _, args := range [][]string{{"-config", path}, {"--config=" + path}} {
+		cfg, err := loadConfig(newTestFlagSet(), args, envOf(map[string]string{"MQX_CONFIG": other}))
+		assert.NoError(t, err)
+		assert.Equal(t, "file-dsn", cfg.DSN)
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	_, err := loadConfig(newTestFlagSet(), []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, envOf(nil))
+	assert.Error(t, err)
+
+	_, err = loadConfig(newTestFlagSet(), []string{"-config", writeConfigFile(t, "delayInterval: soon\n")}, envOf(nil))
+	assert.Error(t, err)
+
+	_, err = loadConfig(newTestFlagSet(), nil, envOf(map[string]string{"MQX_GRPC_TOKEN": "a:root:hunter2"}))
+	assert.ErrorContains(t, err, "MQX_GRPC_TOKEN")
+	assert.NotContains(t, err.Error(), "hunter2")
+
+	_, err = loadConfig(newTestFlagSet(), []string{"extra"}, envOf(nil))
+	assert.ErrorContains(t, err, "unexpected arguments")
+}
+
+func TestServerConfig_MQXConfig(t *testing.T) {
+	cfg := defaultServerConfig()
+	_, err := cfg.mqxConfig()
+	assert.ErrorContains(t, err, "DSN")
+
+	cfg.DSN = "dsn"
+	cfg.Console.Users = []userConfig{{Username: "admin", PasswordHash: "hash", Role: mqx.ConsoleAdmin}}
+	cfg.Console.Proxy = &proxyConfig{UserHeader: "X-Forwarded-User", DefaultRole: mqx.ConsoleViewer}
+	cfg.Gateway = gatewayConfig{Enabled: true, Address: ":8080", Tokens: []tokenConfig{{Name: "gw", Role: mqx.ConsoleOperator, Token: "t"}}}
+	cfg.Webhooks.Enabled = true
+	converted, err := cfg.mqxConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "dsn", converted.DSN)
+	assert.True(t, converted.EnableConsole)
+	assert.Equal(t, []mqx.ConsoleUser{{Username: "admin", PasswordHash: "hash", Role: mqx.ConsoleAdmin}}, converted.Console.Users)
+	assert.Equal(t, "X-Forwarded-User", converted.Console.Proxy.UserHeader)
+	assert.True(t, converted.EnableGateway)
+	assert.Equal(t, []mqx.ConsoleToken{{Name: "gw", Role: mqx.ConsoleOperator, Token: "t"}}, converted.Gateway.Tokens)
+	assert.False(t, converted.EnableGRPC)
+	assert.True(t, converted.EnableWebhooks)
+	assert.NotNil(t, converted.Logger)
+
+	cfg.LogLevel = "loud"
+	_, err = cfg.mqxConfig()
+	assert.Error(t, err)
+}
+
+func TestServerConfig_MQXConfig_ConsoleAuthentication(t *testing.T) {
+	cfg := defaultServerConfig()
+	cfg.DSN = "dsn"
+	_, err := cfg.mqxConfig()
+	assert.ErrorContains(t, err, "-console-insecure")
+
+	cfg.Console.Insecure = true
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+
+	cfg.Console.Insecure = false
+	cfg.Console.Tokens = []tokenConfig{{Name: "ops", Role: mqx.ConsoleAdmin, Token: "t"}}
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+
+	cfg.Console = consoleConfig{Enabled: false}
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+}
+
+func TestServerConfig_MQXConfig_GatewayAuthentication(t *testing.T) {
+	cfg := defaultServerConfig()
+	cfg.DSN = "dsn"
+	cfg.Console.Insecure = true
+	cfg.Gateway = gatewayConfig{Enabled: true, Address: ":8080"}
+	_, err := cfg.mqxConfig()
+	assert.ErrorContains(t, err, "-gateway-insecure")
+
+	cfg.Gateway.Insecure = true
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+
+	cfg.Gateway.Insecure = false
+	cfg.Gateway.Tokens = []tokenConfig{{Name: "gw", Role: mqx.ConsoleOperator, Token: "t"}}
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+
+	// Served on the console, the gateway uses the authentication of the console
+	cfg.Gateway = gatewayConfig{Enabled: true}
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+}
+
+func TestServerConfig_MQXConfig_GRPCAuthentication(t *testing.T) {
+	cfg := defaultServerConfig()
+	cfg.DSN = "dsn"
+	cfg.Console.Insecure = true
+	cfg.GRPC = grpcConfig{Enabled: true, Address: ":9090"}
+	_, err := cfg.mqxConfig()
+	assert.ErrorContains(t, err, "-grpc-insecure")
+
+	cfg.GRPC.Insecure = true
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+
+	cfg.GRPC.Insecure = false
+	cfg.GRPC.Tokens = []tokenConfig{{Name: "billing", Role: mqx.ConsoleOperator, Token: "t"}}
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+}
+
+func TestExampleConfig(t *testing.T) {
+	cfg, err := loadConfig(newTestFlagSet(), []string{"-config", "mqx-server.example.yaml"}, envOf(nil))
+	assert.NoError(t, err)
+	_, err = cfg.mqxConfig()
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Console.Users, 1)
+}
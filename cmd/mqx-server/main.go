@@ -0,0 +1,53 @@
+// Command mqx-server runs the console, the delayed message processing, the deletion of expired messages
+// and, when enabled, the HTTP gateway, the gRPC services and the webhook subscriptions, without
+// consuming anything itself. It lets operations run the housekeeping and the UI apart from the
+// application deployments, and serves clients in other languages when no Go application embeds
+// the gateway or the gRPC services.
+//
+// The settings come from a YAML file, the environment and the command line, each overriding the
+// previous one; every flag has an environment variable named after it:
+//
+//	MQX_DSN='root:root@tcp(127.0.0.1:3306)/mqx?parseTime=true' mqx-server -config mqx-server.yaml -gateway
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/wenzuojing/mqx"
+)
+
+func main() {
+	fs := flag.NewFlagSet("mqx-server", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mqx-server [flags]\n\nEvery flag can also be set with $MQX_<FLAG>, e.g. $MQX_CONSOLE_ADDRESS; repeatable flags take a comma separated list.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	settings, err := loadConfig(fs, os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("mqx-server: %v", err)
+	}
+	cfg, err := settings.mqxConfig()
+	if err != nil {
+		log.Fatalf("mqx-server: %v", err)
+	}
+	mq, err := mqx.NewMQX(cfg)
+	if err != nil {
+		log.Fatalf("mqx-server: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	defer cancel()
+	if err := mq.Close(closeCtx); err != nil {
+		log.Fatalf("mqx-server: %v", err)
+	}
+}
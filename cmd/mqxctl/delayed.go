@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/console"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// delayedPageView is a page of waiting delayed and retry messages
+type delayedPageView struct {
+	Total    int64                 `json:"total"`
+	Messages []*delayedMessageView `json:"messages"`
+}
+
+type delayedMessageView struct {
+	*model.HTTPMessage
+	DelayTime time.Time `json:"delayTime"`
+}
+
+// delayedList lists the waiting delayed and retry messages, next delivered first
+func delayedList(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("delayed list")
+	topic := fs.String("topic", "", "topic name (empty for all)")
+	page := fs.Int("page", 1, "page number")
+	limit := fs.Int("limit", 20, fmt.Sprintf("page size, at most %d", maxSearchLimit))
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *page < 1 || *limit < 1 || *limit > maxSearchLimit {
+		return fmt.Errorf("-page must be positive and -limit between 1 and %d", maxSearchLimit)
+	}
+	total, msgs, err := c.factory.GetDelayManager().Query(ctx, &model.DelayFilter{Topic: *topic, PageNo: *page, PageSize: *limit})
+	if err != nil {
+		return err
+	}
+	view := &delayedPageView{Total: total, Messages: make([]*delayedMessageView, len(msgs))}
+	t := &table{header: []string{"MESSAGE ID", "TOPIC", "TAG", "KEY", "RETRY COUNT", "DELAY TIME", "BODY"}}
+	for i, msg := range msgs {
+		view.Messages[i] = &delayedMessageView{HTTPMessage: model.NewHTTPMessage(&msg.Message), DelayTime: msg.DelayTime}
+		view.Messages[i].RetryCount = msg.RetryCount
+		t.rows = append(t.rows, []string{msg.MessageID, msg.Topic, msg.Tag, msg.Key, strconv.Itoa(msg.RetryCount),
+			cellTime(msg.DelayTime), cellBody(msg.Body)})
+	}
+	if err := c.out.write(view, t); err != nil {
+		return err
+	}
+	if !c.out.json {
+		fmt.Fprintf(os.Stderr, "%d waiting messages\n", total)
+	}
+	return nil
+}
+
+// delayedCancel deletes a waiting delayed or retry message so that it is never delivered
+func delayedCancel(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("delayed cancel")
+	id := fs.String("id", "", "message ID")
+	if err := parse(fs, args, "id"); err != nil {
+		return err
+	}
+	err := c.factory.GetDelayManager().Cancel(ctx, *id)
+	c.audit(ctx, console.ActionDelayedCancel, *id, nil, nil, err)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *id, err)
+	}
+	return c.out.write(map[string]string{"messageId": *id}, &table{header: []string{"CANCELLED"}, rows: [][]string{{*id}}})
+}
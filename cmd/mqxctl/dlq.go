@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/console"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// dlqList lists one page of the dead letter queue of a topic, newest first. The group filter applies to
+// the page, so a page may hold fewer messages than -limit.
+func dlqList(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("dlq list")
+	topic := fs.String("topic", "", "topic name, not its dead letter queue")
+	group := fs.String("group", "", "only the messages dead lettered by this group")
+	var from, to timeFlag
+	fs.Var(&from, "from", "born at or after, RFC 3339")
+	fs.Var(&to, "to", "born before, RFC 3339")
+	limit := fs.Int("limit", 20, fmt.Sprintf("page size, at most %d", maxSearchLimit))
+	cursor := fs.String("cursor", "", "cursor of the next page, printed after the previous one")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	if *limit < 1 || *limit > maxSearchLimit {
+		return fmt.Errorf("-limit must be between 1 and %d", maxSearchLimit)
+	}
+	deadLetterTopic := model.DeadLetterTopic(*topic)
+	page := &model.MessagePage{Messages: []*model.Message{}}
+	if _, err := c.topic(ctx, deadLetterTopic); err == nil {
+		filter := &model.MessageFilter{Topic: deadLetterTopic, From: from.Time, To: to.Time, Cursor: *cursor, PageSize: *limit}
+		if page, err = c.factory.GetMessageManager().SearchMessages(ctx, filter); err != nil {
+			return err
+		}
+	} else if _, err := c.topic(ctx, *topic); err != nil {
+		return err
+	}
+
+	if *group != "" {
+		kept := page.Messages[:0]
+		for _, msg := range page.Messages {
+			if msg.Headers[model.HeaderDeadLetterGroup] == *group {
+				kept = append(kept, msg)
+			}
+		}
+		page.Messages, page.Total = kept, nil
+	}
+	t := &table{header: []string{"MESSAGE ID", "GROUP", "TAG", "KEY", "RETRY COUNT", "BORN TIME", "REDRIVEN AT", "BODY"}}
+	for _, msg := range page.Messages {
+		var redrivenAt time.Time
+		if at := msg.Headers[model.HeaderRedrivenAt]; at != "" {
+			redrivenAt, _ = time.Parse(time.RFC3339, at)
+		}
+		t.rows = append(t.rows, []string{msg.MessageID, msg.Headers[model.HeaderDeadLetterGroup], msg.Tag, msg.Key,
+			strconv.Itoa(msg.RetryCount), cellTime(msg.BornTime), cellTime(redrivenAt), cellBody(msg.Body)})
+	}
+	if err := c.out.write(newMessagePageView(page), t); err != nil {
+		return err
+	}
+	if !c.out.json {
+		if page.Total != nil {
+			fmt.Fprintf(os.Stderr, "%d dead lettered messages\n", *page.Total)
+		}
+		if page.NextCursor != "" {
+			fmt.Fprintf(os.Stderr, "Next page: -cursor %s\n", page.NextCursor)
+		}
+	}
+	return nil
+}
+
+// dlqRedrive publishes copies of dead lettered messages to their topic again, each to the group that
+// dead lettered it. The dead letters are kept until the retention of the dead letter queue and those
+// redriven before are skipped.
+func dlqRedrive(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("dlq redrive")
+	topic := fs.String("topic", "", "topic name, not its dead letter queue")
+	group := fs.String("group", "", "only the messages dead lettered by this group")
+	var ids listFlag
+	fs.Var(&ids, "id", "only this dead lettered message, repeatable")
+	var from, to timeFlag
+	fs.Var(&from, "from", "born at or after, RFC 3339")
+	fs.Var(&to, "to", "born before, RFC 3339")
+	dryRun := fs.Bool("dry-run", false, "only count the selected messages")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	if _, err := c.topic(ctx, *topic); err != nil {
+		return err
+	}
+	req := &model.RedriveRequest{Topic: *topic, Group: *group, MessageIDs: ids, From: from.Time, To: to.Time, DryRun: *dryRun}
+	if _, err := c.topic(ctx, model.DeadLetterTopic(*topic)); err != nil {
+		if len(ids) > 0 {
+			return fmt.Errorf("topic %s has no dead lettered message", *topic)
+		}
+		return c.writeRedrive(&model.ReplayResult{DryRun: req.DryRun})
+	}
+	result, err := c.factory.GetReplayManager().Redrive(ctx, req)
+	if !req.DryRun {
+		c.audit(ctx, console.ActionMessageRedrive, *topic, nil, req, err)
+	}
+	if err != nil {
+		// A failed write stops the redrive after the copies already published
+		if result != nil {
+			c.writeRedrive(result)
+		}
+		return err
+	}
+	return c.writeRedrive(result)
+}
+
+func (c *cli) writeRedrive(result *model.ReplayResult) error {
+	if result.DryRun {
+		fmt.Fprintln(os.Stderr, "Dry run, no message was published")
+	}
+	return c.out.write(result, &table{
+		header: []string{"MATCHED", "REDRIVEN", "SKIPPED"},
+		rows: [][]string{{strconv.FormatInt(result.Matched, 10), strconv.FormatInt(result.Replayed, 10),
+			strconv.FormatInt(result.Skipped, 10)}},
+	})
+}
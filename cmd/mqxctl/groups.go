@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/console"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// groupView sums up a consumer group of a topic
+type groupView struct {
+	Group           string `json:"group"`
+	ActiveInstances int    `json:"activeInstances"`
+	Lag             int64  `json:"lag"`
+}
+
+// groupOffsetView is the committed offset of a group on a partition
+type groupOffsetView struct {
+	Group      string `json:"group"`
+	Partition  int    `json:"partition"`
+	Offset     int64  `json:"offset"`
+	MaxOffset  int64  `json:"maxOffset"`
+	Lag        int64  `json:"lag"`
+	InstanceID string `json:"instanceId"`
+}
+
+// groupDetailView describes a consumer group of a topic
+type groupDetailView struct {
+	Group     string                   `json:"group"`
+	Lag       int64                    `json:"lag"`
+	Offsets   []groupOffsetView        `json:"offsets"`
+	Instances []model.ConsumerInstance `json:"instances"`
+}
+
+// heartbeatTimeoutSeconds is the heartbeat age after which an instance no longer counts as active
+func (c *cli) heartbeatTimeoutSeconds() int {
+	return int(c.cfg.HeartbeatInterval.Seconds()) * 3
+}
+
+// offsets returns the committed offsets of a topic with their lag, for one group or all of them when
+// group is empty, ordered by group and partition
+func (c *cli) offsets(ctx context.Context, topic string, group string) ([]groupOffsetView, error) {
+	meta, err := c.topic(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := c.partitions(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := c.factory.GetConsumerManager().GetConsumerOffsets(ctx, topic, group)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]groupOffsetView, 0, len(offsets))
+	for _, offset := range offsets {
+		view := groupOffsetView{Group: offset.Group, Partition: offset.Partition, Offset: offset.Offset, InstanceID: offset.InstanceID}
+		if offset.Partition < len(partitions) {
+			p := partitions[offset.Partition]
+			view.MaxOffset = p.MaxOffset
+			view.Lag = p.MaxOffset - max(offset.Offset, p.MinOffset)
+		}
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Group != views[j].Group {
+			return views[i].Group < views[j].Group
+		}
+		return views[i].Partition < views[j].Partition
+	})
+	return views, nil
+}
+
+func groupsList(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("groups list")
+	topic := fs.String("topic", "", "topic name")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	offsets, err := c.offsets(ctx, *topic, "")
+	if err != nil {
+		return err
+	}
+	instances, err := c.factory.GetConsumerManager().GetActiveConsumerInstances(ctx, *topic, "", c.heartbeatTimeoutSeconds())
+	if err != nil {
+		return err
+	}
+
+	groups := make([]*groupView, 0)
+	byName := make(map[string]*groupView)
+	for _, offset := range offsets {
+		group, ok := byName[offset.Group]
+		if !ok {
+			group = &groupView{Group: offset.Group}
+			byName[offset.Group] = group
+			groups = append(groups, group)
+		}
+		group.Lag += offset.Lag
+	}
+	for _, instance := range instances {
+		if group, ok := byName[instance.Group]; ok {
+			group.ActiveInstances++
+		}
+	}
+	t := &table{header: []string{"GROUP", "ACTIVE INSTANCES", "LAG"}}
+	for _, group := range groups {
+		t.rows = append(t.rows, []string{group.Group, strconv.Itoa(group.ActiveInstances), strconv.FormatInt(group.Lag, 10)})
+	}
+	return c.out.write(groups, t)
+}
+
+func groupsDescribe(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("groups describe")
+	topic := fs.String("topic", "", "topic name")
+	group := fs.String("group", "", "consumer group")
+	if err := parse(fs, args, "topic", "group"); err != nil {
+		return err
+	}
+	offsets, err := c.offsets(ctx, *topic, *group)
+	if err != nil {
+		return err
+	}
+	if len(offsets) == 0 {
+		return fmt.Errorf("consumer group %s not found on topic %s", *group, *topic)
+	}
+	instances, err := c.factory.GetConsumerManager().GetConsumerInstances(ctx, *topic, *group)
+	if err != nil {
+		return err
+	}
+
+	view := &groupDetailView{Group: *group, Offsets: offsets, Instances: instances}
+	offsetTable := &table{header: []string{"PARTITION", "OFFSET", "MAX OFFSET", "LAG", "INSTANCE"}}
+	for _, offset := range offsets {
+		view.Lag += offset.Lag
+		offsetTable.rows = append(offsetTable.rows, []string{strconv.Itoa(offset.Partition), strconv.FormatInt(offset.Offset, 10),
+			strconv.FormatInt(offset.MaxOffset, 10), strconv.FormatInt(offset.Lag, 10), offset.InstanceID})
+	}
+	instanceTable := &table{header: []string{"INSTANCE", "HOSTNAME", "ACTIVE", "HEARTBEAT"}}
+	for _, instance := range instances {
+		instanceTable.rows = append(instanceTable.rows, []string{instance.InstanceID, instance.Hostname,
+			strconv.FormatBool(instance.Active), cellTime(instance.Heartbeat)})
+	}
+	return c.out.write(view, offsetTable, instanceTable)
+}
+
+// groupsLag lists the lag of every partition of a group, or of all the groups of a topic
+func groupsLag(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("groups lag")
+	topic := fs.String("topic", "", "topic name")
+	group := fs.String("group", "", "consumer group (empty for all)")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	offsets, err := c.offsets(ctx, *topic, *group)
+	if err != nil {
+		return err
+	}
+	t := &table{header: []string{"GROUP", "PARTITION", "OFFSET", "MAX OFFSET", "LAG"}}
+	for _, offset := range offsets {
+		t.rows = append(t.rows, []string{offset.Group, strconv.Itoa(offset.Partition), strconv.FormatInt(offset.Offset, 10),
+			strconv.FormatInt(offset.MaxOffset, 10), strconv.FormatInt(offset.Lag, 10)})
+	}
+	return c.out.write(offsets, t)
+}
+
+func groupsResetOffsets(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("groups reset-offsets")
+	topic := fs.String("topic", "", "topic name")
+	group := fs.String("group", "", "consumer group")
+	to := fs.String("to", "", "earliest, latest, offset:N (N is consumed next) or time:RFC3339 (first message born at or after)")
+	partition := fs.Int("partition", -1, "partition to reset (-1 for all)")
+	dryRun := fs.Bool("dry-run", false, "only show the new offsets")
+	if err := parse(fs, args, "topic", "group", "to"); err != nil {
+		return err
+	}
+	reset, err := parseResetTarget(*to)
+	if err != nil {
+		return err
+	}
+	reset.Topic, reset.Group, reset.DryRun = *topic, *group, *dryRun
+	if *partition >= 0 {
+		reset.Partition = partition
+	}
+
+	results, err := c.factory.GetConsumerManager().ResetOffsets(ctx, reset)
+	if !reset.DryRun {
+		c.audit(ctx, console.ActionGroupReset, reset.Topic+"/"+reset.Group, nil, map[string]any{"reset": reset, "offsets": results}, err)
+	}
+	if err != nil {
+		return err
+	}
+	t := &table{header: []string{"PARTITION", "BEFORE", "AFTER"}}
+	for _, result := range results {
+		t.rows = append(t.rows, []string{strconv.Itoa(result.Partition), strconv.FormatInt(result.Before, 10), strconv.FormatInt(result.After, 10)})
+	}
+	if reset.DryRun {
+		fmt.Fprintln(os.Stderr, "Dry run, no offset was changed")
+	}
+	return c.out.write(results, t)
+}
+
+// parseResetTarget parses the -to flag of groups reset-offsets
+func parseResetTarget(to string) (*model.OffsetReset, error) {
+	kind, value, _ := strings.Cut(to, ":")
+	switch model.OffsetResetTarget(kind) {
+	case model.OffsetResetEarliest, model.OffsetResetLatest:
+		if value == "" {
+			return &model.OffsetReset{Target: model.OffsetResetTarget(kind)}, nil
+		}
+	case model.OffsetResetOffset:
+		offset, err := strconv.ParseInt(value, 10, 64)
+		if err == nil && offset > 0 {
+			return &model.OffsetReset{Target: model.OffsetResetOffset, Offset: offset}, nil
+		}
+	case model.OffsetResetTime:
+		t, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return &model.OffsetReset{Target: model.OffsetResetTime, Time: t}, nil
+		}
+	}
+	return nil, fmt.Errorf("-to %q must be earliest, latest, offset:N with N > 0 or time:RFC3339", to)
+}
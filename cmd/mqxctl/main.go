@@ -0,0 +1,217 @@
+// Command mqxctl administers MQX from the command line. It works on the database directly, like the
+// console, so it needs no running MQX instance.
+//
+//	mqxctl -dsn 'root:root@tcp(127.0.0.1:3306)/mqx?parseTime=true' topics list
+//	mqxctl -o json groups describe -topic orders -group billing
+//	mqxctl groups reset-offsets -topic orders -group billing -to time:2024-05-01T00:00:00Z -dry-run
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"os/user"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/wenzuojing/mqx"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/factory"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// command runs a subcommand with its arguments
+type command func(ctx context.Context, c *cli, args []string) error
+
+// commands holds the subcommands by resource and name
+var commands = map[string]map[string]command{
+	"topics": {
+		"list":   topicsList,
+		"create": topicsCreate,
+		"update": topicsUpdate,
+		"delete": topicsDelete,
+		"stats":  topicsStats,
+	},
+	"groups": {
+		"list":          groupsList,
+		"describe":      groupsDescribe,
+		"lag":           groupsLag,
+		"reset-offsets": groupsResetOffsets,
+	},
+	"messages": {
+		"get":     messagesGet,
+		"search":  messagesSearch,
+		"produce": messagesProduce,
+		"tail":    messagesTail,
+	},
+	"delayed": {
+		"list":   delayedList,
+		"cancel": delayedCancel,
+	},
+	"dlq": {
+		"list":    dlqList,
+		"redrive": dlqRedrive,
+	},
+}
+
+// errUsage reports wrong arguments; the usage has been printed already
+var errUsage = errors.New("usage")
+
+// cli is the state shared by the subcommands
+type cli struct {
+	cfg     *config.Config
+	factory interfaces.Factory
+	out     *output
+	// user is recorded in the audit log for the mutating subcommands
+	user string
+}
+
+func main() {
+	defaults := mqx.NewConfig()
+	dsn := flag.String("dsn", os.Getenv("MQX_DSN"), "MySQL DSN (default $MQX_DSN)")
+	format := flag.String("o", formatTable, "output format: table or json")
+	heartbeatInterval := flag.Duration("heartbeat-interval", defaults.HeartbeatInterval, "heartbeat interval of the consumers, which decides the active instances")
+	verbose := flag.Bool("v", false, "log what the managers do to stderr")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		usage()
+		os.Exit(2)
+	}
+	run, ok := commands[flag.Arg(0)][flag.Arg(1)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "mqxctl: unknown command %q\n", strings.Join(flag.Args()[:2], " "))
+		usage()
+		os.Exit(2)
+	}
+	if *format != formatTable && *format != formatJSON {
+		fatalf("-o must be %s or %s", formatTable, formatJSON)
+	}
+	// The flags of a command are shown without a DSN
+	if *dsn == "" && !slices.ContainsFunc(flag.Args()[2:], isHelpFlag) {
+		fatalf("-dsn or $MQX_DSN is required")
+	}
+
+	cfg := &config.Config{
+		DSN:                 *dsn,
+		DefaultPartitionNum: defaults.DefaultPartitionNum,
+		RetentionDays:       defaults.RetentionDays,
+		HeartbeatInterval:   *heartbeatInterval,
+		Logger:              logging.Discard(),
+	}
+	if *verbose {
+		cfg.Logger = nil
+	}
+	db, err := sql.Open("mysql", cfg.DSN)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer db.Close()
+	f, err := factory.NewFactory(db, cfg)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	c := &cli{cfg: cfg, factory: f, out: &output{w: os.Stdout, json: *format == formatJSON}, user: auditUser()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, c, flag.Args()[2:]); err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fatalf("%v", err)
+	}
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "mqxctl: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: mqxctl [flags] <resource> <command> [command flags]\n\nCommands:\n")
+	resources := make([]string, 0, len(commands))
+	for resource := range commands {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		names := make([]string, 0, len(commands[resource]))
+		for name := range commands[resource] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(w, "  %-10s %s\n", resource, strings.Join(names, ", "))
+	}
+	fmt.Fprintf(w, "\nRun mqxctl <resource> <command> -h for the flags of a command.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--h" || arg == "--help"
+}
+
+// auditUser names the operating system user in the audit log
+func auditUser() string {
+	if u, err := user.Current(); err == nil {
+		return "mqxctl:" + u.Username
+	}
+	return "mqxctl"
+}
+
+// newFlagSet returns the flag set of a subcommand, printing its errors and usage to stderr
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("mqxctl "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// parse parses the flags of a subcommand and checks that the required ones are set
+func parse(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return errUsage
+	}
+	for _, name := range required {
+		if fs.Lookup(name).Value.String() == "" {
+			fmt.Fprintf(fs.Output(), "-%s is required\n", name)
+			fs.Usage()
+			return errUsage
+		}
+	}
+	return nil
+}
+
+// audit records a mutating subcommand in the audit log shared with the console.
+// A failure to write the audit log is reported and does not fail the subcommand, which has already taken effect.
+func (c *cli) audit(ctx context.Context, action string, target string, before any, after any, err error) {
+	entry := &model.AuditEntry{
+		User:   c.user,
+		Action: action,
+		Target: target,
+		Before: auditJSON(before),
+		After:  auditJSON(after),
+		Result: model.AuditResultSuccess,
+	}
+	if err != nil {
+		entry.Result, entry.Error = model.AuditResultFailure, err.Error()
+	}
+	if err := c.factory.GetAuditManager().Record(ctx, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "mqxctl: failed to write audit log: %v\n", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/factory"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func newTestCLI(t *testing.T, json bool) (*cli, sqlmock.Sqlmock, *bytes.Buffer) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	cfg := &config.Config{DefaultPartitionNum: 8, RetentionDays: 7, HeartbeatInterval: 30 * time.Second, Logger: logging.Discard()}
+	f, err := factory.NewFactory(db, cfg)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	return &cli{cfg: cfg, factory: f, out: &output{w: &buf, json: json}, user: "mqxctl:ops"}, smock, &buf
+}
+
+func TestParseResetTarget(t *testing.T) {
+	reset, err := parseResetTarget("earliest")
+	assert.NoError(t, err)
+	assert.Equal(t, model.OffsetResetEarliest, reset.Target)
+
+	reset, err = parseResetTarget("offset:42")
+	assert.NoError(t, err)
+	assert.Equal(t, model.OffsetResetOffset, reset.Target)
+	assert.Equal(t, int64(42), reset.Offset)
+
+	reset, err = parseResetTarget("time:2024-05-01T08:00:00+08:00")
+	assert.NoError(t, err)
+	assert.Equal(t, model.OffsetResetTime, reset.Target)
+	assert.True(t, reset.Time.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+
+	for _, to := range []string{"", "latest:1", "offset:0", "offset:x", "time:yesterday", "middle"} {
+		_, err := parseResetTarget(to)
+		assert.Error(t, err, to)
+	}
+}
+
+func TestOutput_Write(t *testing.T) {
+	var buf bytes.Buffer
+	out := &output{w: &buf}
+	v := []model.TopicMeta{{Topic: "orders", PartitionNum: 8, RetentionDays: 7}}
+	assert.NoError(t, out.write(v, &table{header: []string{"TOPIC", "PARTITIONS"}, rows: [][]string{{"orders", "8"}}},
+		&table{header: []string{"A"}, rows: [][]string{{"b"}}}))
+	assert.Equal(t, "TOPIC   PARTITIONS\norders  8\n\nA\nb\n", buf.String())
+
+	buf.Reset()
+	out.json = true
+	assert.NoError(t, out.write(v, &table{header: []string{"TOPIC"}}))
+	assert.JSONEq(t, `[{"topic":"orders","partitionNum":8,"retentionDays":7}]`, buf.String())
+}
+
+func TestCellBody(t *testing.T) {
+	assert.Equal(t, `{ "id": 1}`, cellBody([]byte("{\n  \"id\": 1}\n")))
+	assert.Equal(t, "<3 bytes>", cellBody([]byte{0xff, 0xfe, 0x00}))
+	long := cellBody(bytes.Repeat([]byte("界"), maxCellBody+1))
+	assert.Equal(t, maxCellBody+3, len([]rune(long)))
+}
+
+func TestHeaderFlags(t *testing.T) {
+	headers := headerFlags{}
+	assert.NoError(t, headers.Set("trace=abc=1"))
+	assert.Equal(t, "abc=1", headers["trace"])
+	assert.Error(t, headers.Set("trace"))
+	assert.Error(t, headers.Set("=value"))
+}
+
+func TestDelayedCancel(t *testing.T) {
+	c, smock, buf := newTestCLI(t, false)
+	smock.ExpectExec("DELETE FROM mqx_delay_messages").WithArgs("msg-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	smock.ExpectExec("INSERT INTO").
+		WithArgs("mqxctl:ops", "", "delayed.cancel", "msg-1", nil, nil, model.AuditResultSuccess, nil, "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, delayedCancel(context.Background(), c, []string{"-id", "msg-1"}))
+	assert.Equal(t, "CANCELLED\nmsg-1\n", buf.String())
+
+	smock.ExpectExec("DELETE FROM mqx_delay_messages").WithArgs("gone").WillReturnResult(sqlmock.NewResult(0, 0))
+	smock.ExpectExec("INSERT INTO").
+		WithArgs("mqxctl:ops", "", "delayed.cancel", "gone", nil, nil, model.AuditResultFailure, sqlmock.AnyArg(), "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	assert.ErrorContains(t, delayedCancel(context.Background(), c, []string{"-id", "gone"}), "not found")
+
+	assert.ErrorIs(t, delayedCancel(context.Background(), c, nil), errUsage)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/console"
+	"github.com/wenzuojing/mqx/internal/message"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// maxSearchLimit is the largest page of messages searched at once
+const maxSearchLimit = 100
+
+// messagePageView is a page of messages with the cursor of the next one
+type messagePageView struct {
+	Messages   []*model.HTTPMessage `json:"messages"`
+	Total      *int64               `json:"total,omitempty"`
+	NextCursor string               `json:"nextCursor,omitempty"`
+}
+
+func newMessagePageView(page *model.MessagePage) *messagePageView {
+	view := &messagePageView{Messages: make([]*model.HTTPMessage, len(page.Messages)), Total: page.Total, NextCursor: page.NextCursor}
+	for i, msg := range page.Messages {
+		view.Messages[i] = model.NewHTTPMessage(msg)
+	}
+	return view
+}
+
+// messageRow is the table row of a message in a list
+func messageRow(msg *model.Message) []string {
+	return []string{msg.MessageID, strconv.Itoa(msg.Partition), strconv.FormatInt(msg.Offset, 10), msg.Tag, msg.Key,
+		cellTime(msg.BornTime), cellBody(msg.Body)}
+}
+
+var messageHeader = []string{"MESSAGE ID", "PARTITION", "OFFSET", "TAG", "KEY", "BORN TIME", "BODY"}
+
+func messagesGet(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("messages get")
+	topic := fs.String("topic", "", "topic name")
+	id := fs.String("id", "", "message ID")
+	if err := parse(fs, args, "topic", "id"); err != nil {
+		return err
+	}
+	if _, err := c.topic(ctx, *topic); err != nil {
+		return err
+	}
+	page, err := c.factory.GetMessageManager().SearchMessages(ctx, &model.MessageFilter{Topic: *topic, MessageID: *id, PageSize: 1})
+	if err != nil {
+		return err
+	}
+	if len(page.Messages) == 0 {
+		return fmt.Errorf("message %s not found in topic %s", *id, *topic)
+	}
+	msg := page.Messages[0]
+	view := model.NewHTTPMessage(msg)
+	body := view.Body
+	if view.BodyBase64 != "" {
+		body = "base64:" + view.BodyBase64
+	}
+	t := &table{header: []string{"FIELD", "VALUE"}, rows: [][]string{
+		{"MESSAGE ID", msg.MessageID},
+		{"TOPIC", msg.Topic},
+		{"PARTITION", strconv.Itoa(msg.Partition)},
+		{"OFFSET", strconv.FormatInt(msg.Offset, 10)},
+		{"TAG", msg.Tag},
+		{"KEY", msg.Key},
+		{"BORN TIME", cellTime(msg.BornTime)},
+		{"RETRY COUNT", strconv.Itoa(msg.RetryCount)},
+	}}
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.rows = append(t.rows, []string{"HEADER " + name, msg.Headers[name]})
+	}
+	t.rows = append(t.rows, []string{"BODY", body})
+	return c.out.write(view, t)
+}
+
+// messagesSearch lists one page of the messages of a topic, newest first
+func messagesSearch(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("messages search")
+	topic := fs.String("topic", "", "topic name")
+	partition := fs.Int("partition", -1, "partition (-1 for all)")
+	tag := fs.String("tag", "", "message tag")
+	key := fs.String("key", "", "message key")
+	var from, to timeFlag
+	fs.Var(&from, "from", "born at or after, RFC 3339")
+	fs.Var(&to, "to", "born before, RFC 3339")
+	limit := fs.Int("limit", 20, fmt.Sprintf("page size, at most %d", maxSearchLimit))
+	cursor := fs.String("cursor", "", "cursor of the next page, printed after the previous one")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	if *limit < 1 || *limit > maxSearchLimit {
+		return fmt.Errorf("-limit must be between 1 and %d", maxSearchLimit)
+	}
+	if _, err := c.topic(ctx, *topic); err != nil {
+		return err
+	}
+	filter := &model.MessageFilter{Topic: *topic, Tag: *tag, Key: *key, From: from.Time, To: to.Time, Cursor: *cursor, PageSize: *limit}
+	if *partition >= 0 {
+		filter.Partition = partition
+	}
+	page, err := c.factory.GetMessageManager().SearchMessages(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return c.writeMessagePage(page)
+}
+
+// writeMessagePage writes a page of messages; in a table the total and the next cursor go to stderr
+func (c *cli) writeMessagePage(page *model.MessagePage) error {
+	t := &table{header: messageHeader}
+	for _, msg := range page.Messages {
+		t.rows = append(t.rows, messageRow(msg))
+	}
+	if err := c.out.write(newMessagePageView(page), t); err != nil {
+		return err
+	}
+	if !c.out.json {
+		if page.Total != nil {
+			fmt.Fprintf(os.Stderr, "%d matching messages\n", *page.Total)
+		}
+		if page.NextCursor != "" {
+			fmt.Fprintf(os.Stderr, "Next page: -cursor %s\n", page.NextCursor)
+		}
+	}
+	return nil
+}
+
+// messagesProduce sends a message whose body is given inline, read from a file or from stdin
+func messagesProduce(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("messages produce")
+	topic := fs.String("topic", "", "topic name")
+	tag := fs.String("tag", "", "message tag")
+	key := fs.String("key", "", "message key")
+	body := fs.String("body", "", "message body")
+	file := fs.String("file", "", "file holding the message body, - for stdin")
+	delay := fs.Duration("delay", 0, "delivery delay")
+	headers := headerFlags{}
+	fs.Var(headers, "header", "message header as name=value, repeatable")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	if *body != "" && *file != "" {
+		return errors.New("-body and -file are exclusive")
+	}
+	data := []byte(*body)
+	if *file != "" {
+		var err error
+		if data, err = readBody(*file); err != nil {
+			return err
+		}
+	}
+	if _, err := c.topic(ctx, *topic); err != nil {
+		return err
+	}
+
+	msg := &model.Message{Topic: *topic, Tag: *tag, Key: *key, Body: data, Delay: *delay}
+	if len(headers) > 0 {
+		msg.Headers = headers
+	}
+	id, err := c.factory.GetProducerManager().SendSync(ctx, msg)
+	c.audit(ctx, console.ActionMessageSend, *topic, nil, model.NewHTTPMessage(msg), err)
+	if err != nil {
+		return err
+	}
+	return c.out.write(map[string]string{"messageId": id}, &table{header: []string{"MESSAGE ID"}, rows: [][]string{{id}}})
+}
+
+func readBody(file string) ([]byte, error) {
+	if file == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(file)
+}
+
+// messagesTail prints the messages written to a topic from now on until interrupted. It reads the
+// partitions directly, so no consumer group is created and no offset is moved.
+func messagesTail(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("messages tail")
+	topic := fs.String("topic", "", "topic name")
+	tag := fs.String("tag", "", "message tag")
+	key := fs.String("key", "", "message key")
+	interval := fs.Duration("interval", time.Second, "polling interval")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return errors.New("-interval must be positive")
+	}
+	meta, err := c.topic(ctx, *topic)
+	if err != nil {
+		return err
+	}
+	tail, err := message.NewTail(ctx, c.factory.GetMessageManager(), meta, *tag, *key)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Tailing %d partitions of %s, press Ctrl+C to stop\n", meta.PartitionNum, meta.Topic)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		msgs, err := tail.Poll(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The messages read before a failure are not returned again
+		for _, msg := range msgs {
+			if err := c.out.writeLine(model.NewHTTPMessage(msg), messageRow(msg)); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// maxCellBody is the number of characters of a message body shown in a table cell
+const maxCellBody = 60
+
+// output writes the result of a subcommand as indented JSON or as aligned tables
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+// table is the table form of a result
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// write writes v as JSON, or the tables separated by blank lines
+func (o *output) write(v any, tables ...*table) error {
+	if o.json {
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Fprintln(o.w)
+		}
+		if err := o.writeTable(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *output) writeTable(t *table) error {
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeLine writes v as a single line of JSON, or a row without header, for streamed results
+func (o *output) writeLine(v any, row []string) error {
+	if o.json {
+		return json.NewEncoder(o.w).Encode(v)
+	}
+	_, err := fmt.Fprintln(o.w, strings.Join(row, "  "))
+	return err
+}
+
+// cellTime formats a time for a table cell, empty for the zero time
+func cellTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// cellBody formats a message body for a table cell: text on one line, shortened to maxCellBody characters
+func cellBody(body []byte) string {
+	if !utf8.Valid(body) {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+	s := strings.Join(strings.Fields(string(body)), " ")
+	if utf8.RuneCountInString(s) > maxCellBody {
+		s = string([]rune(s)[:maxCellBody]) + "..."
+	}
+	return s
+}
+
+func auditJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/wenzuojing/mqx/internal/console"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// topicView is a topic with the number of its stored messages
+type topicView struct {
+	model.TopicMeta
+	Messages int64 `json:"messages"`
+}
+
+// partitionView is the stat of a partition of a topic
+type partitionView struct {
+	Partition int `json:"partition"`
+	interfaces.PartitionStat
+}
+
+// topic returns the meta of an existing topic. Unlike GetTopicMeta it does not create a missing topic.
+func (c *cli) topic(ctx context.Context, name string) (*model.TopicMeta, error) {
+	metas, err := c.factory.GetTopicManager().GetAllTopicMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, meta := range metas {
+		if meta.Topic == name {
+			return &meta, nil
+		}
+	}
+	return nil, fmt.Errorf("topic %s not found", name)
+}
+
+// partitions returns the stats of the partitions of a topic in partition order
+func (c *cli) partitions(ctx context.Context, meta *model.TopicMeta) ([]partitionView, error) {
+	partitions := make([]partitionView, meta.PartitionNum)
+	errs := make([]error, meta.PartitionNum)
+	var wg sync.WaitGroup
+	for i := range meta.PartitionNum {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stat, err := c.factory.GetMessageManager().GetPartitionStat(ctx, meta.Topic, i)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			partitions[i] = partitionView{Partition: i, PartitionStat: *stat}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return partitions, nil
+}
+
+func topicsList(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("topics list")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	metas, err := c.factory.GetTopicManager().GetAllTopicMeta(ctx)
+	if err != nil {
+		return err
+	}
+	topics := make([]topicView, 0, len(metas))
+	t := &table{header: []string{"TOPIC", "PARTITIONS", "RETENTION DAYS", "MESSAGES"}}
+	for _, meta := range metas {
+		partitions, err := c.partitions(ctx, &meta)
+		if err != nil {
+			return err
+		}
+		topic := topicView{TopicMeta: meta}
+		for _, partition := range partitions {
+			topic.Messages += partition.Total
+		}
+		topics = append(topics, topic)
+		t.rows = append(t.rows, []string{meta.Topic, strconv.Itoa(meta.PartitionNum), strconv.Itoa(meta.RetentionDays), strconv.FormatInt(topic.Messages, 10)})
+	}
+	return c.out.write(topics, t)
+}
+
+func topicsCreate(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("topics create")
+	name := fs.String("topic", "", "topic name")
+	partitionNum := fs.Int("partitions", c.cfg.DefaultPartitionNum, "number of partitions")
+	retentionDays := fs.Int("retention-days", c.cfg.RetentionDays, "days the messages are kept")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	if *partitionNum <= 0 || *retentionDays <= 0 {
+		return errors.New("-partitions and -retention-days must be positive")
+	}
+	meta := &model.TopicMeta{Topic: *name, PartitionNum: *partitionNum, RetentionDays: *retentionDays}
+	err := c.factory.GetTopicManager().CreateTopic(ctx, meta)
+	c.audit(ctx, console.ActionTopicCreate, meta.Topic, nil, meta, err)
+	if err != nil {
+		return err
+	}
+	return c.writeTopic(meta)
+}
+
+// topicsUpdate changes the partitions or the retention of a topic; the flags left out keep their value
+func topicsUpdate(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("topics update")
+	name := fs.String("topic", "", "topic name")
+	partitionNum := fs.Int("partitions", 0, "number of partitions (0 to keep)")
+	retentionDays := fs.Int("retention-days", 0, "days the messages are kept (0 to keep)")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	if *partitionNum < 0 || *retentionDays < 0 {
+		return errors.New("-partitions and -retention-days must not be negative")
+	}
+	before, err := c.topic(ctx, *name)
+	if err != nil {
+		return err
+	}
+	meta := *before
+	if *partitionNum > 0 {
+		meta.PartitionNum = *partitionNum
+	}
+	if *retentionDays > 0 {
+		meta.RetentionDays = *retentionDays
+	}
+	err = c.factory.GetTopicManager().UpdateTopicMeta(ctx, &meta)
+	c.audit(ctx, console.ActionTopicUpdate, meta.Topic, before, &meta, err)
+	if err != nil {
+		return err
+	}
+	return c.writeTopic(&meta)
+}
+
+// topicsDelete deletes a topic with its messages, offsets, delayed and half messages.
+// It asks for -yes since nothing can be recovered.
+func topicsDelete(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("topics delete")
+	name := fs.String("topic", "", "topic name")
+	yes := fs.Bool("yes", false, "confirm the deletion of the topic and all its messages")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	before, err := c.topic(ctx, *name)
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		return fmt.Errorf("deleting topic %s drops all its messages; run again with -yes to confirm", *name)
+	}
+	err = c.factory.GetTopicManager().DeleteTopic(ctx, *name)
+	c.audit(ctx, console.ActionTopicDelete, *name, before, nil, err)
+	if err != nil {
+		return err
+	}
+	return c.writeTopic(before)
+}
+
+func (c *cli) writeTopic(meta *model.TopicMeta) error {
+	return c.out.write(meta, &table{
+		header: []string{"TOPIC", "PARTITIONS", "RETENTION DAYS"},
+		rows:   [][]string{{meta.Topic, strconv.Itoa(meta.PartitionNum), strconv.Itoa(meta.RetentionDays)}},
+	})
+}
+
+func topicsStats(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet("topics stats")
+	name := fs.String("topic", "", "topic name")
+	if err := parse(fs, args, "topic"); err != nil {
+		return err
+	}
+	meta, err := c.topic(ctx, *name)
+	if err != nil {
+		return err
+	}
+	partitions, err := c.partitions(ctx, meta)
+	if err != nil {
+		return err
+	}
+	t := &table{header: []string{"PARTITION", "MIN OFFSET", "MAX OFFSET", "MESSAGES"}}
+	for _, p := range partitions {
+		t.rows = append(t.rows, []string{strconv.Itoa(p.Partition), strconv.FormatInt(p.MinOffset, 10),
+			strconv.FormatInt(p.MaxOffset, 10), strconv.FormatInt(p.Total, 10)})
+	}
+	return c.out.write(partitions, t)
+}
@@ -0,0 +1,118 @@
+package mqx
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Content types of the built-in codecs
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeGob      = "application/x-gob"
+)
+
+// Codec encodes typed values into message bodies and back
+type Codec interface {
+	// ContentType returns the content type stored with messages encoded by this codec
+	ContentType() string
+	// Marshal encodes a value into a message body
+	Marshal(v any) ([]byte, error)
+	// Unmarshal decodes a message body into the value pointed to by v
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSONCodec encodes values with encoding/json
+	JSONCodec Codec = jsonCodec{}
+	// ProtobufCodec encodes proto.Message values with google.golang.org/protobuf
+	ProtobufCodec Codec = protobufCodec{}
+	// GobCodec encodes values with encoding/gob
+	GobCodec Codec = gobCodec{}
+)
+
+var codecs = struct {
+	sync.RWMutex
+	byContentType map[string]Codec
+}{byContentType: map[string]Codec{
+	ContentTypeJSON:     JSONCodec,
+	ContentTypeProtobuf: ProtobufCodec,
+	ContentTypeGob:      GobCodec,
+}}
+
+// RegisterCodec makes a codec available to typed subscriptions by its content type
+func RegisterCodec(codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.byContentType[codec.ContentType()] = codec
+}
+
+// lookupCodec returns the codec registered for a content type
+func lookupCodec(contentType string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.byContentType[contentType]
+	return codec, ok
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string { return ContentTypeGob }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal accepts either a proto.Message or a pointer to a nil proto.Message pointer,
+// which is what a typed subscription of *pb.Foo passes in.
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Pointer {
+		elem := reflect.New(rv.Elem().Type().Elem())
+		if m, ok := elem.Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(data, m); err != nil {
+				return err
+			}
+			rv.Elem().Set(elem)
+			return nil
+		}
+	}
+	return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+}
@@ -1,26 +1,76 @@
 package mqx
 
-import "time"
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
 
 type Config struct {
-	DSN                               string        // Database connection string
-	DefaultPartitionNum               int           // Default number of partitions
-	RetentionDays                     int           // Message retention days
-	RebalanceInterval                 time.Duration // Consumer rebalance interval
-	RefreshConsumerPartitionsInterval time.Duration // Refresh consumer partitions interval
-	HeartbeatInterval                 time.Duration // Consumer heartbeat interval
-	DelayInterval                     time.Duration // Delay message processing interval
-	PullingInterval                   time.Duration // Message pulling interval
-	PullingSize                       int           // Batch size for message pulling
-	RetryInterval                     time.Duration // Retry interval for failed operations (base interval for exponential backoff)
-	RetryTimes                        int           // Maximum number of retry attempts
-	ClearInterval                     time.Duration // Clear interval for expired messages
-	EnableConsole                     bool          // Enable console
-	Console                           Console       // Console configuration
+	DSN                               string                        // Database connection string
+	DefaultPartitionNum               int                           // Default number of partitions
+	RetentionDays                     int                           // Message retention days
+	RebalanceInterval                 time.Duration                 // Consumer rebalance interval
+	RefreshConsumerPartitionsInterval time.Duration                 // Refresh consumer partitions interval
+	HeartbeatInterval                 time.Duration                 // Consumer heartbeat interval
+	DelayInterval                     time.Duration                 // Delay message processing interval
+	PullingInterval                   time.Duration                 // Message pulling interval
+	PullingSize                       int                           // Batch size for message pulling
+	RetryInterval                     time.Duration                 // Retry interval for failed operations (base interval for exponential backoff)
+	RetryTimes                        int                           // Maximum number of retry attempts
+	HandlerTimeout                    time.Duration                 // Deadline of the context passed to each handler invocation (0 for none)
+	ClearInterval                     time.Duration                 // Clear interval for expired messages
+	TransactionTimeout                time.Duration                 // Time a half message may stay unresolved before it is checked back
+	TransactionCheckInterval          time.Duration                 // Interval between transaction check-back rounds
+	TransactionCheckMaxTimes          int                           // Maximum number of check-backs before a half message is rolled back
+	RequestTimeout                    time.Duration                 // Default reply timeout for requests whose context has no deadline
+	ReplyPollingInterval              time.Duration                 // Reply topic polling interval while requests are outstanding
+	AsyncBufferSize                   int                           // Capacity of the async send buffer
+	AsyncBatchSize                    int                           // Maximum number of async messages written in one batch
+	AsyncLinger                       time.Duration                 // Maximum time an async message waits for its batch to fill
+	AsyncFailFast                     bool                          // Fail SendAsync when the buffer is full instead of blocking
+	TracerProvider                    trace.TracerProvider          // OpenTelemetry tracer provider (nil for the global provider)
+	Propagator                        propagation.TextMapPropagator // Propagator of the trace context stored in message headers (nil for W3C trace context)
+	Logger                            Logger                        // Structured logger (nil for the slog default logger)
+	EnableMessageTrace                bool                          // Record the lifecycle of every message in the message trace table
+	MessageTraceRetentionDays         int                           // Message trace retention days (0 for RetentionDays)
+	AuditRetentionDays                int                           // Console audit log retention days (0 to keep forever)
+	EnableConsole                     bool                          // Enable console
+	Console                           Console                       // Console configuration
+	EnableGateway                     bool                          // Enable the HTTP gateway for services that cannot embed this library
+	Gateway                           Gateway                       // HTTP gateway configuration
+	EnableGRPC                        bool                          // Enable the gRPC server for streaming clients in other languages
+	GRPC                              GRPC                          // gRPC server configuration
+	EnableWebhooks                    bool                          // Run the webhook subscriptions on this instance
+	WebhookTimeout                    time.Duration                 // Default timeout of a webhook delivery
+	WebhookRefreshInterval            time.Duration                 // Interval between reloads of the webhook subscriptions, which picks up those changed on other instances
 }
 
 type Console struct {
-	Address string // Console server address
+	Address        string                 // Console server address
+	Users          []ConsoleUser          // Static users authenticated with HTTP basic auth
+	Tokens         []ConsoleToken         // Bearer tokens
+	Proxy          *ConsoleProxyAuth      // Reverse proxy header authentication (nil to disable)
+	Authenticators []ConsoleAuthenticator // Custom authenticators, tried after the built-in ones
+	AllowedOrigins []string               // Origins allowed by CORS, "*" for any (empty for same-origin only)
+	TLSCertFile    string                 // TLS certificate file (empty to serve plain HTTP)
+	TLSKeyFile     string                 // TLS private key file
+}
+
+type Gateway struct {
+	Address        string         // Standalone gateway address (empty to serve the gateway on the console under /gateway/v1)
+	Tokens         []ConsoleToken // Bearer tokens of a standalone gateway, operator role or above (empty for none); the console authenticates a gateway it serves
+	MaxBatchSize   int            // Maximum number of messages published or fetched by one request
+	MaxWait        time.Duration  // Longest wait of a long-poll fetch
+	SessionTimeout time.Duration  // Time after which a consumer instance neither fetching nor committing leaves its group
+}
+
+type GRPC struct {
+	Address      string         // gRPC server address
+	Tokens       []ConsoleToken // Bearer tokens sent in the authorization metadata (empty for none); roles apply as on the console
+	MaxBatchSize int            // Maximum number of messages of a PublishBatch call
+	MaxInFlight  int            // Maximum number of messages streamed to a subscription before they are acked
 }
 
 // NewConfig creates a new Config with default values
@@ -38,8 +88,30 @@ func NewConfig() *Config {
 		RetryInterval:                     time.Second * 3,
 		RetryTimes:                        10,
 		ClearInterval:                     time.Second * 120,
+		TransactionTimeout:                time.Second * 60,
+		TransactionCheckInterval:          time.Second * 30,
+		TransactionCheckMaxTimes:          15,
+		RequestTimeout:                    time.Second * 30,
+		ReplyPollingInterval:              time.Millisecond * 100,
+		AsyncBufferSize:                   10000,
+		AsyncBatchSize:                    100,
+		AsyncLinger:                       time.Millisecond * 10,
+		AuditRetentionDays:                90,
 		EnableConsole:                     true,
 		Console:                           Console{Address: ":9000"},
+		Gateway: Gateway{
+			MaxBatchSize:   500,
+			MaxWait:        time.Second * 30,
+			SessionTimeout: time.Minute * 5,
+		},
+		GRPC: GRPC{
+			Address:      ":9090",
+			MaxBatchSize: 500,
+			MaxInFlight:  1000,
+		},
+		EnableWebhooks:         true,
+		WebhookTimeout:         time.Second * 10,
+		WebhookRefreshInterval: time.Second * 30,
 	}
 }
 
@@ -102,6 +174,102 @@ func (c *Config) WithRetryTimes(times int) *Config {
 	return c
 }
 
+// WithHandlerTimeout sets the deadline of the context passed to each handler invocation
+func (c *Config) WithHandlerTimeout(timeout time.Duration) *Config {
+	c.HandlerTimeout = timeout
+	return c
+}
+
+// WithTransactionTimeout sets the time a half message may stay unresolved before it is checked back
+func (c *Config) WithTransactionTimeout(timeout time.Duration) *Config {
+	c.TransactionTimeout = timeout
+	return c
+}
+
+// WithTransactionCheckInterval sets the interval between transaction check-back rounds
+func (c *Config) WithTransactionCheckInterval(interval time.Duration) *Config {
+	c.TransactionCheckInterval = interval
+	return c
+}
+
+// WithTransactionCheckMaxTimes sets the maximum number of check-backs before a half message is rolled back
+func (c *Config) WithTransactionCheckMaxTimes(times int) *Config {
+	c.TransactionCheckMaxTimes = times
+	return c
+}
+
+// WithRequestTimeout sets the default reply timeout for requests whose context has no deadline
+func (c *Config) WithRequestTimeout(timeout time.Duration) *Config {
+	c.RequestTimeout = timeout
+	return c
+}
+
+// WithReplyPollingInterval sets the reply topic polling interval
+func (c *Config) WithReplyPollingInterval(interval time.Duration) *Config {
+	c.ReplyPollingInterval = interval
+	return c
+}
+
+// WithAsyncBufferSize sets the capacity of the async send buffer
+func (c *Config) WithAsyncBufferSize(size int) *Config {
+	c.AsyncBufferSize = size
+	return c
+}
+
+// WithAsyncBatchSize sets the maximum number of async messages written in one batch
+func (c *Config) WithAsyncBatchSize(size int) *Config {
+	c.AsyncBatchSize = size
+	return c
+}
+
+// WithAsyncLinger sets the maximum time an async message waits for its batch to fill
+func (c *Config) WithAsyncLinger(linger time.Duration) *Config {
+	c.AsyncLinger = linger
+	return c
+}
+
+// WithAsyncFailFast makes SendAsync fail with ErrBufferFull instead of blocking when the buffer is full
+func (c *Config) WithAsyncFailFast(failFast bool) *Config {
+	c.AsyncFailFast = failFast
+	return c
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used for producer and consumer spans
+func (c *Config) WithTracerProvider(provider trace.TracerProvider) *Config {
+	c.TracerProvider = provider
+	return c
+}
+
+// WithPropagator sets the propagator of the trace context stored in message headers
+func (c *Config) WithPropagator(propagator propagation.TextMapPropagator) *Config {
+	c.Propagator = propagator
+	return c
+}
+
+// WithLogger sets the structured logger, e.g. NewSlogLogger(logger) or NewKlogLogger()
+func (c *Config) WithLogger(logger Logger) *Config {
+	c.Logger = logger
+	return c
+}
+
+// WithEnableMessageTrace enables recording the lifecycle of every message, queried with TraceMessage
+func (c *Config) WithEnableMessageTrace(enable bool) *Config {
+	c.EnableMessageTrace = enable
+	return c
+}
+
+// WithMessageTraceRetentionDays sets the message trace retention days, 0 keeps traces as long as messages
+func (c *Config) WithMessageTraceRetentionDays(days int) *Config {
+	c.MessageTraceRetentionDays = days
+	return c
+}
+
+// WithAuditRetentionDays sets the console audit log retention days, 0 keeps the audit log forever
+func (c *Config) WithAuditRetentionDays(days int) *Config {
+	c.AuditRetentionDays = days
+	return c
+}
+
 // WithEnableConsole sets the enable console
 func (c *Config) WithEnableConsole(enable bool) *Config {
 	c.EnableConsole = enable
@@ -113,3 +281,45 @@ func (c *Config) WithConsole(console Console) *Config {
 	c.Console = console
 	return c
 }
+
+// WithEnableGateway sets the enable HTTP gateway
+func (c *Config) WithEnableGateway(enable bool) *Config {
+	c.EnableGateway = enable
+	return c
+}
+
+// WithGateway sets the HTTP gateway configuration
+func (c *Config) WithGateway(gateway Gateway) *Config {
+	c.Gateway = gateway
+	return c
+}
+
+// WithEnableGRPC sets the enable gRPC server
+func (c *Config) WithEnableGRPC(enable bool) *Config {
+	c.EnableGRPC = enable
+	return c
+}
+
+// WithGRPC sets the gRPC server configuration
+func (c *Config) WithGRPC(grpc GRPC) *Config {
+	c.GRPC = grpc
+	return c
+}
+
+// WithEnableWebhooks sets whether this instance runs the webhook subscriptions
+func (c *Config) WithEnableWebhooks(enable bool) *Config {
+	c.EnableWebhooks = enable
+	return c
+}
+
+// WithWebhookTimeout sets the default timeout of a webhook delivery
+func (c *Config) WithWebhookTimeout(timeout time.Duration) *Config {
+	c.WebhookTimeout = timeout
+	return c
+}
+
+// WithWebhookRefreshInterval sets the interval between reloads of the webhook subscriptions
+func (c *Config) WithWebhookRefreshInterval(interval time.Duration) *Config {
+	c.WebhookRefreshInterval = interval
+	return c
+}
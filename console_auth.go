@@ -0,0 +1,32 @@
+package mqx
+
+import "github.com/wenzuojing/mqx/internal/auth"
+
+// ConsoleRole grants access to console routes; each role includes the ones below it
+type ConsoleRole = auth.Role
+
+const (
+	// ConsoleViewer reads topics, consumer groups, messages, traces and metrics
+	ConsoleViewer = auth.RoleViewer
+	// ConsoleOperator also sends messages
+	ConsoleOperator = auth.RoleOperator
+	// ConsoleAdmin also creates, updates and deletes topics
+	ConsoleAdmin = auth.RoleAdmin
+)
+
+// ConsoleUser is a static console user authenticated with HTTP basic auth.
+// PasswordHash is a bcrypt hash, e.g. from `htpasswd -nbBC 10 user password`.
+type ConsoleUser = auth.User
+
+// ConsoleToken is a bearer token sent as "Authorization: Bearer <token>"
+type ConsoleToken = auth.Token
+
+// ConsoleProxyAuth trusts the user and role headers set by a reverse proxy
+type ConsoleProxyAuth = auth.ProxyConfig
+
+// ConsolePrincipal is an authenticated console user
+type ConsolePrincipal = auth.Principal
+
+// ConsoleAuthenticator identifies the user of a console request. It returns nil, nil
+// when the request carries no credentials it understands, and an error when they are invalid.
+type ConsoleAuthenticator = auth.Authenticator
@@ -40,7 +40,7 @@ func main() {
 	group := "delay-demo-group"
 
 	// --- Consumer ---
-	err = mq.GroupSubscribe(context.TODO(), topic, group, func(msg *mqx.MessageView) error {
+	err = mq.GroupSubscribe(context.TODO(), topic, group, func(ctx context.Context, msg *mqx.MessageView) error {
 		receivedAt := time.Now().Format("15:04:05.000")
 		fmt.Printf("[%s] ✅ Received: key=%s, partition=%d, body=%s\n",
 			receivedAt, msg.Key, msg.Partition, string(msg.Body))
@@ -47,7 +47,7 @@ func main() {
 	// Track how many times each message key has been attempted
 	attempts := &sync.Map{}
 
-	err = mq.GroupSubscribe(context.TODO(), topic, group, func(msg *mqx.MessageView) error {
+	err = mq.GroupSubscribe(context.TODO(), topic, group, func(ctx context.Context, msg *mqx.MessageView) error {
 		key := msg.Key
 
 		// Count attempts for this key
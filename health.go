@@ -0,0 +1,23 @@
+package mqx
+
+import "github.com/wenzuojing/mqx/internal/model"
+
+// Health statuses
+const (
+	HealthUp   = model.HealthUp
+	HealthDown = model.HealthDown
+)
+
+// HealthReport is the health of an MQX instance.
+// Live is false when a background loop is stuck and only a restart helps;
+// Ready is false when any check or subscription is down.
+type HealthReport = model.HealthReport
+
+// HealthCheck is the result of one health check: database, tables, heartbeat or delay_loop
+type HealthCheck = model.HealthCheck
+
+// SubscriptionHealth is the heartbeat and partition status of a subscription of this instance
+type SubscriptionHealth = model.SubscriptionHealth
+
+// PartitionHealth is the last successful poll of a partition assigned to this instance
+type PartitionHealth = model.PartitionHealth
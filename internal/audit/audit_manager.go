@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/template"
+	"github.com/wenzuojing/mqx/pkg/templatex"
+)
+
+// NewAuditManager creates the manager of the console audit log
+func NewAuditManager(db *sql.DB, cfg *config.Config, factory interfaces.Factory) (interfaces.AuditManager, error) {
+	return &auditManagerImpl{db: db, cfg: cfg, logger: factory.GetLogger()}, nil
+}
+
+type auditManagerImpl struct {
+	db     *sql.DB
+	cfg    *config.Config
+	logger logging.Logger
+}
+
+func (a *auditManagerImpl) Start(ctx context.Context) error {
+	if _, err := a.db.ExecContext(ctx, template.CreateAuditLogTable); err != nil {
+		a.logger.Error("Failed to create audit log table", "error", err)
+		return err
+	}
+	return nil
+}
+
+func (a *auditManagerImpl) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Record writes an audit entry, setting its time when zero
+func (a *auditManagerImpl) Record(ctx context.Context, entry *model.AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	result, err := a.db.ExecContext(ctx, template.InsertAuditLog, entry.User, entry.Role, entry.Action, entry.Target,
+		nullString(entry.Before), nullString(entry.After), entry.Result, nullString(entry.Error), entry.ClientIP, entry.Time)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert audit entry")
+	}
+	entry.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// Query returns the total number of matching entries and one page of them, newest first
+func (a *auditManagerImpl) Query(ctx context.Context, filter *model.AuditFilter) (int64, []*model.AuditEntry, error) {
+	data := map[string]any{
+		"User":    filter.User,
+		"Action":  filter.Action,
+		"Target":  filter.Target,
+		"HasFrom": !filter.From.IsZero(),
+		"HasTo":   !filter.To.IsZero(),
+	}
+	var args []any
+	for _, value := range []string{filter.User, filter.Action, filter.Target} {
+		if value != "" {
+			args = append(args, value)
+		}
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+	}
+
+	countQuery, err := templatex.Rander(template.CountAuditLog, data)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to template sql")
+	}
+	var total int64
+	if err := a.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return 0, nil, errors.Wrap(err, "failed to count audit entries")
+	}
+
+	query, err := templatex.Rander(template.SelectAuditLog, data)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to template sql")
+	}
+	pageNo, pageSize := filter.PageNo, filter.PageSize
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	rows, err := a.db.QueryContext(ctx, query, append(args, pageSize, (pageNo-1)*pageSize)...)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to query audit entries")
+	}
+	defer rows.Close()
+
+	entries := make([]*model.AuditEntry, 0)
+	for rows.Next() {
+		var entry model.AuditEntry
+		var before, after, errText sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.User, &entry.Role, &entry.Action, &entry.Target, &before, &after,
+			&entry.Result, &errText, &entry.ClientIP, &entry.Time); err != nil {
+			return 0, nil, errors.Wrap(err, "failed to scan audit entry")
+		}
+		entry.Before, entry.After, entry.Error = before.String, after.String, errText.String
+		entries = append(entries, &entry)
+	}
+	return total, entries, rows.Err()
+}
+
+// DeleteBefore deletes the entries recorded before a time and returns how many were deleted
+func (a *auditManagerImpl) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := a.db.ExecContext(ctx, template.DeleteAuditLog, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
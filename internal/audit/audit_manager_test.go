@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func newTestManager(db *sql.DB) *auditManagerImpl {
+	return &auditManagerImpl{db: db, cfg: &config.Config{}, logger: logging.Discard()}
+}
+
+func TestAuditManager_Record(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO mqx_audit_log").
+		WithArgs("ops", "admin", "topic.delete", "orders", `{"topic":"orders"}`, nil, "success", nil, "10.0.0.1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(42, 1))
+
+	entry := &model.AuditEntry{
+		User:     "ops",
+		Role:     "admin",
+		Action:   "topic.delete",
+		Target:   "orders",
+		Before:   `{"topic":"orders"}`,
+		Result:   model.AuditResultSuccess,
+		ClientIP: "10.0.0.1",
+	}
+	assert.NoError(t, newTestManager(db).Record(context.Background(), entry))
+	assert.Equal(t, int64(42), entry.ID)
+	assert.False(t, entry.Time.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuditManager_Query(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Now().Add(-time.Hour)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)\\s+FROM `mqx_audit_log`\\s+WHERE 1 = 1\\s+AND `user` = \\?\\s+AND `time` >= \\?").
+		WithArgs("ops", from).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	rows := sqlmock.NewRows([]string{"id", "user", "role", "action", "target", "before", "after", "result", "error", "client_ip", "time"}).
+		AddRow(3, "ops", "admin", "topic.update", "orders", `{"partitionNum":4}`, `{"partitionNum":8}`, "success", nil, "10.0.0.1", time.Now())
+	mock.ExpectQuery("SELECT (.+) FROM `mqx_audit_log`\\s+WHERE 1 = 1\\s+AND `user` = \\?\\s+AND `time` >= \\?\\s+ORDER BY").
+		WithArgs("ops", from, 2, 2).
+		WillReturnRows(rows)
+
+	total, entries, err := newTestManager(db).Query(context.Background(), &model.AuditFilter{User: "ops", From: from, PageNo: 2, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "topic.update", entries[0].Action)
+	assert.Equal(t, `{"partitionNum":8}`, entries[0].After)
+	assert.Empty(t, entries[0].Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuditManager_DeleteBefore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	before := time.Now().AddDate(0, 0, -90)
+	mock.ExpectExec("DELETE FROM mqx_audit_log").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 5))
+
+	deleted, err := newTestManager(db).DeleteBefore(context.Background(), before)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnauthenticated is returned when a request carries credentials that are not valid
+var ErrUnauthenticated = errors.New("invalid credentials")
+
+// Role grants access to console routes. Each role includes the permissions of the roles below it.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // Read topics, groups, messages and metrics
+	RoleOperator Role = "operator" // Also send messages
+	RoleAdmin    Role = "admin"    // Also create, update and delete topics
+)
+
+var roleLevels = map[Role]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	return roleLevels[r] > 0
+}
+
+// Allows reports whether r includes the permissions of required
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && roleLevels[r] >= roleLevels[required]
+}
+
+// Principal is an authenticated console user
+type Principal struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// Authenticator identifies the user of a console request.
+// It returns nil, nil when the request carries no credentials it understands, so the
+// next authenticator is tried, and an error when the credentials are present but invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// User is a static console user authenticated with HTTP basic auth
+type User struct {
+	Username     string // Login name
+	PasswordHash string // bcrypt hash of the password
+	Role         Role   // Role granted to the user
+}
+
+type staticUsers struct {
+	users map[string]User
+	// dummyHash is compared for unknown users, so that the response time does not tell which users exist
+	dummyHash []byte
+}
+
+// NewStaticUsers authenticates HTTP basic auth credentials against bcrypt password hashes
+func NewStaticUsers(users []User) (Authenticator, error) {
+	a := &staticUsers{users: make(map[string]User, len(users))}
+	cost := bcrypt.DefaultCost
+	for _, user := range users {
+		if !user.Role.Valid() {
+			return nil, fmt.Errorf("console user %q has unknown role %q", user.Username, user.Role)
+		}
+		userCost, err := bcrypt.Cost([]byte(user.PasswordHash))
+		if err != nil {
+			return nil, fmt.Errorf("console user %q has an invalid bcrypt password hash: %w", user.Username, err)
+		}
+		cost = max(cost, userCost)
+		a.users[user.Username] = user
+	}
+	// Takes as long to compare as the slowest hash of the users
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("mqx-unknown-user"), cost)
+	if err != nil {
+		return nil, err
+	}
+	a.dummyHash = dummyHash
+	return a, nil
+}
+
+func (a *staticUsers) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	user, ok := a.users[username]
+	if !ok {
+		bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return nil, ErrUnauthenticated
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrUnauthenticated
+	}
+	return &Principal{Name: user.Username, Role: user.Role}, nil
+}
+
+// Token is a static bearer token
+type Token struct {
+	Name  string // Name reported as the principal, e.g. the client using the token
+	Token string // Secret sent as "Authorization: Bearer <token>"
+	Role  Role   // Role granted to the token
+}
+
+type bearerTokens struct {
+	tokens []Token
+}
+
+// NewBearerTokens authenticates "Authorization: Bearer" tokens
+func NewBearerTokens(tokens []Token) (Authenticator, error) {
+	for _, token := range tokens {
+		if token.Token == "" {
+			return nil, fmt.Errorf("console token %q is empty", token.Name)
+		}
+		if !token.Role.Valid() {
+			return nil, fmt.Errorf("console token %q has unknown role %q", token.Name, token.Role)
+		}
+	}
+	return &bearerTokens{tokens: tokens}, nil
+}
+
+func (a *bearerTokens) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil, nil
+	}
+	presented := []byte(strings.TrimSpace(header[7:]))
+	for _, token := range a.tokens {
+		if subtle.ConstantTimeCompare(presented, []byte(token.Token)) == 1 {
+			return &Principal{Name: token.Name, Role: token.Role}, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+// ProxyConfig configures authentication by a reverse proxy that sets the user in request headers
+type ProxyConfig struct {
+	UserHeader     string   // Header carrying the user name, e.g. X-Forwarded-User
+	RoleHeader     string   // Header carrying the role (empty to always use DefaultRole)
+	DefaultRole    Role     // Role of proxy users without a role header
+	TrustedProxies []string // IPs or CIDRs of the proxies; headers from other peers are ignored
+}
+
+type proxyHeader struct {
+	cfg     ProxyConfig
+	trusted []*net.IPNet
+}
+
+// NewProxyHeader trusts the user and role headers set by a reverse proxy
+func NewProxyHeader(cfg ProxyConfig) (Authenticator, error) {
+	if cfg.UserHeader == "" {
+		return nil, errors.New("console proxy authentication requires a user header")
+	}
+	if len(cfg.TrustedProxies) == 0 {
+		return nil, errors.New("console proxy authentication requires trusted proxies")
+	}
+	if cfg.DefaultRole != "" && !cfg.DefaultRole.Valid() {
+		return nil, fmt.Errorf("console proxy default role %q is unknown", cfg.DefaultRole)
+	}
+	a := &proxyHeader{cfg: cfg}
+	for _, proxy := range cfg.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid console trusted proxy %q: %w", proxy, err)
+		}
+		a.trusted = append(a.trusted, network)
+	}
+	return a, nil
+}
+
+func (a *proxyHeader) Authenticate(r *http.Request) (*Principal, error) {
+	user := r.Header.Get(a.cfg.UserHeader)
+	if user == "" || !a.fromTrustedProxy(r) {
+		return nil, nil
+	}
+	role := a.cfg.DefaultRole
+	if a.cfg.RoleHeader != "" {
+		if header := r.Header.Get(a.cfg.RoleHeader); header != "" {
+			role = Role(strings.ToLower(header))
+		}
+	}
+	if !role.Valid() {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrUnauthenticated, role)
+	}
+	return &Principal{Name: user, Role: role}, nil
+}
+
+func (a *proxyHeader) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Chain tries authenticators in order and returns the first principal found.
+// An invalid credential stops the chain.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil || principal != nil {
+			return principal, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRole_Allows(t *testing.T) {
+	assert.True(t, RoleAdmin.Allows(RoleOperator))
+	assert.True(t, RoleOperator.Allows(RoleOperator))
+	assert.False(t, RoleViewer.Allows(RoleOperator))
+	assert.False(t, Role("root").Allows(RoleViewer))
+}
+
+func TestStaticUsers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	users, err := NewStaticUsers([]User{{Username: "alice", PasswordHash: string(hash), Role: RoleOperator}})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	principal, err := users.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+
+	req.SetBasicAuth("alice", "secret")
+	principal, err = users.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "alice", Role: RoleOperator}, principal)
+
+	req.SetBasicAuth("alice", "wrong")
+	_, err = users.Authenticate(req)
+	assert.True(t, errors.Is(err, ErrUnauthenticated))
+
+	req.SetBasicAuth("mallory", "secret")
+	_, err = users.Authenticate(req)
+	assert.True(t, errors.Is(err, ErrUnauthenticated))
+	cost, err := bcrypt.Cost(users.(*staticUsers).dummyHash)
+	assert.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+
+	_, err = NewStaticUsers([]User{{Username: "bob", PasswordHash: "plain", Role: RoleViewer}})
+	assert.Error(t, err)
+}
+
+func TestBearerTokens(t *testing.T) {
+	tokens, err := NewBearerTokens([]Token{{Name: "ci", Token: "t0ken", Role: RoleAdmin}})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	principal, err := tokens.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "ci", Role: RoleAdmin}, principal)
+
+	req.Header.Set("Authorization", "Bearer other")
+	_, err = tokens.Authenticate(req)
+	assert.True(t, errors.Is(err, ErrUnauthenticated))
+
+	_, err = NewBearerTokens([]Token{{Name: "ci", Token: "t0ken", Role: "root"}})
+	assert.Error(t, err)
+}
+
+func TestProxyHeader(t *testing.T) {
+	proxy, err := NewProxyHeader(ProxyConfig{
+		UserHeader:     "X-Forwarded-User",
+		RoleHeader:     "X-Forwarded-Role",
+		DefaultRole:    RoleViewer,
+		TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1"},
+	})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("X-Forwarded-User", "carol")
+	principal, err := proxy.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "carol", Role: RoleViewer}, principal)
+
+	req.Header.Set("X-Forwarded-Role", "Admin")
+	principal, err = proxy.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleAdmin, principal.Role)
+
+	// Headers from untrusted peers are ignored
+	req.RemoteAddr = "192.168.1.1:4567"
+	principal, err = proxy.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+
+	_, err = NewProxyHeader(ProxyConfig{UserHeader: "X-Forwarded-User"})
+	assert.Error(t, err)
+}
+
+func TestChain(t *testing.T) {
+	tokens, err := NewBearerTokens([]Token{{Name: "ci", Token: "t0ken", Role: RoleAdmin}})
+	assert.NoError(t, err)
+	proxy, err := NewProxyHeader(ProxyConfig{UserHeader: "X-User", DefaultRole: RoleViewer, TrustedProxies: []string{"192.0.2.1"}})
+	assert.NoError(t, err)
+	chain := Chain{tokens, proxy}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	req.Header.Set("X-User", "dave")
+	principal, err := chain.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "dave", principal.Name)
+
+	// An invalid credential stops the chain
+	req.Header.Set("Authorization", "Bearer other")
+	principal, err = chain.Authenticate(req)
+	assert.Error(t, err)
+	assert.Nil(t, principal)
+}
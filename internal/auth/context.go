@@ -0,0 +1,16 @@
+package auth
+
+import "context"
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal of a request
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal carried by ctx, nil when the request is unauthenticated
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
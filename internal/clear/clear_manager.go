@@ -9,8 +9,9 @@ import (
 
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
 	"github.com/wenzuojing/mqx/internal/template"
-	"k8s.io/klog/v2"
 )
 
 type clearManagerImpl struct {
@@ -18,15 +19,23 @@ type clearManagerImpl struct {
 	factory  interfaces.Factory
 	cfg      *config.Config
 	stopChan chan struct{}
+	logger   logging.Logger
 }
 
 func NewClearManger(db *sql.DB, cfg *config.Config, factory interfaces.Factory) (interfaces.ClearManager, error) {
-	return &clearManagerImpl{db: db, cfg: cfg, factory: factory, stopChan: make(chan struct{})}, nil
+	return &clearManagerImpl{db: db, cfg: cfg, factory: factory, stopChan: make(chan struct{}), logger: factory.GetLogger()}, nil
 }
 
 func (c *clearManagerImpl) Start(ctx context.Context) error {
 	go c.clearConsumerInstance(context.Background())
 	go c.clearMessage(context.Background())
+	go c.clearReplyTopics(context.Background())
+	if c.factory.GetTraceManager() != nil {
+		go c.clearMessageTrace(context.Background())
+	}
+	if c.cfg.AuditRetentionDays > 0 {
+		go c.clearAuditLog(context.Background())
+	}
 	return nil
 }
 
@@ -38,15 +47,21 @@ func (c *clearManagerImpl) Stop(ctx context.Context) error {
 func (c *clearManagerImpl) clearConsumerInstance(ctx context.Context) {
 	ticker := time.NewTicker(c.cfg.ClearInterval)
 	defer ticker.Stop()
+	errLog := logging.NewThrottle(c.logger, 0)
 
 	for {
 		select {
 		case <-c.stopChan:
 			return
 		case <-ticker.C:
-			_, err := c.db.ExecContext(ctx, template.DeleteUnactiveConsumerInstance)
+			result, err := c.db.ExecContext(ctx, template.DeleteUnactiveConsumerInstance)
 			if err != nil {
-				klog.Errorf("Failed to clear consumer instances: %v", err)
+				errLog.Error("Failed to clear consumer instances", "error", err)
+				continue
+			}
+			errLog.Reset()
+			if deleted, err := result.RowsAffected(); err == nil {
+				c.factory.GetMetrics().ConsumerInstancesCleared(deleted)
 			}
 		}
 	}
@@ -55,6 +70,7 @@ func (c *clearManagerImpl) clearConsumerInstance(ctx context.Context) {
 func (c *clearManagerImpl) clearMessage(ctx context.Context) {
 	ticker := time.NewTicker(c.cfg.ClearInterval)
 	defer ticker.Stop()
+	errLog := logging.NewThrottle(c.logger, 0)
 
 	for {
 		select {
@@ -64,9 +80,10 @@ func (c *clearManagerImpl) clearMessage(ctx context.Context) {
 			//查询所有topicMeta
 			topics, err := c.factory.GetTopicManager().GetAllTopicMeta(ctx)
 			if err != nil {
-				klog.Errorf("Failed to get all topic meta: %v", err)
+				errLog.Error("Failed to get all topic meta", "error", err)
 				continue
 			}
+			errLog.Reset()
 
 			//遍历topicMeta，根据topicMeta的partitionNum，删除对应数量的message
 			for _, topic := range topics {
@@ -76,7 +93,7 @@ func (c *clearManagerImpl) clearMessage(ctx context.Context) {
 						if strings.Contains(err.Error(), "doesn't exist") {
 							continue
 						}
-						klog.Errorf("Failed to clear message by partition, topic: %s, partition: %d, error: %v", topic.Topic, i, err)
+						c.logger.Error("Failed to clear message by partition", "topic", topic.Topic, "partition", i, "error", err)
 					}
 				}
 			}
@@ -84,10 +101,116 @@ func (c *clearManagerImpl) clearMessage(ctx context.Context) {
 	}
 }
 
+// clearReplyTopics deletes the reply topics whose instance stopped heartbeating without deleting them
+func (c *clearManagerImpl) clearReplyTopics(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.ClearInterval)
+	defer ticker.Stop()
+	errLog := logging.NewThrottle(c.logger, 0)
+
+	heartbeatTimeoutSeconds := int(c.cfg.HeartbeatInterval.Seconds()) * 3
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			topics, err := c.factory.GetTopicManager().GetAllTopicMeta(ctx)
+			if err != nil {
+				errLog.Error("Failed to get all topic meta", "error", err)
+				continue
+			}
+			errLog.Reset()
+
+			for _, topic := range topics {
+				if !strings.HasPrefix(topic.Topic, model.ReplyTopicPrefix) {
+					continue
+				}
+				instances, err := c.factory.GetConsumerManager().GetActiveConsumerInstances(ctx, topic.Topic, model.ReplyGroup, heartbeatTimeoutSeconds)
+				if err != nil {
+					c.logger.Error("Failed to get reply topic heartbeat", "topic", topic.Topic, "error", err)
+					continue
+				}
+				if len(instances) > 0 {
+					continue
+				}
+				// The stale heartbeat would keep the topic from being deleted
+				if _, err := c.db.ExecContext(ctx, template.DeleteGroupInstances, model.ReplyGroup, topic.Topic); err != nil {
+					c.logger.Error("Failed to delete reply topic heartbeat", "topic", topic.Topic, "error", err)
+					continue
+				}
+				if err := c.factory.GetTopicManager().DeleteTopic(ctx, topic.Topic); err != nil {
+					c.logger.Warn("Failed to delete reply topic", "topic", topic.Topic, "error", err)
+					continue
+				}
+				c.logger.Info("Deleted reply topic of a stopped instance", "topic", topic.Topic)
+			}
+		}
+	}
+}
+
+// clearMessageTrace deletes trace events older than the message trace retention
+func (c *clearManagerImpl) clearMessageTrace(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.ClearInterval)
+	defer ticker.Stop()
+	errLog := logging.NewThrottle(c.logger, 0)
+
+	retentionDays := c.cfg.MessageTraceRetentionDays
+	if retentionDays <= 0 {
+		retentionDays = c.cfg.RetentionDays
+	}
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			before := time.Now().Add(-time.Duration(retentionDays) * time.Hour * 24)
+			deleted, err := c.factory.GetTraceManager().DeleteBefore(ctx, before)
+			if err != nil {
+				errLog.Error("Failed to clear message traces", "error", err)
+				continue
+			}
+			errLog.Reset()
+			if deleted > 0 {
+				c.logger.Debug("Cleared message traces", "count", deleted)
+			}
+		}
+	}
+}
+
+// clearAuditLog deletes audit entries older than the audit retention
+func (c *clearManagerImpl) clearAuditLog(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.ClearInterval)
+	defer ticker.Stop()
+	errLog := logging.NewThrottle(c.logger, 0)
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			before := time.Now().Add(-time.Duration(c.cfg.AuditRetentionDays) * time.Hour * 24)
+			deleted, err := c.factory.GetAuditManager().DeleteBefore(ctx, before)
+			if err != nil {
+				errLog.Error("Failed to clear audit log", "error", err)
+				continue
+			}
+			errLog.Reset()
+			if deleted > 0 {
+				c.logger.Debug("Cleared audit log", "count", deleted)
+			}
+		}
+	}
+}
+
 func (c *clearManagerImpl) clearMessageByPartition(ctx context.Context, topic string, partition int, retentionDays int) error {
 	tableName := getMessageTableName(topic, partition)
-	_, err := c.db.ExecContext(ctx, fmt.Sprintf(template.DeleteMessages, tableName), time.Now().Add(-time.Duration(retentionDays)*time.Hour*24))
-	return err
+	result, err := c.db.ExecContext(ctx, fmt.Sprintf(template.DeleteMessages, tableName), time.Now().Add(-time.Duration(retentionDays)*time.Hour*24))
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err == nil {
+		c.factory.GetMetrics().MessagesCleared(topic, deleted)
+	}
+	return nil
 }
 
 func getMessageTableName(topic string, partition int) string {
@@ -1,24 +1,76 @@
 package config
 
-import "time"
+import (
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
 
 type Config struct {
-	DSN                               string        // Database connection string
-	DefaultPartitionNum               int           // Default number of partitions
-	RetentionDays                     int           // Message retention days
-	RebalanceInterval                 time.Duration // Consumer rebalance interval
-	RefreshConsumerPartitionsInterval time.Duration // Refresh consumer partitions interval
-	HeartbeatInterval                 time.Duration // Consumer heartbeat interval
-	DelayInterval                     time.Duration // Delay message processing interval
-	PullingInterval                   time.Duration // Message pulling interval
-	PullingSize                       int           // Batch size for message pulling
-	RetryInterval                     time.Duration // Retry interval for failed operations (base interval for exponential backoff)
-	RetryTimes                        int           // Maximum number of retry attempts
-	ClearInterval                     time.Duration // Clear interval for expired messages
-	Console                           Console       // Console configuration
-	EnableConsole                     bool          // Enable console
+	DSN                               string                        // Database connection string
+	DefaultPartitionNum               int                           // Default number of partitions
+	RetentionDays                     int                           // Message retention days
+	RebalanceInterval                 time.Duration                 // Consumer rebalance interval
+	RefreshConsumerPartitionsInterval time.Duration                 // Refresh consumer partitions interval
+	HeartbeatInterval                 time.Duration                 // Consumer heartbeat interval
+	DelayInterval                     time.Duration                 // Delay message processing interval
+	PullingInterval                   time.Duration                 // Message pulling interval
+	PullingSize                       int                           // Batch size for message pulling
+	RetryInterval                     time.Duration                 // Retry interval for failed operations (base interval for exponential backoff)
+	RetryTimes                        int                           // Maximum number of retry attempts
+	HandlerTimeout                    time.Duration                 // Deadline of the context passed to each handler invocation (0 for none)
+	ClearInterval                     time.Duration                 // Clear interval for expired messages
+	TransactionTimeout                time.Duration                 // Time a half message may stay unresolved before it is checked back
+	TransactionCheckInterval          time.Duration                 // Interval between transaction check-back rounds
+	TransactionCheckMaxTimes          int                           // Maximum number of check-backs before a half message is rolled back
+	RequestTimeout                    time.Duration                 // Default reply timeout for requests whose context has no deadline
+	ReplyPollingInterval              time.Duration                 // Reply topic polling interval while requests are outstanding
+	AsyncBufferSize                   int                           // Capacity of the async send buffer
+	AsyncBatchSize                    int                           // Maximum number of async messages written in one batch
+	AsyncLinger                       time.Duration                 // Maximum time an async message waits for its batch to fill
+	AsyncFailFast                     bool                          // Fail SendAsync when the buffer is full instead of blocking
+	TracerProvider                    trace.TracerProvider          // OpenTelemetry tracer provider (nil for the global provider)
+	Propagator                        propagation.TextMapPropagator // Propagator of the trace context stored in message headers (nil for W3C trace context)
+	Logger                            logging.Logger                // Structured logger (nil for the slog default logger)
+	EnableMessageTrace                bool                          // Record the lifecycle of every message in the message trace table
+	MessageTraceRetentionDays         int                           // Message trace retention days (0 for RetentionDays)
+	AuditRetentionDays                int                           // Console audit log retention days (0 to keep forever)
+	Console                           Console                       // Console configuration
+	EnableConsole                     bool                          // Enable console
+	Gateway                           Gateway                       // HTTP gateway configuration
+	EnableGateway                     bool                          // Enable the HTTP gateway
+	GRPC                              GRPC                          // gRPC server configuration
+	EnableGRPC                        bool                          // Enable the gRPC server
+	EnableWebhooks                    bool                          // Run the webhook subscriptions on this instance
+	WebhookTimeout                    time.Duration                 // Default timeout of a webhook delivery
+	WebhookRefreshInterval            time.Duration                 // Interval between reloads of the webhook subscriptions
 }
 
 type Console struct {
-	Address string // Console server address
+	Address        string               // Console server address
+	Users          []auth.User          // Static users authenticated with HTTP basic auth
+	Tokens         []auth.Token         // Bearer tokens
+	Proxy          *auth.ProxyConfig    // Reverse proxy header authentication (nil to disable)
+	Authenticators []auth.Authenticator // Custom authenticators, tried after the built-in ones
+	AllowedOrigins []string             // Origins allowed by CORS, "*" for any (empty for same-origin only)
+	TLSCertFile    string               // TLS certificate file (empty to serve plain HTTP)
+	TLSKeyFile     string               // TLS private key file
+}
+
+type Gateway struct {
+	Address        string        // Standalone gateway address (empty to serve the gateway on the console under /gateway/v1)
+	Tokens         []auth.Token  // Bearer tokens of a standalone gateway (empty for none); the console authenticates a gateway it serves
+	MaxBatchSize   int           // Maximum number of messages published or fetched by one request
+	MaxWait        time.Duration // Longest wait of a long-poll fetch
+	SessionTimeout time.Duration // Time after which a consumer instance neither fetching nor committing leaves its group
+}
+
+type GRPC struct {
+	Address      string       // gRPC server address
+	Tokens       []auth.Token // Bearer tokens sent in the authorization metadata (empty for none)
+	MaxBatchSize int          // Maximum number of messages of a PublishBatch call
+	MaxInFlight  int          // Maximum number of messages streamed to a subscription before they are acked
 }
@@ -0,0 +1,104 @@
+package console
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+)
+
+// anonymous acts for every request when no authentication is configured
+var anonymous = &auth.Principal{Name: "anonymous", Role: auth.RoleAdmin}
+
+// newAuthenticator builds the authenticator chain of the console, nil when no authentication is configured
+func newAuthenticator(cfg config.Console) (auth.Authenticator, error) {
+	var chain auth.Chain
+	if len(cfg.Users) > 0 {
+		users, err := auth.NewStaticUsers(cfg.Users)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, users)
+	}
+	if len(cfg.Tokens) > 0 {
+		tokens, err := auth.NewBearerTokens(cfg.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, tokens)
+	}
+	if cfg.Proxy != nil {
+		proxy, err := auth.NewProxyHeader(*cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, proxy)
+	}
+	chain = append(chain, cfg.Authenticators...)
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// authenticate identifies the user of a request. Requests without credentials continue
+// unauthenticated and are rejected by the routes that require a role.
+func (s *ConsoleServer) authenticate(c *gin.Context) {
+	if s.authenticator == nil {
+		setPrincipal(c, anonymous)
+		return
+	}
+	principal, err := s.authenticator.Authenticate(c.Request)
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			s.factory.GetLogger().Warn("Console authentication failed", "path", c.Request.URL.Path, "error", err)
+		}
+		s.unauthorized(c)
+		return
+	}
+	if principal != nil {
+		setPrincipal(c, principal)
+	}
+}
+
+// require rejects requests whose user does not have the role
+func (s *ConsoleServer) require(role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := principalFrom(c)
+		if principal == nil {
+			s.unauthorized(c)
+			return
+		}
+		if !principal.Role.Allows(role) {
+			httpapi.WriteError(c, http.StatusForbidden, "role "+string(role)+" required")
+			return
+		}
+	}
+}
+
+func (s *ConsoleServer) unauthorized(c *gin.Context) {
+	if len(s.cfg.Console.Users) > 0 {
+		// Lets the browser prompt for the credentials of a static user
+		c.Header("WWW-Authenticate", `Basic realm="mqx console"`)
+	}
+	httpapi.WriteError(c, http.StatusUnauthorized, "authentication required")
+}
+
+// setPrincipal stores the user in the request context, where the handlers mounted
+// on the console, such as the gateway, find it too
+func setPrincipal(c *gin.Context, principal *auth.Principal) {
+	c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), principal))
+}
+
+// principalFrom returns the user of a request, nil when unauthenticated
+func principalFrom(c *gin.Context) *auth.Principal {
+	return auth.FromContext(c.Request.Context())
+}
+
+// me handles the GET /api/v1/me request
+func (s *ConsoleServer) me(c *gin.Context) {
+	c.JSON(http.StatusOK, principalFrom(c))
+}
@@ -0,0 +1,260 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/metrics"
+	"github.com/wenzuojing/mqx/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MockFactory implements interfaces.Factory for testing
+type MockFactory struct {
+	mock.Mock
+	interfaces.Factory
+}
+
+func (m *MockFactory) GetTopicManager() interfaces.TopicManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.TopicManager)
+}
+
+func (m *MockFactory) GetAuditManager() interfaces.AuditManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.AuditManager)
+}
+
+func (m *MockFactory) GetHealthChecker() interfaces.HealthChecker {
+	args := m.Called()
+	return args.Get(0).(interfaces.HealthChecker)
+}
+
+func (m *MockFactory) GetMetrics() *metrics.Metrics {
+	return nil
+}
+
+func (m *MockFactory) GetLogger() logging.Logger {
+	return logging.Discard()
+}
+
+// MockTopicManager implements interfaces.TopicManager for testing
+type MockTopicManager struct {
+	mock.Mock
+	interfaces.TopicManager
+}
+
+func (m *MockTopicManager) DeleteTopic(ctx context.Context, topic string) error {
+	args := m.Called(ctx, topic)
+	return args.Error(0)
+}
+
+func (m *MockTopicManager) GetTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	args := m.Called(ctx, topic)
+	meta, _ := args.Get(0).(*model.TopicMeta)
+	return meta, args.Error(1)
+}
+
+func (m *MockTopicManager) FindTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	args := m.Called(ctx, topic)
+	meta, _ := args.Get(0).(*model.TopicMeta)
+	return meta, args.Error(1)
+}
+
+// MockHealthChecker implements interfaces.HealthChecker for testing
+type MockHealthChecker struct {
+	mock.Mock
+}
+
+func (m *MockHealthChecker) Check(ctx context.Context) *model.HealthReport {
+	args := m.Called(ctx)
+	return args.Get(0).(*model.HealthReport)
+}
+
+// MockAuditManager implements interfaces.AuditManager for testing
+type MockAuditManager struct {
+	mock.Mock
+	interfaces.AuditManager
+}
+
+func (m *MockAuditManager) Record(ctx context.Context, entry *model.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func newTestServer(t *testing.T, console config.Console, factory interfaces.Factory) *ConsoleServer {
+	gin.SetMode(gin.TestMode)
+	s, err := NewConsoleServer(&config.Config{Console: console}, factory)
+	assert.NoError(t, err)
+	s.setupRoutes()
+	return s
+}
+
+func serve(s *ConsoleServer, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestConsoleServer_RoleEnforcement(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	topicManager := new(MockTopicManager)
+	topicManager.On("DeleteTopic", mock.Anything, "orders").Return(nil)
+	topicManager.On("GetTopicMeta", mock.Anything, "orders").Return(&model.TopicMeta{Topic: "orders", PartitionNum: 4}, nil)
+	auditManager := new(MockAuditManager)
+	auditManager.On("Record", mock.Anything, mock.Anything).Return(nil)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetTopicManager").Return(topicManager)
+	mockFactory.On("GetAuditManager").Return(auditManager)
+	s := newTestServer(t, config.Console{
+		Users: []auth.User{{Username: "alice", PasswordHash: string(hash), Role: auth.RoleViewer}},
+		Tokens: []auth.Token{
+			{Name: "deployer", Token: "operator-token", Role: auth.RoleOperator},
+			{Name: "ops", Token: "admin-token", Role: auth.RoleAdmin},
+		},
+	}, mockFactory)
+
+	// Without credentials the browser is asked for basic auth
+	w := serve(s, httptest.NewRequest(http.MethodDelete, "/api/v1/topics/orders", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Basic")
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/topics/orders", nil)
+	req.SetBasicAuth("alice", "secret")
+	assert.Equal(t, http.StatusForbidden, serve(s, req).Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/topics/orders", nil)
+	req.Header.Set("Authorization", "Bearer operator-token")
+	assert.Equal(t, http.StatusForbidden, serve(s, req).Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/topics/orders", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	assert.Equal(t, http.StatusOK, serve(s, req).Code)
+	topicManager.AssertNumberOfCalls(t, "DeleteTopic", 1)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.SetBasicAuth("alice", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, serve(s, req).Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.Header.Set("Authorization", "Bearer operator-token")
+	w = serve(s, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name":"deployer","role":"operator"}`, w.Body.String())
+}
+
+func TestConsoleServer_AuthDisabled(t *testing.T) {
+	s := newTestServer(t, config.Console{}, new(MockFactory))
+
+	w := serve(s, httptest.NewRequest(http.MethodGet, "/api/v1/me", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name":"anonymous","role":"admin"}`, w.Body.String())
+}
+
+func TestConsoleServer_Probes(t *testing.T) {
+	checker := new(MockHealthChecker)
+	checker.On("Check", mock.Anything).Return(&model.HealthReport{
+		Status: model.HealthDown,
+		Live:   true,
+		Checks: []model.HealthCheck{{Name: "database", Status: model.HealthDown, Error: "dial tcp 10.0.0.5:3306: connection refused"}},
+	})
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetHealthChecker").Return(checker)
+	s := newTestServer(t, config.Console{Tokens: []auth.Token{{Name: "grafana", Token: "viewer-token", Role: auth.RoleViewer}}}, mockFactory)
+
+	// The kubelet gets the status without the details
+	w := serve(s, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"down","live":true,"ready":false}`, w.Body.String())
+	w = serve(s, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "10.0.0.5")
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	req.Header.Set("Authorization", "Bearer viewer-token")
+	w = serve(s, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "10.0.0.5")
+}
+
+func TestConsoleServer_CORS(t *testing.T) {
+	s := newTestServer(t, config.Console{AllowedOrigins: []string{"https://ops.example.com"}}, new(MockFactory))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.Header.Set("Origin", "https://ops.example.com")
+	w := serve(s, req)
+	assert.Equal(t, "https://ops.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, serve(s, req).Code)
+}
+
+func TestConsoleServer_AuditsMutations(t *testing.T) {
+	topicManager := new(MockTopicManager)
+	topicManager.On("GetTopicMeta", mock.Anything, "orders").Return(&model.TopicMeta{Topic: "orders", PartitionNum: 4}, nil)
+	topicManager.On("DeleteTopic", mock.Anything, "orders").Return(errors.New("topic is in use"))
+	auditManager := new(MockAuditManager)
+	auditManager.On("Record", mock.Anything, mock.Anything).Return(errors.New("database is down"))
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetTopicManager").Return(topicManager)
+	mockFactory.On("GetAuditManager").Return(auditManager)
+	s := newTestServer(t, config.Console{
+		Tokens: []auth.Token{{Name: "ops", Token: "admin-token", Role: auth.RoleAdmin}},
+	}, mockFactory)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/topics/orders", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	req.RemoteAddr = "10.0.0.1:51000"
+	req.Header.Set("X-Forwarded-For", "192.168.1.1")
+	// A failing audit write does not change the response
+	assert.Equal(t, http.StatusInternalServerError, serve(s, req).Code)
+
+	entry := auditManager.Calls[0].Arguments.Get(1).(*model.AuditEntry)
+	assert.Equal(t, "ops", entry.User)
+	assert.Equal(t, "admin", entry.Role)
+	assert.Equal(t, ActionTopicDelete, entry.Action)
+	assert.Equal(t, "orders", entry.Target)
+	assert.JSONEq(t, `{"topic":"orders","partitionNum":4,"retentionDays":0}`, entry.Before)
+	assert.Empty(t, entry.After)
+	assert.Equal(t, model.AuditResultFailure, entry.Result)
+	assert.Equal(t, "topic is in use", entry.Error)
+	// Forwarding headers are ignored unless the peer is a trusted proxy
+	assert.Equal(t, "10.0.0.1", entry.ClientIP)
+}
+
+func TestConsoleServer_Mount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s, err := NewConsoleServer(&config.Config{Console: config.Console{Tokens: []auth.Token{
+		{Name: "grafana", Token: "viewer-token", Role: auth.RoleViewer},
+		{Name: "billing", Token: "operator-token", Role: auth.RoleOperator},
+	}}}, new(MockFactory))
+	assert.NoError(t, err)
+	s.Mount("/gateway/v1", auth.RoleOperator, func(r gin.IRouter) {
+		r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	})
+	s.setupRoutes()
+
+	request := func(path string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return serve(s, req)
+	}
+	assert.Equal(t, http.StatusForbidden, request("/gateway/v1/ping", "viewer-token").Code)
+	assert.Equal(t, "pong", request("/gateway/v1/ping", "operator-token").Body.String())
+	// Unknown routes of a mount get an error object rather than the web app
+	w := request("/gateway/v1/pong", "operator-token")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"not_found"`)
+}
@@ -0,0 +1,190 @@
+package console
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// Formats of a message body in the console responses
+const (
+	BodyFormatAuto   = "auto" // Chosen from the content type header or the body itself
+	BodyFormatText   = "text"
+	BodyFormatJSON   = "json" // Pretty-printed
+	BodyFormatHex    = "hex"  // Hex dump with offsets and printable characters, like hexdump -C
+	BodyFormatBase64 = "base64"
+)
+
+// defaultMaxBodyBytes is the number of body bytes rendered when the request sets no limit
+const defaultMaxBodyBytes = 64 << 10
+
+// bodyOptions is how a request wants message bodies rendered.
+// At most 1 MiB of a body is rendered, larger bodies are downloaded.
+type bodyOptions struct {
+	Format   string `form:"format,default=auto" binding:"oneof=auto text json hex base64"`
+	MaxBytes int    `form:"maxBodyBytes" binding:"min=0,max=1048576"`
+}
+
+func (o bodyOptions) maxBytes() int {
+	if o.MaxBytes == 0 {
+		return defaultMaxBodyBytes
+	}
+	return o.MaxBytes
+}
+
+// MessageView is a message with its body rendered for display
+type MessageView struct {
+	*model.Message
+	// Body shadows the raw body of the message
+	Body        string `json:"body"`
+	BodyFormat  string `json:"bodyFormat"`
+	BodySize    int    `json:"bodySize"`
+	ContentType string `json:"contentType,omitempty"`
+	// Truncated is set when only the first bytes of the body are rendered
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// newMessageViewPage renders the bodies of a page of a message search
+func newMessageViewPage(page *model.MessagePage, opts bodyOptions) *httpapi.Page[*MessageView] {
+	views := make([]*MessageView, len(page.Messages))
+	for i, msg := range page.Messages {
+		views[i] = newMessageView(msg, opts)
+	}
+	return &httpapi.Page[*MessageView]{Items: views, Total: page.Total, NextCursor: page.NextCursor}
+}
+
+func newMessageView(msg *model.Message, opts bodyOptions) *MessageView {
+	view := &MessageView{
+		Message:     msg,
+		BodySize:    len(msg.Body),
+		ContentType: msg.Headers[model.HeaderContentType],
+	}
+	view.Body, view.BodyFormat, view.Truncated = renderBody(msg.Body, view.ContentType, opts.Format, opts.maxBytes())
+	return view
+}
+
+// renderBody renders at most maxBytes of a body in a format, falling back to a format the body fits
+// when it does not fit the requested one: JSON that does not parse is shown as text, text that is
+// not UTF-8 as a hex dump. A truncated JSON body is shown as text since it cannot be pretty-printed.
+func renderBody(body []byte, contentType string, format string, maxBytes int) (rendered string, actual string, truncated bool) {
+	if format == "" || format == BodyFormatAuto {
+		format = detectBodyFormat(body, contentType)
+	}
+	if len(body) > maxBytes {
+		body, truncated = body[:maxBytes], true
+	}
+
+	switch format {
+	case BodyFormatJSON:
+		var out bytes.Buffer
+		if !truncated && json.Indent(&out, body, "", "  ") == nil {
+			return out.String(), BodyFormatJSON, false
+		}
+		fallthrough
+	case BodyFormatText:
+		if truncated {
+			body = trimPartialRune(body)
+		}
+		if utf8.Valid(body) {
+			return string(body), BodyFormatText, truncated
+		}
+		return hex.Dump(body), BodyFormatHex, truncated
+	case BodyFormatHex:
+		return hex.Dump(body), BodyFormatHex, truncated
+	default:
+		return base64.StdEncoding.EncodeToString(body), BodyFormatBase64, truncated
+	}
+}
+
+// detectBodyFormat picks the format of a body from its content type, or from its bytes when there is none
+func detectBodyFormat(body []byte, contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			return BodyFormatJSON
+		case strings.HasPrefix(mediaType, "text/") || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml"):
+			return BodyFormatText
+		default:
+			// Protobuf, gob and other binary encodings
+			return BodyFormatHex
+		}
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return BodyFormatJSON
+	}
+	if isPrintable(body) {
+		return BodyFormatText
+	}
+	return BodyFormatHex
+}
+
+// isPrintable reports whether a body is UTF-8 text without control characters other than whitespace
+func isPrintable(body []byte) bool {
+	if !utf8.Valid(body) {
+		return false
+	}
+	for _, r := range string(body) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimPartialRune drops the incomplete UTF-8 sequence left at the end of a truncated body
+func trimPartialRune(body []byte) []byte {
+	for i := 0; i < utf8.UTFMax && i < len(body); i++ {
+		r, size := utf8.DecodeLastRune(body[:len(body)-i])
+		if r != utf8.RuneError || size > 1 {
+			return body[:len(body)-i]
+		}
+	}
+	return body
+}
+
+// downloadMessageBody handles the GET /api/v1/topics/:topic/messages/:messageId/body request,
+// returning the raw body with the content type of the message
+func (s *ConsoleServer) downloadMessageBody(c *gin.Context) {
+	topic, messageID := c.Param("topic"), c.Param("messageId")
+	page, err := s.factory.GetMessageManager().SearchMessages(c.Request.Context(), &model.MessageFilter{Topic: topic, MessageID: messageID, PageSize: 1})
+	if err != nil {
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(page.Messages) == 0 {
+		httpapi.WriteError(c, http.StatusNotFound, "message not found")
+		return
+	}
+
+	msg := page.Messages[0]
+	contentType := msg.Headers[model.HeaderContentType]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": messageID + bodyExtension(contentType)}))
+	c.Data(http.StatusOK, contentType, msg.Body)
+}
+
+// bodyExtension returns the file extension of a downloaded body
+func bodyExtension(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return ".json"
+	case strings.HasPrefix(mediaType, "text/"):
+		return ".txt"
+	default:
+		return ".bin"
+	}
+}
@@ -0,0 +1,93 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func (m *MockMessageManager) SearchMessages(ctx context.Context, filter *model.MessageFilter) (*model.MessagePage, error) {
+	args := m.Called(ctx, filter)
+	page, _ := args.Get(0).(*model.MessagePage)
+	return page, args.Error(1)
+}
+
+func TestRenderBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		format      string
+		maxBytes    int
+		rendered    string
+		actual      string
+		truncated   bool
+	}{
+		{"detected json", `{"id":1,"tags":["a"]}`, "", "auto", 100, "{\n  \"id\": 1,\n  \"tags\": [\n    \"a\"\n  ]\n}", "json", false},
+		{"json content type", `1`, "application/json; charset=utf-8", "auto", 100, "1", "json", false},
+		{"detected text", "paid order", "", "auto", 100, "paid order", "text", false},
+		{"detected binary", "\x00\x01ok", "", "auto", 100, "00000000  00 01 6f 6b                                       |..ok|\n", "hex", false},
+		{"binary content type", "ok", "application/x-protobuf", "auto", 100, "00000000  6f 6b                                             |ok|\n", "hex", false},
+		{"requested base64", "ok", "", "base64", 100, "b2s=", "base64", false},
+		{"invalid json as text", "not json", "", "json", 100, "not json", "text", false},
+		{"truncated json as text", `{"id":1}`, "", "json", 4, `{"id`, "text", true},
+		{"truncated inside a rune", "价格", "", "text", 4, "价", "text", true},
+		{"invalid utf-8 as hex", "\xff", "", "text", 100, "00000000  ff                                                |.|\n", "hex", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, actual, truncated := renderBody([]byte(tt.body), tt.contentType, tt.format, tt.maxBytes)
+			assert.Equal(t, tt.rendered, rendered)
+			assert.Equal(t, tt.actual, actual)
+			assert.Equal(t, tt.truncated, truncated)
+		})
+	}
+}
+
+func TestConsoleServer_MessageBodies(t *testing.T) {
+	stored := &model.Message{
+		MessageID: "msg-1",
+		Topic:     "orders",
+		Body:      []byte(`{"amount":42}`),
+		Headers:   map[string]string{model.HeaderContentType: "application/json"},
+	}
+	messages := new(MockMessageManager)
+	messages.On("SearchMessages", mock.Anything, mock.MatchedBy(func(f *model.MessageFilter) bool { return f.MessageID == "msg-1" })).
+		Return(&model.MessagePage{Messages: []*model.Message{stored}}, nil)
+	messages.On("SearchMessages", mock.Anything, mock.Anything).Return(&model.MessagePage{}, nil)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetMessageManager").Return(messages)
+	s := newTestServer(t, config.Console{}, mockFactory)
+
+	w := serve(s, httptest.NewRequest(http.MethodGet, "/api/v1/messages?topic=orders&messageId=msg-1&maxBodyBytes=8", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Items []map[string]any `json:"items"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, `{"amount`, page.Items[0]["body"])
+	assert.Equal(t, "text", page.Items[0]["bodyFormat"])
+	assert.Equal(t, float64(13), page.Items[0]["bodySize"])
+	assert.Equal(t, true, page.Items[0]["truncated"])
+	assert.Equal(t, "application/json", page.Items[0]["contentType"])
+
+	w = serve(s, httptest.NewRequest(http.MethodGet, "/api/v1/messages?topic=orders&format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The raw body is downloaded in full
+	w = serve(s, httptest.NewRequest(http.MethodGet, "/api/v1/topics/orders/messages/msg-1/body", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"amount":42}`, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), `filename=msg-1.json`)
+
+	w = serve(s, httptest.NewRequest(http.MethodGet, "/api/v1/topics/orders/messages/missing/body", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,6 +1,36 @@
 import axios from 'axios'
 
-const BASE_URL = ''
+const BASE_URL = '/api/v1'
+
+// 错误响应的 error 对象，code 为 invalid_argument、not_found 等固定取值
+export interface APIError {
+  code: string
+  message: string
+  details?: unknown
+}
+
+// 所有列表接口的响应格式，total 和 nextCursor 只在支持时返回
+export interface Page<T> {
+  items: T[]
+  total?: number
+  nextCursor?: string
+}
+
+// 将错误响应中的 error.message 作为错误信息
+axios.interceptors.response.use(undefined, (error) => {
+  const apiError: APIError | undefined = error.response?.data?.error
+  return Promise.reject(apiError?.message ? new Error(apiError.message) : error)
+})
+
+export interface Principal {
+  name: string
+  role: 'viewer' | 'operator' | 'admin'
+}
+
+export const getCurrentUser = async (): Promise<Principal> => {
+  const response = await axios.get(`${BASE_URL}/me`)
+  return response.data
+}
 
 export interface TopicData {
   topic: string
@@ -24,6 +54,7 @@ export interface SendMessageParams {
   tag: string
   key: string
   body: string
+  contentType?: string
 }
 
 export interface ConsumerGroup {
@@ -51,73 +82,67 @@ export interface ConsumerOffset {
   minOffset: number
 }
 
+// 消息内容的展示格式，auto 根据 Content-Type 消息头或内容自动选择
+export type BodyFormat = 'auto' | 'text' | 'json' | 'hex' | 'base64'
+
 export interface Message {
   messageId: string
   tag: string
   key: string
+  // 按 bodyFormat 渲染后的消息内容，超过 maxBodyBytes 时被截断
   body: string
+  bodyFormat: BodyFormat
+  bodySize: number
+  contentType?: string
+  truncated?: boolean
   bornTime: string
+  partition?: number
+  offset?: number
 }
 
 export interface QueryMessageParams {
-  pageNo: number
   pageSize: number
   topic: string
-  partition: number
+  partition?: number
   messageId?: string
   tag?: string
+  key?: string
+  from?: string
+  to?: string
+  cursor?: string
+  format?: BodyFormat
+  maxBodyBytes?: number
 }
 
 export const fetchTopics = async (): Promise<TopicData[]> => {
-  const response = await axios.get(`${BASE_URL}/api/topics`)
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
-  return response.data.topics
+  const response = await axios.get(`${BASE_URL}/topics`)
+  return response.data.items
 }
 
 export const createTopic = async (params: CreateTopicParams): Promise<void> => {
-  const response = await axios.post(`${BASE_URL}/api/topics`, params)
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
+  const response = await axios.post(`${BASE_URL}/topics`, params)
 }
 
 export const updateTopic = async (topic: string, params: UpdateTopicParams): Promise<void> => {
-  const response = await axios.put(`${BASE_URL}/api/topics/${topic}`, params)
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
+  const response = await axios.put(`${BASE_URL}/topics/${topic}`, params)
 }
 
 export const deleteTopic = async (topic: string): Promise<void> => {
-  const response = await axios.delete(`${BASE_URL}/api/topics/${topic}`)
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
+  const response = await axios.delete(`${BASE_URL}/topics/${topic}`)
 }
 
 export const sendMessage = async (topic: string, params: SendMessageParams): Promise<void> => {
-  const response = await axios.post(`${BASE_URL}/api/topics/${topic}/messages`, params)
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
+  const response = await axios.post(`${BASE_URL}/topics/${topic}/messages`, params)
 }
 
 export const getConsumerGroups = async (topic: string): Promise<ConsumerGroup[]> => {
-  const response = await axios.get(`${BASE_URL}/api/topics/${topic}/consumer-groups`)
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
-  return response.data.consumerGroups
+  const response = await axios.get(`${BASE_URL}/topics/${topic}/consumer-groups`)
+  return response.data.items
 }
 
 export const getPartitions = async (topic: string): Promise<Partition[]> => {
-  const response = await axios.get(`${BASE_URL}/api/topics/${topic}/partitions`)
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
-  return response.data.partitions
+  const response = await axios.get(`${BASE_URL}/topics/${topic}/partitions`)
+  return response.data.items
 }
 
 export const getConsumerGroupOffsets = async (
@@ -125,18 +150,173 @@ export const getConsumerGroupOffsets = async (
   group: string,
 ): Promise<ConsumerOffset[]> => {
   const response = await axios.get(
-    `${BASE_URL}/api/topics/${topic}/consumer-groups/${group}/offsets`,
+    `${BASE_URL}/topics/${topic}/consumer-groups/${group}/offsets`,
   )
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
-  return response.data.offsets
+  return response.data.items
 }
 
-export const queryMessages = async (params: QueryMessageParams): Promise<Message[]> => {
-  const response = await axios.get(`${BASE_URL}/api/messages`, { params })
-  if (response.data.error) {
-    throw new Error(response.data.error)
-  }
-  return response.data.messages
+// 删除没有活跃实例的消费组及其偏移量
+export const deleteConsumerGroup = async (topic: string, group: string): Promise<void> => {
+  const response = await axios.delete(
+    `${BASE_URL}/topics/${encodeURIComponent(topic)}/consumer-groups/${encodeURIComponent(group)}`,
+  )
+}
+
+// 将实例标记为不活跃，并把它的分区重新分配给其他实例
+export const evictConsumerInstance = async (topic: string, group: string, instanceId: string): Promise<void> => {
+  const response = await axios.post(
+    `${BASE_URL}/topics/${encodeURIComponent(topic)}/consumer-groups/${encodeURIComponent(group)}/instances/${encodeURIComponent(instanceId)}/evict`,
+  )
+}
+
+// 立即重新分配消费组的分区
+export const rebalanceConsumerGroup = async (topic: string, group: string): Promise<void> => {
+  const response = await axios.post(
+    `${BASE_URL}/topics/${encodeURIComponent(topic)}/consumer-groups/${encodeURIComponent(group)}/rebalance`,
+  )
+}
+
+// 跨分区搜索消息，按写入时间倒序；total 只在第一页返回，下一页使用 nextCursor
+export const queryMessages = async (params: QueryMessageParams): Promise<Page<Message>> => {
+  const response = await axios.get(`${BASE_URL}/messages`, { params })
+  return response.data
+}
+
+// 下载完整的原始消息内容
+export const messageBodyUrl = (topic: string, messageId: string): string =>
+  `${BASE_URL}/topics/${encodeURIComponent(topic)}/messages/${encodeURIComponent(messageId)}/body`
+
+export interface TailParams {
+  tag?: string
+  key?: string
+  format?: BodyFormat
+  maxBodyBytes?: number
+}
+
+// 通过 Server-Sent Events 实时接收 Topic 的新消息
+export const tailTopic = (topic: string, params: TailParams): EventSource => {
+  const query = new URLSearchParams()
+  if (params.tag) query.set('tag', params.tag)
+  if (params.key) query.set('key', params.key)
+  if (params.format) query.set('format', params.format)
+  if (params.maxBodyBytes) query.set('maxBodyBytes', String(params.maxBodyBytes))
+  return new EventSource(`${BASE_URL}/topics/${encodeURIComponent(topic)}/tail?${query}`, { withCredentials: true })
+}
+
+export interface MessageTraceEvent {
+  id: number
+  messageId: string
+  topic: string
+  event: string
+  group?: string
+  instanceId?: string
+  partition: number
+  offset: number
+  retryCount: number
+  result?: string
+  error?: string
+  delayTime?: string
+  time: string
+}
+
+export const getMessageTrace = async (messageId: string): Promise<MessageTraceEvent[]> => {
+  const response = await axios.get(`${BASE_URL}/messages/${encodeURIComponent(messageId)}/trace`)
+  return response.data.items
+}
+
+export interface AuditEntry {
+  id: number
+  user: string
+  role: string
+  action: string
+  target: string
+  before?: string
+  after?: string
+  result: 'success' | 'failure'
+  error?: string
+  clientIp: string
+  time: string
+}
+
+export interface AuditQueryParams {
+  user?: string
+  action?: string
+  target?: string
+  from?: string
+  to?: string
+  pageNo: number
+  pageSize: number
+}
+
+export const queryAuditLog = async (params: AuditQueryParams): Promise<Page<AuditEntry>> => {
+  const response = await axios.get(`${BASE_URL}/audit`, { params })
+  return response.data
+}
+
+// 重发一条消息，group 为空时发给 Topic 的所有消费组
+export const resendMessage = async (topic: string, messageId: string, group?: string): Promise<string> => {
+  const response = await axios.post(
+    `${BASE_URL}/topics/${encodeURIComponent(topic)}/messages/${encodeURIComponent(messageId)}/resend`,
+    { group: group || '' },
+  )
+  return response.data.messageId
+}
+
+export interface ReplayParams {
+  group: string
+  partition?: number
+  fromOffset?: number
+  toOffset?: number
+  from?: string
+  to?: string
+  dryRun?: boolean
+}
+
+export interface ReplayResult {
+  matched: number
+  replayed: number
+  dryRun: boolean
+}
+
+// 将一段位点或一个时间窗口内的消息重放给指定消费组，dryRun 时只统计条数
+export const replayMessages = async (topic: string, params: ReplayParams): Promise<ReplayResult> => {
+  const response = await axios.post(`${BASE_URL}/topics/${encodeURIComponent(topic)}/replay`, params)
+  return response.data
+}
+
+export interface WebhookSubscription {
+  topic: string
+  group: string
+  url: string
+  concurrency: number
+  rateLimit: number
+  timeoutMs: number
+  createdTime: string
+  updatedTime: string
+}
+
+export interface WebhookParams {
+  url: string
+  secret?: string
+  concurrency?: number
+  rateLimit?: number
+  timeoutMs?: number
+}
+
+export const fetchWebhooks = async (): Promise<WebhookSubscription[]> => {
+  const response = await axios.get(`${BASE_URL}/webhooks`)
+  return response.data.items
+}
+
+// 创建或修改一个 Webhook 订阅，修改时 secret 留空则沿用原密钥
+export const putWebhook = async (topic: string, group: string, params: WebhookParams): Promise<WebhookSubscription> => {
+  const response = await axios.put(
+    `${BASE_URL}/topics/${encodeURIComponent(topic)}/webhooks/${encodeURIComponent(group)}`,
+    params,
+  )
+  return response.data
+}
+
+export const deleteWebhook = async (topic: string, group: string): Promise<void> => {
+  await axios.delete(`${BASE_URL}/topics/${encodeURIComponent(topic)}/webhooks/${encodeURIComponent(group)}`)
 }
@@ -2,19 +2,27 @@ package console
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
+	"errors"
+	"fmt"
 	"io/fs"
 	"net/http"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/auth"
 	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/httpapi"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/message"
 	"github.com/wenzuojing/mqx/internal/model"
-	"k8s.io/klog"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
 )
 
 //go:embed console-web/dist/*
@@ -24,12 +32,21 @@ type ConsoleServer struct {
 	cfg     *config.Config
 	engine  *gin.Engine
 	factory interfaces.Factory
+	server  *http.Server
+	// authenticator is nil when no authentication is configured
+	authenticator auth.Authenticator
+	// closing is closed by Stop to end the streaming responses, which would otherwise hold up the shutdown
+	closing   chan struct{}
+	closeOnce sync.Once
+	// mounts are the route groups of other components served by the console
+	mounts []mount
 }
 
-// TopicListResponse represents the response structure for topic list
-type TopicListResponse struct {
-	Topics []Topic `json:"topics"`
-	Total  int64   `json:"total"`
+// mount is a route group served by the console for the users with a role
+type mount struct {
+	path     string
+	role     auth.Role
+	register func(gin.IRouter)
 }
 
 // Topic represents a message topic
@@ -40,6 +57,24 @@ type Topic struct {
 	MessageTotal  int64  `json:"messageTotal"`
 }
 
+// ConsumerGroup represents a consumer group of a topic
+type ConsumerGroup struct {
+	Group       string `json:"group"`
+	Delay       int64  `json:"delay"`
+	ClientCount int    `json:"clientCount"`
+}
+
+// ConsumerGroupOffset represents the progress of a consumer group on a partition
+type ConsumerGroupOffset struct {
+	Partition  int    `json:"partition"`
+	Offset     int64  `json:"offset"`
+	InstanceId string `json:"instanceId"`
+	Hostname   string `json:"hostname"`
+	Active     bool   `json:"active"`
+	MaxOffset  int64  `json:"maxOffset"`
+	MinOffset  int64  `json:"minOffset"`
+}
+
 type Partition struct {
 	Partition int                       `json:"partition"`
 	Stat      *interfaces.PartitionStat `json:"stat"`
@@ -47,9 +82,15 @@ type Partition struct {
 
 // SendMessageRequest represents the request structure for sending a message
 type SendMessageRequest struct {
-	Tag  string `json:"tag"`
-	Key  string `json:"key"`
-	Body string `json:"body" binding:"required"`
+	Tag         string `json:"tag"`
+	Key         string `json:"key"`
+	Body        string `json:"body" binding:"required"`
+	ContentType string `json:"contentType"` // Stored in the content type header when set
+}
+
+// SendMessageResponse represents the response structure for a sent or resent message
+type SendMessageResponse struct {
+	MessageID string `json:"messageId"`
 }
 
 // UpdateTopicRequest represents the request structure for updating topic metadata
@@ -64,37 +105,93 @@ type CreateTopicRequest struct {
 	RetentionDays int    `json:"retentionDays" binding:"required"`
 }
 
-func NewConsoleServer(cfg *config.Config, factory interfaces.Factory) *ConsoleServer {
+func NewConsoleServer(cfg *config.Config, factory interfaces.Factory) (*ConsoleServer, error) {
+	authenticator, err := newAuthenticator(cfg.Console)
+	if err != nil {
+		return nil, err
+	}
+
 	engine := gin.Default()
+	// ClientIP, recorded in the audit log, only honours forwarding headers from the trusted proxies
+	var trustedProxies []string
+	if cfg.Console.Proxy != nil {
+		trustedProxies = cfg.Console.Proxy.TrustedProxies
+	}
+	if err := engine.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, err
+	}
 
-	// Add CORS middleware
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowAllOrigins = true
-	corsConfig.AllowMethods = []string{"*"}
-	corsConfig.AllowHeaders = []string{"*"}
-	engine.Use(cors.New(corsConfig))
+	// Add CORS middleware for the allowed origins; without any only same-origin requests work
+	if origins := cfg.Console.AllowedOrigins; len(origins) > 0 {
+		corsConfig := cors.DefaultConfig()
+		if slices.Contains(origins, "*") {
+			corsConfig.AllowAllOrigins = true
+		} else {
+			corsConfig.AllowOrigins = origins
+			corsConfig.AllowCredentials = true
+		}
+		corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+		engine.Use(cors.New(corsConfig))
+	}
 
 	return &ConsoleServer{
-		cfg:     cfg,
-		engine:  engine,
-		factory: factory,
-	}
+		cfg:           cfg,
+		engine:        engine,
+		factory:       factory,
+		authenticator: authenticator,
+		closing:       make(chan struct{}),
+	}, nil
 }
 
 func (s *ConsoleServer) Start(ctx context.Context) error {
+	logger := s.factory.GetLogger()
+	if s.authenticator == nil {
+		logger.Warn("Console authentication is disabled, every request acts as admin", "address", s.cfg.Console.Address)
+	}
+
 	// Setup routes
 	s.setupRoutes()
 
-	// Start HTTP server
+	// Start HTTP server, with TLS when a certificate is configured
+	s.server = &http.Server{Addr: s.cfg.Console.Address, Handler: s.engine}
+	useTLS := s.cfg.Console.TLSCertFile != "" || s.cfg.Console.TLSKeyFile != ""
+	if useTLS {
+		cert, err := tls.LoadX509KeyPair(s.cfg.Console.TLSCertFile, s.cfg.Console.TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load console TLS certificate: %w", err)
+		}
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
 	go func() {
-		if err := s.engine.Run(s.cfg.Console.Address); err != nil {
-			klog.Errorf("Failed to start console server: %v", err)
+		var err error
+		if useTLS {
+			err = s.server.ListenAndServeTLS("", "")
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("Failed to start console server", "address", s.cfg.Console.Address, "error", err)
 		}
 	}()
 
 	return nil
 }
 
+// Mount serves the routes added by register under path, authenticated like the console API and
+// limited to the users with role. It must be called before Start.
+func (s *ConsoleServer) Mount(path string, role auth.Role, register func(gin.IRouter)) {
+	s.mounts = append(s.mounts, mount{path: path, role: role, register: register})
+}
+
+// Stop shuts the HTTP server down, waiting for active requests up to the ctx deadline
+func (s *ConsoleServer) Stop(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.closing) })
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
+
 func (s *ConsoleServer) setupRoutes() {
 
 	sub, err := fs.Sub(StaticFiles, "console-web/dist")
@@ -104,62 +201,179 @@ func (s *ConsoleServer) setupRoutes() {
 
 	s.engine.NoRoute(func(c *gin.Context) {
 		path := c.Request.URL.Path
+		if strings.HasPrefix(path, "/api/") || slices.ContainsFunc(s.mounts, func(m mount) bool { return strings.HasPrefix(path, m.path+"/") }) {
+			httpapi.WriteError(c, http.StatusNotFound, "no route for "+c.Request.Method+" "+path)
+			return
+		}
 		c.FileFromFS(path, http.FS(sub))
 	})
 
-	// API group
-	api := s.engine.Group("/api")
-	{
-		// Topic endpoints
-		api.GET("/topics", s.listTopics)
-		api.PUT("/topics/:topic", s.updateTopic)
-		api.POST("/topics", s.createTopic)
-		api.DELETE("/topics/:topic", s.deleteTopic)
-		// Message endpoints
-		api.POST("/topics/:topic/messages", s.sendMessage)
+	s.engine.Use(s.authenticate)
 
-		api.GET("/topics/:topic/consumer-groups", s.listConsumerGroups)
-		api.GET("/topics/:topic/consumer-groups/:group/offsets", s.listConsumerGroupOffsets)
-		api.GET("/topics/:topic/partitions", s.listPartitions)
+	// Prometheus metrics
+	s.engine.GET("/metrics", s.require(auth.RoleViewer), gin.WrapH(s.factory.GetMetrics().Handler()))
+	// Kubernetes probes, left open for the kubelet
+	s.engine.GET("/healthz", s.healthz)
+	s.engine.GET("/readyz", s.readyz)
 
-		api.GET("/messages", s.listMessages)
+	// OpenAPI document of the versioned API
+	s.engine.GET("/api/openapi.json", s.require(auth.RoleViewer), s.openAPI)
+
+	// API group, readable by every role; changes require the operator or admin role
+	s.registerAPI(s.engine.Group("/api/v1", s.require(auth.RoleViewer)))
+	// Unversioned aliases kept for the clients written before /api/v1, to be removed in the next release
+	s.registerAPI(s.engine.Group("/api", deprecated, s.require(auth.RoleViewer)))
+
+	for _, m := range s.mounts {
+		m.register(s.engine.Group(m.path, s.require(m.role)))
 	}
 }
 
-func (s *ConsoleServer) listMessages(c *gin.Context) {
+// registerAPI adds the routes of the console API to a group
+func (s *ConsoleServer) registerAPI(api *gin.RouterGroup) {
+	api.GET("/me", s.me)
+	// Topic endpoints
+	api.GET("/topics", s.listTopics)
+	api.PUT("/topics/:topic", s.require(auth.RoleAdmin), s.updateTopic)
+	api.POST("/topics", s.require(auth.RoleAdmin), s.createTopic)
+	api.DELETE("/topics/:topic", s.require(auth.RoleAdmin), s.deleteTopic)
+	// Message endpoints
+	api.POST("/topics/:topic/messages", s.require(auth.RoleOperator), s.sendMessage)
+	api.GET("/topics/:topic/messages/:messageId/body", s.downloadMessageBody)
+	api.POST("/topics/:topic/messages/:messageId/resend", s.require(auth.RoleOperator), s.resendMessage)
+	api.POST("/topics/:topic/replay", s.require(auth.RoleOperator), s.replayMessages)
+
+	api.GET("/topics/:topic/consumer-groups", s.listConsumerGroups)
+	api.GET("/topics/:topic/consumer-groups/:group/offsets", s.listConsumerGroupOffsets)
+	api.DELETE("/topics/:topic/consumer-groups/:group", s.require(auth.RoleAdmin), s.deleteConsumerGroup)
+	api.POST("/topics/:topic/consumer-groups/:group/instances/:instanceId/evict", s.require(auth.RoleOperator), s.evictConsumerInstance)
+	api.POST("/topics/:topic/consumer-groups/:group/rebalance", s.require(auth.RoleOperator), s.rebalanceConsumerGroup)
+	api.GET("/topics/:topic/partitions", s.listPartitions)
+	api.GET("/topics/:topic/tail", s.tailTopic)
+	// Webhook endpoints
+	api.GET("/webhooks", s.listWebhooks)
+	api.PUT("/topics/:topic/webhooks/:group", s.require(auth.RoleAdmin), s.putWebhook)
+	api.DELETE("/topics/:topic/webhooks/:group", s.require(auth.RoleAdmin), s.deleteWebhook)
+
+	api.GET("/messages", s.listMessages)
+	api.GET("/messages/:messageId/trace", s.getMessageTrace)
+
+	api.GET("/audit", s.require(auth.RoleAdmin), s.listAudit)
+}
 
+// deprecated marks the responses of the unversioned API routes, pointing to their /api/v1 successor
+func deprecated(c *gin.Context) {
+	c.Header("Deprecation", "true")
+	successor := "/api/v1" + strings.TrimPrefix(c.Request.URL.Path, "/api")
+	c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+}
+
+// listMessages handles the GET /api/v1/messages request, searching one or all partitions of a topic.
+// The total is returned with the first page; the next page is requested with the nextCursor of the previous one.
+// Bodies are rendered in the requested format and truncated to maxBodyBytes.
+func (s *ConsoleServer) listMessages(c *gin.Context) {
 	var params struct {
-		Topic     string `form:"topic" binding:"required"`
-		Partition int    `form:"partition"`
-		MessageID string `form:"messageId"`
-		Tag       string `form:"tag"`
-		PageNo    int    `form:"pageNo" binding:"required"`
-		PageSize  int    `form:"pageSize" binding:"required"`
+		Topic     string    `form:"topic" binding:"required"`
+		Partition *int      `form:"partition"`
+		MessageID string    `form:"messageId"`
+		Tag       string    `form:"tag"`
+		Key       string    `form:"key"`
+		From      time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+		To        time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+		Cursor    string    `form:"cursor"`
+		PageSize  int       `form:"pageSize,default=20" binding:"min=1,max=100"`
+		bodyOptions
 	}
 	if err := c.ShouldBindQuery(&params); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := s.factory.GetMessageManager().SearchMessages(c.Request.Context(), &model.MessageFilter{
+		Topic:     params.Topic,
+		Partition: params.Partition,
+		MessageID: params.MessageID,
+		Tag:       params.Tag,
+		Key:       params.Key,
+		From:      params.From,
+		To:        params.To,
+		Cursor:    params.Cursor,
+		PageSize:  params.PageSize,
+	})
+	if errors.Is(err, message.ErrInvalidCursor) || errors.Is(err, message.ErrInvalidPartition) || errors.Is(err, model.ErrInvalidTopic) {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, model.ErrTopicNotFound) {
+		httpapi.WriteError(c, http.StatusNotFound, err.Error())
 		return
 	}
-	total, messages, err := s.factory.GetMessageManager().QueryMessageForPage(c.Request.Context(), params.Topic, params.Partition, params.MessageID, params.Tag, params.PageNo, params.PageSize)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messages, "total": total})
+	c.JSON(http.StatusOK, newMessageViewPage(page, params.bodyOptions))
+}
+
+// healthz handles the liveness probe, failing only when a background loop is stuck
+func (s *ConsoleServer) healthz(c *gin.Context) {
+	report := s.factory.GetHealthChecker().Check(c.Request.Context())
+	s.writeHealth(c, report.Live, report)
+}
+
+// readyz handles the readiness probe, failing when any check or subscription is down
+func (s *ConsoleServer) readyz(c *gin.Context) {
+	report := s.factory.GetHealthChecker().Check(c.Request.Context())
+	s.writeHealth(c, report.Ready, report)
+}
+
+// healthSummary is the answer of a probe to the clients without the viewer role
+type healthSummary struct {
+	Status string `json:"status"`
+	Live   bool   `json:"live"`
+	Ready  bool   `json:"ready"`
+}
+
+// writeHealth answers a probe, with 503 when it fails. The probes are open for the kubelet, so only
+// the viewers get the full report, whose checks and subscriptions name topics, groups and errors.
+func (s *ConsoleServer) writeHealth(c *gin.Context, ok bool, report *model.HealthReport) {
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	if principal := principalFrom(c); principal != nil && principal.Role.Allows(auth.RoleViewer) {
+		c.JSON(status, report)
+		return
+	}
+	c.JSON(status, healthSummary{Status: report.Status, Live: report.Live, Ready: report.Ready})
+}
+
+// getMessageTrace handles the GET /api/v1/messages/:messageId/trace request
+func (s *ConsoleServer) getMessageTrace(c *gin.Context) {
+	events, err := s.factory.GetTraceManager().GetTrace(c.Request.Context(), c.Param("messageId"))
+	if errors.Is(err, msgtrace.ErrDisabled) {
+		httpapi.WriteError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, newPage(events, int64(len(events))))
 }
 
 func (s *ConsoleServer) listConsumerGroups(c *gin.Context) {
 	topic := c.Param("topic")
 	if topic == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "topic parameter is required"})
+		httpapi.WriteError(c, http.StatusBadRequest, "topic parameter is required")
 		return
 	}
 
 	heartbeatTimeoutSeconds := int(s.cfg.HeartbeatInterval.Seconds()) * 3
 	activeInstances, err := s.factory.GetConsumerManager().GetActiveConsumerInstances(c.Request.Context(), topic, "", heartbeatTimeoutSeconds)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 	groupInstanceCount := make(map[string]int)
@@ -169,22 +383,16 @@ func (s *ConsoleServer) listConsumerGroups(c *gin.Context) {
 
 	partitions, err := queryTopicPartitions(c.Request.Context(), s.factory, topic)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	consumerOffsets, err := s.factory.GetConsumerManager().GetConsumerOffsets(c.Request.Context(), topic, "")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	type ConsumerGroup struct {
-		Group       string `json:"group"`
-		Delay       int64  `json:"delay"`
-		ClientCount int    `json:"clientCount"`
-	}
-
 	max := func(a, b int64) int64 {
 		if a > b {
 			return a
@@ -222,27 +430,25 @@ func (s *ConsoleServer) listConsumerGroups(c *gin.Context) {
 		consumerGroups = append(consumerGroups, consumerGroup)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"consumerGroups": consumerGroups,
-	})
+	c.JSON(http.StatusOK, newPage(consumerGroups, int64(len(consumerGroups))))
 }
 
 func (s *ConsoleServer) listConsumerGroupOffsets(c *gin.Context) {
 	topic := c.Param("topic")
 	if topic == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "topic parameter is required"})
+		httpapi.WriteError(c, http.StatusBadRequest, "topic parameter is required")
 		return
 	}
 
 	group := c.Param("group")
 	if group == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "group parameter is required"})
+		httpapi.WriteError(c, http.StatusBadRequest, "group parameter is required")
 		return
 	}
 
 	partitions, err := queryTopicPartitions(c.Request.Context(), s.factory, topic)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -253,7 +459,7 @@ func (s *ConsoleServer) listConsumerGroupOffsets(c *gin.Context) {
 
 	consumerInstances, err := s.factory.GetConsumerManager().GetConsumerInstances(c.Request.Context(), topic, group)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 	instanceMap := make(map[string]*model.ConsumerInstance)
@@ -265,7 +471,7 @@ func (s *ConsoleServer) listConsumerGroupOffsets(c *gin.Context) {
 
 	consumerOffsets, err := s.factory.GetConsumerManager().GetConsumerOffsets(c.Request.Context(), topic, group)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -274,21 +480,11 @@ func (s *ConsoleServer) listConsumerGroupOffsets(c *gin.Context) {
 		partitionMap[offset.Partition] = &offset
 	}
 
-	type Offset struct {
-		Partition  int    `json:"partition"`
-		Offset     int64  `json:"offset"`
-		InstanceId string `json:"instanceId"`
-		Hostname   string `json:"hostname"`
-		Active     bool   `json:"active"`
-		MaxOffset  int64  `json:"maxOffset"`
-		MinOffset  int64  `json:"minOffset"`
-	}
-
-	var offsets []Offset
+	var offsets []ConsumerGroupOffset
 	for _, partition := range partitions {
 		consumerPartition := partitionMap[partition.Partition]
 
-		offset := Offset{
+		offset := ConsumerGroupOffset{
 			Partition: partition.Partition,
 		}
 
@@ -310,29 +506,29 @@ func (s *ConsoleServer) listConsumerGroupOffsets(c *gin.Context) {
 
 	}
 
-	c.JSON(http.StatusOK, gin.H{"offsets": offsets})
+	c.JSON(http.StatusOK, newPage(offsets, int64(len(offsets))))
 }
 
 func (s *ConsoleServer) listPartitions(c *gin.Context) {
 	topic := c.Param("topic")
 	if topic == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "topic parameter is required"})
+		httpapi.WriteError(c, http.StatusBadRequest, "topic parameter is required")
 		return
 	}
 
 	partitions, err := queryTopicPartitions(c.Request.Context(), s.factory, topic)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"partitions": partitions})
+	c.JSON(http.StatusOK, newPage(partitions, int64(len(partitions))))
 }
 
-// listTopics handles the GET /api/topics request
+// listTopics handles the GET /api/v1/topics request
 func (s *ConsoleServer) listTopics(c *gin.Context) {
 	topicMetas, err := s.factory.GetTopicManager().GetAllTopicMeta(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -353,7 +549,7 @@ func (s *ConsoleServer) listTopics(c *gin.Context) {
 				defer wg.Done()
 				stat, err := s.factory.GetMessageManager().GetPartitionStat(context.Background(), t.Topic, partition)
 				if err != nil {
-					klog.Errorf("Failed to get message total for topic %s partition %d: %v", t.Topic, partition, err)
+					s.factory.GetLogger().Error("Failed to get message total", "topic", t.Topic, "partition", partition, "error", err)
 					return
 				}
 				mu.Lock()
@@ -365,23 +561,20 @@ func (s *ConsoleServer) listTopics(c *gin.Context) {
 		topics = append(topics, topic)
 	}
 
-	c.JSON(http.StatusOK, TopicListResponse{
-		Topics: topics,
-		Total:  int64(len(topics)),
-	})
+	c.JSON(http.StatusOK, newPage(topics, int64(len(topics))))
 }
 
-// sendMessage handles the POST /api/messages request
+// sendMessage handles the POST /api/v1/topics/:topic/messages request
 func (s *ConsoleServer) sendMessage(c *gin.Context) {
 	topic := c.Param("topic")
 	if topic == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "topic parameter is required"})
+		httpapi.WriteError(c, http.StatusBadRequest, "topic parameter is required")
 		return
 	}
 
 	var req SendMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -392,29 +585,36 @@ func (s *ConsoleServer) sendMessage(c *gin.Context) {
 		Body:     []byte(req.Body),
 		BornTime: time.Now(),
 	}
+	if req.ContentType != "" {
+		msg.Headers = map[string]string{model.HeaderContentType: req.ContentType}
+	}
 
 	messageID, err := s.factory.GetProducerManager().SendSync(c.Request.Context(), msg)
+	// The body is left out of the audit log, it may hold sensitive data
+	s.audit(c, ActionMessageSend, topic, nil, gin.H{"messageId": messageID, "tag": req.Tag, "key": req.Key, "bodyBytes": len(req.Body)}, err)
+	if errors.Is(err, model.ErrInvalidTopic) {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"messageId": messageID,
-	})
+	c.JSON(http.StatusOK, SendMessageResponse{MessageID: messageID})
 }
 
-// updateTopic handles the PUT /api/topics request
+// updateTopic handles the PUT /api/v1/topics/:topic request
 func (s *ConsoleServer) updateTopic(c *gin.Context) {
 	topic := c.Param("topic")
 	if topic == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "topic parameter is required"})
+		httpapi.WriteError(c, http.StatusBadRequest, "topic parameter is required")
 		return
 	}
 
 	var req UpdateTopicRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -424,20 +624,23 @@ func (s *ConsoleServer) updateTopic(c *gin.Context) {
 		RetentionDays: req.RetentionDays,
 	}
 
-	if err := s.factory.GetTopicManager().UpdateTopicMeta(c.Request.Context(), topicMeta); err != nil {
-		klog.Errorf("Failed to update topic: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	before, _ := s.factory.GetTopicManager().GetTopicMeta(c.Request.Context(), topic)
+	err := s.factory.GetTopicManager().UpdateTopicMeta(c.Request.Context(), topicMeta)
+	s.audit(c, ActionTopicUpdate, topic, before, topicMeta, err)
+	if err != nil {
+		s.factory.GetLogger().Error("Failed to update topic", "error", err)
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Topic updated successfully"})
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Topic updated successfully"})
 }
 
-// createTopic handles the POST /api/topics request
+// createTopic handles the POST /api/v1/topics request
 func (s *ConsoleServer) createTopic(c *gin.Context) {
 	var req CreateTopicRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -447,30 +650,35 @@ func (s *ConsoleServer) createTopic(c *gin.Context) {
 		RetentionDays: req.RetentionDays,
 	}
 
-	if err := s.factory.GetTopicManager().CreateTopic(c.Request.Context(), topicMeta); err != nil {
-		klog.Errorf("Failed to create topic: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	err := s.factory.GetTopicManager().CreateTopic(c.Request.Context(), topicMeta)
+	s.audit(c, ActionTopicCreate, req.Topic, nil, topicMeta, err)
+	if err != nil {
+		s.factory.GetLogger().Error("Failed to create topic", "error", err)
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Topic created successfully"})
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Topic created successfully"})
 }
 
-// deleteTopic handles the DELETE /api/topics request
+// deleteTopic handles the DELETE /api/v1/topics/:topic request
 func (s *ConsoleServer) deleteTopic(c *gin.Context) {
 	topic := c.Param("topic")
 	if topic == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "topic parameter is required"})
+		httpapi.WriteError(c, http.StatusBadRequest, "topic parameter is required")
 		return
 	}
 
-	if err := s.factory.GetTopicManager().DeleteTopic(c.Request.Context(), topic); err != nil {
-		klog.Errorf("Failed to delete topic: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	before, _ := s.factory.GetTopicManager().GetTopicMeta(c.Request.Context(), topic)
+	err := s.factory.GetTopicManager().DeleteTopic(c.Request.Context(), topic)
+	s.audit(c, ActionTopicDelete, topic, before, nil, err)
+	if err != nil {
+		s.factory.GetLogger().Error("Failed to delete topic", "error", err)
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Topic deleted successfully"})
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Topic deleted successfully"})
 }
 
 func queryTopicPartitions(ctx context.Context, factory interfaces.Factory, topic string) ([]Partition, error) {
@@ -0,0 +1,67 @@
+package console
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+)
+
+// groupStatus maps the errors of the consumer group administration to HTTP status codes
+func groupStatus(err error) int {
+	switch {
+	case errors.Is(err, consumer.ErrInstanceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, consumer.ErrGroupActive), errors.Is(err, consumer.ErrNoActiveInstances):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// deleteConsumerGroup handles the DELETE /api/v1/topics/:topic/consumer-groups/:group request.
+// Only a group without active instances can be deleted; its offsets are recorded in the audit log.
+func (s *ConsoleServer) deleteConsumerGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+	topic, group := c.Param("topic"), c.Param("group")
+	before, _ := s.factory.GetConsumerManager().GetConsumerOffsets(ctx, topic, group)
+
+	err := s.factory.GetConsumerManager().DeleteGroup(ctx, topic, group)
+	s.audit(c, ActionGroupDelete, topic+"/"+group, before, nil, err)
+	if err != nil {
+		httpapi.WriteError(c, groupStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Consumer group deleted successfully"})
+}
+
+// evictConsumerInstance handles the POST /api/v1/topics/:topic/consumer-groups/:group/instances/:instanceId/evict request
+func (s *ConsoleServer) evictConsumerInstance(c *gin.Context) {
+	topic, group, instanceID := c.Param("topic"), c.Param("group"), c.Param("instanceId")
+
+	err := s.factory.GetConsumerManager().EvictInstance(c.Request.Context(), topic, group, instanceID)
+	s.audit(c, ActionGroupEvict, topic+"/"+group, nil, gin.H{"instanceId": instanceID}, err)
+	if err != nil {
+		httpapi.WriteError(c, groupStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Consumer instance evicted successfully"})
+}
+
+// rebalanceConsumerGroup handles the POST /api/v1/topics/:topic/consumer-groups/:group/rebalance request
+func (s *ConsoleServer) rebalanceConsumerGroup(c *gin.Context) {
+	topic, group := c.Param("topic"), c.Param("group")
+
+	err := s.factory.GetConsumerManager().Rebalance(c.Request.Context(), topic, group)
+	s.audit(c, ActionGroupRebalance, topic+"/"+group, nil, nil, err)
+	if err != nil {
+		httpapi.WriteError(c, groupStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Consumer group rebalanced successfully"})
+}
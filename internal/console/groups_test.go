@@ -0,0 +1,80 @@
+package console
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func (m *MockFactory) GetConsumerManager() interfaces.ConsumerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ConsumerManager)
+}
+
+// MockConsumerManager implements interfaces.ConsumerManager for testing
+type MockConsumerManager struct {
+	mock.Mock
+	interfaces.ConsumerManager
+}
+
+func (m *MockConsumerManager) GetConsumerOffsets(ctx context.Context, topic string, group string) ([]model.ConsumerOffset, error) {
+	args := m.Called(ctx, topic, group)
+	offsets, _ := args.Get(0).([]model.ConsumerOffset)
+	return offsets, args.Error(1)
+}
+
+func (m *MockConsumerManager) DeleteGroup(ctx context.Context, topic string, group string) error {
+	args := m.Called(ctx, topic, group)
+	return args.Error(0)
+}
+
+func (m *MockConsumerManager) EvictInstance(ctx context.Context, topic string, group string, instanceID string) error {
+	args := m.Called(ctx, topic, group, instanceID)
+	return args.Error(0)
+}
+
+func (m *MockConsumerManager) Rebalance(ctx context.Context, topic string, group string) error {
+	args := m.Called(ctx, topic, group)
+	return args.Error(0)
+}
+
+func TestConsoleServer_ConsumerGroupActions(t *testing.T) {
+	consumers := new(MockConsumerManager)
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", "billing").
+		Return([]model.ConsumerOffset{{Topic: "orders", Group: "billing", Partition: 0, Offset: 41}}, nil)
+	consumers.On("DeleteGroup", mock.Anything, "orders", "billing").Return(consumer.ErrGroupActive).Once()
+	consumers.On("DeleteGroup", mock.Anything, "orders", "billing").Return(nil).Once()
+	consumers.On("EvictInstance", mock.Anything, "orders", "billing", "gone").Return(consumer.ErrInstanceNotFound)
+	consumers.On("Rebalance", mock.Anything, "orders", "billing").Return(nil)
+	auditManager := new(MockAuditManager)
+	auditManager.On("Record", mock.Anything, mock.Anything).Return(nil)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetConsumerManager").Return(consumers)
+	mockFactory.On("GetAuditManager").Return(auditManager)
+	s := newTestServer(t, config.Console{}, mockFactory)
+
+	w := serve(s, httptest.NewRequest(http.MethodDelete, "/api/v1/topics/orders/consumer-groups/billing", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = serve(s, httptest.NewRequest(http.MethodDelete, "/api/v1/topics/orders/consumer-groups/billing", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	entry := auditManager.Calls[1].Arguments.Get(1).(*model.AuditEntry)
+	assert.Equal(t, ActionGroupDelete, entry.Action)
+	assert.Equal(t, "orders/billing", entry.Target)
+	// The deleted offsets are kept in the audit log
+	assert.Contains(t, entry.Before, `"offset":41`)
+
+	w = serve(s, httptest.NewRequest(http.MethodPost, "/api/v1/topics/orders/consumer-groups/billing/instances/gone/evict", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve(s, httptest.NewRequest(http.MethodPost, "/api/v1/topics/orders/consumer-groups/billing/rebalance", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, auditManager.Calls, 4)
+	consumers.AssertExpectations(t)
+}
@@ -0,0 +1,18 @@
+package console
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIDocument is the OpenAPI 3 description of the /api/v1 routes
+//
+//go:embed openapi.json
+var OpenAPIDocument []byte
+
+// openAPI handles the GET /api/openapi.json request
+func (s *ConsoleServer) openAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", OpenAPIDocument)
+}
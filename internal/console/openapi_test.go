@@ -0,0 +1,311 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+	"github.com/wenzuojing/mqx/internal/replay"
+	"github.com/wenzuojing/mqx/internal/webhook"
+)
+
+func (m *MockFactory) GetProducerManager() interfaces.ProducerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ProducerManager)
+}
+
+func (m *MockFactory) GetTraceManager() *msgtrace.Manager {
+	return nil
+}
+
+func (m *MockTopicManager) GetAllTopicMeta(ctx context.Context) ([]model.TopicMeta, error) {
+	args := m.Called(ctx)
+	metas, _ := args.Get(0).([]model.TopicMeta)
+	return metas, args.Error(1)
+}
+
+func (m *MockTopicManager) CreateTopic(ctx context.Context, meta *model.TopicMeta) error {
+	args := m.Called(ctx, meta)
+	return args.Error(0)
+}
+
+func (m *MockTopicManager) UpdateTopicMeta(ctx context.Context, meta *model.TopicMeta) error {
+	args := m.Called(ctx, meta)
+	return args.Error(0)
+}
+
+func (m *MockConsumerManager) GetConsumerInstances(ctx context.Context, topic string, group string) ([]model.ConsumerInstance, error) {
+	args := m.Called(ctx, topic, group)
+	instances, _ := args.Get(0).([]model.ConsumerInstance)
+	return instances, args.Error(1)
+}
+
+func (m *MockConsumerManager) GetActiveConsumerInstances(ctx context.Context, topic string, group string, heartbeatTimeoutSeconds int) ([]model.ConsumerInstance, error) {
+	args := m.Called(ctx, topic, group, heartbeatTimeoutSeconds)
+	instances, _ := args.Get(0).([]model.ConsumerInstance)
+	return instances, args.Error(1)
+}
+
+func (m *MockAuditManager) Query(ctx context.Context, filter *model.AuditFilter) (int64, []*model.AuditEntry, error) {
+	args := m.Called(ctx, filter)
+	entries, _ := args.Get(1).([]*model.AuditEntry)
+	return args.Get(0).(int64), entries, args.Error(2)
+}
+
+// MockProducerManager implements interfaces.ProducerManager for testing
+type MockProducerManager struct {
+	mock.Mock
+	interfaces.ProducerManager
+}
+
+func (m *MockProducerManager) SendSync(ctx context.Context, msg *model.Message) (string, error) {
+	args := m.Called(ctx, msg)
+	return args.String(0), args.Error(1)
+}
+
+func loadOpenAPIDocument(t *testing.T) *openapi3.T {
+	doc, err := openapi3.NewLoader().LoadFromData(OpenAPIDocument)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+	return doc
+}
+
+func TestOpenAPIDocument_CoversRoutes(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	s := newTestServer(t, config.Console{}, new(MockFactory))
+
+	param := regexp.MustCompile(`:(\w+)`)
+	routes := make(map[string]bool)
+	for _, route := range s.engine.Routes() {
+		path, ok := strings.CutPrefix(route.Path, "/api/v1")
+		if !ok {
+			continue
+		}
+		path = param.ReplaceAllString(path, "{$1}")
+		routes[route.Method+" "+path] = true
+		item := doc.Paths.Find(path)
+		if assert.NotNil(t, item, "route %s %s is not documented", route.Method, route.Path) {
+			assert.NotNil(t, item.GetOperation(route.Method), "route %s %s is not documented", route.Method, route.Path)
+		}
+	}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			assert.True(t, routes[method+" "+path], "operation %s %s has no route", method, path)
+		}
+	}
+}
+
+func TestConsoleServer_OpenAPIDocument(t *testing.T) {
+	s := newTestServer(t, config.Console{}, new(MockFactory))
+
+	w := serve(s, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, OpenAPIDocument, w.Body.Bytes())
+
+	// Unknown API routes get an error object rather than the web app
+	w = serve(s, httptest.NewRequest(http.MethodGet, "/api/v1/queues", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":{"code":"not_found","message":"no route for GET /api/v1/queues"}}`, w.Body.String())
+}
+
+func TestConsoleServer_DeprecatedRoutes(t *testing.T) {
+	s := newTestServer(t, config.Console{}, new(MockFactory))
+
+	w := serve(s, httptest.NewRequest(http.MethodGet, "/api/v1/me", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+
+	// The unversioned routes of the previous release answer like /api/v1 and point to it
+	w = serve(s, httptest.NewRequest(http.MethodGet, "/api/me", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v1/me>; rel="successor-version"`, w.Header().Get("Link"))
+	assert.JSONEq(t, `{"name":"anonymous","role":"admin"}`, w.Body.String())
+
+	// Every versioned route has its alias
+	routes := make(map[string]bool)
+	for _, route := range s.engine.Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+	for _, route := range s.engine.Routes() {
+		if path, ok := strings.CutPrefix(route.Path, "/api/v1/"); ok {
+			assert.True(t, routes[route.Method+" /api/"+path], "route %s %s has no alias", route.Method, route.Path)
+		}
+	}
+}
+
+// TestConsoleServer_Contract validates the requests and responses of every operation against the OpenAPI document
+func TestConsoleServer_Contract(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	// Match the relative server URL against the test requests
+	doc.Servers = openapi3.Servers{{URL: "http://console.test/api/v1"}}
+	router, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+
+	now := time.Now()
+	total := int64(2)
+	topics := new(MockTopicManager)
+	topics.On("GetAllTopicMeta", mock.Anything).Return([]model.TopicMeta{{Topic: "orders", PartitionNum: 1, RetentionDays: 7}}, nil)
+	topics.On("GetTopicMeta", mock.Anything, "orders").Return(&model.TopicMeta{Topic: "orders", PartitionNum: 1, RetentionDays: 7}, nil)
+	topics.On("CreateTopic", mock.Anything, mock.Anything).Return(nil)
+	topics.On("UpdateTopicMeta", mock.Anything, mock.Anything).Return(nil)
+	topics.On("DeleteTopic", mock.Anything, "orders").Return(nil)
+	messages := new(MockMessageManager)
+	messages.On("GetPartitionStat", mock.Anything, "orders", 0).Return(&interfaces.PartitionStat{MaxOffset: 42, MinOffset: 1, Total: 42}, nil)
+	messages.On("SearchMessages", mock.Anything, mock.MatchedBy(func(f *model.MessageFilter) bool { return f.MessageID == "missing" })).
+		Return(&model.MessagePage{}, nil)
+	messages.On("SearchMessages", mock.Anything, mock.Anything).Return(&model.MessagePage{
+		Messages: []*model.Message{{
+			MessageID: "msg-1", Topic: "orders", Tag: "paid", Body: []byte(`{"amount":42}`), BornTime: now, Offset: 42,
+			Headers: map[string]string{model.HeaderContentType: "application/json"},
+		}},
+		Total:      &total,
+		NextCursor: "next",
+	}, nil)
+	consumers := new(MockConsumerManager)
+	consumers.On("GetActiveConsumerInstances", mock.Anything, "orders", "", mock.Anything).
+		Return([]model.ConsumerInstance{{Group: "billing", Topic: "orders", InstanceID: "a", Active: true, Heartbeat: now}}, nil)
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", mock.Anything).
+		Return([]model.ConsumerOffset{{Group: "billing", Topic: "orders", Partition: 0, Offset: 40, InstanceID: "a"}}, nil)
+	consumers.On("GetConsumerInstances", mock.Anything, "orders", "billing").
+		Return([]model.ConsumerInstance{{Group: "billing", Topic: "orders", InstanceID: "a", Hostname: "host-a", Active: true, Heartbeat: now}}, nil)
+	consumers.On("DeleteGroup", mock.Anything, "orders", "billing").Return(consumer.ErrGroupActive)
+	consumers.On("EvictInstance", mock.Anything, "orders", "billing", "a").Return(nil)
+	consumers.On("Rebalance", mock.Anything, "orders", "billing").Return(nil)
+	producer := new(MockProducerManager)
+	producer.On("SendSync", mock.Anything, mock.Anything).Return("msg-2", nil)
+	replays := new(MockReplayManager)
+	replays.On("Resend", mock.Anything, "orders", "msg-1", "").Return("msg-3", nil)
+	replays.On("Replay", mock.Anything, mock.Anything).Return(&model.ReplayResult{Matched: 10, Replayed: 4}, replay.ErrReplayTooLarge)
+	audits := new(MockAuditManager)
+	audits.On("Record", mock.Anything, mock.Anything).Return(nil)
+	audits.On("Query", mock.Anything, mock.Anything).Return(int64(1), []*model.AuditEntry{{
+		ID: 1, User: "ops", Role: "admin", Action: ActionTopicCreate, Target: "orders", Result: model.AuditResultSuccess, Time: now,
+	}}, nil)
+	webhooks := new(MockWebhookManager)
+	webhooks.On("GetSubscriptions", mock.Anything).Return([]*model.WebhookSubscription{{
+		Topic: "orders", Group: "billing", URL: "https://example.com/hook", Concurrency: 4, CreatedTime: now, UpdatedTime: now,
+	}}, nil)
+	webhooks.On("GetSubscription", mock.Anything, "orders", "billing").Return(nil, webhook.ErrSubscriptionNotFound)
+	webhooks.On("Subscribe", mock.Anything, mock.Anything).Return(nil)
+	webhooks.On("Unsubscribe", mock.Anything, "orders", "billing").Return(webhook.ErrSubscriptionNotFound)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetTopicManager").Return(topics)
+	mockFactory.On("GetMessageManager").Return(messages)
+	mockFactory.On("GetConsumerManager").Return(consumers)
+	mockFactory.On("GetProducerManager").Return(producer)
+	mockFactory.On("GetReplayManager").Return(replays)
+	mockFactory.On("GetAuditManager").Return(audits)
+	mockFactory.On("GetWebhookManager").Return(webhooks)
+	s := newTestServer(t, config.Console{}, mockFactory)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/me", "", http.StatusOK},
+		{http.MethodGet, "/topics", "", http.StatusOK},
+		{http.MethodPost, "/topics", `{"topic":"orders","partitionNum":1,"retentionDays":7}`, http.StatusOK},
+		{http.MethodPost, "/topics", `{"topic":"orders"}`, http.StatusBadRequest},
+		{http.MethodPut, "/topics/orders", `{"partitionNum":2,"retentionDays":7}`, http.StatusOK},
+		{http.MethodDelete, "/topics/orders", "", http.StatusOK},
+		{http.MethodGet, "/topics/orders/partitions", "", http.StatusOK},
+		{http.MethodPost, "/topics/orders/messages", `{"tag":"paid","body":"{}","contentType":"application/json"}`, http.StatusOK},
+		{http.MethodGet, "/topics/orders/messages/msg-1/body", "", http.StatusOK},
+		{http.MethodGet, "/topics/orders/messages/missing/body", "", http.StatusNotFound},
+		{http.MethodPost, "/topics/orders/messages/msg-1/resend", "", http.StatusOK},
+		{http.MethodPost, "/topics/orders/replay", `{"group":"billing","from":"2024-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{http.MethodGet, "/topics/orders/consumer-groups", "", http.StatusOK},
+		{http.MethodGet, "/topics/orders/consumer-groups/billing/offsets", "", http.StatusOK},
+		{http.MethodDelete, "/topics/orders/consumer-groups/billing", "", http.StatusConflict},
+		{http.MethodPost, "/topics/orders/consumer-groups/billing/instances/a/evict", "", http.StatusOK},
+		{http.MethodPost, "/topics/orders/consumer-groups/billing/rebalance", "", http.StatusOK},
+		{http.MethodGet, "/webhooks", "", http.StatusOK},
+		{http.MethodPut, "/topics/orders/webhooks/billing", `{"url":"https://example.com/hook","secret":"s","concurrency":4,"rateLimit":2.5}`, http.StatusOK},
+		{http.MethodPut, "/topics/orders/webhooks/billing", `{"url":"https://example.com/hook","concurrency":-1}`, http.StatusBadRequest},
+		{http.MethodDelete, "/topics/orders/webhooks/billing", "", http.StatusNotFound},
+		{http.MethodGet, "/messages?topic=orders&format=json&maxBodyBytes=1024", "", http.StatusOK},
+		{http.MethodGet, "/messages?topic=orders&cursor=next&pageSize=1000", "", http.StatusBadRequest},
+		{http.MethodGet, "/messages/msg-1/trace", "", http.StatusNotFound},
+		{http.MethodGet, "/audit?user=ops&from=2024-01-01T00:00:00Z", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://console.test/api/v1"+tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			route, pathParams, err := router.FindRoute(req)
+			require.NoError(t, err)
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+			}
+			// Requests expected to fail validation are checked by the handlers only
+			if tt.status != http.StatusBadRequest {
+				require.NoError(t, openapi3filter.ValidateRequest(context.Background(), requestInput))
+			}
+			if tt.body != "" {
+				req.Body = io.NopCloser(strings.NewReader(tt.body))
+			}
+
+			w := serve(s, req)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 w.Code,
+				Header:                 w.Header(),
+				Body:                   io.NopCloser(w.Body),
+				Options: &openapi3filter.Options{
+					IncludeResponseStatus: true,
+					// The raw body of a message has the content type of the message
+					ExcludeResponseBody: strings.HasSuffix(tt.path, "/body") && w.Code == http.StatusOK,
+				},
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConsoleServer_ErrorResponse(t *testing.T) {
+	replays := new(MockReplayManager)
+	replays.On("Replay", mock.Anything, mock.Anything).Return(&model.ReplayResult{Matched: 10, Replayed: 4}, replay.ErrReplayTooLarge)
+	audits := new(MockAuditManager)
+	audits.On("Record", mock.Anything, mock.Anything).Return(nil)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetReplayManager").Return(replays)
+	mockFactory.On("GetAuditManager").Return(audits)
+	s := newTestServer(t, config.Console{}, mockFactory)
+
+	w := serve(s, httptest.NewRequest(http.MethodPost, "/api/v1/topics/orders/replay", strings.NewReader(`{"group":"billing","from":"2024-01-01T00:00:00Z"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response httpapi.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "invalid_argument", response.Error.Code)
+	assert.Equal(t, replay.ErrReplayTooLarge.Error(), response.Error.Message)
+	// A failed replay reports the copies already published
+	assert.Equal(t, map[string]any{"matched": float64(10), "replayed": float64(4), "dryRun": false}, response.Error.Details)
+}
@@ -0,0 +1,78 @@
+package console
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/message"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/replay"
+)
+
+// ResendMessageRequest represents the request structure for resending a message
+type ResendMessageRequest struct {
+	Group string `json:"group"` // Empty to resend to every group of the topic
+}
+
+// replayStatus maps the errors of the replay manager to HTTP status codes
+func replayStatus(err error) int {
+	switch {
+	case errors.Is(err, replay.ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, replay.ErrUnknownGroup), errors.Is(err, replay.ErrInvalidReplay),
+		errors.Is(err, replay.ErrReplayTooLarge), errors.Is(err, message.ErrInvalidPartition):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// resendMessage handles the POST /api/v1/topics/:topic/messages/:messageId/resend request
+func (s *ConsoleServer) resendMessage(c *gin.Context) {
+	topic, messageID := c.Param("topic"), c.Param("messageId")
+	var req ResendMessageRequest
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	copyID, err := s.factory.GetReplayManager().Resend(c.Request.Context(), topic, messageID, req.Group)
+	s.audit(c, ActionMessageResend, topic, nil, gin.H{"messageId": messageID, "group": req.Group, "copyId": copyID}, err)
+	if err != nil {
+		httpapi.WriteError(c, replayStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, SendMessageResponse{MessageID: copyID})
+}
+
+// replayMessages handles the POST /api/v1/topics/:topic/replay request.
+// Dry runs only count the selected messages and are not audited.
+func (s *ConsoleServer) replayMessages(c *gin.Context) {
+	var req model.ReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.Topic = c.Param("topic")
+
+	result, err := s.factory.GetReplayManager().Replay(c.Request.Context(), &req)
+	if !req.DryRun {
+		s.audit(c, ActionMessageReplay, req.Topic, nil, gin.H{"request": req, "result": result}, err)
+	}
+	if err != nil {
+		// A replay failing midway reports how many copies were published
+		status := replayStatus(err)
+		response := httpapi.NewErrorResponse(status, err.Error())
+		response.Error.Details = result
+		c.AbortWithStatusJSON(status, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,95 @@
+package console
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/replay"
+)
+
+func (m *MockFactory) GetReplayManager() interfaces.ReplayManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ReplayManager)
+}
+
+// MockReplayManager implements interfaces.ReplayManager for testing
+type MockReplayManager struct {
+	mock.Mock
+}
+
+func (m *MockReplayManager) Resend(ctx context.Context, topic string, messageID string, group string) (string, error) {
+	args := m.Called(ctx, topic, messageID, group)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockReplayManager) Replay(ctx context.Context, req *model.ReplayRequest) (*model.ReplayResult, error) {
+	args := m.Called(ctx, req)
+	result, _ := args.Get(0).(*model.ReplayResult)
+	return result, args.Error(1)
+}
+
+func (m *MockReplayManager) Redrive(ctx context.Context, req *model.RedriveRequest) (*model.ReplayResult, error) {
+	args := m.Called(ctx, req)
+	result, _ := args.Get(0).(*model.ReplayResult)
+	return result, args.Error(1)
+}
+
+func TestConsoleServer_Replay(t *testing.T) {
+	replayManager := new(MockReplayManager)
+	replayManager.On("Replay", mock.Anything, mock.MatchedBy(func(req *model.ReplayRequest) bool { return req.DryRun })).
+		Return(&model.ReplayResult{Matched: 42, DryRun: true}, nil)
+	replayManager.On("Replay", mock.Anything, mock.MatchedBy(func(req *model.ReplayRequest) bool { return !req.DryRun })).
+		Return(&model.ReplayResult{Matched: 42, Replayed: 42}, nil)
+	auditManager := new(MockAuditManager)
+	auditManager.On("Record", mock.Anything, mock.Anything).Return(nil)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetReplayManager").Return(replayManager)
+	mockFactory.On("GetAuditManager").Return(auditManager)
+	s := newTestServer(t, config.Console{}, mockFactory)
+
+	body := `{"group":"billing","partition":0,"fromOffset":100,"toOffset":141,"dryRun":true}`
+	w := serve(s, httptest.NewRequest(http.MethodPost, "/api/v1/topics/orders/replay", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"matched":42,"replayed":0,"dryRun":true}`, w.Body.String())
+	// Dry runs are not audited
+	auditManager.AssertNotCalled(t, "Record", mock.Anything, mock.Anything)
+
+	body = `{"group":"billing","partition":0,"fromOffset":100,"toOffset":141}`
+	w = serve(s, httptest.NewRequest(http.MethodPost, "/api/v1/topics/orders/replay", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	req := replayManager.Calls[1].Arguments.Get(1).(*model.ReplayRequest)
+	assert.Equal(t, "orders", req.Topic)
+	assert.Equal(t, 0, *req.Partition)
+	entry := auditManager.Calls[0].Arguments.Get(1).(*model.AuditEntry)
+	assert.Equal(t, ActionMessageReplay, entry.Action)
+	assert.Contains(t, entry.After, `"replayed":42`)
+	assert.Contains(t, entry.After, `"group":"billing"`)
+}
+
+func TestConsoleServer_Resend(t *testing.T) {
+	replayManager := new(MockReplayManager)
+	replayManager.On("Resend", mock.Anything, "orders", "msg-1", "").Return("copy-1", nil)
+	replayManager.On("Resend", mock.Anything, "orders", "missing", "billing").Return("", replay.ErrMessageNotFound)
+	auditManager := new(MockAuditManager)
+	auditManager.On("Record", mock.Anything, mock.Anything).Return(nil)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetReplayManager").Return(replayManager)
+	mockFactory.On("GetAuditManager").Return(auditManager)
+	s := newTestServer(t, config.Console{}, mockFactory)
+
+	w := serve(s, httptest.NewRequest(http.MethodPost, "/api/v1/topics/orders/messages/msg-1/resend", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"messageId":"copy-1"}`, w.Body.String())
+
+	w = serve(s, httptest.NewRequest(http.MethodPost, "/api/v1/topics/orders/messages/missing/resend", strings.NewReader(`{"group":"billing"}`)))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Len(t, auditManager.Calls, 2)
+}
@@ -0,0 +1,10 @@
+package console
+
+import "github.com/wenzuojing/mqx/internal/httpapi"
+
+// newPage returns a page of items counting total items, with an empty list rather than null
+func newPage[T any](items []T, total int64) *httpapi.Page[T] {
+	page := httpapi.NewPage(items)
+	page.Total = &total
+	return page
+}
@@ -0,0 +1,98 @@
+package console
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/message"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// tailKeepAlive is how long a tail stays silent before a comment is sent to keep proxies from closing it
+const tailKeepAlive = 15 * time.Second
+
+// tailTopic handles the GET /api/v1/topics/:topic/tail request.
+// It streams the messages written to the topic after the request as server-sent events:
+// a "ready" event once the tail is positioned, then a "message" event per message and an
+// "error" event when reading fails. The stream ends when the client disconnects or the console stops.
+func (s *ConsoleServer) tailTopic(c *gin.Context) {
+	var params struct {
+		Tag string `form:"tag"`
+		Key string `form:"key"`
+		bodyOptions
+	}
+	if err := c.ShouldBindQuery(&params); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := c.Request.Context()
+	topic := c.Param("topic")
+	if err := model.ValidateTopic(topic); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Viewers may tail, so the topic is looked up without creating it
+	meta, err := s.factory.GetTopicManager().FindTopicMeta(ctx, topic)
+	if errors.Is(err, model.ErrTopicNotFound) {
+		httpapi.WriteError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	tail, err := message.NewTail(ctx, s.factory.GetMessageManager(), meta, params.Tag, params.Key)
+	if err != nil {
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	logger := s.factory.GetLogger().With("topic", topic)
+	logger.Debug("Starting topic tail", "tag", params.Tag, "key", params.Key)
+	c.Header("Cache-Control", "no-cache")
+	// Keep nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", gin.H{"topic": topic, "partitions": meta.PartitionNum})
+	c.Writer.Flush()
+
+	interval := s.cfg.PullingInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	errLog := logging.NewThrottle(logger, 0)
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("Topic tail closed by client")
+			return
+		case <-s.closing:
+			return
+		case <-ticker.C:
+		}
+
+		msgs, err := tail.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			errLog.Error("Failed to read messages for topic tail", "error", err)
+			c.SSEvent("error", httpapi.NewErrorResponse(http.StatusInternalServerError, err.Error()).Error)
+		} else if err == nil {
+			errLog.Reset()
+		}
+		for _, msg := range msgs {
+			c.SSEvent("message", newMessageView(msg, params.bodyOptions))
+		}
+		if err != nil || len(msgs) > 0 {
+			lastWrite = time.Now()
+		} else if time.Since(lastWrite) >= tailKeepAlive {
+			c.Writer.WriteString(": keep-alive\n\n")
+			lastWrite = time.Now()
+		}
+		c.Writer.Flush()
+	}
+}
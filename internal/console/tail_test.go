@@ -0,0 +1,103 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/message"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func (m *MockFactory) GetMessageManager() interfaces.MessageManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.MessageManager)
+}
+
+// MockMessageManager implements interfaces.MessageManager for testing
+type MockMessageManager struct {
+	mock.Mock
+	interfaces.MessageManager
+}
+
+func (m *MockMessageManager) GetPartitionStat(ctx context.Context, topic string, partition int) (*interfaces.PartitionStat, error) {
+	args := m.Called(ctx, topic, partition)
+	stat, _ := args.Get(0).(*interfaces.PartitionStat)
+	return stat, args.Error(1)
+}
+
+func (m *MockMessageManager) GetMessages(ctx context.Context, topic string, group string, partition int, offset int64, size int) ([]*model.Message, error) {
+	args := m.Called(ctx, topic, group, partition, offset, size)
+	msgs, _ := args.Get(0).([]*model.Message)
+	return msgs, args.Error(1)
+}
+
+func TestConsoleServer_TailTopic(t *testing.T) {
+	topicManager := new(MockTopicManager)
+	topicManager.On("FindTopicMeta", mock.Anything, "orders").Return(&model.TopicMeta{Topic: "orders", PartitionNum: 1}, nil)
+	messages := new(MockMessageManager)
+	messages.On("GetPartitionStat", mock.Anything, "orders", 0).Return(&interfaces.PartitionStat{MaxOffset: 5}, nil)
+	messages.On("GetMessages", mock.Anything, "orders", "", 0, int64(5), message.TailBatchSize).Return([]*model.Message{
+		{MessageID: "other", Key: "order-2", Offset: 6},
+		{MessageID: "match", Key: "order-1", Offset: 7, Body: []byte("hello")},
+	}, nil).Once()
+	messages.On("GetMessages", mock.Anything, "orders", "", 0, int64(7), message.TailBatchSize).Return(nil, nil)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetTopicManager").Return(topicManager)
+	mockFactory.On("GetMessageManager").Return(messages)
+	s := newTestServer(t, config.Console{}, mockFactory)
+	s.cfg.PullingInterval = 10 * time.Millisecond
+	server := httptest.NewServer(s.engine)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/topics/orders/tail?key=order-1")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && len(events) < 4 {
+		if line := scanner.Text(); line != "" {
+			events = append(events, line)
+		}
+	}
+	assert.Equal(t, "event:ready", events[0])
+	assert.Equal(t, `data:{"partitions":1,"topic":"orders"}`, events[1])
+	assert.Equal(t, "event:message", events[2])
+	assert.True(t, strings.HasPrefix(events[3], `data:{"messageId":"match"`), events[3])
+
+	// Stopping the console ends the stream
+	assert.NoError(t, s.Stop(context.Background()))
+	for scanner.Scan() {
+	}
+	assert.NoError(t, scanner.Err())
+}
+
+func TestConsoleServer_TailTopic_UnknownTopic(t *testing.T) {
+	topicManager := new(MockTopicManager)
+	topicManager.On("FindTopicMeta", mock.Anything, "missing").Return(nil, fmt.Errorf("%w: missing", model.ErrTopicNotFound))
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetTopicManager").Return(topicManager)
+	s := newTestServer(t, config.Console{}, mockFactory)
+
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/topics/missing/tail", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	// The tail does not create the topic
+	topicManager.AssertNotCalled(t, "GetTopicMeta", mock.Anything, mock.Anything)
+
+	w = httptest.NewRecorder()
+	s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/topics/orders%60x/tail", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
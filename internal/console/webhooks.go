@@ -0,0 +1,91 @@
+package console
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/webhook"
+)
+
+// WebhookRequest creates or replaces the webhook subscription of a consumer group
+type WebhookRequest struct {
+	URL string `json:"url" binding:"required"`
+	// Secret signs the deliveries; empty keeps the secret of the subscription replaced
+	Secret      string  `json:"secret"`
+	Concurrency int     `json:"concurrency" binding:"min=0"`
+	RateLimit   float64 `json:"rateLimit" binding:"min=0"`
+	TimeoutMs   int64   `json:"timeoutMs" binding:"min=0"`
+}
+
+// webhookStatus maps the errors of the webhook manager to HTTP status codes
+func webhookStatus(err error) int {
+	switch {
+	case errors.Is(err, webhook.ErrInvalidSubscription):
+		return http.StatusBadRequest
+	case errors.Is(err, webhook.ErrSubscriptionNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// listWebhooks handles the GET /api/v1/webhooks request
+func (s *ConsoleServer) listWebhooks(c *gin.Context) {
+	subs, err := s.factory.GetWebhookManager().GetSubscriptions(c.Request.Context())
+	if err != nil {
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, newPage(subs, int64(len(subs))))
+}
+
+// putWebhook handles the PUT /api/v1/topics/:topic/webhooks/:group request
+func (s *ConsoleServer) putWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	topic, group := c.Param("topic"), c.Param("group")
+	sub := &model.WebhookSubscription{
+		Topic:       topic,
+		Group:       group,
+		URL:         req.URL,
+		Secret:      req.Secret,
+		Concurrency: req.Concurrency,
+		RateLimit:   req.RateLimit,
+		TimeoutMs:   req.TimeoutMs,
+	}
+
+	action := ActionWebhookUpdate
+	before, err := s.factory.GetWebhookManager().GetSubscription(c.Request.Context(), topic, group)
+	if errors.Is(err, webhook.ErrSubscriptionNotFound) {
+		action = ActionWebhookCreate
+	}
+	err = s.factory.GetWebhookManager().Subscribe(c.Request.Context(), sub)
+	s.audit(c, action, topic+"/"+group, before, sub, err)
+	if err != nil {
+		httpapi.WriteError(c, webhookStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// deleteWebhook handles the DELETE /api/v1/topics/:topic/webhooks/:group request
+func (s *ConsoleServer) deleteWebhook(c *gin.Context) {
+	topic, group := c.Param("topic"), c.Param("group")
+	before, _ := s.factory.GetWebhookManager().GetSubscription(c.Request.Context(), topic, group)
+
+	err := s.factory.GetWebhookManager().Unsubscribe(c.Request.Context(), topic, group)
+	s.audit(c, ActionWebhookDelete, topic+"/"+group, before, nil, err)
+	if err != nil {
+		httpapi.WriteError(c, webhookStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Webhook deleted successfully"})
+}
@@ -0,0 +1,88 @@
+package console
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/webhook"
+)
+
+func (m *MockFactory) GetWebhookManager() interfaces.WebhookManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.WebhookManager)
+}
+
+// MockWebhookManager implements interfaces.WebhookManager for testing
+type MockWebhookManager struct {
+	mock.Mock
+	interfaces.WebhookManager
+}
+
+func (m *MockWebhookManager) Subscribe(ctx context.Context, sub *model.WebhookSubscription) error {
+	args := m.Called(ctx, sub)
+	return args.Error(0)
+}
+
+func (m *MockWebhookManager) Unsubscribe(ctx context.Context, topic string, group string) error {
+	args := m.Called(ctx, topic, group)
+	return args.Error(0)
+}
+
+func (m *MockWebhookManager) GetSubscription(ctx context.Context, topic string, group string) (*model.WebhookSubscription, error) {
+	args := m.Called(ctx, topic, group)
+	sub, _ := args.Get(0).(*model.WebhookSubscription)
+	return sub, args.Error(1)
+}
+
+func (m *MockWebhookManager) GetSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	subs, _ := args.Get(0).([]*model.WebhookSubscription)
+	return subs, args.Error(1)
+}
+
+func TestConsoleServer_WebhookActions(t *testing.T) {
+	existing := &model.WebhookSubscription{Topic: "orders", Group: "billing", URL: "https://example.com/old", Secret: "s3cret", CreatedTime: time.Now()}
+	webhooks := new(MockWebhookManager)
+	webhooks.On("GetSubscription", mock.Anything, "orders", "billing").Return(nil, webhook.ErrSubscriptionNotFound).Once()
+	webhooks.On("GetSubscription", mock.Anything, "orders", "billing").Return(existing, nil)
+	webhooks.On("Subscribe", mock.Anything, mock.MatchedBy(func(sub *model.WebhookSubscription) bool {
+		return sub.URL == "https://example.com/hook" && sub.Concurrency == 4
+	})).Return(nil)
+	webhooks.On("Unsubscribe", mock.Anything, "orders", "billing").Return(nil)
+	auditManager := new(MockAuditManager)
+	auditManager.On("Record", mock.Anything, mock.Anything).Return(nil)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetWebhookManager").Return(webhooks)
+	mockFactory.On("GetAuditManager").Return(auditManager)
+	s := newTestServer(t, config.Console{}, mockFactory)
+
+	body := `{"url":"https://example.com/hook","secret":"n3w","concurrency":4}`
+	w := serve(s, httptest.NewRequest(http.MethodPut, "/api/v1/topics/orders/webhooks/billing", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve(s, httptest.NewRequest(http.MethodPut, "/api/v1/topics/orders/webhooks/billing", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "n3w")
+	w = serve(s, httptest.NewRequest(http.MethodDelete, "/api/v1/topics/orders/webhooks/billing", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var actions []string
+	for _, call := range auditManager.Calls {
+		entry := call.Arguments.Get(1).(*model.AuditEntry)
+		actions = append(actions, entry.Action)
+		assert.Equal(t, "orders/billing", entry.Target)
+		// The secrets stay out of the audit log
+		assert.NotContains(t, entry.Before+entry.After, "s3cret")
+		assert.NotContains(t, entry.Before+entry.After, "n3w")
+	}
+	assert.Equal(t, []string{ActionWebhookCreate, ActionWebhookUpdate, ActionWebhookDelete}, actions)
+	webhooks.AssertExpectations(t)
+}
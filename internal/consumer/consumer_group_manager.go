@@ -8,14 +8,16 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
 	"github.com/wenzuojing/mqx/internal/template"
-	"k8s.io/klog/v2"
 )
 
 // consumerGroupManager handles consumer group rebalancing and heartbeat
@@ -29,38 +31,80 @@ type consumerGroupManager struct {
 	factory        interfaces.Factory
 	stopChan       chan struct{}
 	partitionsHash string
+	// cancel aborts a rebalance blocked on the distributed lock when the manager stops
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// logger carries the topic, group and instance fields
+	logger logging.Logger
+	// lastHeartbeat is the unix nano time of the last successful heartbeat
+	lastHeartbeat atomic.Int64
 }
 
 func (c *consumerGroupManager) Start(ctx context.Context) error {
-	klog.V(4).Infof("Starting rebalance manager for group: %s, topic: %s", c.group, c.topic)
+	c.logger.Debug("Starting rebalance manager")
 	if success, err := c.updateConsumerInstanceHeartbeat(ctx, c.group, c.topic, c.instanceID, c.hostname); err != nil {
-		klog.Errorf("Failed to send initial heartbeat: %v", err)
+		c.logger.Error("Failed to send initial heartbeat", "error", err)
 		return err
 	} else if !success {
-		klog.Warning("Initial heartbeat was not successful")
+		c.logger.Warn("Initial heartbeat was not successful")
+	} else {
+		c.lastHeartbeat.Store(time.Now().UnixNano())
 	}
+	rebalanceCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.wg.Add(2)
 	go func() {
+		defer c.wg.Done()
 		for {
 			select {
 			case <-c.stopChan:
 				return
 			default:
-				c.rebalance(context.Background())
+				c.rebalance(rebalanceCtx)
 			}
 		}
 	}()
-	go c.heartbeat(ctx)
+	go func() {
+		defer c.wg.Done()
+		c.heartbeat(ctx)
+	}()
 	return nil
 }
 
+// Stop stops rebalancing and heartbeats, waiting for them up to the ctx deadline,
+// then marks this instance inactive so the remaining instances take over its partitions
 func (c *consumerGroupManager) Stop(ctx context.Context) error {
 	close(c.stopChan)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.logger.Warn("Timed out waiting for rebalance to stop")
+	}
 	_, err := c.db.Exec(template.UpdateConsumerInstanceUnactive, c.group, c.topic, c.instanceID)
 	return err
 }
 
+// sleep waits for d or until the manager is stopped
+func (c *consumerGroupManager) sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-c.stopChan:
+	case <-timer.C:
+	}
+}
+
 // rebalance performs consumer group partition rebalancing
 func (c *consumerGroupManager) rebalance(ctx context.Context) error {
+	errLog := logging.NewThrottle(c.logger, 0)
 	for {
 		select {
 		case <-c.stopChan:
@@ -68,45 +112,36 @@ func (c *consumerGroupManager) rebalance(ctx context.Context) error {
 		default:
 		}
 
-		// Acquire lock on a dedicated connection to ensure GET_LOCK and RELEASE_LOCK
-		// operate on the same session (sql.DB is a connection pool).
-		conn, err := c.db.Conn(ctx)
+		unlock, err := lockRebalance(ctx, c.db)
 		if err != nil {
-			klog.Errorf("Failed to get dedicated connection for rebalance lock: %v", err)
-			time.Sleep(time.Second)
-			continue
-		}
-
-		var lockAcquired bool
-		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK('rebalance_lock', 30)").Scan(&lockAcquired)
-		if err != nil || !lockAcquired {
-			conn.Close()
-			if err != nil {
-				klog.Errorf("Failed to acquire rebalance lock: %v", err)
+			if !errors.Is(err, ErrRebalanceLockTimeout) {
+				errLog.Error("Failed to acquire rebalance lock", "error", err)
 			}
-			time.Sleep(time.Second)
+			c.sleep(time.Second)
 			continue
 		}
 
-		klog.V(4).Info("Acquired rebalance lock")
+		c.logger.Debug("Acquired rebalance lock")
 		start := time.Now()
 		err = c.doRebalance(ctx)
 		if err != nil {
-			klog.Errorf("Failed to rebalance: %v", err)
+			errLog.Error("Failed to rebalance", "error", err)
+		} else {
+			errLog.Reset()
 		}
-		conn.ExecContext(ctx, "SELECT RELEASE_LOCK('rebalance_lock')")
-		conn.Close()
-		klog.V(4).Info("Released rebalance lock")
+		unlock()
+		c.logger.Debug("Released rebalance lock")
 
 		elapsed := time.Since(start)
 		if remaining := c.cfg.RebalanceInterval - elapsed; remaining > 0 {
-			time.Sleep(remaining)
+			c.sleep(remaining)
 		}
 	}
 }
 
 func (c *consumerGroupManager) heartbeat(ctx context.Context) {
-	klog.V(4).Infof("Starting heartbeat for group: %s, topic: %s", c.group, c.topic)
+	c.logger.Debug("Starting heartbeat")
+	errLog := logging.NewThrottle(c.logger, 0)
 	heartbeatTicker := time.NewTicker(c.cfg.HeartbeatInterval)
 	defer heartbeatTicker.Stop()
 	for {
@@ -116,25 +151,28 @@ func (c *consumerGroupManager) heartbeat(ctx context.Context) {
 		case <-heartbeatTicker.C:
 			success, err := c.updateConsumerInstanceHeartbeat(ctx, c.group, c.topic, c.instanceID, c.hostname)
 			if err != nil {
-				klog.Errorf("Heartbeat failed: %v", err)
+				errLog.Error("Heartbeat failed", "error", err)
 				continue
 			}
+			errLog.Reset()
 			if !success {
-				klog.Warning("Heartbeat was not successful")
+				c.logger.Warn("Heartbeat was not successful")
+				continue
 			}
+			c.lastHeartbeat.Store(time.Now().UnixNano())
 		}
 	}
 }
 
 func (c *consumerGroupManager) doRebalance(ctx context.Context) error {
-	klog.V(4).Infof("Starting rebalance for group: %s, topic: %s", c.group, c.topic)
+	c.logger.Debug("Starting rebalance")
 	instances, err := c.getActiveConsumerInstances(ctx, c.group, c.topic)
 	if err != nil {
 		return errors.Wrap(err, "failed to get active consumer instances")
 	}
 
 	if len(instances) == 0 {
-		klog.Errorf("No active consumer instances found for group: %s, topic: %s", c.group, c.topic)
+		c.logger.Warn("No active consumer instances found")
 		return nil
 	}
 
@@ -143,20 +181,9 @@ func (c *consumerGroupManager) doRebalance(ctx context.Context) error {
 		return errors.Wrap(err, "failed to get topic metadata")
 	}
 
-	klog.V(4).Infof("Rebalancing %d partitions across %d instances",
-		topicMeta.PartitionNum, len(instances))
-
-	var partitions []model.ConsumerOffset
-	for i := 0; i < topicMeta.PartitionNum; i++ {
-		instance := instances[i%len(instances)]
-		partitions = append(partitions, model.ConsumerOffset{
-			Group:      c.group,
-			Topic:      c.topic,
-			Partition:  i,
-			InstanceID: instance.InstanceID,
-		})
-	}
+	c.logger.Debug("Rebalancing partitions", "partitions", topicMeta.PartitionNum, "instances", len(instances))
 
+	partitions := assignPartitions(c.group, c.topic, topicMeta.PartitionNum, instances)
 	partitionsHash := hashPartitions(partitions)
 	if partitionsHash == c.partitionsHash {
 		return nil
@@ -165,7 +192,8 @@ func (c *consumerGroupManager) doRebalance(ctx context.Context) error {
 		return errors.Wrap(err, "failed to rebalance consumer partitions")
 	}
 	c.partitionsHash = partitionsHash
-	klog.V(4).Info("Rebalance completed successfully")
+	c.factory.GetMetrics().Rebalanced(c.topic, c.group)
+	c.logger.Debug("Rebalance completed successfully")
 	return nil
 }
 
@@ -187,6 +215,10 @@ func (c *consumerGroupManager) updateConsumerInstanceHeartbeat(ctx context.Conte
 	_, err = c.db.Exec(template.InsertConsumerInstanceHeartbeat, group, topic, instanceID, hostname)
 
 	if err != nil {
+		// The record exists but was not updated: the instance was evicted and stays inactive
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return false, ErrInstanceEvicted
+		}
 		return false, err
 	}
 	return true, nil
@@ -198,18 +230,60 @@ func (c *consumerGroupManager) getActiveConsumerInstances(ctx context.Context, g
 }
 
 func (c *consumerGroupManager) updateConsumerPartitions(ctx context.Context, partitions []model.ConsumerOffset) error {
-	klog.Infof("Rebalancing consumer partitions for %d partitions", len(partitions))
+	return saveAssignment(ctx, c.db, c.logger, partitions)
+}
+
+// lockRebalance acquires the global rebalance lock on a dedicated connection, so that GET_LOCK
+// and RELEASE_LOCK operate on the same session (sql.DB is a connection pool).
+// It returns ErrRebalanceLockTimeout when the lock is held elsewhere for longer than 30 seconds.
+func lockRebalance(ctx context.Context, db *sql.DB) (unlock func(), err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get dedicated connection for rebalance lock")
+	}
+	var lockAcquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK('rebalance_lock', 30)").Scan(&lockAcquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !lockAcquired {
+		conn.Close()
+		return nil, ErrRebalanceLockTimeout
+	}
+	return func() {
+		// Release even when ctx is canceled, the pooled session would otherwise keep the lock
+		conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK('rebalance_lock')")
+		conn.Close()
+	}, nil
+}
+
+// assignPartitions spreads the partitions of a topic round-robin over the active instances of a group
+func assignPartitions(group string, topic string, partitionNum int, instances []model.ConsumerInstance) []model.ConsumerOffset {
+	partitions := make([]model.ConsumerOffset, 0, partitionNum)
+	for i := 0; i < partitionNum; i++ {
+		partitions = append(partitions, model.ConsumerOffset{
+			Group:      group,
+			Topic:      topic,
+			Partition:  i,
+			InstanceID: instances[i%len(instances)].InstanceID,
+		})
+	}
+	return partitions
+}
+
+// saveAssignment writes the owner of every partition, creating the offsets of new partitions
+func saveAssignment(ctx context.Context, db *sql.DB, logger logging.Logger, partitions []model.ConsumerOffset) error {
+	logger.Info("Rebalancing consumer partitions", "partitions", len(partitions))
 
-	tx, err := c.db.Begin()
+	tx, err := db.Begin()
 	if err != nil {
-		klog.Errorf("Failed to begin transaction for rebalance: %v", err)
+		logger.Error("Failed to begin transaction for rebalance", "error", err)
 		return err
 	}
 	defer tx.Rollback()
 
 	for _, p := range partitions {
-		klog.V(4).Infof("Assigning partition %d of topic %s to instance %s",
-			p.Partition, p.Topic, p.InstanceID)
+		logger.Debug("Assigning partition", "partition", p.Partition, "assignee", p.InstanceID)
 		// Update consumer offset record
 		result, err := tx.Exec(template.UpdateConsumerInstanceId,
 			p.InstanceID, p.Group, p.Topic, p.Partition)
@@ -236,10 +310,10 @@ func (c *consumerGroupManager) updateConsumerPartitions(ctx context.Context, par
 	}
 
 	if err := tx.Commit(); err != nil {
-		klog.Errorf("Failed to commit rebalance transaction: %v", err)
+		logger.Error("Failed to commit rebalance transaction", "error", err)
 		return err
 	}
-	klog.Info("Consumer partition rebalance completed successfully")
+	logger.Info("Consumer partition rebalance completed successfully")
 	return nil
 }
 
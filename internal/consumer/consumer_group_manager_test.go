@@ -9,6 +9,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
 )
 
@@ -22,6 +24,12 @@ func (m *MockTopicManager) GetTopicMeta(ctx context.Context, topic string) (*mod
 	return args.Get(0).(*model.TopicMeta), args.Error(1)
 }
 
+func (m *MockTopicManager) FindTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	args := m.Called(ctx, topic)
+	meta, _ := args.Get(0).(*model.TopicMeta)
+	return meta, args.Error(1)
+}
+
 func (m *MockTopicManager) GetAllTopicMeta(ctx context.Context) ([]model.TopicMeta, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]model.TopicMeta), args.Error(1)
@@ -72,7 +80,7 @@ func (m *MockConsumerManager) GetConsumerInstances(ctx context.Context, topic st
 	return args.Get(0).([]model.ConsumerInstance), args.Error(1)
 }
 
-func (m *MockConsumerManager) Consume(ctx context.Context, topic string, group string, handler func(msg *model.Message) error) error {
+func (m *MockConsumerManager) Consume(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg *model.Message) error) error {
 	args := m.Called(ctx, topic, group, handler)
 	return args.Error(0)
 }
@@ -92,6 +100,44 @@ func (m *MockConsumerManager) GetActiveConsumerInstances(ctx context.Context, to
 	return args.Get(0).([]model.ConsumerInstance), args.Error(1)
 }
 
+func (m *MockConsumerManager) GetSubscriptionHealth() []model.SubscriptionHealth {
+	args := m.Called()
+	return args.Get(0).([]model.SubscriptionHealth)
+}
+
+func (m *MockConsumerManager) DeleteGroup(ctx context.Context, topic string, group string) error {
+	args := m.Called(ctx, topic, group)
+	return args.Error(0)
+}
+
+func (m *MockConsumerManager) EvictInstance(ctx context.Context, topic string, group string, instanceID string) error {
+	args := m.Called(ctx, topic, group, instanceID)
+	return args.Error(0)
+}
+
+func (m *MockConsumerManager) Rebalance(ctx context.Context, topic string, group string) error {
+	args := m.Called(ctx, topic, group)
+	return args.Error(0)
+}
+
+func (m *MockConsumerManager) ResetOffsets(ctx context.Context, reset *model.OffsetReset) ([]model.OffsetResetResult, error) {
+	args := m.Called(ctx, reset)
+	results, _ := args.Get(0).([]model.OffsetResetResult)
+	return results, args.Error(1)
+}
+
+func (m *MockConsumerManager) NewPullConsumer(ctx context.Context, topic string, group string) (interfaces.PullConsumer, error) {
+	args := m.Called(ctx, topic, group)
+	consumer, _ := args.Get(0).(interfaces.PullConsumer)
+	return consumer, args.Error(1)
+}
+
+func (m *MockConsumerManager) Subscribe(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg *model.Message) error) (interfaces.Subscription, error) {
+	args := m.Called(ctx, topic, group, handler)
+	subscription, _ := args.Get(0).(interfaces.Subscription)
+	return subscription, args.Error(1)
+}
+
 func TestConsumerGroupManager_Start(t *testing.T) {
 	db, smock, err := sqlmock.New()
 	assert.NoError(t, err)
@@ -104,6 +150,7 @@ func TestConsumerGroupManager_Start(t *testing.T) {
 	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
 
 	cgm := &consumerGroupManager{
+		logger:     logging.Discard(),
 		db:         db,
 		cfg:        &config.Config{HeartbeatInterval: time.Second * 30, RebalanceInterval: time.Second * 30},
 		group:      "test-group",
@@ -161,6 +208,7 @@ func TestConsumerGroupManager_Rebalance(t *testing.T) {
 		}, nil)
 
 	cgm := &consumerGroupManager{
+		logger:     logging.Discard(),
 		db:         db,
 		cfg:        &config.Config{RebalanceInterval: time.Second, HeartbeatInterval: time.Second * 30},
 		group:      "test-group",
@@ -208,6 +256,7 @@ func TestConsumerGroupManager_Heartbeat(t *testing.T) {
 	defer db.Close()
 
 	cgm := &consumerGroupManager{
+		logger:     logging.Discard(),
 		db:         db,
 		cfg:        &config.Config{HeartbeatInterval: time.Second},
 		group:      "test-group",
@@ -237,6 +286,7 @@ func TestConsumerGroupManager_GetActiveConsumerInstances(t *testing.T) {
 	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
 
 	cgm := &consumerGroupManager{
+		logger:     logging.Discard(),
 		factory:    mockFactory,
 		cfg:        &config.Config{HeartbeatInterval: time.Second * 30},
 		group:      "test-group",
@@ -266,7 +316,8 @@ func TestConsumerGroupManager_UpdateConsumerPartitions(t *testing.T) {
 	defer db.Close()
 
 	cgm := &consumerGroupManager{
-		db: db,
+		logger: logging.Discard(),
+		db:     db,
 	}
 
 	partitions := []model.ConsumerOffset{
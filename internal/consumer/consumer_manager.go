@@ -3,17 +3,18 @@ package consumer
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
 	"github.com/wenzuojing/mqx/internal/template"
 	"github.com/wenzuojing/mqx/pkg/templatex"
-	"golang.org/x/sync/errgroup"
-	"k8s.io/klog/v2"
 )
 
 // NewConsumerManager creates a new consumer manager instance
@@ -22,13 +23,15 @@ func NewConsumerManager(db *sql.DB, cfg *config.Config, factory interfaces.Facto
 	if err != nil {
 		return nil, err
 	}
+	instanceID := uuid.NewString()
 	return &consumerManagerImpl{
 		db:                        db,
 		cfg:                       cfg,
 		factory:                   factory,
-		instanceID:                uuid.NewString(),
+		instanceID:                instanceID,
 		hostname:                  hostname,
-		consumerRebalanceManagers: make(map[string]consumerGroupManager),
+		consumerRebalanceManagers: make(map[string]*consumerGroupManager),
+		logger:                    factory.GetLogger().With("instance", instanceID),
 	}, nil
 }
 
@@ -36,38 +39,39 @@ type consumerManagerImpl struct {
 	db                        *sql.DB
 	cfg                       *config.Config
 	factory                   interfaces.Factory
-	consumerRebalanceManagers map[string]consumerGroupManager
+	consumerRebalanceManagers map[string]*consumerGroupManager
 	groupConsumers            []*groupConsumer
 	instanceID                string
 	hostname                  string
 	mu                        sync.Mutex
+	logger                    logging.Logger
 }
 
 func (c *consumerManagerImpl) Start(ctx context.Context) error {
-	klog.Info("Starting consumer service...")
+	c.logger.Info("Starting consumer service")
 	// Check if consumer offset table exists, create if not
 	if _, err := c.db.Exec(template.CreateConsumerOffsetsTable); err != nil {
-		klog.Errorf("Failed to create consumer_offsets table: %v", err)
+		c.logger.Error("Failed to create consumer_offsets table", "error", err)
 		return err
 	}
-	klog.V(2).Info("Created/verified consumer_offsets table")
+	c.logger.Debug("Created/verified consumer_offsets table")
 
 	// Check if consumer instance table exists, create if not
 	if _, err := c.db.Exec(template.CreateConsumerInstancesTable); err != nil {
-		klog.Errorf("Failed to create consumer_instances table: %v", err)
+		c.logger.Error("Failed to create consumer_instances table", "error", err)
 		return err
 	}
 
-	klog.V(2).Info("Created/verified consumer_instances table")
+	c.logger.Debug("Created/verified consumer_instances table")
 	return nil
 }
 
 func (c *consumerManagerImpl) Stop(ctx context.Context) error {
-	klog.Info("Stopping consumer service...")
+	c.logger.Info("Stopping consumer service")
 
 	// Collect managers and consumers under lock to avoid data race
 	c.mu.Lock()
-	managers := make([]consumerGroupManager, 0, len(c.consumerRebalanceManagers))
+	managers := make([]*consumerGroupManager, 0, len(c.consumerRebalanceManagers))
 	for _, manager := range c.consumerRebalanceManagers {
 		managers = append(managers, manager)
 	}
@@ -75,33 +79,42 @@ func (c *consumerManagerImpl) Stop(ctx context.Context) error {
 	copy(consumers, c.groupConsumers)
 	c.mu.Unlock()
 
-	g := new(errgroup.Group)
-	for _, manager := range managers {
-		m := manager
-		g.Go(func() error {
-			klog.V(4).Infof("Stopping rebalance manager for group: %s", m.group)
-			return m.Stop(ctx)
-		})
+	// Drain the group consumers first so their final offsets are committed while this
+	// instance still owns the partitions, then leave the groups.
+	consumerErrs := make([]error, len(consumers))
+	var wg sync.WaitGroup
+	for i, gc := range consumers {
+		wg.Add(1)
+		go func(i int, consumer *groupConsumer) {
+			defer wg.Done()
+			consumer.logger.Debug("Stopping group consumer")
+			consumerErrs[i] = consumer.Stop(ctx)
+		}(i, gc)
 	}
-	for _, gc := range consumers {
-		consumer := gc
-		g.Go(func() error {
-			klog.V(4).Infof("Stopping group consumer for topic: %s, group: %s",
-				consumer.topic, consumer.group)
-			return consumer.Stop(ctx)
-		})
-	}
-	return g.Wait()
+	wg.Wait()
+
+	managerErrs := make([]error, len(managers))
+	for i, manager := range managers {
+		wg.Add(1)
+		go func(i int, m *consumerGroupManager) {
+			defer wg.Done()
+			m.logger.Debug("Stopping rebalance manager")
+			managerErrs[i] = m.Stop(ctx)
+		}(i, manager)
+	}
+	wg.Wait()
+	return errors.Join(append(consumerErrs, managerErrs...)...)
 }
 
-func (c *consumerManagerImpl) Consume(ctx context.Context, topic string, group string, handler func(msg *model.Message) error) error {
-	klog.Infof("Setting up consumer for topic: %s, group: %s", topic, group)
+func (c *consumerManagerImpl) Consume(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg *model.Message) error) error {
+	logger := c.logger.With("topic", topic, "group", group)
+	logger.Info("Setting up consumer")
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	key := group + ":" + topic
 	if _, ok := c.consumerRebalanceManagers[key]; !ok {
-		klog.V(4).Infof("Creating new rebalance manager for %s", key)
-		manager := consumerGroupManager{
+		logger.Debug("Creating new rebalance manager")
+		manager := &consumerGroupManager{
 			db:         c.db,
 			cfg:        c.cfg,
 			group:      group,
@@ -110,9 +123,10 @@ func (c *consumerManagerImpl) Consume(ctx context.Context, topic string, group s
 			instanceID: c.instanceID,
 			hostname:   c.hostname,
 			stopChan:   make(chan struct{}),
+			logger:     logger,
 		}
 		if err := manager.Start(ctx); err != nil {
-			klog.Errorf("Failed to start rebalance manager: %v", err)
+			logger.Error("Failed to start rebalance manager", "error", err)
 			return err
 		}
 		c.consumerRebalanceManagers[key] = manager
@@ -125,16 +139,59 @@ func (c *consumerManagerImpl) Consume(ctx context.Context, topic string, group s
 		topic:      topic,
 		instanceID: c.instanceID,
 		handler:    handler,
+		stopChan:   make(chan struct{}),
+		logger:     logger,
 	}
 	if err := gc.Start(ctx); err != nil {
-		klog.Errorf("Failed to start group consumer: %v", err)
+		logger.Error("Failed to start group consumer", "error", err)
 		return err
 	}
 	c.groupConsumers = append(c.groupConsumers, gc)
-	klog.Infof("Successfully set up consumer for topic: %s, group: %s", topic, group)
+	logger.Info("Successfully set up consumer")
 	return nil
 }
 
+// GetSubscriptionHealth returns the status of every subscription of this instance.
+// A subscription is down when its group heartbeat is older than the timeout after which
+// the other instances consider this one inactive.
+func (c *consumerManagerImpl) GetSubscriptionHealth() []model.SubscriptionHealth {
+	c.mu.Lock()
+	consumers := make([]*groupConsumer, len(c.groupConsumers))
+	copy(consumers, c.groupConsumers)
+	managers := make(map[string]*consumerGroupManager, len(c.consumerRebalanceManagers))
+	for key, manager := range c.consumerRebalanceManagers {
+		managers[key] = manager
+	}
+	c.mu.Unlock()
+
+	heartbeatTimeout := c.cfg.HeartbeatInterval * 3
+	subscriptions := make([]model.SubscriptionHealth, 0, len(consumers))
+	for _, gc := range consumers {
+		subscription := model.SubscriptionHealth{
+			Topic:      gc.topic,
+			Group:      gc.group,
+			Status:     model.HealthDown,
+			Partitions: gc.partitionHealth(),
+		}
+		if manager, ok := managers[gc.group+":"+gc.topic]; ok {
+			subscription.LastHeartbeat = unixNanoTime(manager.lastHeartbeat.Load())
+		}
+		if !subscription.LastHeartbeat.IsZero() && time.Since(subscription.LastHeartbeat) <= heartbeatTimeout {
+			subscription.Status = model.HealthUp
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions
+}
+
+// unixNanoTime converts a unix nano timestamp to a time, zero for 0
+func unixNanoTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
 func (c *consumerManagerImpl) GetConsumerOffsets(ctx context.Context, topic string, group string) ([]model.ConsumerOffset, error) {
 	args := []any{topic}
 	if group != "" {
@@ -4,3 +4,35 @@ import "errors"
 
 var ErrOffsetNotFound = errors.New("not found offset")
 var ErrOffsetUpdate = errors.New("update offset error")
+
+// ErrDeadLetter marks a handler error as unrecoverable: the message is sent to the
+// dead letter queue immediately instead of being retried.
+var ErrDeadLetter = errors.New("dead letter")
+
+// ErrInstanceEvicted is returned by the heartbeat of an instance evicted from its group.
+// The instance rejoins the group once the clear task has removed its inactive record.
+var ErrInstanceEvicted = errors.New("consumer instance evicted")
+
+// ErrInstanceNotFound is returned when evicting an instance that is not an active member of the group
+var ErrInstanceNotFound = errors.New("consumer instance not found or already inactive")
+
+// ErrGroupActive is returned when deleting a group that still has active instances
+var ErrGroupActive = errors.New("consumer group has active instances")
+
+// ErrGroupNotFound is returned when a group has no offsets for a topic
+var ErrGroupNotFound = errors.New("consumer group not found")
+
+// ErrInvalidOffsetReset is returned for an offset reset without a valid target or partition
+var ErrInvalidOffsetReset = errors.New("invalid offset reset")
+
+// ErrNoActiveInstances is returned when rebalancing a group without active instances
+var ErrNoActiveInstances = errors.New("consumer group has no active instances")
+
+// ErrRebalanceLockTimeout is returned when the rebalance lock is not acquired within its timeout
+var ErrRebalanceLockTimeout = errors.New("timed out waiting for the rebalance lock")
+
+// ErrPartitionNotAssigned is returned when committing the offset of a partition not assigned to the consumer instance
+var ErrPartitionNotAssigned = errors.New("partition is not assigned to the consumer instance")
+
+// ErrConsumerClosed is returned by a pull consumer after it left its group
+var ErrConsumerClosed = errors.New("consumer closed")
@@ -0,0 +1,208 @@
+package consumer
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/template"
+)
+
+// DeleteGroup deletes the offsets and instance records of a group that has no active instance.
+// It holds the rebalance lock so that no rebalance recreates the offsets meanwhile.
+func (c *consumerManagerImpl) DeleteGroup(ctx context.Context, topic string, group string) error {
+	logger := c.logger.With("topic", topic, "group", group)
+	unlock, err := lockRebalance(ctx, c.db)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire rebalance lock")
+	}
+	defer unlock()
+
+	instances, err := c.GetActiveConsumerInstances(ctx, topic, group, c.heartbeatTimeoutSeconds())
+	if err != nil {
+		return err
+	}
+	if len(instances) > 0 {
+		return errors.Wrapf(ErrGroupActive, "%d active instances", len(instances))
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, template.DeleteGroupOffsets, group, topic)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, template.DeleteGroupInstances, group, topic); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	deleted, _ := result.RowsAffected()
+	logger.Info("Deleted consumer group", "offsets", deleted)
+	return nil
+}
+
+// EvictInstance marks an instance of a group inactive and reassigns its partitions to the other instances.
+// The heartbeat of the evicted instance fails with ErrInstanceEvicted until the clear task removes its record.
+func (c *consumerManagerImpl) EvictInstance(ctx context.Context, topic string, group string, instanceID string) error {
+	result, err := c.db.ExecContext(ctx, template.UpdateConsumerInstanceUnactive, group, topic, instanceID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInstanceNotFound
+	}
+	c.logger.Info("Evicted consumer instance", "topic", topic, "group", group, "evicted", instanceID)
+
+	// The partitions stay unassigned until an instance joins when the group has no other instance
+	if err := c.Rebalance(ctx, topic, group); err != nil && !errors.Is(err, ErrNoActiveInstances) {
+		return errors.Wrap(err, "instance evicted but rebalance failed")
+	}
+	return nil
+}
+
+// Rebalance reassigns the partitions of a topic to the active instances of a group immediately,
+// instead of waiting for the next periodic rebalance of the group instances
+func (c *consumerManagerImpl) Rebalance(ctx context.Context, topic string, group string) error {
+	logger := c.logger.With("topic", topic, "group", group)
+	unlock, err := lockRebalance(ctx, c.db)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire rebalance lock")
+	}
+	defer unlock()
+
+	instances, err := c.GetActiveConsumerInstances(ctx, topic, group, c.heartbeatTimeoutSeconds())
+	if err != nil {
+		return errors.Wrap(err, "failed to get active consumer instances")
+	}
+	if len(instances) == 0 {
+		return ErrNoActiveInstances
+	}
+	topicMeta, err := c.factory.GetTopicManager().GetTopicMeta(ctx, topic)
+	if err != nil {
+		return errors.Wrap(err, "failed to get topic metadata")
+	}
+
+	if err := saveAssignment(ctx, c.db, logger, assignPartitions(group, topic, topicMeta.PartitionNum, instances)); err != nil {
+		return errors.Wrap(err, "failed to rebalance consumer partitions")
+	}
+	c.factory.GetMetrics().Rebalanced(topic, group)
+	logger.Info("Forced rebalance completed", "partitions", topicMeta.PartitionNum, "instances", len(instances))
+	return nil
+}
+
+// heartbeatTimeoutSeconds is how long an instance stays active without a heartbeat
+func (c *consumerManagerImpl) heartbeatTimeoutSeconds() int {
+	return int(c.cfg.HeartbeatInterval.Seconds()) * 3
+}
+
+// ResetOffsets moves the committed offsets of a group that has no active instance, so that it consumes
+// again from, or skips to, the reset target when it restarts. The offsets of all partitions are written
+// in one transaction under the rebalance lock; a dry run only computes them.
+func (c *consumerManagerImpl) ResetOffsets(ctx context.Context, reset *model.OffsetReset) ([]model.OffsetResetResult, error) {
+	switch reset.Target {
+	case model.OffsetResetEarliest, model.OffsetResetLatest:
+	case model.OffsetResetOffset:
+		if reset.Offset < 1 {
+			return nil, errors.Wrap(ErrInvalidOffsetReset, "offset must be positive")
+		}
+	case model.OffsetResetTime:
+		if reset.Time.IsZero() {
+			return nil, errors.Wrap(ErrInvalidOffsetReset, "time is required")
+		}
+	default:
+		return nil, errors.Wrapf(ErrInvalidOffsetReset, "unknown target %q", reset.Target)
+	}
+	logger := c.logger.With("topic", reset.Topic, "group", reset.Group)
+	unlock, err := lockRebalance(ctx, c.db)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to acquire rebalance lock")
+	}
+	defer unlock()
+
+	instances, err := c.GetActiveConsumerInstances(ctx, reset.Topic, reset.Group, c.heartbeatTimeoutSeconds())
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) > 0 {
+		return nil, errors.Wrapf(ErrGroupActive, "%d active instances", len(instances))
+	}
+	offsets, err := c.GetConsumerOffsets(ctx, reset.Topic, reset.Group)
+	if err != nil {
+		return nil, err
+	}
+	if len(offsets) == 0 {
+		return nil, ErrGroupNotFound
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i].Partition < offsets[j].Partition })
+
+	results := make([]model.OffsetResetResult, 0, len(offsets))
+	for _, offset := range offsets {
+		if reset.Partition != nil && offset.Partition != *reset.Partition {
+			continue
+		}
+		after, err := c.resetTarget(ctx, reset, offset.Partition)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, model.OffsetResetResult{Partition: offset.Partition, Before: offset.Offset, After: after})
+	}
+	if len(results) == 0 {
+		return nil, errors.Wrapf(ErrInvalidOffsetReset, "group has no offset for partition %d", *reset.Partition)
+	}
+	if reset.DryRun {
+		return results, nil
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, result := range results {
+		if _, err := tx.ExecContext(ctx, template.ResetConsumerOffset, result.After, reset.Group, reset.Topic, result.Partition); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	logger.Info("Reset consumer group offsets", "target", reset.Target, "partitions", len(results))
+	return results, nil
+}
+
+// resetTarget returns the offset to commit for a partition so that consumption resumes at the reset target.
+// A committed offset is the last handled message, the next one consumed follows it.
+func (c *consumerManagerImpl) resetTarget(ctx context.Context, reset *model.OffsetReset, partition int) (int64, error) {
+	messages := c.factory.GetMessageManager()
+	switch reset.Target {
+	case model.OffsetResetOffset:
+		return reset.Offset - 1, nil
+	case model.OffsetResetTime:
+		first, err := messages.GetOffsetByTime(ctx, reset.Topic, partition, reset.Time)
+		if err != nil {
+			return 0, err
+		}
+		if first > 0 {
+			return first - 1, nil
+		}
+	}
+	stat, err := messages.GetPartitionStat(ctx, reset.Topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	if reset.Target == model.OffsetResetEarliest {
+		return max(stat.MinOffset-1, 0), nil
+	}
+	// Latest, or a time after the newest message
+	return stat.MaxOffset, nil
+}
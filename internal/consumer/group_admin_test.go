@@ -0,0 +1,193 @@
+package consumer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func newTestConsumerManager(db *sql.DB, factory *MockFactory) *consumerManagerImpl {
+	return &consumerManagerImpl{
+		db:                        db,
+		cfg:                       &config.Config{HeartbeatInterval: 30 * time.Second},
+		factory:                   factory,
+		instanceID:                "admin",
+		consumerRebalanceManagers: make(map[string]*consumerGroupManager),
+		logger:                    logging.Discard(),
+	}
+}
+
+func instanceRows(instanceIDs ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"group", "topic", "instance_id", "hostname", "active", "heartbeat"})
+	for _, id := range instanceIDs {
+		rows.AddRow("billing", "orders", id, "host-"+id, true, time.Now())
+	}
+	return rows
+}
+
+func TestConsumerManager_Rebalance(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	topicManager := new(MockTopicManager)
+	topicManager.On("GetTopicMeta", mock.Anything, "orders").Return(&model.TopicMeta{Topic: "orders", PartitionNum: 3}, nil)
+	factory := new(MockFactory)
+	factory.On("GetTopicManager").Return(topicManager)
+
+	smock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_instances`").
+		WithArgs("orders", 90, "billing").
+		WillReturnRows(instanceRows("a", "b"))
+	smock.ExpectBegin()
+	for partition, owner := range []string{"a", "b", "a"} {
+		smock.ExpectExec("UPDATE mqx_consumer_offsets").
+			WithArgs(owner, "billing", "orders", partition).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	smock.ExpectCommit()
+	smock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, newTestConsumerManager(db, factory).Rebalance(context.Background(), "orders", "billing"))
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestConsumerManager_EvictInstance(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	cm := newTestConsumerManager(db, new(MockFactory))
+
+	smock.ExpectExec("UPDATE mqx_consumer_instances\\s+SET active = FALSE").
+		WithArgs("billing", "orders", "gone").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, cm.EvictInstance(context.Background(), "orders", "billing", "gone"), ErrInstanceNotFound)
+
+	// Evicting the last instance leaves the partitions to the next instance joining
+	smock.ExpectExec("UPDATE mqx_consumer_instances\\s+SET active = FALSE").
+		WithArgs("billing", "orders", "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	smock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_instances`").WillReturnRows(instanceRows())
+	smock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, cm.EvictInstance(context.Background(), "orders", "billing", "a"))
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestConsumerManager_DeleteGroup(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	cm := newTestConsumerManager(db, new(MockFactory))
+
+	smock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_instances`").WillReturnRows(instanceRows("a"))
+	smock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, cm.DeleteGroup(context.Background(), "orders", "billing"), ErrGroupActive)
+
+	smock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_instances`").WillReturnRows(instanceRows())
+	smock.ExpectBegin()
+	smock.ExpectExec("DELETE FROM `mqx_consumer_offsets`").WithArgs("billing", "orders").WillReturnResult(sqlmock.NewResult(0, 4))
+	smock.ExpectExec("DELETE FROM `mqx_consumer_instances`").WithArgs("billing", "orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	smock.ExpectCommit()
+	smock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, cm.DeleteGroup(context.Background(), "orders", "billing"))
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func offsetRows(offsets ...int64) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"topic", "group", "partition", "offset", "instance_id"})
+	for partition, offset := range offsets {
+		rows.AddRow("orders", "billing", partition, offset, "")
+	}
+	return rows
+}
+
+func TestConsumerManager_ResetOffsets(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	messages := new(MockMessageManager)
+	messages.On("GetOffsetByTime", mock.Anything, "orders", 0, at).Return(int64(40), nil)
+	messages.On("GetOffsetByTime", mock.Anything, "orders", 1, at).Return(int64(0), nil)
+	messages.On("GetPartitionStat", mock.Anything, "orders", 0).Return(&interfaces.PartitionStat{MinOffset: 21, MaxOffset: 60}, nil)
+	messages.On("GetPartitionStat", mock.Anything, "orders", 1).Return(&interfaces.PartitionStat{MinOffset: 5, MaxOffset: 9}, nil)
+	factory := new(MockFactory)
+	factory.On("GetMessageManager").Return(messages)
+	cm := newTestConsumerManager(db, factory)
+	ctx := context.Background()
+
+	_, err = cm.ResetOffsets(ctx, &model.OffsetReset{Topic: "orders", Group: "billing", Target: "begin"})
+	assert.ErrorIs(t, err, ErrInvalidOffsetReset)
+
+	// A group with active instances would overwrite the reset with its next commit
+	smock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_instances`").WillReturnRows(instanceRows("a"))
+	smock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = cm.ResetOffsets(ctx, &model.OffsetReset{Topic: "orders", Group: "billing", Target: model.OffsetResetLatest})
+	assert.ErrorIs(t, err, ErrGroupActive)
+
+	// A time after the newest message of a partition moves to its end
+	smock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_instances`").WillReturnRows(instanceRows())
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_offsets`").WillReturnRows(offsetRows(55, 7))
+	smock.ExpectBegin()
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").WithArgs(int64(39), "billing", "orders", 0).WillReturnResult(sqlmock.NewResult(0, 1))
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").WithArgs(int64(9), "billing", "orders", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	smock.ExpectCommit()
+	smock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	results, err := cm.ResetOffsets(ctx, &model.OffsetReset{Topic: "orders", Group: "billing", Target: model.OffsetResetTime, Time: at})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.OffsetResetResult{{Partition: 0, Before: 55, After: 39}, {Partition: 1, Before: 7, After: 9}}, results)
+
+	// A dry run of a single partition writes nothing
+	smock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_instances`").WillReturnRows(instanceRows())
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_offsets`").WillReturnRows(offsetRows(55, 7))
+	smock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	partition := 0
+	results, err = cm.ResetOffsets(ctx, &model.OffsetReset{Topic: "orders", Group: "billing", Partition: &partition,
+		Target: model.OffsetResetEarliest, DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.OffsetResetResult{{Partition: 0, Before: 55, After: 20}}, results)
+
+	// An unknown group has no offsets
+	smock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_instances`").WillReturnRows(instanceRows())
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_consumer_offsets`").WillReturnRows(offsetRows())
+	smock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = cm.ResetOffsets(ctx, &model.OffsetReset{Topic: "orders", Group: "billing", Target: model.OffsetResetOffset, Offset: 3})
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestConsumerGroupManager_Heartbeat_Evicted(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	cgm := &consumerGroupManager{logger: logging.Discard(), db: db}
+
+	// An evicted instance is not updated and its record blocks the insert
+	smock.ExpectExec("UPDATE mqx_consumer_instances").
+		WithArgs("billing", "orders", "a").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	smock.ExpectExec("INSERT INTO mqx_consumer_instances").
+		WithArgs("billing", "orders", "a", "host-a").
+		WillReturnError(errors.New("Error 1062 (23000): Duplicate entry 'billing-orders-a' for key 'PRIMARY'"))
+
+	success, err := cgm.updateConsumerInstanceHeartbeat(context.Background(), "billing", "orders", "a", "host-a")
+	assert.False(t, success)
+	assert.ErrorIs(t, err, ErrInstanceEvicted)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
@@ -3,13 +3,15 @@ package consumer
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
-	"k8s.io/klog/v2"
 )
 
 // groupConsumer manages message consumption for a consumer group
@@ -21,39 +23,81 @@ type groupConsumer struct {
 	group              string
 	instanceID         string
 	partitionConsumers map[int]*partitionConsumer
-	handler            func(msg *model.Message) error
+	handler            func(ctx context.Context, msg *model.Message) error
 	stopChan           chan struct{}
 	mu                 sync.Mutex
+	// logger carries the topic, group and instance fields
+	logger logging.Logger
 }
 
 func (g *groupConsumer) Start(ctx context.Context) error {
-	klog.V(4).Infof("Starting group consumer for topic: %s, group: %s", g.topic, g.group)
+	g.logger.Debug("Starting group consumer")
 	go g.consume(ctx)
 	return nil
 }
 
+// Stop stops all partition consumers in parallel, waiting for their in-flight handlers
+// up to the ctx deadline. The returned error lists the abandoned messages.
 func (g *groupConsumer) Stop(ctx context.Context) error {
-	klog.V(4).Infof("Stopping group consumer for topic: %s, group: %s", g.topic, g.group)
+	g.logger.Debug("Stopping group consumer")
 	close(g.stopChan)
-	return nil
+	g.mu.Lock()
+	consumers := make([]*partitionConsumer, 0, len(g.partitionConsumers))
+	for partition, pc := range g.partitionConsumers {
+		consumers = append(consumers, pc)
+		delete(g.partitionConsumers, partition)
+	}
+	g.mu.Unlock()
+
+	errs := make([]error, len(consumers))
+	var wg sync.WaitGroup
+	for i, pc := range consumers {
+		wg.Add(1)
+		go func(i int, pc *partitionConsumer) {
+			defer wg.Done()
+			errs[i] = pc.Stop(ctx)
+		}(i, pc)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// partitionHealth returns the partitions currently consumed by this group consumer
+func (g *groupConsumer) partitionHealth() []model.PartitionHealth {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	partitions := make([]model.PartitionHealth, 0, len(g.partitionConsumers))
+	for partition, pc := range g.partitionConsumers {
+		partitions = append(partitions, model.PartitionHealth{Partition: partition, LastPoll: unixNanoTime(pc.lastPoll.Load())})
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Partition < partitions[j].Partition })
+	return partitions
 }
 
 func (g *groupConsumer) consume(ctx context.Context) {
-	klog.V(4).Infof("Starting consume loop for topic: %s, group: %s", g.topic, g.group)
+	g.logger.Debug("Starting consume loop")
+	errLog := logging.NewThrottle(g.logger, 0)
 	for {
 		select {
 		case <-g.stopChan:
-			klog.V(4).Infof("Stopping consume loop for topic: %s, group: %s", g.topic, g.group)
+			g.logger.Debug("Stopping consume loop")
 			return
 		default:
 			start := time.Now()
 			if err := g.refreshConsumerPatitions(ctx); err != nil {
-				klog.Errorf("Failed to refresh consumer partitions: %v", err)
+				errLog.Error("Failed to refresh consumer partitions", "error", err)
+			} else {
+				errLog.Reset()
 			}
 			elapsed := time.Since(start)
-			klog.V(4).Infof("Refresh consumer partitions took %s", elapsed)
+			g.logger.Debug("Refreshed consumer partitions", "elapsed", elapsed)
 			if elapsed < g.cfg.RefreshConsumerPartitionsInterval {
-				time.Sleep(g.cfg.RefreshConsumerPartitionsInterval - elapsed)
+				timer := time.NewTimer(g.cfg.RefreshConsumerPartitionsInterval - elapsed)
+				select {
+				case <-g.stopChan:
+				case <-timer.C:
+				}
+				timer.Stop()
 			}
 		}
 	}
@@ -63,12 +107,18 @@ func (g *groupConsumer) refreshConsumerPatitions(ctx context.Context) error {
 	// Get assigned partitions for this consumer instance
 	consumerOffsets, err := g.getConsumerOffsets(ctx, g.group, g.topic, g.instanceID)
 	if err != nil {
-		klog.Errorf("Failed to get consumer partitions: %v", err)
 		return err
 	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	select {
+	case <-g.stopChan:
+		// Stopped while fetching assignments: don't start new partition consumers
+		return nil
+	default:
+	}
+
 	// Maintain partition consumers
 	for _, offset := range consumerOffsets {
 
@@ -76,7 +126,7 @@ func (g *groupConsumer) refreshConsumerPatitions(ctx context.Context) error {
 			g.partitionConsumers = make(map[int]*partitionConsumer)
 		}
 		if _, ok := g.partitionConsumers[offset.Partition]; !ok {
-			klog.V(4).Infof("Creating new partition consumer for partition %d", offset.Partition)
+			g.logger.Debug("Creating new partition consumer", "partition", offset.Partition)
 			pc := &partitionConsumer{
 				db:         g.db,
 				factory:    g.factory,
@@ -87,6 +137,7 @@ func (g *groupConsumer) refreshConsumerPatitions(ctx context.Context) error {
 				instanceID: g.instanceID,
 				handler:    g.handler,
 				stopChan:   make(chan struct{}),
+				logger:     g.logger.With("partition", offset.Partition),
 			}
 			pc.Start(ctx)
 			g.partitionConsumers[offset.Partition] = pc
@@ -104,8 +155,8 @@ func (g *groupConsumer) refreshConsumerPatitions(ctx context.Context) error {
 			}
 		}
 		if !exist {
-			klog.V(4).Infof("Removing partition consumer for partition %d", partition)
-			pc.Stop(ctx)
+			g.logger.Debug("Removing partition consumer", "partition", partition)
+			pc.revoke()
 			delete(g.partitionConsumers, partition)
 		}
 	}
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
 )
 
@@ -24,6 +25,7 @@ func TestGroupConsumer_Start(t *testing.T) {
 		Return([]model.ConsumerOffset{}, nil)
 
 	gc := &groupConsumer{
+		logger:             logging.Discard(),
 		db:                 db,
 		factory:            mockFactory,
 		cfg:                &config.Config{RefreshConsumerPartitionsInterval: time.Second * 30},
@@ -31,7 +33,7 @@ func TestGroupConsumer_Start(t *testing.T) {
 		group:              "test-group",
 		instanceID:         "test-instance",
 		partitionConsumers: make(map[int]*partitionConsumer),
-		handler:            func(msg *model.Message) error { return nil },
+		handler:            func(ctx context.Context, msg *model.Message) error { return nil },
 		stopChan:           make(chan struct{}),
 	}
 
@@ -48,6 +50,7 @@ func TestGroupConsumer_Stop(t *testing.T) {
 	defer db.Close()
 
 	gc := &groupConsumer{
+		logger:   logging.Discard(),
 		db:       db,
 		stopChan: make(chan struct{}),
 	}
@@ -68,6 +71,7 @@ func TestGroupConsumer_Consume(t *testing.T) {
 		Return([]model.ConsumerOffset{}, nil)
 
 	gc := &groupConsumer{
+		logger:             logging.Discard(),
 		db:                 db,
 		factory:            mockFactory,
 		cfg:                &config.Config{RefreshConsumerPartitionsInterval: time.Second * 30},
@@ -75,7 +79,7 @@ func TestGroupConsumer_Consume(t *testing.T) {
 		group:              "test-group",
 		instanceID:         "test-instance",
 		partitionConsumers: make(map[int]*partitionConsumer),
-		handler:            func(msg *model.Message) error { return nil },
+		handler:            func(ctx context.Context, msg *model.Message) error { return nil },
 		stopChan:           make(chan struct{}),
 	}
 
@@ -99,6 +103,7 @@ func TestGroupConsumer_GetConsumerPartitions(t *testing.T) {
 	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
 
 	gc := &groupConsumer{
+		logger:     logging.Discard(),
 		factory:    mockFactory,
 		topic:      "test-topic",
 		group:      "test-group",
@@ -129,6 +134,7 @@ func TestGroupConsumer_PartitionManagement(t *testing.T) {
 	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
 
 	gc := &groupConsumer{
+		logger:             logging.Discard(),
 		db:                 db,
 		factory:            mockFactory,
 		cfg:                &config.Config{PullingSize: 100, PullingInterval: time.Second},
@@ -136,7 +142,7 @@ func TestGroupConsumer_PartitionManagement(t *testing.T) {
 		group:              "test-group",
 		instanceID:         "test-instance",
 		partitionConsumers: make(map[int]*partitionConsumer),
-		handler:            func(msg *model.Message) error { return nil },
+		handler:            func(ctx context.Context, msg *model.Message) error { return nil },
 		stopChan:           make(chan struct{}),
 	}
 
@@ -153,6 +159,7 @@ func TestGroupConsumer_PartitionManagement(t *testing.T) {
 	for _, partition := range partitions {
 		assert.NotContains(t, gc.partitionConsumers, partition.Partition)
 		pc := &partitionConsumer{
+			logger:     logging.Discard(),
 			db:         gc.db,
 			factory:    gc.factory,
 			cfg:        gc.cfg,
@@ -3,14 +3,20 @@ package consumer
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
 	"github.com/wenzuojing/mqx/internal/template"
-	"k8s.io/klog/v2"
+	"github.com/wenzuojing/mqx/internal/tracing"
 )
 
 // partitionConsumer handles message consumption for a specific partition
@@ -22,25 +28,91 @@ type partitionConsumer struct {
 	group      string
 	partition  int
 	instanceID string
-	handler    func(msg *model.Message) error
+	handler    func(ctx context.Context, msg *model.Message) error
 	stopChan   chan struct{}
+	// cancel cancels the context handed to running handlers when the partition is revoked or stopped
+	cancel context.CancelFunc
+	// done is closed when the consume loop has exited
+	done chan struct{}
+	// inflight holds the message being handled, if any
+	inflight atomic.Pointer[model.Message]
+	// logger carries the topic, group, instance and partition fields
+	logger logging.Logger
+	// lastPoll is the unix nano time of the last successful fetch
+	lastPoll atomic.Int64
 }
 
 func (p *partitionConsumer) Start(ctx context.Context) error {
-	klog.V(4).Infof("Starting partition consumer for topic: %s, partition: %d", p.topic, p.partition)
-	go p.consume(context.Background())
+	p.logger.Debug("Starting partition consumer")
+	consumeCtx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		p.consume(consumeCtx)
+	}()
 	return nil
 }
 
+// Stop stops fetching and waits for the in-flight handler to finish and commit its offset.
+// When ctx expires first, the handler context is cancelled and the message is reported as
+// abandoned; it will be redelivered to the next owner of the partition.
 func (p *partitionConsumer) Stop(ctx context.Context) error {
-	klog.V(4).Infof("Stopping partition consumer for topic: %s, partition: %d", p.topic, p.partition)
+	p.logger.Debug("Stopping partition consumer")
 	close(p.stopChan)
-	return nil
+	if p.done == nil {
+		return nil
+	}
+	defer p.factory.GetMetrics().PartitionReleased(p.topic, p.group, p.partition)
+	select {
+	case <-p.done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		if msg := p.inflight.Load(); msg != nil {
+			return fmt.Errorf("abandoned in-flight message %s of topic %s partition %d: %w", msg.MessageID, p.topic, p.partition, ctx.Err())
+		}
+		return nil
+	}
+}
+
+// revoke stops the partition consumer without waiting, cancelling the running handler.
+// Used when the partition is reassigned to another instance.
+func (p *partitionConsumer) revoke() {
+	p.logger.Debug("Revoking partition consumer")
+	close(p.stopChan)
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.factory.GetMetrics().PartitionReleased(p.topic, p.group, p.partition)
+}
+
+// sleep waits for d or until the partition consumer is stopped
+func (p *partitionConsumer) sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-p.stopChan:
+	case <-timer.C:
+	}
+}
+
+// stopped reports whether the partition consumer has been asked to stop
+func (p *partitionConsumer) stopped() bool {
+	select {
+	case <-p.stopChan:
+		return true
+	default:
+		return false
+	}
 }
 
 func (p *partitionConsumer) consume(ctx context.Context) {
 	isBroadcast := strings.HasPrefix(p.group, "__broadcast__")
 	_broadcastOffset := int64(0)
+	// errLog keeps a failing database from logging on every poll
+	errLog := logging.NewThrottle(p.logger, 0)
 
 	// For broadcast mode, start from the latest offset to only consume new messages.
 	// Retry until successful to avoid consuming all historical messages (offset 0).
@@ -53,10 +125,12 @@ func (p *partitionConsumer) consume(ctx context.Context) {
 			default:
 				maxOffset, err := p.factory.GetMessageManager().GetMaxOffset(ctx, p.topic, p.partition)
 				if err != nil {
-					klog.Warningf("Failed to get max offset for broadcast, retrying: %v", err)
-					time.Sleep(time.Second)
+					errLog.Error("Failed to get max offset for broadcast, retrying", "error", err)
+					p.sleep(time.Second)
 				} else {
 					_broadcastOffset = maxOffset
+					p.factory.GetMetrics().OffsetCommitted(p.topic, p.group, p.partition, maxOffset)
+					errLog.Reset()
 					break initBroadcast
 				}
 			}
@@ -66,7 +140,7 @@ func (p *partitionConsumer) consume(ctx context.Context) {
 	for {
 		select {
 		case <-p.stopChan:
-			klog.V(4).Info("Partition consumer received stop signal")
+			p.logger.Debug("Partition consumer received stop signal")
 			return
 		default:
 			start := time.Now()
@@ -78,41 +152,69 @@ func (p *partitionConsumer) consume(ctx context.Context) {
 				lastOffset, err := p.getOffset(ctx, p.group, p.topic, p.partition, p.instanceID)
 				if err != nil {
 					if err != ErrOffsetNotFound {
-						klog.Errorf("Failed to get consumer offset: %v, group: %s, topic: %s, partition: %d, instanceID: %s", err, p.group, p.topic, p.partition, p.instanceID)
+						errLog.Error("Failed to get consumer offset", "error", err)
 					}
-					time.Sleep(time.Second * 5)
+					p.sleep(time.Second * 5)
 					break
 				}
 				offset = lastOffset
+				// Tracks the lag of the partition before its first commit, e.g. when stuck on its first message
+				if !p.stopped() {
+					p.factory.GetMetrics().OffsetCommitted(p.topic, p.group, p.partition, offset)
+				}
 			}
 
 			// Fetch messages from the current offset
 			msgs, err := p.factory.GetMessageManager().GetMessages(ctx, p.topic, p.group, p.partition, offset, p.cfg.PullingSize)
 			if err != nil {
 				if !strings.Contains(err.Error(), "doesn't exist") {
-					klog.Errorf("Failed to get messages: %v", err)
+					errLog.Error("Failed to get messages", "offset", offset, "error", err)
 				}
 			} else {
+				errLog.Reset()
+				p.lastPoll.Store(time.Now().UnixNano())
+				// skipped is the offset of the last skipped message not covered by a commit yet, -1 when none
+				skipped := int64(-1)
 				// Process fetched messages
 				for _, msg := range msgs {
-					if err := p.callHandler(msg); err != nil {
+					if p.stopped() {
+						break
+					}
+					if target := msg.Headers[model.HeaderTargetGroup]; target != "" && target != p.group {
+						// Resent or replayed to another group only: move past it without handling.
+						// The commit of the next handled message, or the one after the batch, covers it.
+						if isBroadcast {
+							_broadcastOffset = msg.Offset + 1
+						} else {
+							skipped = msg.Offset
+						}
+						continue
+					}
+					skipped = -1
+					p.inflight.Store(msg)
+					handleStart := time.Now()
+					spanCtx, span := p.factory.GetTracer().StartProcess(ctx, msg, p.group)
+					err := p.callHandler(spanCtx, msg)
+					tracing.End(span, err)
+					p.inflight.Store(nil)
+					p.factory.GetMetrics().HandlerDone(p.topic, p.group, handleStart, err)
+					p.traceConsumed(msg, err)
+					if err != nil {
+						if p.stopped() {
+							// Revoked or stopped while handling: leave the offset for the next owner
+							p.logger.Debug("Partition consumer stopped while handling message", "messageId", msg.MessageID, "error", err)
+							break
+						}
 						// Handler failed - decide between retry or DLQ
-						if msg.RetryCount >= p.cfg.RetryTimes-1 {
+						if errors.Is(err, ErrDeadLetter) {
+							// Unrecoverable failure -> dead letter queue without burning retries
+							p.logger.Error("Message cannot be processed, sending to DLQ", "messageId", msg.MessageID, "error", err)
+							p.sendToDeadLetter(ctx, msg)
+						} else if msg.RetryCount >= p.cfg.RetryTimes-1 {
 							// Max retries exhausted -> dead letter queue
-							klog.Errorf("Message %s exhausted retries (%d), sending to DLQ: %v",
-								msg.MessageID, p.cfg.RetryTimes, err)
-							_, dlqErr := p.factory.GetMessageManager().SaveMessage(ctx, &model.Message{
-								MessageID: msg.MessageID,
-								Topic:     msg.Topic + "_dead",
-								Partition: msg.Partition,
-								Key:       msg.Key,
-								Tag:       msg.Tag,
-								BornTime:  msg.BornTime,
-								Body:      msg.Body,
-							})
-							if dlqErr != nil {
-								klog.Errorf("Failed to save message to dead letter queue: %v", dlqErr)
-							}
+							p.logger.Error("Message exhausted retries, sending to DLQ", "messageId", msg.MessageID,
+								"retryTimes", p.cfg.RetryTimes, "error", err)
+							p.sendToDeadLetter(ctx, msg)
 						} else {
 							// Schedule async retry via delay queue
 							backoff := p.cfg.RetryInterval * (1 << uint(msg.RetryCount))
@@ -120,35 +222,37 @@ func (p *partitionConsumer) consume(ctx context.Context) {
 								// Overflow protection
 								backoff = time.Minute * 5
 							}
-							klog.V(4).Infof("Scheduling retry for message %s (attempt %d/%d) in %v",
-								msg.MessageID, msg.RetryCount+1, p.cfg.RetryTimes, backoff)
-							_, retryErr := p.factory.GetDelayManager().AddRetry(ctx, &model.RetryMessage{
+							p.logger.Debug("Scheduling retry for message", "messageId", msg.MessageID,
+								"attempt", msg.RetryCount+1, "retryTimes", p.cfg.RetryTimes, "backoff", backoff)
+							retry := &model.RetryMessage{
 								Message:    *msg,
 								RetryCount: msg.RetryCount + 1,
 								Delay:      backoff,
-							})
+							}
+							// The retry continues the trace of the failed attempt
+							p.factory.GetTracer().Inject(spanCtx, &retry.Message)
+							_, retryErr := p.factory.GetDelayManager().AddRetry(ctx, retry)
 							if retryErr != nil {
-								klog.Errorf("Failed to schedule retry for message %s: %v", msg.MessageID, retryErr)
+								p.logger.Error("Failed to schedule retry for message", "messageId", msg.MessageID, "error", retryErr)
 								// Fallback to DLQ to prevent message loss
-								p.factory.GetMessageManager().SaveMessage(ctx, &model.Message{
-									MessageID: msg.MessageID,
-									Topic:     msg.Topic + "_dead",
-									Partition: msg.Partition,
-									Key:       msg.Key,
-									Tag:       msg.Tag,
-									BornTime:  msg.BornTime,
-									Body:      msg.Body,
-								})
+								p.sendToDeadLetter(ctx, msg)
+							} else {
+								p.factory.GetMetrics().Retried(p.topic, p.group)
+								event := p.traceEvent(msg, model.TraceRetryScheduled)
+								event.RetryCount = retry.RetryCount
+								event.DelayTime = event.Time.Add(backoff)
+								p.factory.GetTraceManager().Record(event)
 							}
 						}
 
 						// Advance offset (both DLQ and retry paths)
 						if !isBroadcast {
 							if updErr := p.updateConsumerOffset(ctx, p.group, p.topic, p.partition, p.instanceID, msg.Offset); updErr != nil {
-								klog.Errorf("Failed to advance offset: %v", updErr)
+								p.logger.Error("Failed to advance offset", "offset", msg.Offset, "error", updErr)
 							}
 						} else {
 							_broadcastOffset = msg.Offset + 1
+							p.factory.GetMetrics().OffsetCommitted(p.topic, p.group, p.partition, msg.Offset)
 						}
 						continue
 					}
@@ -156,20 +260,26 @@ func (p *partitionConsumer) consume(ctx context.Context) {
 					// Update offset tracking after successful processing
 					if isBroadcast {
 						_broadcastOffset = msg.Offset + 1
+						p.factory.GetMetrics().OffsetCommitted(p.topic, p.group, p.partition, msg.Offset)
 					} else {
 						err := p.updateConsumerOffset(ctx, p.group, p.topic, p.partition, p.instanceID, msg.Offset)
 						if err != nil {
-							klog.Errorf("Failed to update consumer offset: %v", err)
+							p.logger.Error("Failed to update consumer offset", "offset", msg.Offset, "error", err)
 							break
 						}
 					}
 				}
+				if skipped >= 0 && !p.stopped() {
+					if err := p.updateConsumerOffset(ctx, p.group, p.topic, p.partition, p.instanceID, skipped); err != nil {
+						p.logger.Error("Failed to update consumer offset", "offset", skipped, "error", err)
+					}
+				}
 			}
 
 			// Control polling interval
 			elapsed := time.Since(start)
 			if elapsed < p.cfg.PullingInterval {
-				time.Sleep(p.cfg.PullingInterval - elapsed)
+				p.sleep(p.cfg.PullingInterval - elapsed)
 			}
 		}
 	}
@@ -189,6 +299,7 @@ func (p *partitionConsumer) updateConsumerOffset(ctx context.Context, group stri
 	if rowsAffected == 0 {
 		return ErrOffsetUpdate
 	}
+	p.factory.GetMetrics().OffsetCommitted(topic, group, partition, offset)
 	return nil
 }
 
@@ -205,8 +316,67 @@ func (p *partitionConsumer) getOffset(ctx context.Context, group string, topic s
 	return 0, ErrOffsetNotFound
 }
 
+// sendToDeadLetter saves a message to the dead letter queue of its topic, recording the group so that
+// a redrive delivers it to this group only
+func (p *partitionConsumer) sendToDeadLetter(ctx context.Context, msg *model.Message) {
+	headers := maps.Clone(msg.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[model.HeaderDeadLetterGroup] = p.group
+	_, err := p.factory.GetMessageManager().SaveMessage(ctx, &model.Message{
+		MessageID: msg.MessageID,
+		Topic:     model.DeadLetterTopic(msg.Topic),
+		Partition: msg.Partition,
+		Key:       msg.Key,
+		Tag:       msg.Tag,
+		BornTime:  msg.BornTime,
+		Body:      msg.Body,
+		Headers:   headers,
+	})
+	if err != nil {
+		p.logger.Error("Failed to save message to dead letter queue", "messageId", msg.MessageID, "error", err)
+		return
+	}
+	p.factory.GetMetrics().DeadLettered(p.topic, p.group)
+	p.factory.GetTraceManager().Record(p.traceEvent(msg, model.TraceDeadLettered))
+}
+
+// traceEvent creates a trace event of a message handled by this partition consumer
+func (p *partitionConsumer) traceEvent(msg *model.Message, event model.TraceEventType) *model.TraceEvent {
+	e := msgtrace.NewEvent(msg, event)
+	e.Group = p.group
+	e.InstanceID = p.instanceID
+	return e
+}
+
+// traceConsumed records the result of a delivery attempt
+func (p *partitionConsumer) traceConsumed(msg *model.Message, err error) {
+	event := p.traceEvent(msg, model.TraceConsumed)
+	event.Result = model.TraceResultSuccess
+	if err != nil {
+		event.Result = model.TraceResultFailure
+		event.Error = err.Error()
+	}
+	p.factory.GetTraceManager().Record(event)
+}
+
 // callHandler executes message handler once without retry.
 // Retry logic is now handled asynchronously via the delay queue.
-func (p *partitionConsumer) callHandler(msg *model.Message) error {
-	return p.handler(msg)
+// A panicking handler is reported as a handler error so the partition keeps consuming.
+// The handler context is cancelled when the partition consumer stops and carries the
+// configured handler timeout as its deadline.
+func (p *partitionConsumer) callHandler(ctx context.Context, msg *model.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.logger.Error("Message handler panicked", "messageId", msg.MessageID, "panic", r)
+			err = fmt.Errorf("message handler panicked: %v", r)
+		}
+	}()
+	if p.cfg.HandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.HandlerTimeout)
+		defer cancel()
+	}
+	return p.handler(ctx, msg)
 }
@@ -4,20 +4,33 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/metrics"
 	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+	"github.com/wenzuojing/mqx/internal/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MockFactory implements interfaces.Factory for testing
 type MockFactory struct {
 	mock.Mock
+	tracer  *tracing.Tracer
+	metrics *metrics.Metrics
 }
 
 func (m *MockFactory) GetMessageManager() interfaces.MessageManager {
@@ -50,6 +63,48 @@ func (m *MockFactory) GetClearManager() interfaces.ClearManager {
 	return args.Get(0).(interfaces.ClearManager)
 }
 
+func (m *MockFactory) GetTransactionManager() interfaces.TransactionManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.TransactionManager)
+}
+
+func (m *MockFactory) GetReplyManager() interfaces.ReplyManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ReplyManager)
+}
+
+func (m *MockFactory) GetMetrics() *metrics.Metrics {
+	return m.metrics
+}
+
+func (m *MockFactory) GetTracer() *tracing.Tracer {
+	return m.tracer
+}
+
+func (m *MockFactory) GetLogger() logging.Logger {
+	return logging.Discard()
+}
+
+func (m *MockFactory) GetTraceManager() *msgtrace.Manager {
+	return nil
+}
+
+func (m *MockFactory) GetHealthChecker() interfaces.HealthChecker {
+	return nil
+}
+
+func (m *MockFactory) GetAuditManager() interfaces.AuditManager {
+	return nil
+}
+
+func (m *MockFactory) GetReplayManager() interfaces.ReplayManager {
+	return nil
+}
+
+func (m *MockFactory) GetWebhookManager() interfaces.WebhookManager {
+	return nil
+}
+
 // MockMessageManager implements interfaces.MessageManager for testing
 type MockMessageManager struct {
 	mock.Mock
@@ -70,6 +125,11 @@ func (m *MockMessageManager) SaveMessage(ctx context.Context, msg *model.Message
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockMessageManager) SaveMessages(ctx context.Context, msgs []*model.Message) error {
+	args := m.Called(ctx, msgs)
+	return args.Error(0)
+}
+
 func (m *MockMessageManager) GetMessages(ctx context.Context, topic string, group string, partition int, offset int64, size int) ([]*model.Message, error) {
 	args := m.Called(ctx, topic, group, partition, offset, size)
 	return args.Get(0).([]*model.Message), args.Error(1)
@@ -85,14 +145,24 @@ func (m *MockMessageManager) GetPartitionStat(ctx context.Context, topic string,
 	return args.Get(0).(*interfaces.PartitionStat), args.Error(1)
 }
 
+func (m *MockMessageManager) UpdateHeaders(ctx context.Context, msgs []*model.Message) error {
+	args := m.Called(ctx, msgs)
+	return args.Error(0)
+}
+
+func (m *MockMessageManager) GetOffsetByTime(ctx context.Context, topic string, partition int, t time.Time) (int64, error) {
+	args := m.Called(ctx, topic, partition, t)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *MockMessageManager) DeleteMessages(ctx context.Context, topic string, partition int) error {
 	args := m.Called(ctx, topic, partition)
 	return args.Error(0)
 }
 
-func (m *MockMessageManager) QueryMessageForPage(ctx context.Context, topic string, partition int, messageID string, tag string, pageNo int, pageSize int) (int, []*model.Message, error) {
-	args := m.Called(ctx, topic, partition, messageID, tag, pageNo, pageSize)
-	return args.Int(0), args.Get(1).([]*model.Message), args.Error(2)
+func (m *MockMessageManager) SearchMessages(ctx context.Context, filter *model.MessageFilter) (*model.MessagePage, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(*model.MessagePage), args.Error(1)
 }
 
 func (m *MockMessageManager) SaveMessageWithTx(ctx context.Context, tx *sql.Tx, msg *model.Message) error {
@@ -114,6 +184,7 @@ func TestPartitionConsumer_Start(t *testing.T) {
 		Maybe().Return([]model.ConsumerOffset{}, nil)
 
 	pc := &partitionConsumer{
+		logger:     logging.Discard(),
 		db:         db,
 		factory:    mockFactory,
 		cfg:        &config.Config{PullingInterval: time.Second, RetryTimes: 3},
@@ -121,7 +192,7 @@ func TestPartitionConsumer_Start(t *testing.T) {
 		group:      "test-group",
 		partition:  0,
 		instanceID: "test-instance",
-		handler:    func(msg *model.Message) error { return nil },
+		handler:    func(ctx context.Context, msg *model.Message) error { return nil },
 		stopChan:   make(chan struct{}),
 	}
 
@@ -139,6 +210,7 @@ func TestPartitionConsumer_Stop(t *testing.T) {
 	defer db.Close()
 
 	pc := &partitionConsumer{
+		logger:   logging.Discard(),
 		db:       db,
 		stopChan: make(chan struct{}),
 	}
@@ -186,6 +258,7 @@ func TestPartitionConsumer_Consume(t *testing.T) {
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	pc := &partitionConsumer{
+		logger:     logging.Discard(),
 		db:         db,
 		factory:    mockFactory,
 		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3},
@@ -193,7 +266,7 @@ func TestPartitionConsumer_Consume(t *testing.T) {
 		group:      "test-group",
 		partition:  0,
 		instanceID: "test-instance",
-		handler:    func(msg *model.Message) error { return nil },
+		handler:    func(ctx context.Context, msg *model.Message) error { return nil },
 		stopChan:   make(chan struct{}),
 	}
 
@@ -212,14 +285,128 @@ func TestPartitionConsumer_Consume(t *testing.T) {
 	mockMsgManager.AssertExpectations(t)
 }
 
+type fakeOffsetReader int64
+
+func (f fakeOffsetReader) GetMaxOffset(ctx context.Context, topic string, partition int) (int64, error) {
+	return int64(f), nil
+}
+
+func TestPartitionConsumer_Consume_TracksLagBeforeFirstCommit(t *testing.T) {
+	mockMsgManager := new(MockMessageManager)
+	mockConsumerManager := new(MockConsumerManager)
+	mockFactory := &MockFactory{metrics: metrics.New(fakeOffsetReader(5), nil, logging.Discard())}
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
+
+	mockConsumerManager.On("GetConsumerOffsets", mock.Anything, "test-topic", "test-group").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "test-instance", Offset: 0}}, nil)
+	mockMsgManager.On("GetMessages", mock.Anything, "test-topic", "test-group", 0, int64(0), 100).
+		Return([]*model.Message{{MessageID: "msg-1", Topic: "test-topic", Offset: 1}}, nil)
+
+	// The handler is stuck on the first message, nothing is committed
+	handling := make(chan struct{})
+	pc := &partitionConsumer{
+		logger:     logging.Discard(),
+		factory:    mockFactory,
+		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3},
+		topic:      "test-topic",
+		group:      "test-group",
+		partition:  0,
+		instanceID: "test-instance",
+		handler: func(ctx context.Context, msg *model.Message) error {
+			close(handling)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		stopChan: make(chan struct{}),
+	}
+	assert.NoError(t, pc.Start(context.Background()))
+	<-handling
+
+	reg := prometheus.NewRegistry()
+	assert.NoError(t, mockFactory.metrics.Register(reg))
+	expected := `
+# HELP mqx_consumer_lag Number of messages between the newest offset and the committed offset of the partitions consumed by this instance.
+# TYPE mqx_consumer_lag gauge
+mqx_consumer_lag{group="test-group",partition="0",topic="test-topic"} 5
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "mqx_consumer_lag"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	pc.Stop(ctx)
+	count, err := testutil.GatherAndCount(reg, "mqx_consumer_lag")
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestPartitionConsumer_Consume_SkipsMessagesTargetedAtOtherGroups(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockConsumerManager := new(MockConsumerManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
+
+	testMessages := []*model.Message{
+		{MessageID: "msg-1", Topic: "test-topic", Offset: 1, Headers: map[string]string{model.HeaderTargetGroup: "other-group"}},
+		{MessageID: "msg-2", Topic: "test-topic", Offset: 2, Headers: map[string]string{model.HeaderTargetGroup: "other-group"}},
+		{MessageID: "msg-3", Topic: "test-topic", Offset: 3, Headers: map[string]string{model.HeaderTargetGroup: "test-group"}},
+		{MessageID: "msg-4", Topic: "test-topic", Offset: 4, Headers: map[string]string{model.HeaderTargetGroup: "other-group"}},
+		{MessageID: "msg-5", Topic: "test-topic", Offset: 5, Headers: map[string]string{model.HeaderTargetGroup: "other-group"}},
+	}
+	mockConsumerManager.On("GetConsumerOffsets", mock.Anything, "test-topic", "test-group").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "test-instance", Offset: 0}}, nil)
+	mockMsgManager.On("GetMessages", mock.Anything, "test-topic", "test-group", 0, int64(0), 100).Return(testMessages, nil)
+
+	// The skipped messages still move the offset, with one commit for each run of them: the commit
+	// of the handled message covers those before it and the commit after the batch the rest
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(3), "test-group", "test-topic", 0, "test-instance").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(5), "test-group", "test-topic", 0, "test-instance").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	var handled []string
+	pc := &partitionConsumer{
+		logger:     logging.Discard(),
+		db:         db,
+		factory:    mockFactory,
+		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3},
+		topic:      "test-topic",
+		group:      "test-group",
+		partition:  0,
+		instanceID: "test-instance",
+		handler: func(ctx context.Context, msg *model.Message) error {
+			handled = append(handled, msg.MessageID)
+			return nil
+		},
+		stopChan: make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pc.Start(ctx)
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, pc.Stop(ctx))
+
+	assert.Equal(t, []string{"msg-3"}, handled)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
 func TestPartitionConsumer_CallHandler(t *testing.T) {
 	handlerCalled := false
-	handler := func(msg *model.Message) error {
+	handler := func(ctx context.Context, msg *model.Message) error {
 		handlerCalled = true
 		return nil
 	}
 
 	pc := &partitionConsumer{
+		logger:  logging.Discard(),
 		cfg:     &config.Config{},
 		handler: handler,
 	}
@@ -229,7 +416,7 @@ func TestPartitionConsumer_CallHandler(t *testing.T) {
 		Body:      []byte("test message"),
 	}
 
-	err := pc.callHandler(msg)
+	err := pc.callHandler(context.Background(), msg)
 	assert.NoError(t, err)
 	assert.True(t, handlerCalled)
 }
@@ -254,6 +441,27 @@ func (m *MockDelayManager) DeleteMessagesByTopic(ctx context.Context, topic stri
 	return args.Error(0)
 }
 
+func (m *MockDelayManager) GetQueueStat(ctx context.Context) (*model.DelayQueueStat, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*model.DelayQueueStat), args.Error(1)
+}
+
+func (m *MockDelayManager) Query(ctx context.Context, filter *model.DelayFilter) (int64, []*model.DelayMessage, error) {
+	args := m.Called(ctx, filter)
+	msgs, _ := args.Get(1).([]*model.DelayMessage)
+	return args.Get(0).(int64), msgs, args.Error(2)
+}
+
+func (m *MockDelayManager) Cancel(ctx context.Context, messageID string) error {
+	args := m.Called(ctx, messageID)
+	return args.Error(0)
+}
+
+func (m *MockDelayManager) LastCycleTime() time.Time {
+	args := m.Called()
+	return args.Get(0).(time.Time)
+}
+
 func (m *MockDelayManager) Start(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
@@ -296,7 +504,7 @@ func TestPartitionConsumer_Consume_HandlerFailure_TriggersAddRetry(t *testing.T)
 		Return(testMessages, nil)
 
 	// Handler fails
-	handler := func(msg *model.Message) error {
+	handler := func(ctx context.Context, msg *model.Message) error {
 		return errors.New("handler error")
 	}
 
@@ -312,6 +520,7 @@ func TestPartitionConsumer_Consume_HandlerFailure_TriggersAddRetry(t *testing.T)
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	pc := &partitionConsumer{
+		logger:     logging.Discard(),
 		db:         db,
 		factory:    mockFactory,
 		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3, RetryInterval: time.Second * 3},
@@ -366,13 +575,13 @@ func TestPartitionConsumer_Consume_MaxRetriesExhausted_TriggersDLQ(t *testing.T)
 		Return(testMessages, nil)
 
 	// Handler fails
-	handler := func(msg *model.Message) error {
+	handler := func(ctx context.Context, msg *model.Message) error {
 		return errors.New("handler error")
 	}
 
-	// Expect SaveMessage to DLQ (not AddRetry)
+	// Expect SaveMessage to DLQ (not AddRetry), recording the group
 	mockMsgManager.On("SaveMessage", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool {
-		return msg.Topic == "test-topic_dead" && msg.MessageID == "msg-1"
+		return msg.Topic == "test-topic_dead" && msg.MessageID == "msg-1" && msg.Headers[model.HeaderDeadLetterGroup] == "test-group"
 	})).Return("msg-1", nil)
 
 	// Expect offset to advance
@@ -381,6 +590,76 @@ func TestPartitionConsumer_Consume_MaxRetriesExhausted_TriggersDLQ(t *testing.T)
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	pc := &partitionConsumer{
+		logger:     logging.Discard(),
+		db:         db,
+		factory:    mockFactory,
+		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3},
+		topic:      "test-topic",
+		group:      "test-group",
+		partition:  0,
+		instanceID: "test-instance",
+		handler:    handler,
+		stopChan:   make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	go pc.consume(ctx)
+	time.Sleep(time.Millisecond * 100)
+	pc.Stop(ctx)
+
+	assert.NoError(t, smock.ExpectationsWereMet())
+	mockMsgManager.AssertExpectations(t)
+}
+
+func TestPartitionConsumer_Consume_DeadLetterError_SkipsRetry(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockConsumerManager := new(MockConsumerManager)
+	mockDelayManager := new(MockDelayManager)
+
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
+	mockFactory.On("GetDelayManager").Return(mockDelayManager)
+
+	testMessages := []*model.Message{
+		{
+			MessageID:  "msg-1",
+			Topic:      "test-topic",
+			Partition:  0,
+			Offset:     1,
+			RetryCount: 0,
+			Body:       []byte("test message"),
+		},
+	}
+
+	mockConsumerManager.On("GetConsumerOffsets", mock.Anything, "test-topic", "test-group").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "test-instance", Offset: 0}}, nil)
+
+	mockMsgManager.On("GetMessages", mock.Anything, "test-topic", "test-group", 0, int64(0), 100).
+		Return(testMessages, nil)
+
+	// Handler reports an unrecoverable failure
+	handler := func(ctx context.Context, msg *model.Message) error {
+		return fmt.Errorf("%w: cannot decode", ErrDeadLetter)
+	}
+
+	// Expect SaveMessage to DLQ on the first attempt
+	mockMsgManager.On("SaveMessage", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool {
+		return msg.Topic == "test-topic_dead" && msg.MessageID == "msg-1"
+	})).Return("msg-1", nil)
+
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(1), "test-group", "test-topic", 0, "test-instance").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	pc := &partitionConsumer{
+		logger:     logging.Discard(),
 		db:         db,
 		factory:    mockFactory,
 		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3},
@@ -401,4 +680,211 @@ func TestPartitionConsumer_Consume_MaxRetriesExhausted_TriggersDLQ(t *testing.T)
 
 	assert.NoError(t, smock.ExpectationsWereMet())
 	mockMsgManager.AssertExpectations(t)
+	mockDelayManager.AssertNotCalled(t, "AddRetry", mock.Anything, mock.Anything)
+}
+
+func TestPartitionConsumer_CallHandler_RecoversPanic(t *testing.T) {
+	pc := &partitionConsumer{
+		logger: logging.Discard(),
+		cfg:    &config.Config{},
+		handler: func(ctx context.Context, msg *model.Message) error {
+			panic("boom")
+		},
+	}
+
+	err := pc.callHandler(context.Background(), &model.Message{MessageID: "test-msg"})
+	assert.EqualError(t, err, "message handler panicked: boom")
+}
+
+func TestPartitionConsumer_CallHandler_HandlerTimeout(t *testing.T) {
+	pc := &partitionConsumer{
+		logger: logging.Discard(),
+		cfg:    &config.Config{HandlerTimeout: time.Millisecond * 50},
+		handler: func(ctx context.Context, msg *model.Message) error {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	err := pc.callHandler(context.Background(), &model.Message{MessageID: "test-msg"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPartitionConsumer_Stop_DrainsInFlightHandler(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockConsumerManager := new(MockConsumerManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
+
+	mockConsumerManager.On("GetConsumerOffsets", mock.Anything, "test-topic", "test-group").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "test-instance", Offset: 0}}, nil)
+	mockMsgManager.On("GetMessages", mock.Anything, "test-topic", "test-group", 0, int64(0), 100).
+		Return([]*model.Message{
+			{MessageID: "msg-1", Topic: "test-topic", Offset: 1},
+			{MessageID: "msg-2", Topic: "test-topic", Offset: 2},
+		}, nil)
+
+	// Only the in-flight message is committed; msg-2 is left for the next owner
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(1), "test-group", "test-topic", 0, "test-instance").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	started := make(chan struct{})
+	pc := &partitionConsumer{
+		logger:     logging.Discard(),
+		db:         db,
+		factory:    mockFactory,
+		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3},
+		topic:      "test-topic",
+		group:      "test-group",
+		partition:  0,
+		instanceID: "test-instance",
+		handler: func(ctx context.Context, msg *model.Message) error {
+			close(started)
+			time.Sleep(time.Millisecond * 100)
+			return ctx.Err()
+		},
+		stopChan: make(chan struct{}),
+	}
+
+	assert.NoError(t, pc.Start(context.Background()))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, pc.Stop(ctx))
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestPartitionConsumer_Stop_ReportsAbandonedMessage(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockConsumerManager := new(MockConsumerManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
+
+	mockConsumerManager.On("GetConsumerOffsets", mock.Anything, "test-topic", "test-group").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "test-instance", Offset: 0}}, nil)
+	mockMsgManager.On("GetMessages", mock.Anything, "test-topic", "test-group", 0, int64(0), 100).
+		Return([]*model.Message{{MessageID: "msg-1", Topic: "test-topic", Offset: 1}}, nil)
+
+	// The abandoned handler still commits its offset if it completes later
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(1), "test-group", "test-topic", 0, "test-instance").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	pc := &partitionConsumer{
+		logger:     logging.Discard(),
+		db:         db,
+		factory:    mockFactory,
+		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3},
+		topic:      "test-topic",
+		group:      "test-group",
+		partition:  0,
+		instanceID: "test-instance",
+		handler: func(ctx context.Context, msg *model.Message) error {
+			close(started)
+			<-release
+			return nil
+		},
+		stopChan: make(chan struct{}),
+	}
+
+	assert.NoError(t, pc.Start(context.Background()))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err = pc.Stop(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "abandoned in-flight message msg-1")
+
+	close(release)
+	<-pc.done
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestPartitionConsumer_Consume_TracesHandlerAndRetry(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := tracing.New(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), nil)
+
+	mockFactory := &MockFactory{tracer: tracer}
+	mockMsgManager := new(MockMessageManager)
+	mockConsumerManager := new(MockConsumerManager)
+	mockDelayManager := new(MockDelayManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+	mockFactory.On("GetConsumerManager").Return(mockConsumerManager)
+	mockFactory.On("GetDelayManager").Return(mockDelayManager)
+
+	// The message was produced under a traced send
+	msg := &model.Message{MessageID: "msg-1", Topic: "test-topic", Offset: 1}
+	_, sendSpan := tracer.StartSend(context.Background(), msg)
+	tracer.SendDone(sendSpan, msg, nil)
+
+	mockConsumerManager.On("GetConsumerOffsets", mock.Anything, "test-topic", "test-group").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "test-instance", Offset: 0}}, nil)
+	mockMsgManager.On("GetMessages", mock.Anything, "test-topic", "test-group", 0, int64(0), 100).
+		Return([]*model.Message{msg}, nil)
+
+	var handlerSpan trace.SpanContext
+	handler := func(ctx context.Context, msg *model.Message) error {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return errors.New("handler error")
+	}
+
+	// The retry carries the trace context of the failed attempt
+	var retryTraceparent string
+	mockDelayManager.On("AddRetry", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		retryTraceparent = args.Get(1).(*model.RetryMessage).Headers["traceparent"]
+	}).Return("msg-1", nil)
+
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(1), "test-group", "test-topic", 0, "test-instance").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	pc := &partitionConsumer{
+		logger:     logging.Discard(),
+		db:         db,
+		factory:    mockFactory,
+		cfg:        &config.Config{PullingInterval: time.Second, PullingSize: 100, RetryTimes: 3, RetryInterval: time.Second * 3},
+		topic:      "test-topic",
+		group:      "test-group",
+		partition:  0,
+		instanceID: "test-instance",
+		handler:    handler,
+		stopChan:   make(chan struct{}),
+	}
+
+	assert.NoError(t, pc.Start(context.Background()))
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, pc.Stop(context.Background()))
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 2) {
+		send, process := spans[0], spans[1]
+		assert.Equal(t, "test-topic process", process.Name)
+		assert.Equal(t, handlerSpan.SpanID(), process.SpanContext.SpanID())
+		if assert.Len(t, process.Links, 1) {
+			assert.Equal(t, send.SpanContext.SpanID(), process.Links[0].SpanContext.SpanID())
+		}
+		assert.Contains(t, retryTraceparent, process.SpanContext.SpanID().String())
+	}
+	assert.NoError(t, smock.ExpectationsWereMet())
 }
@@ -0,0 +1,219 @@
+package consumer
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/template"
+)
+
+// NewPullConsumer joins a consumer group as a new instance with its own heartbeat, so that it takes
+// part in the partition assignment like the instances consuming through handlers. The topic must
+// exist: unlike the consumers of the application, the clients of the pull consumers do not create topics.
+func (c *consumerManagerImpl) NewPullConsumer(ctx context.Context, topic string, group string) (interfaces.PullConsumer, error) {
+	if err := model.ValidateTopic(topic); err != nil {
+		return nil, err
+	}
+	if _, err := c.factory.GetTopicManager().FindTopicMeta(ctx, topic); err != nil {
+		return nil, err
+	}
+	instanceID := uuid.NewString()
+	logger := c.factory.GetLogger().With("instance", instanceID, "topic", topic, "group", group)
+	manager := &consumerGroupManager{
+		db:         c.db,
+		cfg:        c.cfg,
+		group:      group,
+		topic:      topic,
+		factory:    c.factory,
+		instanceID: instanceID,
+		hostname:   c.hostname,
+		stopChan:   make(chan struct{}),
+		logger:     logger,
+	}
+	// The heartbeat outlives the request that joined the group
+	if err := manager.Start(context.WithoutCancel(ctx)); err != nil {
+		logger.Error("Failed to join consumer group", "error", err)
+		return nil, err
+	}
+	logger.Info("Pull consumer joined consumer group")
+	return &pullConsumer{
+		db:         c.db,
+		cfg:        c.cfg,
+		factory:    c.factory,
+		topic:      topic,
+		group:      group,
+		instanceID: instanceID,
+		manager:    manager,
+		positions:  make(map[int]int64),
+		closed:     make(chan struct{}),
+		logger:     logger,
+	}, nil
+}
+
+// pullConsumer fetches the messages of the partitions assigned to its instance on request
+type pullConsumer struct {
+	db         *sql.DB
+	cfg        *config.Config
+	factory    interfaces.Factory
+	topic      string
+	group      string
+	instanceID string
+	manager    *consumerGroupManager
+	mu         sync.Mutex
+	// positions holds the offset of the last fetched message of each assigned partition
+	positions map[int]int64
+	// next rotates the partition read first, so that a busy partition does not starve the others
+	next      int
+	closed    chan struct{}
+	closeOnce sync.Once
+	// logger carries the topic, group and instance fields
+	logger logging.Logger
+}
+
+func (p *pullConsumer) InstanceID() string {
+	return p.instanceID
+}
+
+// Fetch polls the assigned partitions every PullingInterval until a message arrives or wait has passed
+func (p *pullConsumer) Fetch(ctx context.Context, max int, wait time.Duration) ([]*model.Message, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		select {
+		case <-p.closed:
+			return nil, ErrConsumerClosed
+		default:
+		}
+		msgs, err := p.poll(ctx, max)
+		if err != nil || len(msgs) > 0 {
+			return msgs, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return msgs, nil
+		}
+		timer := time.NewTimer(min(p.cfg.PullingInterval, remaining))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-p.closed:
+			timer.Stop()
+			return nil, ErrConsumerClosed
+		case <-timer.C:
+		}
+	}
+}
+
+// poll reads the messages after the fetch positions of the assigned partitions once
+func (p *pullConsumer) poll(ctx context.Context, max int) ([]*model.Message, error) {
+	offsets, err := p.factory.GetConsumerManager().GetConsumerOffsets(ctx, p.topic, p.group)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	assigned := make(map[int]int64)
+	partitions := make([]int, 0)
+	for _, offset := range offsets {
+		if offset.InstanceID == p.instanceID {
+			assigned[offset.Partition] = offset.Offset
+			partitions = append(partitions, offset.Partition)
+		}
+	}
+	// A revoked partition restarts from its committed offset when it is assigned again
+	for partition := range p.positions {
+		if _, ok := assigned[partition]; !ok {
+			delete(p.positions, partition)
+			p.factory.GetMetrics().PartitionReleased(p.topic, p.group, partition)
+		}
+	}
+	for partition, committed := range assigned {
+		if _, ok := p.positions[partition]; !ok {
+			p.positions[partition] = committed
+			// Tracked for lag from its assignment, not from its first commit
+			p.factory.GetMetrics().OffsetCommitted(p.topic, p.group, partition, committed)
+		}
+	}
+	sort.Ints(partitions)
+
+	msgs := make([]*model.Message, 0)
+	for i := range partitions {
+		if len(msgs) >= max {
+			break
+		}
+		partition := partitions[(p.next+i)%len(partitions)]
+		fetched, err := p.factory.GetMessageManager().GetMessages(ctx, p.topic, p.group, partition, p.positions[partition], max-len(msgs))
+		if err != nil {
+			if len(msgs) > 0 {
+				// Return what was read, the positions have moved past it
+				p.logger.Error("Failed to get messages", "partition", partition, "error", err)
+				break
+			}
+			return nil, err
+		}
+		for _, msg := range fetched {
+			p.positions[partition] = msg.Offset
+			// Resent or replayed to another group only: skipped like the handler consumers do
+			if target := msg.Headers[model.HeaderTargetGroup]; target != "" && target != p.group {
+				continue
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	p.next++
+	return msgs, nil
+}
+
+func (p *pullConsumer) Commit(ctx context.Context, partition int, offset int64) error {
+	result, err := p.db.ExecContext(ctx, template.UpdateConsumerOffset, offset, p.group, p.topic, partition, p.instanceID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// MySQL reports no affected rows when the offset is unchanged, so check the owner
+		offsets, err := p.factory.GetConsumerManager().GetConsumerOffsets(ctx, p.topic, p.group)
+		if err != nil {
+			return err
+		}
+		committed := false
+		for _, o := range offsets {
+			if o.Partition == partition && o.InstanceID == p.instanceID && o.Offset == offset {
+				committed = true
+			}
+		}
+		if !committed {
+			return ErrPartitionNotAssigned
+		}
+	}
+	p.factory.GetMetrics().OffsetCommitted(p.topic, p.group, partition, offset)
+	return nil
+}
+
+// Close stops the heartbeat and marks the instance inactive
+func (p *pullConsumer) Close(ctx context.Context) error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		err = p.manager.Stop(ctx)
+		p.mu.Lock()
+		for partition := range p.positions {
+			p.factory.GetMetrics().PartitionReleased(p.topic, p.group, partition)
+		}
+		p.mu.Unlock()
+		p.logger.Info("Pull consumer left consumer group")
+	})
+	return err
+}
@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func newTestPullConsumer(db *sql.DB, factory *MockFactory) *pullConsumer {
+	return &pullConsumer{
+		db:         db,
+		cfg:        &config.Config{PullingInterval: 10 * time.Millisecond},
+		factory:    factory,
+		topic:      "orders",
+		group:      "billing",
+		instanceID: "a",
+		positions:  make(map[int]int64),
+		closed:     make(chan struct{}),
+		logger:     logging.Discard(),
+	}
+}
+
+func TestPullConsumer_Fetch(t *testing.T) {
+	consumers := new(MockConsumerManager)
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", "billing").Return([]model.ConsumerOffset{
+		{Partition: 0, InstanceID: "a", Offset: 4},
+		{Partition: 1, InstanceID: "b", Offset: 9},
+		{Partition: 2, InstanceID: "a", Offset: 7},
+	}, nil)
+	messages := new(MockMessageManager)
+	messages.On("GetMessages", mock.Anything, "orders", "billing", 0, int64(4), 3).Return([]*model.Message{
+		{MessageID: "m5", Partition: 0, Offset: 5},
+		{MessageID: "m6", Partition: 0, Offset: 6, Headers: map[string]string{model.HeaderTargetGroup: "audit"}},
+	}, nil).Once()
+	messages.On("GetMessages", mock.Anything, "orders", "billing", 2, int64(7), 2).Return([]*model.Message{
+		{MessageID: "m8", Partition: 2, Offset: 8},
+	}, nil).Once()
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	factory.On("GetMessageManager").Return(messages)
+	pc := newTestPullConsumer(nil, factory)
+
+	// Only the assigned partitions are read, skipping the messages targeted at other groups
+	msgs, err := pc.Fetch(context.Background(), 3, 0)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "m5", msgs[0].MessageID)
+	assert.Equal(t, "m8", msgs[1].MessageID)
+
+	// The next fetch continues after the fetched messages, starting with the other partition
+	messages.On("GetMessages", mock.Anything, "orders", "billing", 2, int64(8), 3).Return([]*model.Message{}, nil)
+	messages.On("GetMessages", mock.Anything, "orders", "billing", 0, int64(6), 3).Return([]*model.Message{}, nil)
+	msgs, err = pc.Fetch(context.Background(), 3, 25*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+	messages.AssertExpectations(t)
+
+	close(pc.closed)
+	_, err = pc.Fetch(context.Background(), 3, 0)
+	assert.ErrorIs(t, err, ErrConsumerClosed)
+}
+
+func TestPullConsumer_Fetch_RestartsRevokedPartitions(t *testing.T) {
+	consumers := new(MockConsumerManager)
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", "billing").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "a", Offset: 4}}, nil).Once()
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", "billing").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "b", Offset: 4}}, nil).Once()
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", "billing").
+		Return([]model.ConsumerOffset{{Partition: 0, InstanceID: "a", Offset: 4}}, nil).Once()
+	messages := new(MockMessageManager)
+	messages.On("GetMessages", mock.Anything, "orders", "billing", 0, int64(4), 10).
+		Return([]*model.Message{{MessageID: "m5", Offset: 5}}, nil).Twice()
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	factory.On("GetMessageManager").Return(messages)
+	pc := newTestPullConsumer(nil, factory)
+
+	msgs, err := pc.Fetch(context.Background(), 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	msgs, err = pc.Fetch(context.Background(), 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+	// Assigned again, the uncommitted message is fetched again
+	msgs, err = pc.Fetch(context.Background(), 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	messages.AssertExpectations(t)
+}
+
+func TestPullConsumer_Commit(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	consumers := new(MockConsumerManager)
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", "billing").Return([]model.ConsumerOffset{
+		{Partition: 0, InstanceID: "a", Offset: 5},
+		{Partition: 1, InstanceID: "b", Offset: 9},
+	}, nil)
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	pc := newTestPullConsumer(db, factory)
+
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(5), "billing", "orders", 0, "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, pc.Commit(context.Background(), 0, 5))
+
+	// Committing the same offset again changes no row
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(5), "billing", "orders", 0, "a").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, pc.Commit(context.Background(), 0, 5))
+
+	smock.ExpectExec("UPDATE mqx_consumer_offsets").
+		WithArgs(int64(10), "billing", "orders", 1, "a").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, pc.Commit(context.Background(), 1, 10), ErrPartitionNotAssigned)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestNewPullConsumer_RefusesInvalidAndUnknownTopics(t *testing.T) {
+	topics := new(MockTopicManager)
+	topics.On("FindTopicMeta", mock.Anything, "missing").Return(nil, fmt.Errorf("%w: missing", model.ErrTopicNotFound))
+	factory := new(MockFactory)
+	factory.On("GetTopicManager").Return(topics)
+	c := newTestConsumerManager(nil, factory)
+
+	_, err := c.NewPullConsumer(context.Background(), "orders`; drop table x", "billing")
+	assert.ErrorIs(t, err, model.ErrInvalidTopic)
+
+	// A missing topic is not created for the consumer
+	_, err = c.NewPullConsumer(context.Background(), "missing", "billing")
+	assert.ErrorIs(t, err, model.ErrTopicNotFound)
+	topics.AssertNotCalled(t, "GetTopicMeta", mock.Anything, mock.Anything)
+}
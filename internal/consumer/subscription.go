@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// Subscribe joins a consumer group as a new instance with its own heartbeat, consuming like Consume
+// but leaving the group on its own when closed
+func (c *consumerManagerImpl) Subscribe(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg *model.Message) error) (interfaces.Subscription, error) {
+	instanceID := uuid.NewString()
+	logger := c.factory.GetLogger().With("instance", instanceID, "topic", topic, "group", group)
+	manager := &consumerGroupManager{
+		db:         c.db,
+		cfg:        c.cfg,
+		group:      group,
+		topic:      topic,
+		factory:    c.factory,
+		instanceID: instanceID,
+		hostname:   c.hostname,
+		stopChan:   make(chan struct{}),
+		logger:     logger,
+	}
+	// The subscription outlives the request that created it
+	ctx = context.WithoutCancel(ctx)
+	if err := manager.Start(ctx); err != nil {
+		logger.Error("Failed to join consumer group", "error", err)
+		return nil, err
+	}
+	gc := &groupConsumer{
+		db:         c.db,
+		cfg:        c.cfg,
+		factory:    c.factory,
+		group:      group,
+		topic:      topic,
+		instanceID: instanceID,
+		handler:    handler,
+		stopChan:   make(chan struct{}),
+		logger:     logger,
+	}
+	if err := gc.Start(ctx); err != nil {
+		logger.Error("Failed to start group consumer", "error", err)
+		return nil, errors.Join(err, manager.Stop(ctx))
+	}
+	logger.Info("Subscription joined consumer group")
+	return &subscription{instanceID: instanceID, manager: manager, consumer: gc, logger: logger}, nil
+}
+
+// subscription is a consumer instance of its own, consuming through a handler
+type subscription struct {
+	instanceID string
+	manager    *consumerGroupManager
+	consumer   *groupConsumer
+	closeOnce  sync.Once
+	// logger carries the topic, group and instance fields
+	logger logging.Logger
+}
+
+func (s *subscription) InstanceID() string {
+	return s.instanceID
+}
+
+// Close drains the partition consumers first so their final offsets are committed while the
+// instance still owns the partitions, then stops the heartbeat and marks the instance inactive
+func (s *subscription) Close(ctx context.Context) error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = errors.Join(s.consumer.Stop(ctx), s.manager.Stop(ctx))
+		s.logger.Info("Subscription left consumer group")
+	})
+	return err
+}
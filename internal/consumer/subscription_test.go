@@ -0,0 +1,42 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/logging"
+)
+
+func TestSubscription_Close(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	sub := &subscription{
+		instanceID: "a",
+		manager: &consumerGroupManager{
+			db:         db,
+			group:      "billing",
+			topic:      "orders",
+			instanceID: "a",
+			stopChan:   make(chan struct{}),
+			logger:     logging.Discard(),
+		},
+		consumer: &groupConsumer{
+			partitionConsumers: make(map[int]*partitionConsumer),
+			stopChan:           make(chan struct{}),
+			logger:             logging.Discard(),
+		},
+		logger: logging.Discard(),
+	}
+	smock.ExpectExec("UPDATE mqx_consumer_instances").
+		WithArgs("billing", "orders", "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, sub.Close(context.Background()))
+	// Closing again leaves the group only once
+	assert.NoError(t, sub.Close(context.Background()))
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
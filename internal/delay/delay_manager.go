@@ -3,21 +3,30 @@ package delay
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/message"
 	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
 	"github.com/wenzuojing/mqx/internal/template"
-	"k8s.io/klog/v2"
+	"github.com/wenzuojing/mqx/internal/tracing"
+	"github.com/wenzuojing/mqx/pkg/templatex"
 )
 
+// ErrMessageNotFound is returned when cancelling a message that is not waiting in the delay queue
+var ErrMessageNotFound = errors.New("delayed message not found")
+
 // DelayManager handles delayed message processing
 func NewDelayManager(db *sql.DB, cfg *config.Config, factory interfaces.Factory) (interfaces.DelayManager, error) {
-	return &delayManagerImpl{db: db, factory: factory, cfg: cfg, stopChan: make(chan struct{})}, nil
+	return &delayManagerImpl{db: db, factory: factory, cfg: cfg, stopChan: make(chan struct{}), logger: factory.GetLogger(),
+		traceManager: factory.GetTraceManager()}, nil
 }
 
 type delayManagerImpl struct {
@@ -25,10 +34,17 @@ type delayManagerImpl struct {
 	factory  interfaces.Factory
 	cfg      *config.Config
 	stopChan chan struct{}
+	// done is closed when the delay loop has exited
+	done         chan struct{}
+	cancel       context.CancelFunc
+	logger       logging.Logger
+	traceManager *msgtrace.Manager
+	// lastCycle is the unix nano time the delay loop last started a cycle, whether or not it succeeded
+	lastCycle atomic.Int64
 }
 
 func (d *delayManagerImpl) Add(ctx context.Context, msg *model.Message) (string, error) {
-	klog.V(4).Infof("Adding delayed message for topic: %s, delay: %v", msg.Topic, msg.Delay)
+	d.logger.Debug("Adding delayed message", "topic", msg.Topic, "delay", msg.Delay)
 	if msg.MessageID == "" {
 		msg.MessageID = uuid.New().String()
 	}
@@ -41,17 +57,21 @@ func (d *delayManagerImpl) Add(ctx context.Context, msg *model.Message) (string,
 		msg.BornTime,
 		msg.BornTime.Add(msg.Delay),
 		0, // retry_count: user-initiated delays are not retries
+		model.EncodeHeaders(msg.Headers),
 	)
 	if err != nil {
-		klog.Errorf("Failed to insert delayed message: %v", err)
+		d.logger.Error("Failed to insert delayed message", "topic", msg.Topic, "error", err)
 		return "", err
 	}
-	klog.V(4).Infof("Successfully added delayed message with ID: %s", msg.MessageID)
+	event := msgtrace.NewEvent(msg, model.TraceDelayScheduled)
+	event.DelayTime = msg.BornTime.Add(msg.Delay)
+	d.traceManager.Record(event)
+	d.logger.Debug("Successfully added delayed message", "topic", msg.Topic, "messageId", msg.MessageID)
 	return msg.MessageID, nil
 }
 
 func (d *delayManagerImpl) AddRetry(ctx context.Context, msg *model.RetryMessage) (string, error) {
-	klog.V(4).Infof("Adding retry message for topic: %s, delay: %v, retryCount: %d", msg.Topic, msg.Delay, msg.RetryCount)
+	d.logger.Debug("Adding retry message", "topic", msg.Topic, "delay", msg.Delay, "retryCount", msg.RetryCount)
 	if msg.MessageID == "" {
 		msg.MessageID = uuid.New().String()
 	}
@@ -65,66 +85,202 @@ func (d *delayManagerImpl) AddRetry(ctx context.Context, msg *model.RetryMessage
 		msg.BornTime,
 		delayTime,
 		msg.RetryCount,
+		model.EncodeHeaders(msg.Headers),
 	)
 	if err != nil {
-		klog.Errorf("Failed to insert retry message: %v", err)
+		d.logger.Error("Failed to insert retry message", "topic", msg.Topic, "error", err)
 		return "", err
 	}
-	klog.V(4).Infof("Successfully added retry message with ID: %s", msg.MessageID)
+	d.logger.Debug("Successfully added retry message", "topic", msg.Topic, "messageId", msg.MessageID)
 	return msg.MessageID, nil
 }
 
+// dequeue deletes a ready message from the delay queue in tx and reports whether it was still there.
+// Deleting before the transfer locks the row, so a concurrent Cancel either wins and the message is
+// skipped, or waits for tx and finds nothing to cancel once the message is delivered.
+func (d *delayManagerImpl) dequeue(tx *sql.Tx, msg *model.DelayMessage) (bool, error) {
+	result, err := tx.Exec(template.DeleteDelayMessage, msg.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete processed delayed message: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete processed delayed message: %w", err)
+	}
+	if deleted == 0 {
+		d.logger.Debug("Delayed message was cancelled before delivery", "messageId", msg.MessageID)
+	}
+	return deleted > 0, nil
+}
+
 // transferMessage moves a delay message back to its original topic queue.
 // SaveMessageWithTx handles partition calculation from key and includes retry_count.
-func (d *delayManagerImpl) transferMessage(ctx context.Context, tx *sql.Tx, msg *model.DelayMessage) error {
+func (d *delayManagerImpl) transferMessage(ctx context.Context, tx *sql.Tx, msg *model.DelayMessage) (err error) {
 	// For retry messages, propagate the retry count to the embedded Message
 	msg.Message.RetryCount = msg.RetryCount
+	// Continue the trace stored with the message; the consumer span links to this delivery
+	ctx, span := d.factory.GetTracer().StartDeliver(ctx, &msg.Message)
+	defer func() { tracing.End(span, err) }()
 	return d.factory.GetMessageManager().SaveMessageWithTx(ctx, tx, &msg.Message)
 }
 
 func (d *delayManagerImpl) Start(ctx context.Context) error {
-	klog.Info("Starting delay manager service...")
+	d.logger.Info("Starting delay manager service")
 	// Create delay message table if not exists
 	if _, err := d.db.Exec(template.CreateDelayMessageTable); err != nil {
-		klog.Errorf("Failed to create delay messages table: %v", err)
+		d.logger.Error("Failed to create delay messages table", "error", err)
 		return err
 	}
-	klog.V(2).Info("Created/verified delay messages table")
+	if err := message.AddHeadersColumn(ctx, d.db, "mqx_delay_messages"); err != nil {
+		d.logger.Error("Failed to upgrade delay messages table", "error", err)
+		return err
+	}
+	d.logger.Debug("Created/verified delay messages table")
 
 	// Start delay message processing routine
+	loopCtx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
 	go func() {
+		defer close(d.done)
+		// errLog keeps a failing database from logging on every cycle
+		errLog := logging.NewThrottle(d.logger, 0)
 		for {
 			select {
 			case <-d.stopChan:
 				return
 			default:
-				d.processDelayMessages(context.Background())
+				d.lastCycle.Store(time.Now().UnixNano())
+				d.processDelayMessages(loopCtx, errLog)
 			}
 		}
 	}()
-	klog.Info("Delay manager service started successfully")
+	d.logger.Info("Delay manager service started successfully")
 	return nil
 }
 
+// Stop stops the delay loop and waits for the running cycle to finish. When ctx expires
+// first, the cycle is cancelled and its transaction is rolled back.
 func (d *delayManagerImpl) Stop(ctx context.Context) error {
-	klog.Info("Stopping delay manager service...")
+	d.logger.Info("Stopping delay manager service")
 	close(d.stopChan)
-	return nil
+	if d.done == nil {
+		return nil
+	}
+	defer d.cancel()
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("delay loop did not stop: %w", ctx.Err())
+	}
+}
+
+// sleep waits for dur unless the delay manager is stopped first
+func (d *delayManagerImpl) sleep(dur time.Duration) {
+	timer := time.NewTimer(dur)
+	defer timer.Stop()
+	select {
+	case <-d.stopChan:
+	case <-timer.C:
+	}
+}
+
+// LastCycleTime returns when the delay loop last started a cycle, zero before Start
+func (d *delayManagerImpl) LastCycleTime() time.Time {
+	if nanos := d.lastCycle.Load(); nanos > 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
 }
 
 func (d *delayManagerImpl) DeleteMessagesByTopic(ctx context.Context, topic string) error {
-	klog.Infof("Deleting delayed messages for topic: %s", topic)
+	d.logger.Info("Deleting delayed messages", "topic", topic)
 	_, err := d.db.ExecContext(ctx, template.DeleteDelayMessagesByTopic, topic)
 	return err
 }
 
-func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
+func (d *delayManagerImpl) GetQueueStat(ctx context.Context) (*model.DelayQueueStat, error) {
+	var stat model.DelayQueueStat
+	var oldest sql.NullTime
+	if err := d.db.QueryRowContext(ctx, template.GetDelayQueueStat).Scan(&stat.Depth, &oldest); err != nil {
+		return nil, err
+	}
+	if oldest.Valid {
+		stat.OldestDelayTime = oldest.Time
+	}
+	return &stat, nil
+}
+
+// Query returns the total number of waiting messages matching a filter and one page of them, next delivered first
+func (d *delayManagerImpl) Query(ctx context.Context, filter *model.DelayFilter) (int64, []*model.DelayMessage, error) {
+	data := map[string]any{"Topic": filter.Topic}
+	var args []any
+	if filter.Topic != "" {
+		args = append(args, filter.Topic)
+	}
+	countQuery, err := templatex.Rander(template.CountDelayMessages, data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to template sql: %w", err)
+	}
+	var total int64
+	if err := d.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return 0, nil, fmt.Errorf("failed to count delayed messages: %w", err)
+	}
+	query, err := templatex.Rander(template.SelectDelayMessages, data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to template sql: %w", err)
+	}
+	pageNo, pageSize := filter.PageNo, filter.PageSize
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	rows, err := d.db.QueryContext(ctx, query, append(args, pageSize, (pageNo-1)*pageSize)...)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to query delayed messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]*model.DelayMessage, 0)
+	for rows.Next() {
+		var msg model.DelayMessage
+		var headers sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.MessageID, &msg.Topic, &msg.Key, &msg.Tag, &msg.Body, &msg.BornTime, &msg.DelayTime,
+			&msg.RetryCount, &headers); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan delayed message: %w", err)
+		}
+		msg.Headers = model.DecodeHeaders(headers)
+		messages = append(messages, &msg)
+	}
+	return total, messages, rows.Err()
+}
+
+// Cancel deletes a waiting message, a delayed message or the pending retry of a failed one, so that
+// it is never delivered. A message being delivered at the same time is reported as not found.
+func (d *delayManagerImpl) Cancel(ctx context.Context, messageID string) error {
+	result, err := d.db.ExecContext(ctx, template.DeleteDelayMessageByMessageID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel delayed message: %w", err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrMessageNotFound
+	}
+	d.logger.Info("Cancelled delayed message", "messageId", messageID)
+	return nil
+}
+
+func (d *delayManagerImpl) processDelayMessages(ctx context.Context, errLog *logging.Throttle) error {
 	// Acquire distributed lock on a dedicated connection to ensure GET_LOCK and
 	// RELEASE_LOCK operate on the same session (sql.DB is a connection pool).
 	conn, err := d.db.Conn(ctx)
 	if err != nil {
-		klog.Errorf("Failed to get dedicated connection for delay lock: %v", err)
-		time.Sleep(time.Second)
+		errLog.Error("Failed to get dedicated connection for delay lock", "error", err)
+		d.sleep(time.Second)
 		return nil
 	}
 
@@ -133,17 +289,17 @@ func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
 	if err != nil || !lockAcquired {
 		conn.Close()
 		if err != nil {
-			klog.Errorf("Failed to acquire delay message lock: %v", err)
+			errLog.Error("Failed to acquire delay message lock", "error", err)
 		}
-		time.Sleep(time.Second)
+		d.sleep(time.Second)
 		return nil
 	}
 
-	klog.V(4).Info("Acquired delay message lock")
+	d.logger.Debug("Acquired delay message lock")
 	defer func() {
 		conn.ExecContext(ctx, template.ReleaseLock, "delay_message_lock")
 		conn.Close()
-		klog.V(4).Info("Released delay message lock")
+		d.logger.Debug("Released delay message lock")
 	}()
 
 	// Process delayed messages that are ready
@@ -151,8 +307,7 @@ func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
 		// Query messages that have reached their delay time
 		rows, err := d.db.Query(template.GetReadyDelayMessages, time.Now())
 		if err != nil {
-			klog.Errorf("Failed to query delayed messages: %v", err)
-			return err
+			return fmt.Errorf("failed to query delayed messages: %w", err)
 		}
 		defer rows.Close()
 
@@ -160,12 +315,14 @@ func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
 		for rows.Next() {
 			var msg model.DelayMessage
 			var delayTime time.Time
+			var headers sql.NullString
 			err := rows.Scan(&msg.ID, &msg.MessageID, &msg.Topic, &msg.Key, &msg.Tag, &msg.Body, &msg.BornTime, &delayTime,
-				&msg.RetryCount)
+				&msg.RetryCount, &headers)
 			if err != nil {
-				klog.Warningf("Failed to scan delayed message: %v", err)
+				d.logger.Warn("Failed to scan delayed message", "error", err)
 				continue
 			}
+			msg.Headers = model.DecodeHeaders(headers)
 			messages = append(messages, &msg)
 		}
 
@@ -175,29 +332,38 @@ func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
 
 		// Track poison pills (messages that persistently fail to transfer)
 		poisonPills := make(map[string]bool)
+		// Messages transferred in the current transaction, traced once it commits
+		var delivered []*model.DelayMessage
 
 		// Begin transaction
 		tx, err := d.db.Begin()
 		if err != nil {
-			klog.Errorf("Failed to begin transaction: %v", err)
-			return err
+			return fmt.Errorf("failed to begin transaction: %w", err)
 		}
 
 		for _, msg := range messages {
 			if poisonPills[msg.MessageID] {
 				continue
 			}
+			// Remove the message from the delay queue first (within the same tx)
+			if queued, err := d.dequeue(tx, msg); err != nil {
+				tx.Rollback()
+				return err
+			} else if !queued {
+				continue
+			}
 
 			// Transfer message back to original queue (handles both user-delay and retry messages)
 			err = d.transferMessage(ctx, tx, msg)
 
 			if err != nil {
-				if strings.Contains(err.Error(), "doesn't exist") {
+				if message.IsMissingMessageTable(err) {
 					// DDL causes implicit commit in MySQL — must create table outside tx
 					tx.Rollback()
+					delivered = delivered[:0]
 					topicMeta, metaErr := d.factory.GetTopicManager().GetTopicMeta(ctx, msg.Topic)
 					if metaErr != nil {
-						klog.Errorf("Failed to get topic meta for table creation: %v", metaErr)
+						d.logger.Error("Failed to get topic meta for table creation", "topic", msg.Topic, "error", metaErr)
 						poisonPills[msg.MessageID] = true
 						// Start fresh tx for remaining messages
 						tx, err = d.db.Begin()
@@ -216,8 +382,8 @@ func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
 						partition = -partition
 					}
 					tableName := fmt.Sprintf("mqx_messages_%s_%d", msg.Topic, partition)
-					if _, createErr := d.db.Exec(fmt.Sprintf(template.CreateMessageTableTemplate, tableName)); createErr != nil {
-						klog.Errorf("Failed to create message table %s: %v", tableName, createErr)
+					if createErr := message.EnsureMessageTable(ctx, d.db, tableName, err); createErr != nil {
+						d.logger.Error("Failed to create message table", "table", tableName, "error", createErr)
 						poisonPills[msg.MessageID] = true
 						// Start fresh tx for remaining messages
 						tx, err = d.db.Begin()
@@ -229,22 +395,29 @@ func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
 					// Retry with a fresh transaction
 					tx, err = d.db.Begin()
 					if err != nil {
-						klog.Errorf("Failed to begin retry transaction: %v", err)
-						return err
+						return fmt.Errorf("failed to begin retry transaction: %w", err)
 					}
 					// Re-attempt the transfer with the new table
+					if queued, err := d.dequeue(tx, msg); err != nil {
+						tx.Rollback()
+						return err
+					} else if !queued {
+						continue
+					}
 					err = d.transferMessage(ctx, tx, msg)
 				}
 				if err != nil {
 					// Poison pill: record failed message ID and skip it to unblock remaining messages
-					klog.Errorf("Poison pill detected — message %s failed to transfer, skipping: %v", msg.MessageID, err)
+					d.logger.Error("Poison pill detected, message failed to transfer, skipping", "topic", msg.Topic, "messageId", msg.MessageID, "error", err)
 					poisonPills[msg.MessageID] = true
+					// Roll back first: the tx holds the row lock of its dequeue (current tx may be poisoned too)
+					tx.Rollback()
+					delivered = delivered[:0]
 					// Remove from delay table to prevent continuous re-processing on every cycle
 					if _, delErr := d.db.Exec(template.DeleteDelayMessage, msg.ID); delErr != nil {
-						klog.Errorf("Failed to delete poison pill message %d from delay table: %v", msg.ID, delErr)
+						d.logger.Error("Failed to delete poison pill message from delay table", "id", msg.ID, "error", delErr)
 					}
-					// Start fresh tx for remaining messages (current tx may be poisoned)
-					tx.Rollback()
+					// Start fresh tx for remaining messages
 					tx, err = d.db.Begin()
 					if err != nil {
 						return err
@@ -252,22 +425,17 @@ func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
 					continue
 				}
 			}
-
-			// Remove processed message from delay queue (within the same tx)
-			_, err = tx.Exec(template.DeleteDelayMessage, msg.ID)
-			if err != nil {
-				klog.Errorf("Failed to delete processed delayed message: %v", err)
-				tx.Rollback()
-				return err
-			}
+			delivered = append(delivered, msg)
 		}
 
 		if err := tx.Commit(); err != nil {
-			klog.Errorf("Failed to commit delayed message transaction: %v", err)
 			tx.Rollback()
-			return err
+			return fmt.Errorf("failed to commit delayed message transaction: %w", err)
+		}
+		for _, msg := range delivered {
+			d.traceManager.Record(msgtrace.NewEvent(&msg.Message, model.TraceDelayDelivered))
 		}
-		klog.V(4).Infof("Successfully processed %d delayed messages", len(messages))
+		d.logger.Debug("Successfully processed delayed messages", "count", len(messages))
 		return nil
 	}
 
@@ -275,20 +443,22 @@ func (d *delayManagerImpl) processDelayMessages(ctx context.Context) error {
 	for {
 		select {
 		case <-d.stopChan:
-			klog.Info("Stopping delay message processing")
+			d.logger.Info("Stopping delay message processing")
 			return nil
 		default:
 			start := time.Now()
+			d.lastCycle.Store(start.UnixNano())
 			err := transferMessages()
 			if err != nil {
-				klog.Errorf("Error in transfer messages cycle: %v", err)
-				time.Sleep(time.Second)
+				errLog.Error("Error in transfer messages cycle", "error", err)
+				d.sleep(time.Second)
 				continue
 			}
+			errLog.Reset()
 
 			elapsed := time.Since(start)
 			if remaining := d.cfg.DelayInterval - elapsed; remaining > 0 {
-				time.Sleep(remaining)
+				d.sleep(remaining)
 			}
 		}
 	}
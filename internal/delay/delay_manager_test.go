@@ -2,11 +2,13 @@ package delay
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
 )
 
@@ -15,7 +17,7 @@ func TestDelayManager_AddRetry(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 
-	dm := &delayManagerImpl{db: db, stopChan: make(chan struct{})}
+	dm := &delayManagerImpl{db: db, stopChan: make(chan struct{}), logger: logging.Discard()}
 
 	retryMsg := &model.RetryMessage{
 		Message: model.Message{
@@ -40,6 +42,7 @@ func TestDelayManager_AddRetry(t *testing.T) {
 			sqlmock.AnyArg(), // bornTime
 			sqlmock.AnyArg(), // delayTime
 			2,
+			sqlmock.AnyArg(), // headers
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
@@ -49,3 +52,133 @@ func TestDelayManager_AddRetry(t *testing.T) {
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestDelayManager_GetQueueStat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dm := &delayManagerImpl{db: db, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	oldest := time.Now().Add(-time.Minute)
+	mock.ExpectQuery("SELECT\\s+COUNT\\(\\*\\),\\s+MIN\\(`delay_time`\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "min"}).AddRow(3, oldest))
+	mock.ExpectQuery("SELECT\\s+COUNT\\(\\*\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "min"}).AddRow(0, nil))
+
+	stat, err := dm.GetQueueStat(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stat.Depth)
+	assert.Equal(t, oldest, stat.OldestDelayTime)
+
+	stat, err = dm.GetQueueStat(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stat.Depth)
+	assert.True(t, stat.OldestDelayTime.IsZero())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDelayManager_Query(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dm := &delayManagerImpl{db: db, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	born := time.Now()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)\\s+FROM mqx_delay_messages\\s+WHERE 1 = 1\\s+AND `topic` = \\?").
+		WithArgs("orders").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(21))
+	mock.ExpectQuery("SELECT (.+) FROM mqx_delay_messages\\s+WHERE 1 = 1\\s+AND `topic` = \\?\\s+ORDER BY `delay_time` ASC").
+		WithArgs("orders", 10, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "message_id", "topic", "key", "tag", "body", "born_time", "delay_time", "retry_count", "headers"}).
+			AddRow(7, "m1", "orders", "k", "t", []byte("body"), born, born.Add(time.Hour), 1, `{"a":"b"}`))
+
+	total, msgs, err := dm.Query(context.Background(), &model.DelayFilter{Topic: "orders", PageNo: 3, PageSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(21), total)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "m1", msgs[0].MessageID)
+	assert.Equal(t, born.Add(time.Hour), msgs[0].DelayTime)
+	assert.Equal(t, 1, msgs[0].RetryCount)
+	assert.Equal(t, map[string]string{"a": "b"}, msgs[0].Headers)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDelayManager_Cancel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dm := &delayManagerImpl{db: db, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	mock.ExpectExec("DELETE FROM mqx_delay_messages WHERE `message_id` = \\?").WithArgs("m1").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, dm.Cancel(context.Background(), "m1"))
+	mock.ExpectExec("DELETE FROM mqx_delay_messages WHERE `message_id` = \\?").WithArgs("m1").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, dm.Cancel(context.Background(), "m1"), ErrMessageNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDelayManager_Dequeue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dm := &delayManagerImpl{db: db, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM mqx_delay_messages WHERE `id` = \\?").WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Cancelled since the ready messages were read
+	mock.ExpectExec("DELETE FROM mqx_delay_messages WHERE `id` = \\?").WithArgs(int64(8)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM mqx_delay_messages WHERE `id` = \\?").WithArgs(int64(9)).WillReturnError(errors.New("lock wait timeout"))
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+
+	queued, err := dm.dequeue(tx, &model.DelayMessage{ID: 7})
+	assert.NoError(t, err)
+	assert.True(t, queued)
+	queued, err = dm.dequeue(tx, &model.DelayMessage{ID: 8})
+	assert.NoError(t, err)
+	assert.False(t, queued)
+	_, err = dm.dequeue(tx, &model.DelayMessage{ID: 9})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDelayManager_StopWaitsForLoop(t *testing.T) {
+	dm := &delayManagerImpl{stopChan: make(chan struct{}), done: make(chan struct{}), logger: logging.Discard()}
+	loopCtx, cancel := context.WithCancel(context.Background())
+	dm.cancel = cancel
+	go func() {
+		defer close(dm.done)
+		<-dm.stopChan
+		time.Sleep(10 * time.Millisecond)
+	}()
+
+	assert.NoError(t, dm.Stop(context.Background()))
+	select {
+	case <-dm.done:
+	default:
+		t.Fatal("Stop returned before the delay loop exited")
+	}
+	assert.Error(t, loopCtx.Err())
+}
+
+func TestDelayManager_StopTimeout(t *testing.T) {
+	dm := &delayManagerImpl{stopChan: make(chan struct{}), done: make(chan struct{}), logger: logging.Discard()}
+	loopCtx, cancel := context.WithCancel(context.Background())
+	dm.cancel = cancel
+
+	ctx, cancelStop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelStop()
+	err := dm.Stop(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	// The running cycle is cancelled so that it does not outlive the shutdown
+	assert.Error(t, loopCtx.Err())
+}
+
+func TestDelayManager_StopBeforeStart(t *testing.T) {
+	dm := &delayManagerImpl{stopChan: make(chan struct{}), logger: logging.Discard()}
+	assert.NoError(t, dm.Stop(context.Background()))
+}
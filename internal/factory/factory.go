@@ -3,14 +3,24 @@ package factory
 import (
 	"database/sql"
 
+	"github.com/wenzuojing/mqx/internal/audit"
 	"github.com/wenzuojing/mqx/internal/clear"
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/consumer"
 	"github.com/wenzuojing/mqx/internal/delay"
+	"github.com/wenzuojing/mqx/internal/health"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/message"
+	"github.com/wenzuojing/mqx/internal/metrics"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
 	"github.com/wenzuojing/mqx/internal/producer"
+	"github.com/wenzuojing/mqx/internal/replay"
+	"github.com/wenzuojing/mqx/internal/reply"
 	"github.com/wenzuojing/mqx/internal/topic"
+	"github.com/wenzuojing/mqx/internal/tracing"
+	"github.com/wenzuojing/mqx/internal/transaction"
+	"github.com/wenzuojing/mqx/internal/webhook"
 )
 
 type factoryImpl struct {
@@ -20,10 +30,23 @@ type factoryImpl struct {
 	producerManager interfaces.ProducerManager
 	delayManager    interfaces.DelayManager
 	clearManager    interfaces.ClearManager
+	txManager       interfaces.TransactionManager
+	replyManager    interfaces.ReplyManager
+	auditManager    interfaces.AuditManager
+	replayManager   interfaces.ReplayManager
+	webhookManager  interfaces.WebhookManager
+	metrics         *metrics.Metrics
+	tracer          *tracing.Tracer
+	traceManager    *msgtrace.Manager
+	healthChecker   interfaces.HealthChecker
+	logger          logging.Logger
 }
 
 func NewFactory(db *sql.DB, cfg *config.Config) (interfaces.Factory, error) {
-	f := &factoryImpl{}
+	f := &factoryImpl{logger: logging.OrDefault(cfg.Logger)}
+	if cfg.EnableMessageTrace {
+		f.traceManager = msgtrace.New(db, f.logger)
+	}
 
 	// Create all managers with factory reference.
 	// Managers must not call f.GetXxxManager() during construction.
@@ -39,7 +62,7 @@ func NewFactory(db *sql.DB, cfg *config.Config) (interfaces.Factory, error) {
 	if err != nil {
 		return nil, err
 	}
-	producerManager, err := producer.NewProducerManager(f)
+	producerManager, err := producer.NewProducerManager(cfg, f)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +74,26 @@ func NewFactory(db *sql.DB, cfg *config.Config) (interfaces.Factory, error) {
 	if err != nil {
 		return nil, err
 	}
+	txManager, err := transaction.NewTransactionManager(db, cfg, f)
+	if err != nil {
+		return nil, err
+	}
+	replyManager, err := reply.NewReplyManager(db, cfg, f)
+	if err != nil {
+		return nil, err
+	}
+	auditManager, err := audit.NewAuditManager(db, cfg, f)
+	if err != nil {
+		return nil, err
+	}
+	replayManager, err := replay.NewReplayManager(cfg, f)
+	if err != nil {
+		return nil, err
+	}
+	webhookManager, err := webhook.NewWebhookManager(db, cfg, f)
+	if err != nil {
+		return nil, err
+	}
 
 	// Assign all managers to factory at once
 	f.topicManager = topicManager
@@ -59,6 +102,14 @@ func NewFactory(db *sql.DB, cfg *config.Config) (interfaces.Factory, error) {
 	f.producerManager = producerManager
 	f.delayManager = delayManager
 	f.clearManager = clearManager
+	f.txManager = txManager
+	f.replyManager = replyManager
+	f.auditManager = auditManager
+	f.replayManager = replayManager
+	f.webhookManager = webhookManager
+	f.metrics = metrics.New(messageManager, delayManager, f.logger)
+	f.tracer = tracing.New(cfg.TracerProvider, cfg.Propagator)
+	f.healthChecker = health.NewHealthChecker(db, cfg, f)
 	return f, nil
 }
 
@@ -85,3 +136,43 @@ func (f *factoryImpl) GetDelayManager() interfaces.DelayManager {
 func (f *factoryImpl) GetClearManager() interfaces.ClearManager {
 	return f.clearManager
 }
+
+func (f *factoryImpl) GetTransactionManager() interfaces.TransactionManager {
+	return f.txManager
+}
+
+func (f *factoryImpl) GetReplyManager() interfaces.ReplyManager {
+	return f.replyManager
+}
+
+func (f *factoryImpl) GetAuditManager() interfaces.AuditManager {
+	return f.auditManager
+}
+
+func (f *factoryImpl) GetReplayManager() interfaces.ReplayManager {
+	return f.replayManager
+}
+
+func (f *factoryImpl) GetWebhookManager() interfaces.WebhookManager {
+	return f.webhookManager
+}
+
+func (f *factoryImpl) GetMetrics() *metrics.Metrics {
+	return f.metrics
+}
+
+func (f *factoryImpl) GetTracer() *tracing.Tracer {
+	return f.tracer
+}
+
+func (f *factoryImpl) GetLogger() logging.Logger {
+	return f.logger
+}
+
+func (f *factoryImpl) GetTraceManager() *msgtrace.Manager {
+	return f.traceManager
+}
+
+func (f *factoryImpl) GetHealthChecker() interfaces.HealthChecker {
+	return f.healthChecker
+}
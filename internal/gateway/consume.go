@@ -0,0 +1,230 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// session is a consumer instance created by a gateway client
+type session struct {
+	topic string
+	group string
+	// owner is the name of the principal that created the session, empty without authentication
+	owner    string
+	consumer interfaces.PullConsumer
+	// lastUsed is the unix nano time of the last request of the client
+	lastUsed atomic.Int64
+}
+
+// ownerOf returns the name of the principal of a request, empty when it is unauthenticated
+func ownerOf(c *gin.Context) string {
+	if principal := auth.FromContext(c.Request.Context()); principal != nil {
+		return principal.Name
+	}
+	return ""
+}
+
+func (s *session) touch() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+// CreateConsumerRequest joins a consumer group of a topic
+type CreateConsumerRequest struct {
+	Topic string `json:"topic" binding:"required"`
+	Group string `json:"group" binding:"required"`
+}
+
+// ConsumerResponse describes a consumer instance of the gateway
+type ConsumerResponse struct {
+	InstanceID string `json:"instanceId"`
+	Topic      string `json:"topic"`
+	Group      string `json:"group"`
+}
+
+// CommitRequest holds the offsets of the last handled message of partitions
+type CommitRequest struct {
+	Offsets []PartitionOffset `json:"offsets" binding:"required,min=1,dive"`
+}
+
+// PartitionOffset is the offset of the last handled message of a partition
+type PartitionOffset struct {
+	Partition int   `json:"partition" binding:"min=0"`
+	Offset    int64 `json:"offset" binding:"min=0"`
+}
+
+// createConsumer handles the POST /gateway/v1/consumers request
+func (g *Gateway) createConsumer(c *gin.Context) {
+	var req CreateConsumerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := model.ValidateTopic(req.Topic); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	pc, err := g.factory.GetConsumerManager().NewPullConsumer(c.Request.Context(), req.Topic, req.Group)
+	switch {
+	case errors.Is(err, model.ErrTopicNotFound):
+		httpapi.WriteError(c, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s := &session{topic: req.Topic, group: req.Group, owner: ownerOf(c), consumer: pc}
+	s.touch()
+	g.mu.Lock()
+	g.sessions[pc.InstanceID()] = s
+	g.mu.Unlock()
+
+	c.JSON(http.StatusCreated, ConsumerResponse{InstanceID: pc.InstanceID(), Topic: req.Topic, Group: req.Group})
+}
+
+// session returns the consumer instance of a request, writing a 404 error when it does not exist.
+// Instances created by another principal are reported as missing too.
+func (g *Gateway) session(c *gin.Context) *session {
+	g.mu.Lock()
+	s, ok := g.sessions[c.Param("instanceId")]
+	g.mu.Unlock()
+	if !ok || s.owner != ownerOf(c) {
+		httpapi.WriteError(c, http.StatusNotFound, "consumer instance not found")
+		return nil
+	}
+	s.touch()
+	return s
+}
+
+// fetch handles the GET /gateway/v1/consumers/:instanceId/messages request. It waits up to waitMs
+// milliseconds for messages and returns an empty page when none arrived.
+func (g *Gateway) fetch(c *gin.Context) {
+	var params struct {
+		Max    int   `form:"max,default=100" binding:"min=1"`
+		WaitMs int64 `form:"waitMs" binding:"min=0"`
+	}
+	if err := c.ShouldBindQuery(&params); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Max > g.cfg.MaxBatchSize {
+		httpapi.WriteError(c, http.StatusBadRequest, fmt.Sprintf("max is at most %d", g.cfg.MaxBatchSize))
+		return
+	}
+	s := g.session(c)
+	if s == nil {
+		return
+	}
+
+	wait := min(time.Duration(params.WaitMs)*time.Millisecond, g.cfg.MaxWait)
+	msgs, err := s.consumer.Fetch(c.Request.Context(), params.Max, wait)
+	// Keep a long poll from counting as idle time
+	s.touch()
+	switch {
+	case errors.Is(err, consumer.ErrConsumerClosed):
+		httpapi.WriteError(c, http.StatusNotFound, "consumer instance not found")
+		return
+	case errors.Is(err, context.Canceled):
+		// The client went away
+		c.Abort()
+		return
+	case err != nil:
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	items := make([]*model.HTTPMessage, len(msgs))
+	for i, msg := range msgs {
+		items[i] = model.NewHTTPMessage(msg)
+	}
+	c.JSON(http.StatusOK, httpapi.NewPage(items))
+}
+
+// commit handles the POST /gateway/v1/consumers/:instanceId/offsets request
+func (g *Gateway) commit(c *gin.Context) {
+	var req CommitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	s := g.session(c)
+	if s == nil {
+		return
+	}
+
+	for _, offset := range req.Offsets {
+		err := s.consumer.Commit(c.Request.Context(), offset.Partition, offset.Offset)
+		if errors.Is(err, consumer.ErrPartitionNotAssigned) {
+			// Reassigned since the fetch: its messages are redelivered to the new owner
+			httpapi.WriteError(c, http.StatusConflict, fmt.Sprintf("partition %d: %v", offset.Partition, err))
+			return
+		}
+		if err != nil {
+			httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Offsets committed successfully"})
+}
+
+// deleteConsumer handles the DELETE /gateway/v1/consumers/:instanceId request
+func (g *Gateway) deleteConsumer(c *gin.Context) {
+	g.mu.Lock()
+	s, ok := g.sessions[c.Param("instanceId")]
+	ok = ok && s.owner == ownerOf(c)
+	if ok {
+		delete(g.sessions, c.Param("instanceId"))
+	}
+	g.mu.Unlock()
+	if !ok {
+		httpapi.WriteError(c, http.StatusNotFound, "consumer instance not found")
+		return
+	}
+
+	if err := s.consumer.Close(c.Request.Context()); err != nil {
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Consumer instance deleted successfully"})
+}
+
+// expireSessions closes the consumer instances whose clients have made no request for the session timeout
+func (g *Gateway) expireSessions() {
+	ticker := time.NewTicker(g.cfg.SessionTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stopChan:
+			return
+		case <-ticker.C:
+		}
+		g.mu.Lock()
+		expired := make([]*session, 0)
+		for id, s := range g.sessions {
+			if time.Since(time.Unix(0, s.lastUsed.Load())) > g.cfg.SessionTimeout {
+				expired = append(expired, s)
+				delete(g.sessions, id)
+			}
+		}
+		g.mu.Unlock()
+
+		for _, s := range expired {
+			g.logger.Info("Closing idle gateway consumer instance", "topic", s.topic, "group", s.group, "instance", s.consumer.InstanceID())
+			ctx, cancel := context.WithTimeout(context.Background(), g.cfg.SessionTimeout/4)
+			if err := s.consumer.Close(ctx); err != nil {
+				g.logger.Error("Failed to close gateway consumer instance", "instance", s.consumer.InstanceID(), "error", err)
+			}
+			cancel()
+		}
+	}
+}
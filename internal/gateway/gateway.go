@@ -0,0 +1,170 @@
+// Package gateway lets services that cannot embed the Go library publish and consume over HTTP.
+// Its consumers are instances of the same consumer groups as the Go consumers, sharing their
+// partition assignment and offsets.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+)
+
+const (
+	defaultMaxBatchSize   = 500
+	defaultMaxWait        = 30 * time.Second
+	defaultSessionTimeout = 5 * time.Minute
+)
+
+// Gateway serves the publish, fetch, commit and webhook routes, either on its own address
+// or mounted on the console
+type Gateway struct {
+	cfg     config.Gateway
+	factory interfaces.Factory
+	logger  logging.Logger
+	// authenticator checks the tokens of a standalone gateway, nil when none are configured
+	authenticator auth.Authenticator
+	server        *http.Server
+	mu            sync.Mutex
+	sessions      map[string]*session
+	stopChan      chan struct{}
+	stopOnce      sync.Once
+	wg            sync.WaitGroup
+}
+
+// New creates a gateway, filling in the defaults of the unset limits
+func New(cfg *config.Config, factory interfaces.Factory) (*Gateway, error) {
+	gw := cfg.Gateway
+	if gw.MaxBatchSize <= 0 {
+		gw.MaxBatchSize = defaultMaxBatchSize
+	}
+	if gw.MaxWait <= 0 {
+		gw.MaxWait = defaultMaxWait
+	}
+	if gw.SessionTimeout <= 0 {
+		gw.SessionTimeout = defaultSessionTimeout
+	}
+	var authenticator auth.Authenticator
+	if len(gw.Tokens) > 0 {
+		tokens, err := auth.NewBearerTokens(gw.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		authenticator = tokens
+	}
+	return &Gateway{
+		cfg:           gw,
+		factory:       factory,
+		logger:        factory.GetLogger(),
+		authenticator: authenticator,
+		sessions:      make(map[string]*session),
+		stopChan:      make(chan struct{}),
+	}, nil
+}
+
+// Standalone reports whether the gateway serves its own address rather than being mounted on the console
+func (g *Gateway) Standalone() bool {
+	return g.cfg.Address != ""
+}
+
+// Register adds the gateway routes to r
+func (g *Gateway) Register(r gin.IRouter) {
+	r.POST("/topics/:topic/messages", g.publish)
+	r.POST("/topics/:topic/messages/batch", g.publishBatch)
+
+	r.POST("/consumers", g.createConsumer)
+	r.GET("/consumers/:instanceId/messages", g.fetch)
+	r.POST("/consumers/:instanceId/offsets", g.commit)
+	r.DELETE("/consumers/:instanceId", g.deleteConsumer)
+
+	r.GET("/webhooks", g.listWebhooks)
+	r.PUT("/topics/:topic/webhooks/:group", g.putWebhook)
+	r.DELETE("/topics/:topic/webhooks/:group", g.deleteWebhook)
+}
+
+// Start expires the idle consumer instances and, for a standalone gateway, starts its HTTP server
+func (g *Gateway) Start(ctx context.Context) error {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		g.expireSessions()
+	}()
+	if !g.Standalone() {
+		return nil
+	}
+
+	if g.authenticator == nil {
+		g.logger.Warn("Gateway authentication is disabled", "address", g.cfg.Address)
+	}
+	g.server = &http.Server{Addr: g.cfg.Address, Handler: g.newEngine()}
+	go func() {
+		if err := g.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			g.logger.Error("Failed to start gateway server", "address", g.cfg.Address, "error", err)
+		}
+	}()
+	return nil
+}
+
+// newEngine creates the HTTP handler of a standalone gateway
+func (g *Gateway) newEngine() *gin.Engine {
+	engine := gin.Default()
+	engine.NoRoute(func(c *gin.Context) {
+		httpapi.WriteError(c, http.StatusNotFound, "no route for "+c.Request.Method+" "+c.Request.URL.Path)
+	})
+	g.Register(engine.Group("/gateway/v1", g.authenticate))
+	return engine
+}
+
+// Stop closes the consumer instances, which leave their groups, then shuts the
+// HTTP server of a standalone gateway down. Everything waits at most until the ctx deadline.
+func (g *Gateway) Stop(ctx context.Context) error {
+	g.stopOnce.Do(func() { close(g.stopChan) })
+	var errs []error
+	if g.server != nil {
+		if err := g.server.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	g.mu.Lock()
+	sessions := make([]*session, 0, len(g.sessions))
+	for id, s := range g.sessions {
+		sessions = append(sessions, s)
+		delete(g.sessions, id)
+	}
+	g.mu.Unlock()
+
+	for _, s := range sessions {
+		if err := s.consumer.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	g.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// authenticate requires a token of the operator role on a standalone gateway with tokens
+func (g *Gateway) authenticate(c *gin.Context) {
+	if g.authenticator == nil {
+		return
+	}
+	principal, err := g.authenticator.Authenticate(c.Request)
+	if err != nil || principal == nil {
+		httpapi.WriteError(c, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	if !principal.Role.Allows(auth.RoleOperator) {
+		httpapi.WriteError(c, http.StatusForbidden, fmt.Sprintf("role %s required", auth.RoleOperator))
+		return
+	}
+	c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), principal))
+}
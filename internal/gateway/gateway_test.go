@@ -0,0 +1,374 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/webhook"
+)
+
+// MockFactory implements interfaces.Factory for testing
+type MockFactory struct {
+	mock.Mock
+	interfaces.Factory
+}
+
+func (m *MockFactory) GetProducerManager() interfaces.ProducerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ProducerManager)
+}
+
+func (m *MockFactory) GetConsumerManager() interfaces.ConsumerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ConsumerManager)
+}
+
+func (m *MockFactory) GetWebhookManager() interfaces.WebhookManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.WebhookManager)
+}
+
+func (m *MockFactory) GetLogger() logging.Logger {
+	return logging.Discard()
+}
+
+// MockProducerManager implements interfaces.ProducerManager for testing
+type MockProducerManager struct {
+	mock.Mock
+	interfaces.ProducerManager
+}
+
+func (m *MockProducerManager) SendSync(ctx context.Context, msg *model.Message) (string, error) {
+	args := m.Called(ctx, msg)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockProducerManager) SendAsync(ctx context.Context, msg *model.Message, callback func(string, error)) error {
+	args := m.Called(ctx, msg, callback)
+	return args.Error(0)
+}
+
+// MockConsumerManager implements interfaces.ConsumerManager for testing
+type MockConsumerManager struct {
+	mock.Mock
+	interfaces.ConsumerManager
+}
+
+func (m *MockConsumerManager) NewPullConsumer(ctx context.Context, topic string, group string) (interfaces.PullConsumer, error) {
+	args := m.Called(ctx, topic, group)
+	pc, _ := args.Get(0).(interfaces.PullConsumer)
+	return pc, args.Error(1)
+}
+
+// MockWebhookManager implements interfaces.WebhookManager for testing
+type MockWebhookManager struct {
+	mock.Mock
+	interfaces.WebhookManager
+}
+
+func (m *MockWebhookManager) Subscribe(ctx context.Context, sub *model.WebhookSubscription) error {
+	args := m.Called(ctx, sub)
+	return args.Error(0)
+}
+
+func (m *MockWebhookManager) Unsubscribe(ctx context.Context, topic string, group string) error {
+	args := m.Called(ctx, topic, group)
+	return args.Error(0)
+}
+
+func (m *MockWebhookManager) GetSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	subs, _ := args.Get(0).([]*model.WebhookSubscription)
+	return subs, args.Error(1)
+}
+
+// MockPullConsumer implements interfaces.PullConsumer for testing
+type MockPullConsumer struct {
+	mock.Mock
+}
+
+func (m *MockPullConsumer) InstanceID() string {
+	return "instance-1"
+}
+
+func (m *MockPullConsumer) Fetch(ctx context.Context, max int, wait time.Duration) ([]*model.Message, error) {
+	args := m.Called(ctx, max, wait)
+	msgs, _ := args.Get(0).([]*model.Message)
+	return msgs, args.Error(1)
+}
+
+func (m *MockPullConsumer) Commit(ctx context.Context, partition int, offset int64) error {
+	args := m.Called(ctx, partition, offset)
+	return args.Error(0)
+}
+
+func (m *MockPullConsumer) Close(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func newTestGateway(t *testing.T, cfg config.Gateway, factory interfaces.Factory) (*Gateway, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+	g, err := New(&config.Config{Gateway: cfg}, factory)
+	require.NoError(t, err)
+	return g, g.newEngine()
+}
+
+func serve(engine *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestGateway_Publish(t *testing.T) {
+	producer := new(MockProducerManager)
+	producer.On("SendSync", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool {
+		return msg.Topic == "orders" && string(msg.Body) == "\x00\x01" && msg.Key == "k" && msg.Delay == 2*time.Second
+	})).Return("msg-1", nil)
+	factory := new(MockFactory)
+	factory.On("GetProducerManager").Return(producer)
+	_, engine := newTestGateway(t, config.Gateway{}, factory)
+
+	w := serve(engine, http.MethodPost, "/gateway/v1/topics/orders/messages", `{"key":"k","bodyBase64":"AAE=","delayMs":2000}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"messageId":"msg-1"}`, w.Body.String())
+
+	w = serve(engine, http.MethodPost, "/gateway/v1/topics/orders/messages", `{"body":"a","bodyBase64":"AAE="}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":{"code":"invalid_argument","message":"only one of body and bodyBase64 may be set"}}`, w.Body.String())
+
+	// Clients may not route messages with the headers of mqx
+	w = serve(engine, http.MethodPost, "/gateway/v1/topics/orders/messages", `{"body":"a","headers":{"MQX-Target-Group":"billing"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `header \"MQX-Target-Group\" is reserved`)
+
+	w = serve(engine, http.MethodPost, "/gateway/v1/topics/orders.v2/messages", `{"body":"a"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":{"code":"invalid_argument","message":"invalid topic name"}}`, w.Body.String())
+	w = serve(engine, http.MethodPost, "/gateway/v1/topics/"+strings.Repeat("a", model.MaxTopicLength+1)+"/messages/batch", `{"messages":[{"body":"a"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	producer.AssertNumberOfCalls(t, "SendSync", 1)
+}
+
+func TestGateway_Publish_ErrorStatus(t *testing.T) {
+	producer := new(MockProducerManager)
+	producer.On("SendSync", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool { return string(msg.Body) == "bad" })).
+		Return("", fmt.Errorf("prepare: %w", model.ErrInvalidTopic))
+	producer.On("SendSync", mock.Anything, mock.Anything).Return("", errors.New("connection refused"))
+	factory := new(MockFactory)
+	factory.On("GetProducerManager").Return(producer)
+	_, engine := newTestGateway(t, config.Gateway{}, factory)
+
+	// Validation errors of the producer are the fault of the client
+	w := serve(engine, http.MethodPost, "/gateway/v1/topics/orders/messages", `{"body":"bad"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(engine, http.MethodPost, "/gateway/v1/topics/orders/messages", `{"body":"a"}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGateway_PublishBatch(t *testing.T) {
+	producer := new(MockProducerManager)
+	producer.On("SendAsync", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool { return string(msg.Body) == "full" }), mock.Anything).
+		Return(errors.New("buffer full"))
+	producer.On("SendAsync", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			msg := args.Get(1).(*model.Message)
+			go args.Get(2).(func(string, error))("id-"+string(msg.Body), nil)
+		}).Return(nil)
+	factory := new(MockFactory)
+	factory.On("GetProducerManager").Return(producer)
+	_, engine := newTestGateway(t, config.Gateway{MaxBatchSize: 3}, factory)
+
+	w := serve(engine, http.MethodPost, "/gateway/v1/topics/orders/messages/batch", `{"messages":[{"body":"a"},{"body":"full"},{"body":"b"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"results":[{"messageId":"id-a"},{"error":"buffer full"},{"messageId":"id-b"}]}`, w.Body.String())
+
+	w = serve(engine, http.MethodPost, "/gateway/v1/topics/orders/messages/batch", `{"messages":[{},{},{},{}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(engine, http.MethodPost, "/gateway/v1/topics/orders/messages/batch", `{"messages":[]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGateway_Consumer(t *testing.T) {
+	pc := new(MockPullConsumer)
+	pc.On("Fetch", mock.Anything, 10, 50*time.Millisecond).Return([]*model.Message{
+		{MessageID: "m1", Topic: "orders", Partition: 2, Offset: 7, Body: []byte("paid")},
+		{MessageID: "m2", Topic: "orders", Partition: 2, Offset: 8, Body: []byte{0xff}},
+	}, nil)
+	pc.On("Commit", mock.Anything, 2, int64(8)).Return(nil)
+	pc.On("Commit", mock.Anything, 3, int64(1)).Return(consumer.ErrPartitionNotAssigned)
+	pc.On("Close", mock.Anything).Return(nil)
+	consumers := new(MockConsumerManager)
+	consumers.On("NewPullConsumer", mock.Anything, "orders", "billing").Return(pc, nil)
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	// The wait is capped at MaxWait
+	_, engine := newTestGateway(t, config.Gateway{MaxWait: 50 * time.Millisecond}, factory)
+
+	w := serve(engine, http.MethodPost, "/gateway/v1/consumers", `{"topic":"orders","group":"billing"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"instanceId":"instance-1","topic":"orders","group":"billing"}`, w.Body.String())
+
+	w = serve(engine, http.MethodGet, "/gateway/v1/consumers/instance-1/messages?max=10&waitMs=60000", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page httpapi.Page[model.HTTPMessage]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "paid", page.Items[0].Body)
+	assert.Equal(t, "/w==", page.Items[1].BodyBase64)
+
+	w = serve(engine, http.MethodPost, "/gateway/v1/consumers/instance-1/offsets", `{"offsets":[{"partition":2,"offset":8}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve(engine, http.MethodPost, "/gateway/v1/consumers/instance-1/offsets", `{"offsets":[{"partition":3,"offset":1}]}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = serve(engine, http.MethodDelete, "/gateway/v1/consumers/instance-1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve(engine, http.MethodGet, "/gateway/v1/consumers/instance-1/messages", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	pc.AssertExpectations(t)
+}
+
+func TestGateway_Consumer_Topic(t *testing.T) {
+	consumers := new(MockConsumerManager)
+	consumers.On("NewPullConsumer", mock.Anything, "missing", "billing").Return(nil, fmt.Errorf("%w: missing", model.ErrTopicNotFound))
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	_, engine := newTestGateway(t, config.Gateway{}, factory)
+
+	w := serve(engine, http.MethodPost, "/gateway/v1/consumers", "{\"topic\":\"orders`; drop table x\",\"group\":\"billing\"}")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	consumers.AssertNotCalled(t, "NewPullConsumer", mock.Anything, mock.Anything, mock.Anything)
+
+	w = serve(engine, http.MethodPost, "/gateway/v1/consumers", `{"topic":"missing","group":"billing"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGateway_ExpireSessions(t *testing.T) {
+	pc := new(MockPullConsumer)
+	pc.On("Close", mock.Anything).Return(nil)
+	consumers := new(MockConsumerManager)
+	consumers.On("NewPullConsumer", mock.Anything, "orders", "billing").Return(pc, nil)
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	g, engine := newTestGateway(t, config.Gateway{SessionTimeout: 40 * time.Millisecond}, factory)
+	require.NoError(t, g.Start(context.Background()))
+	defer g.Stop(context.Background())
+
+	w := serve(engine, http.MethodPost, "/gateway/v1/consumers", `{"topic":"orders","group":"billing"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Eventually(t, func() bool {
+		return serve(engine, http.MethodDelete, "/gateway/v1/consumers/instance-1", "").Code == http.StatusNotFound
+	}, time.Second, 20*time.Millisecond)
+	pc.AssertCalled(t, "Close", mock.Anything)
+}
+
+func TestGateway_Webhook(t *testing.T) {
+	webhooks := new(MockWebhookManager)
+	webhooks.On("Subscribe", mock.Anything, mock.MatchedBy(func(sub *model.WebhookSubscription) bool {
+		return sub.Topic == "orders" && sub.Group == "billing" && sub.Secret == "s3cret" && sub.RateLimit == 5
+	})).Return(nil).Once()
+	webhooks.On("Subscribe", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: url is required", webhook.ErrInvalidSubscription)).Once()
+	webhooks.On("GetSubscriptions", mock.Anything).
+		Return([]*model.WebhookSubscription{{Topic: "orders", Group: "billing", URL: "https://example.com/hook", Secret: "s3cret"}}, nil)
+	webhooks.On("Unsubscribe", mock.Anything, "orders", "billing").Return(nil).Once()
+	webhooks.On("Unsubscribe", mock.Anything, "orders", "billing").Return(webhook.ErrSubscriptionNotFound).Once()
+	factory := new(MockFactory)
+	factory.On("GetWebhookManager").Return(webhooks)
+	_, engine := newTestGateway(t, config.Gateway{}, factory)
+
+	w := serve(engine, http.MethodPut, "/gateway/v1/topics/orders/webhooks/billing", `{"url":"https://example.com/hook","secret":"s3cret","rateLimit":5}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "s3cret")
+	w = serve(engine, http.MethodPut, "/gateway/v1/topics/orders/webhooks/billing", `{"url":"ftp://example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(engine, http.MethodPut, "/gateway/v1/topics/orders/webhooks/billing", `{"url":"https://example.com/hook","concurrency":-1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(engine, http.MethodGet, "/gateway/v1/webhooks", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"url":"https://example.com/hook"`)
+	// The secret is never returned
+	assert.NotContains(t, w.Body.String(), "s3cret")
+
+	w = serve(engine, http.MethodDelete, "/gateway/v1/topics/orders/webhooks/billing", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve(engine, http.MethodDelete, "/gateway/v1/topics/orders/webhooks/billing", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	webhooks.AssertExpectations(t)
+}
+
+func TestGateway_Authentication(t *testing.T) {
+	webhooks := new(MockWebhookManager)
+	webhooks.On("GetSubscriptions", mock.Anything).Return([]*model.WebhookSubscription{}, nil)
+	factory := new(MockFactory)
+	factory.On("GetWebhookManager").Return(webhooks)
+	_, engine := newTestGateway(t, config.Gateway{Tokens: []auth.Token{
+		{Name: "billing", Token: "op-token", Role: auth.RoleOperator},
+		{Name: "grafana", Token: "view-token", Role: auth.RoleViewer},
+	}}, factory)
+
+	request := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/gateway/v1/webhooks", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, request(""))
+	assert.Equal(t, http.StatusUnauthorized, request("wrong"))
+	assert.Equal(t, http.StatusForbidden, request("view-token"))
+	assert.Equal(t, http.StatusOK, request("op-token"))
+}
+
+func TestGateway_SessionOwner(t *testing.T) {
+	pc := new(MockPullConsumer)
+	pc.On("Fetch", mock.Anything, 100, time.Duration(0)).Return([]*model.Message{}, nil)
+	pc.On("Close", mock.Anything).Return(nil)
+	consumers := new(MockConsumerManager)
+	consumers.On("NewPullConsumer", mock.Anything, "orders", "billing").Return(pc, nil)
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	_, engine := newTestGateway(t, config.Gateway{Tokens: []auth.Token{
+		{Name: "billing", Token: "billing-token", Role: auth.RoleOperator},
+		{Name: "shipping", Token: "shipping-token", Role: auth.RoleOperator},
+	}}, factory)
+
+	request := func(method, path, body, token string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/gateway/v1/consumers", `{"topic":"orders","group":"billing"}`, "billing-token"))
+
+	// Another client can neither read, commit nor delete the instance
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/gateway/v1/consumers/instance-1/messages", "", "shipping-token"))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodPost, "/gateway/v1/consumers/instance-1/offsets", `{"offsets":[{"partition":0,"offset":1}]}`, "shipping-token"))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, "/gateway/v1/consumers/instance-1", "", "shipping-token"))
+	pc.AssertNotCalled(t, "Close", mock.Anything)
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/gateway/v1/consumers/instance-1/messages", "", "billing-token"))
+	assert.Equal(t, http.StatusOK, request(http.MethodDelete, "/gateway/v1/consumers/instance-1", "", "billing-token"))
+}
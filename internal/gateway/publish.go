@@ -0,0 +1,156 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// PublishRequest is a message to publish. The body is given as text in Body or base64 encoded in BodyBase64.
+type PublishRequest struct {
+	Key        string            `json:"key"`
+	Tag        string            `json:"tag"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	BodyBase64 string            `json:"bodyBase64"`
+	// DelayMs delivers the message after a delay instead of right away
+	DelayMs int64 `json:"delayMs" binding:"min=0"`
+}
+
+// message converts a publish request into a message of topic
+func (r *PublishRequest) message(topic string) (*model.Message, error) {
+	for name := range r.Headers {
+		if model.IsReservedHeader(name) {
+			return nil, fmt.Errorf("header %q is reserved: names starting with %s are set by mqx", name, model.ReservedHeaderPrefix)
+		}
+	}
+	body := []byte(r.Body)
+	if r.BodyBase64 != "" {
+		if r.Body != "" {
+			return nil, errors.New("only one of body and bodyBase64 may be set")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(r.BodyBase64)
+		if err != nil {
+			return nil, errors.New("bodyBase64 is not valid base64")
+		}
+		body = decoded
+	}
+	return &model.Message{
+		Topic:    topic,
+		Key:      r.Key,
+		Tag:      r.Tag,
+		Headers:  r.Headers,
+		Body:     body,
+		BornTime: time.Now(),
+		Delay:    time.Duration(r.DelayMs) * time.Millisecond,
+	}, nil
+}
+
+// PublishResponse holds the ID of a published message
+type PublishResponse struct {
+	MessageID string `json:"messageId"`
+}
+
+// BatchPublishRequest is a batch of messages of one topic
+type BatchPublishRequest struct {
+	Messages []PublishRequest `json:"messages" binding:"required,min=1,dive"`
+}
+
+// PublishResult is the outcome of one message of a batch, with either its ID or the error
+type PublishResult struct {
+	MessageID string `json:"messageId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BatchPublishResponse holds the results of a batch in the order of its messages
+type BatchPublishResponse struct {
+	Results []PublishResult `json:"results"`
+}
+
+// publish handles the POST /gateway/v1/topics/:topic/messages request
+func (g *Gateway) publish(c *gin.Context) {
+	var req PublishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := model.ValidateTopic(c.Param("topic")); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	msg, err := req.message(c.Param("topic"))
+	if err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messageID, err := g.factory.GetProducerManager().SendSync(c.Request.Context(), msg)
+	if err != nil {
+		httpapi.WriteError(c, sendStatus(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, PublishResponse{MessageID: messageID})
+}
+
+// publishBatch handles the POST /gateway/v1/topics/:topic/messages/batch request.
+// The messages go through the async producer, which writes them in multi-row inserts; each one
+// succeeds or fails on its own and the response reports every result.
+func (g *Gateway) publishBatch(c *gin.Context) {
+	var req BatchPublishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Messages) > g.cfg.MaxBatchSize {
+		httpapi.WriteError(c, http.StatusBadRequest, fmt.Sprintf("a batch holds at most %d messages", g.cfg.MaxBatchSize))
+		return
+	}
+	if err := model.ValidateTopic(c.Param("topic")); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	msgs := make([]*model.Message, len(req.Messages))
+	for i := range req.Messages {
+		msg, err := req.Messages[i].message(c.Param("topic"))
+		if err != nil {
+			httpapi.WriteError(c, http.StatusBadRequest, fmt.Sprintf("messages[%d]: %v", i, err))
+			return
+		}
+		msgs[i] = msg
+	}
+
+	results := make([]PublishResult, len(msgs))
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		wg.Add(1)
+		err := g.factory.GetProducerManager().SendAsync(c.Request.Context(), msg, func(messageID string, err error) {
+			defer wg.Done()
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].MessageID = messageID
+		})
+		if err != nil {
+			wg.Done()
+			results[i].Error = err.Error()
+		}
+	}
+	wg.Wait()
+	c.JSON(http.StatusOK, BatchPublishResponse{Results: results})
+}
+
+// sendStatus returns the HTTP status of an error of the producer
+func sendStatus(err error) int {
+	if errors.Is(err, model.ErrInvalidTopic) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
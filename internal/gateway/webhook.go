@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenzuojing/mqx/internal/httpapi"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/webhook"
+)
+
+// WebhookRequest creates or replaces the webhook subscription of a consumer group
+type WebhookRequest struct {
+	URL string `json:"url" binding:"required"`
+	// Secret signs the deliveries; empty keeps the secret of the subscription replaced
+	Secret      string  `json:"secret"`
+	Concurrency int     `json:"concurrency" binding:"min=0"`
+	RateLimit   float64 `json:"rateLimit" binding:"min=0"`
+	TimeoutMs   int64   `json:"timeoutMs" binding:"min=0"`
+}
+
+// webhookStatus maps the errors of the webhook manager to HTTP status codes
+func webhookStatus(err error) int {
+	switch {
+	case errors.Is(err, webhook.ErrInvalidSubscription):
+		return http.StatusBadRequest
+	case errors.Is(err, webhook.ErrSubscriptionNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// listWebhooks handles the GET /gateway/v1/webhooks request
+func (g *Gateway) listWebhooks(c *gin.Context) {
+	subs, err := g.factory.GetWebhookManager().GetSubscriptions(c.Request.Context())
+	if err != nil {
+		httpapi.WriteError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, httpapi.NewPage(subs))
+}
+
+// putWebhook handles the PUT /gateway/v1/topics/:topic/webhooks/:group request
+func (g *Gateway) putWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httpapi.WriteError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	sub := &model.WebhookSubscription{
+		Topic:       c.Param("topic"),
+		Group:       c.Param("group"),
+		URL:         req.URL,
+		Secret:      req.Secret,
+		Concurrency: req.Concurrency,
+		RateLimit:   req.RateLimit,
+		TimeoutMs:   req.TimeoutMs,
+	}
+	if err := g.factory.GetWebhookManager().Subscribe(c.Request.Context(), sub); err != nil {
+		httpapi.WriteError(c, webhookStatus(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// deleteWebhook handles the DELETE /gateway/v1/topics/:topic/webhooks/:group request
+func (g *Gateway) deleteWebhook(c *gin.Context) {
+	if err := g.factory.GetWebhookManager().Unsubscribe(c.Request.Context(), c.Param("topic"), c.Param("group")); err != nil {
+		httpapi.WriteError(c, webhookStatus(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, httpapi.StatusResponse{Message: "Webhook deleted successfully"})
+}
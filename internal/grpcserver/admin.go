@@ -0,0 +1,310 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/console"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/pkg/mqxpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type adminServer struct {
+	mqxpb.UnimplementedAdminServer
+	*Server
+}
+
+// audit records a mutating admin call in the audit log shared with the console
+func (a *adminServer) audit(ctx context.Context, action string, target string, before any, after any, err error) {
+	entry := &model.AuditEntry{
+		Action:   action,
+		Target:   target,
+		Before:   auditJSON(before),
+		After:    auditJSON(after),
+		Result:   model.AuditResultSuccess,
+		ClientIP: clientIP(ctx),
+	}
+	if principal := auth.FromContext(ctx); principal != nil {
+		entry.User, entry.Role = principal.Name, string(principal.Role)
+	}
+	if err != nil {
+		entry.Result, entry.Error = model.AuditResultFailure, err.Error()
+	}
+	if err := a.factory.GetAuditManager().Record(ctx, entry); err != nil {
+		a.logger.Error("Failed to write audit log", "action", action, "target", target, "user", entry.User, "error", err)
+	}
+}
+
+func auditJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
+
+// partitions returns the stats of the partitions of a topic in partition order
+func (a *adminServer) partitions(ctx context.Context, topic string, partitionNum int) ([]*mqxpb.Partition, error) {
+	partitions := make([]*mqxpb.Partition, partitionNum)
+	errs := make([]error, partitionNum)
+	var wg sync.WaitGroup
+	for i := range partitionNum {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stat, err := a.factory.GetMessageManager().GetPartitionStat(ctx, topic, i)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			partitions[i] = &mqxpb.Partition{Partition: int32(i), MinOffset: stat.MinOffset, MaxOffset: stat.MaxOffset, Total: stat.Total}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return partitions, nil
+}
+
+// topicMeta returns the meta of an existing topic. Unlike GetTopicMeta it does not create a missing topic.
+func (a *adminServer) topicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	if err := model.ValidateTopic(topic); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	meta, err := a.factory.GetTopicManager().FindTopicMeta(ctx, topic)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return meta, nil
+}
+
+// lag returns the number of messages of a partition after a committed offset
+func lag(partition *mqxpb.Partition, offset int64) int64 {
+	return partition.MaxOffset - max(offset, partition.MinOffset)
+}
+
+func (a *adminServer) ListTopics(ctx context.Context, req *mqxpb.ListTopicsRequest) (*mqxpb.ListTopicsResponse, error) {
+	metas, err := a.factory.GetTopicManager().GetAllTopicMeta(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	topics := make([]*mqxpb.Topic, 0, len(metas))
+	for _, meta := range metas {
+		partitions, err := a.partitions(ctx, meta.Topic, meta.PartitionNum)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		topic := &mqxpb.Topic{Topic: meta.Topic, PartitionNum: int32(meta.PartitionNum), RetentionDays: int32(meta.RetentionDays)}
+		for _, partition := range partitions {
+			topic.MessageTotal += partition.Total
+		}
+		topics = append(topics, topic)
+	}
+	return &mqxpb.ListTopicsResponse{Topics: topics}, nil
+}
+
+func (a *adminServer) CreateTopic(ctx context.Context, req *mqxpb.CreateTopicRequest) (*mqxpb.Topic, error) {
+	if req.Topic == "" || req.PartitionNum <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "topic and a positive partition_num are required")
+	}
+	if err := model.ValidateTopic(req.Topic); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	meta := &model.TopicMeta{Topic: req.Topic, PartitionNum: int(req.PartitionNum), RetentionDays: int(req.RetentionDays)}
+	err := a.factory.GetTopicManager().CreateTopic(ctx, meta)
+	a.audit(ctx, console.ActionTopicCreate, req.Topic, nil, meta, err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &mqxpb.Topic{Topic: meta.Topic, PartitionNum: req.PartitionNum, RetentionDays: req.RetentionDays}, nil
+}
+
+func (a *adminServer) UpdateTopic(ctx context.Context, req *mqxpb.UpdateTopicRequest) (*mqxpb.Topic, error) {
+	if req.Topic == "" || req.PartitionNum <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "topic and a positive partition_num are required")
+	}
+	if err := model.ValidateTopic(req.Topic); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	meta := &model.TopicMeta{Topic: req.Topic, PartitionNum: int(req.PartitionNum), RetentionDays: int(req.RetentionDays)}
+	before, _ := a.factory.GetTopicManager().FindTopicMeta(ctx, req.Topic)
+	err := a.factory.GetTopicManager().UpdateTopicMeta(ctx, meta)
+	a.audit(ctx, console.ActionTopicUpdate, req.Topic, before, meta, err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &mqxpb.Topic{Topic: meta.Topic, PartitionNum: req.PartitionNum, RetentionDays: req.RetentionDays}, nil
+}
+
+func (a *adminServer) DeleteTopic(ctx context.Context, req *mqxpb.DeleteTopicRequest) (*mqxpb.DeleteTopicResponse, error) {
+	if req.Topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic is required")
+	}
+	before, _ := a.factory.GetTopicManager().GetTopicMeta(ctx, req.Topic)
+	err := a.factory.GetTopicManager().DeleteTopic(ctx, req.Topic)
+	a.audit(ctx, console.ActionTopicDelete, req.Topic, before, nil, err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &mqxpb.DeleteTopicResponse{}, nil
+}
+
+func (a *adminServer) ListPartitions(ctx context.Context, req *mqxpb.ListPartitionsRequest) (*mqxpb.ListPartitionsResponse, error) {
+	if req.Topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic is required")
+	}
+	meta, err := a.topicMeta(ctx, req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := a.partitions(ctx, req.Topic, meta.PartitionNum)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &mqxpb.ListPartitionsResponse{Partitions: partitions}, nil
+}
+
+// heartbeatTimeoutSeconds is the heartbeat age after which an instance no longer counts as active
+func (a *adminServer) heartbeatTimeoutSeconds() int {
+	return int(a.heartbeatInterval.Seconds()) * 3
+}
+
+func (a *adminServer) ListConsumerGroups(ctx context.Context, req *mqxpb.ListConsumerGroupsRequest) (*mqxpb.ListConsumerGroupsResponse, error) {
+	if req.Topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic is required")
+	}
+	meta, err := a.topicMeta(ctx, req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	consumerManager := a.factory.GetConsumerManager()
+	instances, err := consumerManager.GetActiveConsumerInstances(ctx, req.Topic, "", a.heartbeatTimeoutSeconds())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	offsets, err := consumerManager.GetConsumerOffsets(ctx, req.Topic, "")
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	partitions, err := a.partitions(ctx, req.Topic, meta.PartitionNum)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	groups := make(map[string]*mqxpb.ConsumerGroup)
+	for _, offset := range offsets {
+		group, ok := groups[offset.Group]
+		if !ok {
+			group = &mqxpb.ConsumerGroup{Group: offset.Group}
+			groups[offset.Group] = group
+		}
+		if offset.Partition < len(partitions) {
+			group.Lag += lag(partitions[offset.Partition], offset.Offset)
+		}
+	}
+	for _, instance := range instances {
+		if group, ok := groups[instance.Group]; ok {
+			group.ActiveInstances++
+		}
+	}
+	resp := &mqxpb.ListConsumerGroupsResponse{Groups: make([]*mqxpb.ConsumerGroup, 0, len(groups))}
+	for _, group := range groups {
+		resp.Groups = append(resp.Groups, group)
+	}
+	sort.Slice(resp.Groups, func(i, j int) bool { return resp.Groups[i].Group < resp.Groups[j].Group })
+	return resp, nil
+}
+
+func (a *adminServer) DescribeConsumerGroup(ctx context.Context, req *mqxpb.DescribeConsumerGroupRequest) (*mqxpb.DescribeConsumerGroupResponse, error) {
+	if req.Topic == "" || req.Group == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic and group are required")
+	}
+	meta, err := a.topicMeta(ctx, req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	consumerManager := a.factory.GetConsumerManager()
+	offsets, err := consumerManager.GetConsumerOffsets(ctx, req.Topic, req.Group)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if len(offsets) == 0 {
+		return nil, status.Error(codes.NotFound, "consumer group not found")
+	}
+	instances, err := consumerManager.GetConsumerInstances(ctx, req.Topic, req.Group)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	partitions, err := a.partitions(ctx, req.Topic, meta.PartitionNum)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &mqxpb.DescribeConsumerGroupResponse{Group: req.Group}
+	for _, offset := range offsets {
+		consumerOffset := &mqxpb.ConsumerOffset{Partition: int32(offset.Partition), Offset: offset.Offset, InstanceId: offset.InstanceID}
+		if offset.Partition < len(partitions) {
+			consumerOffset.Lag = lag(partitions[offset.Partition], offset.Offset)
+		}
+		resp.Lag += consumerOffset.Lag
+		resp.Offsets = append(resp.Offsets, consumerOffset)
+	}
+	sort.Slice(resp.Offsets, func(i, j int) bool { return resp.Offsets[i].Partition < resp.Offsets[j].Partition })
+	for _, instance := range instances {
+		resp.Instances = append(resp.Instances, &mqxpb.ConsumerInstance{
+			InstanceId: instance.InstanceID,
+			Hostname:   instance.Hostname,
+			Active:     instance.Active,
+			Heartbeat:  timestamppb.New(instance.Heartbeat),
+		})
+	}
+	return resp, nil
+}
+
+func (a *adminServer) DeleteConsumerGroup(ctx context.Context, req *mqxpb.DeleteConsumerGroupRequest) (*mqxpb.DeleteConsumerGroupResponse, error) {
+	if req.Topic == "" || req.Group == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic and group are required")
+	}
+	before, _ := a.factory.GetConsumerManager().GetConsumerOffsets(ctx, req.Topic, req.Group)
+	err := a.factory.GetConsumerManager().DeleteGroup(ctx, req.Topic, req.Group)
+	a.audit(ctx, console.ActionGroupDelete, req.Topic+"/"+req.Group, before, nil, err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &mqxpb.DeleteConsumerGroupResponse{}, nil
+}
+
+func (a *adminServer) EvictInstance(ctx context.Context, req *mqxpb.EvictInstanceRequest) (*mqxpb.EvictInstanceResponse, error) {
+	if req.Topic == "" || req.Group == "" || req.InstanceId == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic, group and instance_id are required")
+	}
+	err := a.factory.GetConsumerManager().EvictInstance(ctx, req.Topic, req.Group, req.InstanceId)
+	a.audit(ctx, console.ActionGroupEvict, req.Topic+"/"+req.Group, nil, map[string]string{"instanceId": req.InstanceId}, err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &mqxpb.EvictInstanceResponse{}, nil
+}
+
+func (a *adminServer) Rebalance(ctx context.Context, req *mqxpb.RebalanceRequest) (*mqxpb.RebalanceResponse, error) {
+	if req.Topic == "" || req.Group == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic and group are required")
+	}
+	err := a.factory.GetConsumerManager().Rebalance(ctx, req.Topic, req.Group)
+	a.audit(ctx, console.ActionGroupRebalance, req.Topic+"/"+req.Group, nil, nil, err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &mqxpb.RebalanceResponse{}, nil
+}
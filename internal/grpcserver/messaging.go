@@ -0,0 +1,358 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/pkg/mqxpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// fetchWait is how long a subscription waits for messages before fetching again
+	fetchWait = 30 * time.Second
+	// fetchRetryInterval is the wait after a failed fetch
+	fetchRetryInterval = time.Second
+	// closeTimeout bounds leaving the group when a subscription ends
+	closeTimeout = 10 * time.Second
+)
+
+type messagingServer struct {
+	mqxpb.UnimplementedMessagingServer
+	*Server
+}
+
+// newMessage converts a stored message for the gRPC clients
+func newMessage(msg *model.Message) *mqxpb.Message {
+	return &mqxpb.Message{
+		MessageId:  msg.MessageID,
+		Topic:      msg.Topic,
+		Partition:  int32(msg.Partition),
+		Offset:     msg.Offset,
+		Key:        msg.Key,
+		Tag:        msg.Tag,
+		Headers:    msg.Headers,
+		Body:       msg.Body,
+		BornTime:   timestamppb.New(msg.BornTime),
+		RetryCount: int32(msg.RetryCount),
+	}
+}
+
+// toModel converts a publish request into a message
+func toModel(req *mqxpb.PublishRequest) (*model.Message, error) {
+	if req.Topic == "" {
+		return nil, errors.New("topic is required")
+	}
+	if req.DelayMs < 0 {
+		return nil, errors.New("delay_ms must not be negative")
+	}
+	return &model.Message{
+		Topic:    req.Topic,
+		Key:      req.Key,
+		Tag:      req.Tag,
+		Headers:  req.Headers,
+		Body:     req.Body,
+		BornTime: time.Now(),
+		Delay:    time.Duration(req.DelayMs) * time.Millisecond,
+	}, nil
+}
+
+func (m *messagingServer) Publish(ctx context.Context, req *mqxpb.PublishRequest) (*mqxpb.PublishResponse, error) {
+	msg, err := toModel(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	messageID, err := m.factory.GetProducerManager().SendSync(ctx, msg)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &mqxpb.PublishResponse{MessageId: messageID}, nil
+}
+
+func (m *messagingServer) PublishBatch(ctx context.Context, req *mqxpb.PublishBatchRequest) (*mqxpb.PublishBatchResponse, error) {
+	if len(req.Messages) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "messages are required")
+	}
+	if len(req.Messages) > m.cfg.MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "a batch holds at most %d messages", m.cfg.MaxBatchSize)
+	}
+	msgs := make([]*model.Message, len(req.Messages))
+	for i, r := range req.Messages {
+		msg, err := toModel(r)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "messages[%d]: %v", i, err)
+		}
+		msgs[i] = msg
+	}
+
+	results := make([]*mqxpb.PublishResult, len(msgs))
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		results[i] = &mqxpb.PublishResult{}
+		wg.Add(1)
+		err := m.factory.GetProducerManager().SendAsync(ctx, msg, func(messageID string, err error) {
+			defer wg.Done()
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].MessageId = messageID
+		})
+		if err != nil {
+			wg.Done()
+			results[i].Error = err.Error()
+		}
+	}
+	wg.Wait()
+	return &mqxpb.PublishBatchResponse{Results: results}, nil
+}
+
+// subscription is a consumer instance streaming to a Subscribe call
+type subscription struct {
+	consumer     interfaces.PullConsumer
+	manualCommit bool
+	window       int
+	cancel       context.CancelFunc
+	mu           sync.Mutex
+	// pending holds the offsets of the streamed messages of each partition not yet committed, true once acked.
+	// A manually committed subscription drops them when acked.
+	pending map[int]map[int64]bool
+	unacked int
+	// acked is signalled when acks make room in the window
+	acked chan struct{}
+	// commitMu keeps the commits of concurrent acks in order
+	commitMu sync.Mutex
+}
+
+// room waits until the window has room and returns how many messages fit
+func (s *subscription) room(ctx context.Context) (int, error) {
+	for {
+		s.mu.Lock()
+		room := s.window - s.unacked
+		s.mu.Unlock()
+		if room > 0 {
+			return room, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-s.acked:
+		}
+	}
+}
+
+// track records a message about to be streamed
+func (s *subscription) track(msg *model.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offsets, ok := s.pending[msg.Partition]
+	if !ok {
+		offsets = make(map[int64]bool)
+		s.pending[msg.Partition] = offsets
+	}
+	// A partition assigned again restarts from its committed offset and streams the same offsets again
+	if acked, ok := offsets[msg.Offset]; ok && !acked {
+		return
+	}
+	offsets[msg.Offset] = false
+	s.unacked++
+}
+
+// ack marks messages as acked and returns the offset to commit for each partition whose first
+// pending messages are all acked
+func (s *subscription) ack(positions []*mqxpb.MessagePosition) map[int]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	touched := make(map[int]bool)
+	for _, position := range positions {
+		partition := int(position.Partition)
+		if acked, ok := s.pending[partition][position.Offset]; !ok || acked {
+			continue
+		}
+		s.unacked--
+		touched[partition] = true
+		if s.manualCommit {
+			delete(s.pending[partition], position.Offset)
+		} else {
+			s.pending[partition][position.Offset] = true
+		}
+	}
+	if len(touched) > 0 {
+		select {
+		case s.acked <- struct{}{}:
+		default:
+		}
+	}
+	if s.manualCommit {
+		return nil
+	}
+
+	commits := make(map[int]int64)
+	for partition := range touched {
+		offsets := make([]int64, 0, len(s.pending[partition]))
+		for offset := range s.pending[partition] {
+			offsets = append(offsets, offset)
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		for _, offset := range offsets {
+			if !s.pending[partition][offset] {
+				break
+			}
+			delete(s.pending[partition], offset)
+			commits[partition] = offset
+		}
+	}
+	return commits
+}
+
+// subscription returns the subscription of an instance
+func (s *Server) subscription(instanceID string) (*subscription, error) {
+	s.mu.Lock()
+	sub, ok := s.subscriptions[instanceID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, status.Error(codes.NotFound, "subscription not found")
+	}
+	return sub, nil
+}
+
+func (m *messagingServer) Subscribe(req *mqxpb.SubscribeRequest, stream mqxpb.Messaging_SubscribeServer) error {
+	if req.Topic == "" || req.Group == "" {
+		return status.Error(codes.InvalidArgument, "topic and group are required")
+	}
+	if err := model.ValidateTopic(req.Topic); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	window := int(req.MaxInFlight)
+	if window == 0 {
+		window = min(defaultInFlight, m.cfg.MaxInFlight)
+	}
+	if window < 0 || window > m.cfg.MaxInFlight {
+		return status.Errorf(codes.InvalidArgument, "max_in_flight must be between 0 and %d", m.cfg.MaxInFlight)
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	pc, err := m.factory.GetConsumerManager().NewPullConsumer(ctx, req.Topic, req.Group)
+	if err != nil {
+		return toStatus(err)
+	}
+	sub := &subscription{
+		consumer:     pc,
+		manualCommit: req.ManualCommit,
+		window:       window,
+		cancel:       cancel,
+		pending:      make(map[int]map[int64]bool),
+		acked:        make(chan struct{}, 1),
+	}
+	m.mu.Lock()
+	m.subscriptions[pc.InstanceID()] = sub
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.subscriptions, pc.InstanceID())
+		m.mu.Unlock()
+		closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), closeTimeout)
+		defer cancel()
+		if err := pc.Close(closeCtx); err != nil {
+			m.logger.Error("Failed to close gRPC subscription", "topic", req.Topic, "group", req.Group, "instance", pc.InstanceID(), "error", err)
+		}
+	}()
+
+	if err := stream.Send(&mqxpb.SubscribeResponse{Event: &mqxpb.SubscribeResponse_Subscribed{
+		Subscribed: &mqxpb.Subscribed{InstanceId: pc.InstanceID()},
+	}}); err != nil {
+		return err
+	}
+
+	logger := m.logger.With("topic", req.Topic, "group", req.Group, "instance", pc.InstanceID())
+	errLog := logging.NewThrottle(logger, 0)
+	for {
+		room, err := sub.room(ctx)
+		if err != nil {
+			return m.ended(stream.Context(), err)
+		}
+		msgs, err := pc.Fetch(ctx, room, fetchWait)
+		if ctx.Err() != nil || errors.Is(err, consumer.ErrConsumerClosed) {
+			return m.ended(stream.Context(), ctx.Err())
+		}
+		if err != nil {
+			errLog.Error("Failed to fetch messages for gRPC subscription", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(fetchRetryInterval):
+			}
+			continue
+		}
+		errLog.Reset()
+
+		for _, msg := range msgs {
+			sub.track(msg)
+			if err := stream.Send(&mqxpb.SubscribeResponse{Event: &mqxpb.SubscribeResponse_Message{Message: newMessage(msg)}}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ended returns the status of a subscription that stopped, ended by the client when its
+// context is done and by Stop otherwise
+func (m *messagingServer) ended(streamCtx context.Context, err error) error {
+	if streamCtx.Err() != nil {
+		return toStatus(streamCtx.Err())
+	}
+	if err == nil || errors.Is(err, context.Canceled) {
+		return status.Error(codes.Unavailable, "server is stopping")
+	}
+	return toStatus(err)
+}
+
+func (m *messagingServer) Ack(ctx context.Context, req *mqxpb.AckRequest) (*mqxpb.AckResponse, error) {
+	sub, err := m.subscription(req.InstanceId)
+	if err != nil {
+		return nil, err
+	}
+	sub.commitMu.Lock()
+	defer sub.commitMu.Unlock()
+	for partition, offset := range sub.ack(req.Messages) {
+		err := sub.consumer.Commit(ctx, partition, offset)
+		if errors.Is(err, consumer.ErrPartitionNotAssigned) {
+			// Reassigned since the messages were streamed: the new owner consumes them again
+			m.logger.Debug("Skipped the commit of a reassigned partition", "instance", req.InstanceId, "partition", partition, "offset", offset)
+			continue
+		}
+		if err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	return &mqxpb.AckResponse{}, nil
+}
+
+func (m *messagingServer) CommitOffset(ctx context.Context, req *mqxpb.CommitOffsetRequest) (*mqxpb.CommitOffsetResponse, error) {
+	if req.Partition < 0 || req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "partition and offset must not be negative")
+	}
+	sub, err := m.subscription(req.InstanceId)
+	if err != nil {
+		return nil, err
+	}
+	sub.commitMu.Lock()
+	defer sub.commitMu.Unlock()
+	if err := sub.consumer.Commit(ctx, int(req.Partition), req.Offset); err != nil {
+		if errors.Is(err, consumer.ErrPartitionNotAssigned) {
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("partition %d: %v", req.Partition, err))
+		}
+		return nil, toStatus(err)
+	}
+	return &mqxpb.CommitOffsetResponse{}, nil
+}
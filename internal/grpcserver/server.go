@@ -0,0 +1,242 @@
+// Package grpcserver serves the Messaging and Admin gRPC services of pkg/mqxpb for clients in other
+// languages. Its subscriptions are instances of the same consumer groups as the Go consumers, sharing
+// their partition assignment and offsets.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/pkg/mqxpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMaxBatchSize = 500
+	defaultMaxInFlight  = 1000
+	// defaultInFlight is the window of a subscription that asks for none
+	defaultInFlight = 100
+)
+
+// Server serves the gRPC services over the managers of a factory
+type Server struct {
+	cfg     config.GRPC
+	factory interfaces.Factory
+	logger  logging.Logger
+	// authenticator checks the bearer tokens, nil when none are configured
+	authenticator auth.Authenticator
+	server        *grpc.Server
+	// heartbeatInterval is the heartbeat interval of the consumer instances, to tell the active ones
+	heartbeatInterval time.Duration
+	mu                sync.Mutex
+	subscriptions     map[string]*subscription
+}
+
+// New creates a server, filling in the defaults of the unset limits
+func New(cfg *config.Config, factory interfaces.Factory) (*Server, error) {
+	c := cfg.GRPC
+	if c.MaxBatchSize <= 0 {
+		c.MaxBatchSize = defaultMaxBatchSize
+	}
+	if c.MaxInFlight <= 0 {
+		c.MaxInFlight = defaultMaxInFlight
+	}
+	var authenticator auth.Authenticator
+	if len(c.Tokens) > 0 {
+		tokens, err := auth.NewBearerTokens(c.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		authenticator = tokens
+	}
+	s := &Server{
+		cfg:               c,
+		factory:           factory,
+		logger:            factory.GetLogger(),
+		authenticator:     authenticator,
+		heartbeatInterval: cfg.HeartbeatInterval,
+		subscriptions:     make(map[string]*subscription),
+	}
+	s.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.authenticateUnary),
+		grpc.ChainStreamInterceptor(s.authenticateStream),
+	)
+	mqxpb.RegisterMessagingServer(s.server, &messagingServer{Server: s})
+	mqxpb.RegisterAdminServer(s.server, &adminServer{Server: s})
+	return s, nil
+}
+
+// Start listens on the configured address and serves in the background
+func (s *Server) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", s.cfg.Address)
+	if err != nil {
+		return err
+	}
+	if s.authenticator == nil {
+		s.logger.Warn("gRPC authentication is disabled", "address", s.cfg.Address)
+	}
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			s.logger.Error("Failed to serve gRPC", "address", s.cfg.Address, "error", err)
+		}
+	}()
+	return nil
+}
+
+// Serve serves the connections of lis until Stop
+func (s *Server) Serve(lis net.Listener) error {
+	return s.server.Serve(lis)
+}
+
+// Stop ends the subscriptions, which leave their groups, and waits for the other calls to finish.
+// Calls still running at the ctx deadline are cancelled.
+func (s *Server) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.server.GracefulStop()
+	}()
+
+	s.mu.Lock()
+	subscriptions := make([]*subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+	s.mu.Unlock()
+	// A subscription stream only ends when cancelled, which GracefulStop does not do
+	for _, sub := range subscriptions {
+		sub.cancel()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// methodRoles is the role required by each method, as for the same action on the console
+var methodRoles = map[string]auth.Role{
+	mqxpb.Messaging_Publish_FullMethodName:      auth.RoleOperator,
+	mqxpb.Messaging_PublishBatch_FullMethodName: auth.RoleOperator,
+	mqxpb.Messaging_Subscribe_FullMethodName:    auth.RoleOperator,
+	mqxpb.Messaging_Ack_FullMethodName:          auth.RoleOperator,
+	mqxpb.Messaging_CommitOffset_FullMethodName: auth.RoleOperator,
+
+	mqxpb.Admin_ListTopics_FullMethodName:            auth.RoleViewer,
+	mqxpb.Admin_CreateTopic_FullMethodName:           auth.RoleAdmin,
+	mqxpb.Admin_UpdateTopic_FullMethodName:           auth.RoleAdmin,
+	mqxpb.Admin_DeleteTopic_FullMethodName:           auth.RoleAdmin,
+	mqxpb.Admin_ListPartitions_FullMethodName:        auth.RoleViewer,
+	mqxpb.Admin_ListConsumerGroups_FullMethodName:    auth.RoleViewer,
+	mqxpb.Admin_DescribeConsumerGroup_FullMethodName: auth.RoleViewer,
+	mqxpb.Admin_DeleteConsumerGroup_FullMethodName:   auth.RoleAdmin,
+	mqxpb.Admin_EvictInstance_FullMethodName:         auth.RoleOperator,
+	mqxpb.Admin_Rebalance_FullMethodName:             auth.RoleOperator,
+}
+
+// authenticate checks the bearer token of a call against the role of its method
+// and returns the context carrying the caller
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if s.authenticator == nil {
+		return ctx, nil
+	}
+	// The authenticators read HTTP requests; the authorization metadata holds the same header
+	r := &http.Request{Header: make(http.Header)}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		r.Header.Add("Authorization", value)
+	}
+	principal, err := s.authenticator.Authenticate(r)
+	if err != nil || principal == nil {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	role, ok := methodRoles[method]
+	if !ok {
+		role = auth.RoleAdmin
+	}
+	if !principal.Role.Allows(role) {
+		return nil, status.Errorf(codes.PermissionDenied, "role %s required", role)
+	}
+	return auth.NewContext(ctx, principal), nil
+}
+
+func (s *Server) authenticateUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authenticateStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream is a server stream whose context carries the caller
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// toStatus maps the errors of the managers to gRPC statuses
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, model.ErrInvalidTopic):
+		code = codes.InvalidArgument
+	case errors.Is(err, model.ErrTopicNotFound), errors.Is(err, consumer.ErrInstanceNotFound), errors.Is(err, consumer.ErrConsumerClosed):
+		code = codes.NotFound
+	case errors.Is(err, consumer.ErrGroupActive), errors.Is(err, consumer.ErrNoActiveInstances),
+		errors.Is(err, consumer.ErrPartitionNotAssigned):
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, err.Error())
+}
+
+// clientIP returns the host of the caller of a call, for the audit log
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,535 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wenzuojing/mqx/internal/auth"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/pkg/mqxpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// MockFactory implements interfaces.Factory for testing
+type MockFactory struct {
+	mock.Mock
+	interfaces.Factory
+}
+
+func (m *MockFactory) GetProducerManager() interfaces.ProducerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ProducerManager)
+}
+
+func (m *MockFactory) GetConsumerManager() interfaces.ConsumerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ConsumerManager)
+}
+
+func (m *MockFactory) GetTopicManager() interfaces.TopicManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.TopicManager)
+}
+
+func (m *MockFactory) GetMessageManager() interfaces.MessageManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.MessageManager)
+}
+
+func (m *MockFactory) GetAuditManager() interfaces.AuditManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.AuditManager)
+}
+
+func (m *MockFactory) GetLogger() logging.Logger {
+	return logging.Discard()
+}
+
+// MockProducerManager implements interfaces.ProducerManager for testing
+type MockProducerManager struct {
+	mock.Mock
+	interfaces.ProducerManager
+}
+
+func (m *MockProducerManager) SendSync(ctx context.Context, msg *model.Message) (string, error) {
+	args := m.Called(ctx, msg)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockProducerManager) SendAsync(ctx context.Context, msg *model.Message, callback func(string, error)) error {
+	args := m.Called(ctx, msg, callback)
+	return args.Error(0)
+}
+
+// MockConsumerManager implements interfaces.ConsumerManager for testing
+type MockConsumerManager struct {
+	mock.Mock
+	interfaces.ConsumerManager
+}
+
+func (m *MockConsumerManager) NewPullConsumer(ctx context.Context, topic string, group string) (interfaces.PullConsumer, error) {
+	args := m.Called(ctx, topic, group)
+	pc, _ := args.Get(0).(interfaces.PullConsumer)
+	return pc, args.Error(1)
+}
+
+func (m *MockConsumerManager) GetConsumerOffsets(ctx context.Context, topic string, group string) ([]model.ConsumerOffset, error) {
+	args := m.Called(ctx, topic, group)
+	return args.Get(0).([]model.ConsumerOffset), args.Error(1)
+}
+
+func (m *MockConsumerManager) GetConsumerInstances(ctx context.Context, topic string, group string) ([]model.ConsumerInstance, error) {
+	args := m.Called(ctx, topic, group)
+	return args.Get(0).([]model.ConsumerInstance), args.Error(1)
+}
+
+func (m *MockConsumerManager) GetActiveConsumerInstances(ctx context.Context, topic string, group string, heartbeatTimeoutSeconds int) ([]model.ConsumerInstance, error) {
+	args := m.Called(ctx, topic, group, heartbeatTimeoutSeconds)
+	return args.Get(0).([]model.ConsumerInstance), args.Error(1)
+}
+
+func (m *MockConsumerManager) DeleteGroup(ctx context.Context, topic string, group string) error {
+	args := m.Called(ctx, topic, group)
+	return args.Error(0)
+}
+
+// MockTopicManager implements interfaces.TopicManager for testing
+type MockTopicManager struct {
+	mock.Mock
+	interfaces.TopicManager
+}
+
+func (m *MockTopicManager) GetTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	args := m.Called(ctx, topic)
+	return args.Get(0).(*model.TopicMeta), args.Error(1)
+}
+
+func (m *MockTopicManager) FindTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	args := m.Called(ctx, topic)
+	meta, _ := args.Get(0).(*model.TopicMeta)
+	return meta, args.Error(1)
+}
+
+func (m *MockTopicManager) GetAllTopicMeta(ctx context.Context) ([]model.TopicMeta, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.TopicMeta), args.Error(1)
+}
+
+// MockMessageManager implements interfaces.MessageManager for testing
+type MockMessageManager struct {
+	mock.Mock
+	interfaces.MessageManager
+}
+
+func (m *MockMessageManager) GetPartitionStat(ctx context.Context, topic string, partition int) (*interfaces.PartitionStat, error) {
+	args := m.Called(ctx, topic, partition)
+	return args.Get(0).(*interfaces.PartitionStat), args.Error(1)
+}
+
+// MockAuditManager implements interfaces.AuditManager for testing
+type MockAuditManager struct {
+	mock.Mock
+	interfaces.AuditManager
+}
+
+func (m *MockAuditManager) Record(ctx context.Context, entry *model.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+// fakePullConsumer hands out queued messages and records the commits
+type fakePullConsumer struct {
+	mu      sync.Mutex
+	queue   []*model.Message
+	commits map[int]int64
+	// notAssigned is the partition whose commits fail
+	notAssigned int
+	closed      chan struct{}
+}
+
+func newFakePullConsumer(msgs ...*model.Message) *fakePullConsumer {
+	return &fakePullConsumer{queue: msgs, commits: make(map[int]int64), notAssigned: -1, closed: make(chan struct{})}
+}
+
+func (f *fakePullConsumer) InstanceID() string {
+	return "instance-1"
+}
+
+func (f *fakePullConsumer) Fetch(ctx context.Context, max int, wait time.Duration) ([]*model.Message, error) {
+	f.mu.Lock()
+	n := min(max, len(f.queue))
+	msgs := f.queue[:n]
+	f.queue = f.queue[n:]
+	f.mu.Unlock()
+	if len(msgs) > 0 {
+		return msgs, nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(10 * time.Millisecond):
+		return nil, nil
+	}
+}
+
+func (f *fakePullConsumer) Commit(ctx context.Context, partition int, offset int64) error {
+	if partition == f.notAssigned {
+		return consumer.ErrPartitionNotAssigned
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commits[partition] = offset
+	return nil
+}
+
+func (f *fakePullConsumer) committed() map[int]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commits := make(map[int]int64, len(f.commits))
+	for partition, offset := range f.commits {
+		commits[partition] = offset
+	}
+	return commits
+}
+
+func (f *fakePullConsumer) Close(ctx context.Context) error {
+	close(f.closed)
+	return nil
+}
+
+// newTestServer serves a server over an in-memory connection and returns its clients
+func newTestServer(t *testing.T, cfg config.GRPC, factory interfaces.Factory) (*Server, mqxpb.MessagingClient, mqxpb.AdminClient) {
+	s, err := New(&config.Config{GRPC: cfg, HeartbeatInterval: 10 * time.Second}, factory)
+	require.NoError(t, err)
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Stop(ctx)
+	})
+	return s, mqxpb.NewMessagingClient(conn), mqxpb.NewAdminClient(conn)
+}
+
+// receive streams the responses of a subscription into a channel
+func receive(stream mqxpb.Messaging_SubscribeClient) (<-chan *mqxpb.SubscribeResponse, <-chan error) {
+	responses, errs := make(chan *mqxpb.SubscribeResponse, 16), make(chan error, 1)
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			responses <- resp
+		}
+	}()
+	return responses, errs
+}
+
+func nextMessage(t *testing.T, responses <-chan *mqxpb.SubscribeResponse) *mqxpb.Message {
+	select {
+	case resp := <-responses:
+		require.NotNil(t, resp.GetMessage())
+		return resp.GetMessage()
+	case <-time.After(time.Second):
+		require.FailNow(t, "no message streamed")
+		return nil
+	}
+}
+
+func TestServer_Publish(t *testing.T) {
+	producer := new(MockProducerManager)
+	producer.On("SendSync", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool {
+		return msg.Topic == "orders" && string(msg.Body) == "\x00\x01" && msg.Key == "k" && msg.Delay == 2*time.Second
+	})).Return("msg-1", nil)
+	factory := new(MockFactory)
+	factory.On("GetProducerManager").Return(producer)
+	_, client, _ := newTestServer(t, config.GRPC{}, factory)
+
+	resp, err := client.Publish(context.Background(), &mqxpb.PublishRequest{Topic: "orders", Key: "k", Body: []byte{0, 1}, DelayMs: 2000})
+	require.NoError(t, err)
+	assert.Equal(t, "msg-1", resp.MessageId)
+
+	_, err = client.Publish(context.Background(), &mqxpb.PublishRequest{Body: []byte("a")})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	producer.AssertNumberOfCalls(t, "SendSync", 1)
+}
+
+func TestServer_PublishBatch(t *testing.T) {
+	producer := new(MockProducerManager)
+	producer.On("SendAsync", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool { return string(msg.Body) == "full" }), mock.Anything).
+		Return(errors.New("buffer full"))
+	producer.On("SendAsync", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			msg := args.Get(1).(*model.Message)
+			go args.Get(2).(func(string, error))("id-"+string(msg.Body), nil)
+		}).Return(nil)
+	factory := new(MockFactory)
+	factory.On("GetProducerManager").Return(producer)
+	_, client, _ := newTestServer(t, config.GRPC{MaxBatchSize: 3}, factory)
+
+	resp, err := client.PublishBatch(context.Background(), &mqxpb.PublishBatchRequest{Messages: []*mqxpb.PublishRequest{
+		{Topic: "orders", Body: []byte("a")},
+		{Topic: "orders", Body: []byte("full")},
+		{Topic: "orders", Body: []byte("b")},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 3)
+	assert.Equal(t, "id-a", resp.Results[0].MessageId)
+	assert.Equal(t, "buffer full", resp.Results[1].Error)
+	assert.Equal(t, "id-b", resp.Results[2].MessageId)
+
+	_, err = client.PublishBatch(context.Background(), &mqxpb.PublishBatchRequest{Messages: make([]*mqxpb.PublishRequest, 4)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.PublishBatch(context.Background(), &mqxpb.PublishBatchRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Subscribe(t *testing.T) {
+	pc := newFakePullConsumer(
+		&model.Message{MessageID: "m1", Topic: "orders", Partition: 0, Offset: 1},
+		&model.Message{MessageID: "m2", Topic: "orders", Partition: 0, Offset: 2},
+		&model.Message{MessageID: "m3", Topic: "orders", Partition: 1, Offset: 5},
+	)
+	consumers := new(MockConsumerManager)
+	consumers.On("NewPullConsumer", mock.Anything, "orders", "billing").Return(pc, nil)
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	_, client, _ := newTestServer(t, config.GRPC{}, factory)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Subscribe(ctx, &mqxpb.SubscribeRequest{Topic: "orders", Group: "billing", MaxInFlight: 2})
+	require.NoError(t, err)
+	responses, errs := receive(stream)
+	first := <-responses
+	require.NotNil(t, first.GetSubscribed())
+	instanceID := first.GetSubscribed().InstanceId
+	assert.Equal(t, "instance-1", instanceID)
+
+	assert.Equal(t, "m1", nextMessage(t, responses).MessageId)
+	assert.Equal(t, "m2", nextMessage(t, responses).MessageId)
+	// The window is full until a message is acked
+	select {
+	case resp := <-responses:
+		require.FailNow(t, "streamed past the window", "%v", resp)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Acking the second message makes room but commits nothing while the first is pending
+	_, err = client.Ack(ctx, &mqxpb.AckRequest{InstanceId: instanceID, Messages: []*mqxpb.MessagePosition{{Partition: 0, Offset: 2}}})
+	require.NoError(t, err)
+	assert.Equal(t, "m3", nextMessage(t, responses).MessageId)
+	assert.Empty(t, pc.committed())
+
+	_, err = client.Ack(ctx, &mqxpb.AckRequest{InstanceId: instanceID, Messages: []*mqxpb.MessagePosition{{Partition: 0, Offset: 1}, {Partition: 1, Offset: 5}}})
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 2, 1: 5}, pc.committed())
+
+	_, err = client.Ack(ctx, &mqxpb.AckRequest{InstanceId: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Cancelling the call leaves the group
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(<-errs))
+	select {
+	case <-pc.closed:
+	case <-time.After(time.Second):
+		require.FailNow(t, "subscription was not closed")
+	}
+}
+
+func TestServer_SubscribeManualCommit(t *testing.T) {
+	pc := newFakePullConsumer(&model.Message{MessageID: "m1", Topic: "orders", Partition: 0, Offset: 1})
+	pc.notAssigned = 3
+	consumers := new(MockConsumerManager)
+	consumers.On("NewPullConsumer", mock.Anything, "orders", "billing").Return(pc, nil)
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	_, client, _ := newTestServer(t, config.GRPC{MaxInFlight: 10}, factory)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Subscribe(ctx, &mqxpb.SubscribeRequest{Topic: "orders", Group: "billing", ManualCommit: true})
+	require.NoError(t, err)
+	responses, _ := receive(stream)
+	instanceID := (<-responses).GetSubscribed().InstanceId
+	assert.Equal(t, "m1", nextMessage(t, responses).MessageId)
+
+	_, err = client.Ack(ctx, &mqxpb.AckRequest{InstanceId: instanceID, Messages: []*mqxpb.MessagePosition{{Partition: 0, Offset: 1}}})
+	require.NoError(t, err)
+	assert.Empty(t, pc.committed())
+
+	_, err = client.CommitOffset(ctx, &mqxpb.CommitOffsetRequest{InstanceId: instanceID, Partition: 0, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 1}, pc.committed())
+	_, err = client.CommitOffset(ctx, &mqxpb.CommitOffsetRequest{InstanceId: instanceID, Partition: 3, Offset: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.CommitOffset(ctx, &mqxpb.CommitOffsetRequest{InstanceId: "unknown", Partition: 0, Offset: 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_SubscribeInvalidWindow(t *testing.T) {
+	_, client, _ := newTestServer(t, config.GRPC{MaxInFlight: 10}, new(MockFactory))
+
+	stream, err := client.Subscribe(context.Background(), &mqxpb.SubscribeRequest{Topic: "orders", Group: "billing", MaxInFlight: 11})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_SubscribeInvalidTopic(t *testing.T) {
+	_, client, _ := newTestServer(t, config.GRPC{MaxInFlight: 10}, new(MockFactory))
+
+	stream, err := client.Subscribe(context.Background(), &mqxpb.SubscribeRequest{Topic: "orders`; drop table x", Group: "billing"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_StopEndsSubscriptions(t *testing.T) {
+	pc := newFakePullConsumer()
+	consumers := new(MockConsumerManager)
+	consumers.On("NewPullConsumer", mock.Anything, "orders", "billing").Return(pc, nil)
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	s, client, _ := newTestServer(t, config.GRPC{}, factory)
+
+	stream, err := client.Subscribe(context.Background(), &mqxpb.SubscribeRequest{Topic: "orders", Group: "billing"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Stop(ctx))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	<-pc.closed
+}
+
+func TestServer_Admin(t *testing.T) {
+	topics := new(MockTopicManager)
+	topics.On("GetAllTopicMeta", mock.Anything).Return([]model.TopicMeta{{Topic: "orders", PartitionNum: 2, RetentionDays: 7}}, nil)
+	topics.On("FindTopicMeta", mock.Anything, "orders").Return(&model.TopicMeta{Topic: "orders", PartitionNum: 2, RetentionDays: 7}, nil)
+	topics.On("FindTopicMeta", mock.Anything, "missing").Return(nil, fmt.Errorf("%w: missing", model.ErrTopicNotFound))
+	messages := new(MockMessageManager)
+	messages.On("GetPartitionStat", mock.Anything, "orders", 0).Return(&interfaces.PartitionStat{MinOffset: 1, MaxOffset: 10, Total: 10}, nil)
+	messages.On("GetPartitionStat", mock.Anything, "orders", 1).Return(&interfaces.PartitionStat{MinOffset: 5, MaxOffset: 8, Total: 4}, nil)
+	consumers := new(MockConsumerManager)
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", "billing").Return([]model.ConsumerOffset{
+		{Group: "billing", Topic: "orders", Partition: 1, Offset: 2, InstanceID: "i2"},
+		{Group: "billing", Topic: "orders", Partition: 0, Offset: 6, InstanceID: "i1"},
+	}, nil)
+	consumers.On("GetConsumerOffsets", mock.Anything, "orders", "idle").Return([]model.ConsumerOffset{}, nil)
+	consumers.On("GetConsumerInstances", mock.Anything, "orders", "billing").Return([]model.ConsumerInstance{
+		{Group: "billing", Topic: "orders", InstanceID: "i1", Hostname: "host-1", Active: true},
+	}, nil)
+	consumers.On("DeleteGroup", mock.Anything, "orders", "billing").Return(consumer.ErrGroupActive)
+	audits := new(MockAuditManager)
+	audits.On("Record", mock.Anything, mock.MatchedBy(func(entry *model.AuditEntry) bool {
+		return entry.Action == "group.delete" && entry.Target == "orders/billing" && entry.Result == model.AuditResultFailure
+	})).Return(nil)
+	factory := new(MockFactory)
+	factory.On("GetTopicManager").Return(topics)
+	factory.On("GetMessageManager").Return(messages)
+	factory.On("GetConsumerManager").Return(consumers)
+	factory.On("GetAuditManager").Return(audits)
+	_, _, client := newTestServer(t, config.GRPC{}, factory)
+	ctx := context.Background()
+
+	listed, err := client.ListTopics(ctx, &mqxpb.ListTopicsRequest{})
+	require.NoError(t, err)
+	require.Len(t, listed.Topics, 1)
+	assert.Equal(t, int64(14), listed.Topics[0].MessageTotal)
+	assert.Equal(t, int32(2), listed.Topics[0].PartitionNum)
+
+	group, err := client.DescribeConsumerGroup(ctx, &mqxpb.DescribeConsumerGroupRequest{Topic: "orders", Group: "billing"})
+	require.NoError(t, err)
+	require.Len(t, group.Offsets, 2)
+	assert.Equal(t, int32(0), group.Offsets[0].Partition)
+	assert.Equal(t, int64(4), group.Offsets[0].Lag)
+	// An offset before the oldest retained message counts from that message
+	assert.Equal(t, int64(3), group.Offsets[1].Lag)
+	assert.Equal(t, int64(7), group.Lag)
+	require.Len(t, group.Instances, 1)
+	assert.Equal(t, "host-1", group.Instances[0].Hostname)
+
+	_, err = client.DescribeConsumerGroup(ctx, &mqxpb.DescribeConsumerGroupRequest{Topic: "orders", Group: "idle"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Topics are looked up without creating them
+	_, err = client.ListPartitions(ctx, &mqxpb.ListPartitionsRequest{Topic: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.ListConsumerGroups(ctx, &mqxpb.ListConsumerGroupsRequest{Topic: "orders`; drop table x"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.CreateTopic(ctx, &mqxpb.CreateTopicRequest{Topic: "orders`; drop table x", PartitionNum: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	topics.AssertNotCalled(t, "GetTopicMeta", mock.Anything, mock.Anything)
+
+	_, err = client.DeleteConsumerGroup(ctx, &mqxpb.DeleteConsumerGroupRequest{Topic: "orders", Group: "billing"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	audits.AssertExpectations(t)
+}
+
+func TestServer_Authentication(t *testing.T) {
+	topics := new(MockTopicManager)
+	topics.On("GetAllTopicMeta", mock.Anything).Return([]model.TopicMeta{}, nil)
+	factory := new(MockFactory)
+	factory.On("GetTopicManager").Return(topics)
+	_, messaging, admin := newTestServer(t, config.GRPC{Tokens: []auth.Token{
+		{Name: "grafana", Token: "viewer-token", Role: auth.RoleViewer},
+	}}, factory)
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	_, err := admin.ListTopics(context.Background(), &mqxpb.ListTopicsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = admin.ListTopics(withToken("wrong"), &mqxpb.ListTopicsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = admin.ListTopics(withToken("viewer-token"), &mqxpb.ListTopicsRequest{})
+	assert.NoError(t, err)
+
+	_, err = messaging.Publish(withToken("viewer-token"), &mqxpb.PublishRequest{Topic: "orders"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	stream, err := messaging.Subscribe(withToken("viewer-token"), &mqxpb.SubscribeRequest{Topic: "orders", Group: "billing"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestMethodRoles_CoverServices(t *testing.T) {
+	for _, service := range []grpc.ServiceDesc{mqxpb.Messaging_ServiceDesc, mqxpb.Admin_ServiceDesc} {
+		for _, method := range service.Methods {
+			assert.Contains(t, methodRoles, "/"+service.ServiceName+"/"+method.MethodName)
+		}
+		for _, stream := range service.Streams {
+			assert.Contains(t, methodRoles, "/"+service.ServiceName+"/"+stream.StreamName)
+		}
+	}
+}
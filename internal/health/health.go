@@ -0,0 +1,140 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/template"
+)
+
+// Names of the health checks
+const (
+	CheckDatabase  = "database"
+	CheckTables    = "tables"
+	CheckHeartbeat = "heartbeat"
+	CheckDelayLoop = "delay_loop"
+)
+
+// delayLockWait is how long a delay cycle may block waiting for the delay lock held by another instance
+const delayLockWait = time.Second * 30
+
+// checker reports the health of an MQX instance
+type checker struct {
+	db      *sql.DB
+	cfg     *config.Config
+	factory interfaces.Factory
+}
+
+// NewHealthChecker creates a health checker
+func NewHealthChecker(db *sql.DB, cfg *config.Config, factory interfaces.Factory) interfaces.HealthChecker {
+	return &checker{db: db, cfg: cfg, factory: factory}
+}
+
+// Check runs all health checks. The instance is ready when every check and subscription
+// is up, and live unless the delay loop is stuck; a database outage makes it unready but
+// not dead, since restarting would not help.
+func (c *checker) Check(ctx context.Context) *model.HealthReport {
+	report := &model.HealthReport{
+		Subscriptions: c.factory.GetConsumerManager().GetSubscriptionHealth(),
+		Time:          time.Now(),
+	}
+	database := newCheck(CheckDatabase, c.db.PingContext(ctx))
+	tables := newCheck(CheckTables, fmt.Errorf("database is down"))
+	if database.Status == model.HealthUp {
+		tables = newCheck(CheckTables, c.checkTables(ctx))
+	}
+	delayLoop := newCheck(CheckDelayLoop, c.checkDelayLoop())
+	report.Checks = []model.HealthCheck{database, tables, newCheck(CheckHeartbeat, c.checkHeartbeat(report.Subscriptions)), delayLoop}
+
+	report.Live = delayLoop.Status == model.HealthUp
+	report.Ready = true
+	for _, check := range report.Checks {
+		if check.Status != model.HealthUp {
+			report.Ready = false
+		}
+	}
+	report.Status = model.HealthUp
+	if !report.Ready {
+		report.Status = model.HealthDown
+	}
+	return report
+}
+
+// systemTables returns the tables created on start
+func (c *checker) systemTables() []string {
+	tables := []string{"mqx_topic_metas", "mqx_consumer_offsets", "mqx_consumer_instances", "mqx_delay_messages", "mqx_half_messages"}
+	if c.cfg.EnableMessageTrace {
+		tables = append(tables, "mqx_message_traces")
+	}
+	return tables
+}
+
+func (c *checker) checkTables(ctx context.Context) error {
+	rows, err := c.db.QueryContext(ctx, template.GetSystemTables)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+		existing[table] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var missing []string
+	for _, table := range c.systemTables() {
+		if !existing[table] {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing tables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (c *checker) checkHeartbeat(subscriptions []model.SubscriptionHealth) error {
+	var stale []string
+	for _, subscription := range subscriptions {
+		if subscription.Status != model.HealthUp {
+			stale = append(stale, subscription.Group+"/"+subscription.Topic)
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		return fmt.Errorf("stale heartbeat of %s", strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// checkDelayLoop fails when the delay loop has not started a cycle for longer than a cycle
+// can take: the delay interval plus the wait for the delay lock, with room for one missed cycle
+func (c *checker) checkDelayLoop() error {
+	last := c.factory.GetDelayManager().LastCycleTime()
+	if last.IsZero() {
+		return fmt.Errorf("delay loop has not started")
+	}
+	if since := time.Since(last); since > 2*(c.cfg.DelayInterval+delayLockWait) {
+		return fmt.Errorf("delay loop has been stuck for %s", since.Truncate(time.Second))
+	}
+	return nil
+}
+
+func newCheck(name string, err error) model.HealthCheck {
+	if err != nil {
+		return model.HealthCheck{Name: name, Status: model.HealthDown, Error: err.Error()}
+	}
+	return model.HealthCheck{Name: name, Status: model.HealthUp}
+}
@@ -0,0 +1,145 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// MockFactory implements interfaces.Factory for testing
+type MockFactory struct {
+	mock.Mock
+	interfaces.Factory
+}
+
+func (m *MockFactory) GetConsumerManager() interfaces.ConsumerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ConsumerManager)
+}
+
+func (m *MockFactory) GetDelayManager() interfaces.DelayManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.DelayManager)
+}
+
+// MockConsumerManager implements interfaces.ConsumerManager for testing
+type MockConsumerManager struct {
+	mock.Mock
+	interfaces.ConsumerManager
+}
+
+func (m *MockConsumerManager) GetSubscriptionHealth() []model.SubscriptionHealth {
+	args := m.Called()
+	return args.Get(0).([]model.SubscriptionHealth)
+}
+
+// MockDelayManager implements interfaces.DelayManager for testing
+type MockDelayManager struct {
+	mock.Mock
+	interfaces.DelayManager
+}
+
+func (m *MockDelayManager) LastCycleTime() time.Time {
+	args := m.Called()
+	return args.Get(0).(time.Time)
+}
+
+func newTestChecker(t *testing.T, subscriptions []model.SubscriptionHealth, lastCycle time.Time) (*checker, sqlmock.Sqlmock) {
+	db, smock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	consumerManager := new(MockConsumerManager)
+	consumerManager.On("GetSubscriptionHealth").Return(subscriptions)
+	delayManager := new(MockDelayManager)
+	delayManager.On("LastCycleTime").Return(lastCycle)
+	mockFactory := new(MockFactory)
+	mockFactory.On("GetConsumerManager").Return(consumerManager)
+	mockFactory.On("GetDelayManager").Return(delayManager)
+
+	cfg := &config.Config{DelayInterval: time.Second * 5, HeartbeatInterval: time.Second * 30}
+	return &checker{db: db, cfg: cfg, factory: mockFactory}, smock
+}
+
+func systemTableRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"table_name"}).
+		AddRow("mqx_topic_metas").
+		AddRow("mqx_consumer_offsets").
+		AddRow("mqx_consumer_instances").
+		AddRow("mqx_delay_messages").
+		AddRow("mqx_half_messages").
+		AddRow("mqx_messages_orders_0")
+}
+
+func findCheck(report *model.HealthReport, name string) model.HealthCheck {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return model.HealthCheck{}
+}
+
+func TestChecker_Check_Up(t *testing.T) {
+	subscriptions := []model.SubscriptionHealth{{Topic: "orders", Group: "billing", Status: model.HealthUp, LastHeartbeat: time.Now()}}
+	c, smock := newTestChecker(t, subscriptions, time.Now())
+	smock.ExpectPing()
+	smock.ExpectQuery("SELECT `table_name`").WillReturnRows(systemTableRows())
+
+	report := c.Check(context.Background())
+	assert.Equal(t, model.HealthUp, report.Status)
+	assert.True(t, report.Live)
+	assert.True(t, report.Ready)
+	assert.Len(t, report.Checks, 4)
+	assert.Equal(t, subscriptions, report.Subscriptions)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestChecker_Check_DatabaseDown(t *testing.T) {
+	c, smock := newTestChecker(t, []model.SubscriptionHealth{}, time.Now())
+	smock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	report := c.Check(context.Background())
+	assert.Equal(t, model.HealthDown, report.Status)
+	assert.False(t, report.Ready)
+	// A database outage is not fixed by restarting
+	assert.True(t, report.Live)
+	assert.Equal(t, "connection refused", findCheck(report, CheckDatabase).Error)
+	assert.Equal(t, model.HealthDown, findCheck(report, CheckTables).Status)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestChecker_Check_MissingTables(t *testing.T) {
+	c, smock := newTestChecker(t, []model.SubscriptionHealth{}, time.Now())
+	c.cfg.EnableMessageTrace = true
+	smock.ExpectPing()
+	smock.ExpectQuery("SELECT `table_name`").WillReturnRows(systemTableRows())
+
+	report := c.Check(context.Background())
+	assert.False(t, report.Ready)
+	assert.Equal(t, "missing tables: mqx_message_traces", findCheck(report, CheckTables).Error)
+}
+
+func TestChecker_Check_StaleHeartbeatAndDelayLoop(t *testing.T) {
+	subscriptions := []model.SubscriptionHealth{
+		{Topic: "orders", Group: "billing", Status: model.HealthUp},
+		{Topic: "orders", Group: "shipping", Status: model.HealthDown},
+	}
+	c, smock := newTestChecker(t, subscriptions, time.Now().Add(-time.Hour))
+	smock.ExpectPing()
+	smock.ExpectQuery("SELECT `table_name`").WillReturnRows(systemTableRows())
+
+	report := c.Check(context.Background())
+	assert.False(t, report.Ready)
+	assert.False(t, report.Live)
+	assert.Equal(t, "stale heartbeat of shipping/orders", findCheck(report, CheckHeartbeat).Error)
+	assert.Equal(t, model.HealthDown, findCheck(report, CheckDelayLoop).Status)
+}
@@ -0,0 +1,70 @@
+// Package httpapi holds the error object, the list envelope and the error handling shared by the
+// console API and the HTTP gateway, so both answer in the same shape.
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIError describes why a request failed
+type APIError struct {
+	// Code is a stable identifier derived from the HTTP status, such as not_found
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details holds what was done before the failure, such as the copies published by a failed replay
+	Details any `json:"details,omitempty"`
+}
+
+// ErrorResponse is the body of every failed API request
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// StatusResponse is the body of a successful request that returns no resource
+type StatusResponse struct {
+	Message string `json:"message"`
+}
+
+// Page is the envelope of every list response
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Total is the number of matching items; searches count it for their first page only
+	Total *int64 `json:"total,omitempty"`
+	// NextCursor continues a cursor-paged list after this page, empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// NewPage returns a page of items, with an empty list rather than null
+func NewPage[T any](items []T) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return &Page[T]{Items: items}
+}
+
+// errorCodes are the codes of the error statuses returned by the APIs
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "invalid_argument",
+	http.StatusUnauthorized:        "unauthenticated",
+	http.StatusForbidden:           "permission_denied",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusInternalServerError: "internal",
+}
+
+// NewErrorResponse returns the error response of a status
+func NewErrorResponse(status int, message string) *ErrorResponse {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = "internal"
+	}
+	return &ErrorResponse{Error: APIError{Code: code, Message: message}}
+}
+
+// WriteError aborts a request with an error response
+func WriteError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, NewErrorResponse(status, message))
+}
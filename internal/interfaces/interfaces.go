@@ -3,8 +3,13 @@ package interfaces
 import (
 	"context"
 	"database/sql"
+	"time"
 
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/metrics"
 	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+	"github.com/wenzuojing/mqx/internal/tracing"
 )
 
 // MessageManager handles message storage and retrieval operations
@@ -15,16 +20,23 @@ type MessageManager interface {
 	Stop(ctx context.Context) error
 	// SaveMessage persists a message to storage and returns its ID
 	SaveMessage(ctx context.Context, msg *model.Message) (string, error)
+	// SaveMessages persists messages of a single topic in one transaction,
+	// using one multi-row insert per partition
+	SaveMessages(ctx context.Context, msgs []*model.Message) error
 	// GetMessages retrieves messages from a specific partition after the given offset
 	GetMessages(ctx context.Context, topic string, group string, partition int, offset int64, size int) ([]*model.Message, error)
 	// GetMaxOffset returns the highest offset in a partition
 	GetMaxOffset(ctx context.Context, topic string, partition int) (int64, error)
 	// GetPartitionStat returns the stat of messages in a partition
 	GetPartitionStat(ctx context.Context, topic string, partition int) (*PartitionStat, error)
+	// GetOffsetByTime returns the offset of the first message of a partition born at or after t, 0 when there is none
+	GetOffsetByTime(ctx context.Context, topic string, partition int, t time.Time) (int64, error)
+	// UpdateHeaders replaces the headers of stored messages of a single topic, found by partition and offset, in one transaction
+	UpdateHeaders(ctx context.Context, msgs []*model.Message) error
 	// DeleteMessages deletes messages from a specific partition
 	DeleteMessages(ctx context.Context, topic string, partition int) error
-	// QueryMessageForPage retrieves messages from a specific partition for pagination
-	QueryMessageForPage(ctx context.Context, topic string, partition int, messageID string, tag string, pageNo int, pageSize int) (int, []*model.Message, error)
+	// SearchMessages searches the partitions of a topic and returns one page of matching messages, newest first
+	SearchMessages(ctx context.Context, filter *model.MessageFilter) (*model.MessagePage, error)
 	// SaveMessageWithTx saves a message using a caller-managed transaction.
 	// The caller is responsible for committing or rolling back the transaction.
 	SaveMessageWithTx(ctx context.Context, tx *sql.Tx, msg *model.Message) error
@@ -34,6 +46,9 @@ type MessageManager interface {
 type TopicManager interface {
 	// GetTopicMeta retrieves metadata for a specific topic
 	GetTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error)
+	// FindTopicMeta retrieves metadata for an existing topic. Unlike GetTopicMeta it does not
+	// create a missing topic but returns an error wrapping model.ErrTopicNotFound.
+	FindTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error)
 	// GetAllTopicMeta retrieves metadata for all topics
 	GetAllTopicMeta(ctx context.Context) ([]model.TopicMeta, error)
 	// UpdateTopicMeta updates the metadata for a topic
@@ -59,13 +74,51 @@ type ConsumerManager interface {
 	// GetActiveConsumerInstances returns active instances with recent heartbeat (SQL-level filtering to avoid timezone issues)
 	GetActiveConsumerInstances(ctx context.Context, topic string, group string, heartbeatTimeoutSeconds int) ([]model.ConsumerInstance, error)
 	// Consume starts consuming messages from a topic with the specified handler
-	Consume(ctx context.Context, topic string, group string, handler func(msg *model.Message) error) error
+	Consume(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg *model.Message) error) error
+	// GetSubscriptionHealth returns the heartbeat and partition status of the subscriptions of this instance
+	GetSubscriptionHealth() []model.SubscriptionHealth
+	// DeleteGroup deletes the offsets of a group without active instances
+	DeleteGroup(ctx context.Context, topic string, group string) error
+	// EvictInstance marks an instance of a group inactive and reassigns its partitions
+	EvictInstance(ctx context.Context, topic string, group string, instanceID string) error
+	// Rebalance reassigns the partitions of a topic to the active instances of a group immediately
+	Rebalance(ctx context.Context, topic string, group string) error
+	// ResetOffsets moves the committed offsets of a group without active instances and returns them per partition
+	ResetOffsets(ctx context.Context, reset *model.OffsetReset) ([]model.OffsetResetResult, error)
+	// NewPullConsumer joins a consumer group as a new instance whose messages are fetched and committed by the caller
+	NewPullConsumer(ctx context.Context, topic string, group string) (PullConsumer, error)
+	// Subscribe joins a consumer group as a new instance consuming through handler until the subscription is closed
+	Subscribe(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg *model.Message) error) (Subscription, error)
 	// Start initializes the consumer manager service
 	Start(ctx context.Context) error
 	// Stop gracefully shuts down the consumer manager service
 	Stop(ctx context.Context) error
 }
 
+// PullConsumer is a consumer group instance driven by its caller. It shares the partition assignment
+// and the offsets of its group with the instances consuming through handlers.
+type PullConsumer interface {
+	// InstanceID returns the ID of the instance in its consumer group
+	InstanceID() string
+	// Fetch returns up to max messages of the assigned partitions, waiting up to wait for the first one.
+	// Fetched messages are not fetched again by this instance; unless committed they are redelivered
+	// to the next owner of their partition.
+	Fetch(ctx context.Context, max int, wait time.Duration) ([]*model.Message, error)
+	// Commit stores offset as the last handled message of an assigned partition
+	Commit(ctx context.Context, partition int, offset int64) error
+	// Close leaves the group; its partitions are reassigned at the next rebalance
+	Close(ctx context.Context) error
+}
+
+// Subscription is a consumer group instance consuming through a handler, with the retries and the dead
+// letter queue of Consume, that can leave its group on its own
+type Subscription interface {
+	// InstanceID returns the ID of the instance in its consumer group
+	InstanceID() string
+	// Close waits for the running handlers up to the ctx deadline and leaves the group
+	Close(ctx context.Context) error
+}
+
 // ProducerManager handles message production and sending
 type ProducerManager interface {
 	// SendSync sends a message synchronously and returns its ID
@@ -86,12 +139,100 @@ type DelayManager interface {
 	AddRetry(ctx context.Context, msg *model.RetryMessage) (string, error)
 	// DeleteMessagesByTopic deletes all delayed messages for a topic
 	DeleteMessagesByTopic(ctx context.Context, topic string) error
+	// GetQueueStat returns the number of waiting messages and the earliest delivery time
+	GetQueueStat(ctx context.Context) (*model.DelayQueueStat, error)
+	// Query returns the total number of waiting messages matching a filter and one page of them, next delivered first
+	Query(ctx context.Context, filter *model.DelayFilter) (int64, []*model.DelayMessage, error)
+	// Cancel deletes a waiting message so that it is never delivered
+	Cancel(ctx context.Context, messageID string) error
+	// LastCycleTime returns when the delay loop last started a cycle, zero before Start.
+	// The loop starts a cycle even when the previous one failed, so it goes stale only when the loop is stuck.
+	LastCycleTime() time.Time
 	// Start initializes the delay manager service
 	Start(ctx context.Context) error
 	// Stop gracefully shuts down the delay manager service
 	Stop(ctx context.Context) error
 }
 
+// TransactionManager handles transactional (half) messages
+type TransactionManager interface {
+	// Prepare stores a half message that stays invisible to consumers until committed
+	Prepare(ctx context.Context, msg *model.Message) (string, error)
+	// Commit delivers a half message to its topic
+	Commit(ctx context.Context, messageID string) error
+	// Rollback discards a half message
+	Rollback(ctx context.Context, messageID string) error
+	// RegisterChecker registers the checker used to resolve unresolved half messages of a topic
+	RegisterChecker(topic string, checker model.TransactionChecker)
+	// DeleteMessagesByTopic deletes all half messages for a topic
+	DeleteMessagesByTopic(ctx context.Context, topic string) error
+	// Start initializes the transaction manager service
+	Start(ctx context.Context) error
+	// Stop gracefully shuts down the transaction manager service
+	Stop(ctx context.Context) error
+}
+
+// ReplyManager handles request/reply messaging over per-instance reply topics
+type ReplyManager interface {
+	// Request publishes a message with a correlation ID and reply-to topic and waits for its reply
+	Request(ctx context.Context, msg *model.Message) (*model.Message, error)
+	// Reply publishes a reply to the reply-to topic of a request
+	Reply(ctx context.Context, request *model.Message, reply *model.Message) (string, error)
+	// Start initializes the reply manager service
+	Start(ctx context.Context) error
+	// Stop gracefully shuts down the reply manager service
+	Stop(ctx context.Context) error
+}
+
+// ReplayManager publishes copies of stored messages, to their whole topic or to a single consumer group
+type ReplayManager interface {
+	// Resend publishes a copy of a stored message to every group of its topic, or only to group when set,
+	// and returns the ID of the copy
+	Resend(ctx context.Context, topic string, messageID string, group string) (string, error)
+	// Replay publishes copies of the selected messages to a group in their original order. A dry run only counts them.
+	Replay(ctx context.Context, req *model.ReplayRequest) (*model.ReplayResult, error)
+	// Redrive publishes copies of the selected dead lettered messages to their topic, each to the group that
+	// dead lettered it when known. A dry run only counts them.
+	Redrive(ctx context.Context, req *model.RedriveRequest) (*model.ReplayResult, error)
+}
+
+// AuditManager records and queries the audit log of mutating console actions
+type AuditManager interface {
+	// Record writes an audit entry
+	Record(ctx context.Context, entry *model.AuditEntry) error
+	// Query returns the total number of entries matching a filter and one page of them, newest first
+	Query(ctx context.Context, filter *model.AuditFilter) (int64, []*model.AuditEntry, error)
+	// DeleteBefore deletes the entries recorded before a time and returns how many were deleted
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+	// Start initializes the audit manager service
+	Start(ctx context.Context) error
+	// Stop gracefully shuts down the audit manager service
+	Stop(ctx context.Context) error
+}
+
+// WebhookManager stores the webhook subscriptions and runs them on every instance
+type WebhookManager interface {
+	// Subscribe creates or replaces the webhook subscription of a consumer group of a topic.
+	// An empty secret keeps the secret of the subscription it replaces.
+	Subscribe(ctx context.Context, sub *model.WebhookSubscription) error
+	// Unsubscribe deletes the webhook subscription of a consumer group of a topic
+	Unsubscribe(ctx context.Context, topic string, group string) error
+	// GetSubscription returns the webhook subscription of a consumer group of a topic
+	GetSubscription(ctx context.Context, topic string, group string) (*model.WebhookSubscription, error)
+	// GetSubscriptions returns all webhook subscriptions
+	GetSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error)
+	// Start initializes the webhook manager service
+	Start(ctx context.Context) error
+	// Stop gracefully shuts down the webhook manager service
+	Stop(ctx context.Context) error
+}
+
+// HealthChecker reports the health of this instance
+type HealthChecker interface {
+	// Check runs all health checks
+	Check(ctx context.Context) *model.HealthReport
+}
+
 type ClearManager interface {
 	// Start initializes the clear manager service
 	Start(ctx context.Context) error
@@ -113,4 +254,24 @@ type Factory interface {
 	GetDelayManager() DelayManager
 	// GetClearManager returns the clear manager instance
 	GetClearManager() ClearManager
+	// GetTransactionManager returns the transaction manager instance
+	GetTransactionManager() TransactionManager
+	// GetReplyManager returns the reply manager instance
+	GetReplyManager() ReplyManager
+	// GetAuditManager returns the audit manager instance
+	GetAuditManager() AuditManager
+	// GetReplayManager returns the replay manager instance
+	GetReplayManager() ReplayManager
+	// GetWebhookManager returns the webhook manager instance
+	GetWebhookManager() WebhookManager
+	// GetMetrics returns the metrics of this instance, nil when metrics are not collected
+	GetMetrics() *metrics.Metrics
+	// GetTracer returns the tracer of this instance, nil when tracing is disabled
+	GetTracer() *tracing.Tracer
+	// GetLogger returns the structured logger of this instance
+	GetLogger() logging.Logger
+	// GetTraceManager returns the message trace manager, nil when message tracing is disabled
+	GetTraceManager() *msgtrace.Manager
+	// GetHealthChecker returns the health checker of this instance
+	GetHealthChecker() HealthChecker
 }
@@ -0,0 +1,140 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"k8s.io/klog/v2"
+)
+
+// Logger is the structured logger used by MQX.
+// keysAndValues are alternating keys and values, as with log/slog.
+type Logger interface {
+	Debug(msg string, keysAndValues ...any)
+	Info(msg string, keysAndValues ...any)
+	Warn(msg string, keysAndValues ...any)
+	Error(msg string, keysAndValues ...any)
+	// With returns a logger adding keysAndValues to every entry
+	With(keysAndValues ...any) Logger
+}
+
+// OrDefault returns logger, or the slog adapter of slog.Default() if logger is nil
+func OrDefault(logger Logger) Logger {
+	if logger == nil {
+		return NewSlog(nil)
+	}
+	return logger
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlog adapts a log/slog logger. A nil logger uses slog.Default().
+func NewSlog(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Debug(msg string, keysAndValues ...any) {
+	l.logger.Debug(msg, keysAndValues...)
+}
+
+func (l *slogLogger) Info(msg string, keysAndValues ...any) {
+	l.logger.Info(msg, keysAndValues...)
+}
+
+func (l *slogLogger) Warn(msg string, keysAndValues ...any) {
+	l.logger.Warn(msg, keysAndValues...)
+}
+
+func (l *slogLogger) Error(msg string, keysAndValues ...any) {
+	l.logger.Error(msg, keysAndValues...)
+}
+
+func (l *slogLogger) With(keysAndValues ...any) Logger {
+	return &slogLogger{logger: l.logger.With(keysAndValues...)}
+}
+
+// debugLevel is the klog verbosity of debug entries
+const debugLevel = 4
+
+type klogLogger struct {
+	values []any
+}
+
+// NewKlog adapts klog/v2. Debug entries are written at verbosity 4; klog has no
+// structured warning severity, so warnings are written as info entries with level=warn.
+func NewKlog() Logger {
+	return &klogLogger{}
+}
+
+func (l *klogLogger) Debug(msg string, keysAndValues ...any) {
+	klog.V(debugLevel).InfoSDepth(1, msg, l.merge(keysAndValues)...)
+}
+
+func (l *klogLogger) Info(msg string, keysAndValues ...any) {
+	klog.InfoSDepth(1, msg, l.merge(keysAndValues)...)
+}
+
+func (l *klogLogger) Warn(msg string, keysAndValues ...any) {
+	klog.InfoSDepth(1, msg, append([]any{"level", "warn"}, l.merge(keysAndValues)...)...)
+}
+
+// Error passes the value of an "error" key, if any, as the klog error
+func (l *klogLogger) Error(msg string, keysAndValues ...any) {
+	var err error
+	kv := l.merge(keysAndValues)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i] == "error" {
+			if e, ok := kv[i+1].(error); ok {
+				err = e
+				kv = append(kv[:i:i], kv[i+2:]...)
+				break
+			}
+		}
+	}
+	klog.ErrorSDepth(1, err, msg, kv...)
+}
+
+func (l *klogLogger) With(keysAndValues ...any) Logger {
+	return &klogLogger{values: l.merge(keysAndValues)}
+}
+
+func (l *klogLogger) merge(keysAndValues []any) []any {
+	if len(l.values) == 0 {
+		return keysAndValues
+	}
+	kv := make([]any, 0, len(l.values)+len(keysAndValues))
+	return append(append(kv, l.values...), keysAndValues...)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying logger
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return logger
+	}
+	return NewSlog(nil)
+}
+
+// Discard returns a logger that drops every entry
+func Discard() Logger {
+	return discard{}
+}
+
+type discard struct{}
+
+func (discard) Debug(string, ...any) {}
+func (discard) Info(string, ...any)  {}
+func (discard) Warn(string, ...any)  {}
+func (discard) Error(string, ...any) {}
+func (d discard) With(...any) Logger { return d }
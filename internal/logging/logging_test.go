@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSlog(buf *bytes.Buffer) Logger {
+	return NewSlog(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+}
+
+func TestSlog_WithFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestSlog(&buf).With("topic", "orders", "group", "billing")
+
+	logger.Error("Failed to get messages", "partition", 3, "error", errors.New("boom"))
+
+	line := buf.String()
+	assert.Contains(t, line, "level=ERROR")
+	assert.Contains(t, line, `msg="Failed to get messages"`)
+	assert.Contains(t, line, "topic=orders group=billing partition=3 error=boom")
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestSlog(&buf)
+
+	FromContext(NewContext(context.Background(), logger)).Info("hello")
+
+	assert.Contains(t, buf.String(), "msg=hello")
+	assert.NotNil(t, FromContext(context.Background()))
+}
+
+func TestThrottle_SuppressesRepeatedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Now()
+	throttle := NewThrottle(newTestSlog(&buf), time.Minute)
+	throttle.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		throttle.Error("Failed to get messages", "error", "db down")
+	}
+	throttle.Error("Failed to get consumer offset", "error", "db down")
+	assert.Equal(t, 1, strings.Count(buf.String(), "Failed to get messages"))
+	assert.Equal(t, 1, strings.Count(buf.String(), "Failed to get consumer offset"))
+
+	// After the interval the error is logged again with the number suppressed meanwhile
+	now = now.Add(time.Minute)
+	throttle.Error("Failed to get messages", "error", "db down")
+	assert.Equal(t, 2, strings.Count(buf.String(), "Failed to get messages"))
+	assert.Contains(t, buf.String(), "suppressed=4")
+}
+
+func TestThrottle_Reset(t *testing.T) {
+	var buf bytes.Buffer
+	throttle := NewThrottle(newTestSlog(&buf), time.Minute)
+
+	throttle.Reset()
+	assert.Empty(t, buf.String())
+
+	throttle.Error("Failed to get messages")
+	throttle.Error("Failed to get messages")
+	throttle.Reset()
+	assert.Contains(t, buf.String(), `msg="Recovered after errors" errors=2`)
+
+	// A new failure is logged right away
+	throttle.Error("Failed to get messages")
+	assert.Equal(t, 2, strings.Count(buf.String(), `msg="Failed to get messages"`))
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultThrottleInterval is the interval between repeated error entries of a polling loop
+const DefaultThrottleInterval = time.Minute
+
+// Throttle rate-limits the errors of a polling loop, so a failure repeating every poll
+// (e.g. the database being down) is logged once per interval instead of once per poll.
+// Errors are told apart by their message; each one is logged on its first occurrence and
+// then at most once per interval with the number of entries suppressed meanwhile.
+type Throttle struct {
+	logger   Logger
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*throttleEntry
+}
+
+type throttleEntry struct {
+	last       time.Time
+	suppressed int
+}
+
+// NewThrottle creates a throttle writing to logger. A non-positive interval uses DefaultThrottleInterval.
+func NewThrottle(logger Logger, interval time.Duration) *Throttle {
+	if interval <= 0 {
+		interval = DefaultThrottleInterval
+	}
+	return &Throttle{
+		logger:   OrDefault(logger),
+		interval: interval,
+		now:      time.Now,
+		entries:  make(map[string]*throttleEntry),
+	}
+}
+
+// Error logs an error entry unless the same message was logged less than an interval ago
+func (t *Throttle) Error(msg string, keysAndValues ...any) {
+	t.mu.Lock()
+	now := t.now()
+	entry, ok := t.entries[msg]
+	if ok && now.Sub(entry.last) < t.interval {
+		entry.suppressed++
+		t.mu.Unlock()
+		return
+	}
+	suppressed := 0
+	if ok {
+		suppressed = entry.suppressed
+	}
+	t.entries[msg] = &throttleEntry{last: now}
+	t.mu.Unlock()
+
+	if suppressed > 0 {
+		keysAndValues = append(keysAndValues, "suppressed", suppressed)
+	}
+	t.logger.Error(msg, keysAndValues...)
+}
+
+// Reset is called once the loop succeeds again. It logs that the loop recovered if
+// errors were logged, and lets the next error be logged right away.
+func (t *Throttle) Reset() {
+	t.mu.Lock()
+	if len(t.entries) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	failures := 0
+	for _, entry := range t.entries {
+		failures += entry.suppressed + 1
+	}
+	t.entries = make(map[string]*throttleEntry)
+	t.mu.Unlock()
+	t.logger.Info("Recovered after errors", "errors", failures)
+}
@@ -5,90 +5,208 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
 	"github.com/wenzuojing/mqx/internal/model"
 	"github.com/wenzuojing/mqx/internal/template"
-	"github.com/wenzuojing/mqx/pkg/templatex"
-	"k8s.io/klog/v2"
 )
 
 // MessageManager implements message storage and retrieval functionality
 func NewMessageManager(db *sql.DB, factory interfaces.Factory) (interfaces.MessageManager, error) {
-	return &messageManagerImpl{db: db, factory: factory}, nil
+	return &messageManagerImpl{db: db, factory: factory, logger: factory.GetLogger()}, nil
 }
 
 type messageManagerImpl struct {
 	db      *sql.DB
 	factory interfaces.Factory
+	logger  logging.Logger
+	// cancel stops the upgrade of the search indexes and done is closed when it has finished
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
+// Start upgrades the partition tables of an earlier version with the search indexes in the background,
+// since building an index on a large table takes a while
 func (s *messageManagerImpl) Start(ctx context.Context) error {
-	klog.Info("Starting MessageManager service...")
-	klog.Info("MessageManager service started successfully")
+	upgradeCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		if err := s.addSearchIndexes(upgradeCtx); err != nil && upgradeCtx.Err() == nil {
+			s.logger.Error("Failed to add search indexes to message tables", "error", err)
+		}
+	}()
+	s.logger.Info("MessageManager service started successfully")
 	return nil
 }
 
 func (s *messageManagerImpl) Stop(ctx context.Context) error {
-	klog.Info("Stopping MessageManager service...")
-	klog.Info("MessageManager service stopped successfully")
+	if s.done != nil {
+		s.cancel()
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			return fmt.Errorf("search index upgrade did not stop: %w", ctx.Err())
+		}
+	}
+	s.logger.Info("MessageManager service stopped successfully")
 	return nil
 }
 
 // prepareMessage validates topic, calculates partition, and assigns messageID.
 // Shared by SaveMessage and SaveMessageWithTx.
 func (s *messageManagerImpl) prepareMessage(msg *model.Message) error {
-	if !isValidTopicName(msg.Topic) {
-		return fmt.Errorf("invalid topic name")
+	topicMeta, err := s.getTopicMeta(msg.Topic)
+	if err != nil {
+		return err
+	}
+	s.assignPartition(msg, topicMeta)
+	return nil
+}
+
+// findTopicMeta validates a topic name and loads the metadata of the topic without creating it
+func (s *messageManagerImpl) findTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	if err := model.ValidateTopic(topic); err != nil {
+		return nil, err
 	}
-	if len(msg.Topic) > 256 {
-		return fmt.Errorf("topic name '%s' is too long: maximum length is 512 characters", msg.Topic)
+	return s.factory.GetTopicManager().FindTopicMeta(ctx, topic)
+}
+
+// getTopicMeta validates a topic name and loads its metadata
+func (s *messageManagerImpl) getTopicMeta(topic string) (*model.TopicMeta, error) {
+	if err := model.ValidateTopic(topic); err != nil {
+		return nil, err
 	}
-	topicMeta, err := s.factory.GetTopicManager().GetTopicMeta(context.Background(), msg.Topic)
+	topicMeta, err := s.factory.GetTopicManager().GetTopicMeta(context.Background(), topic)
 	if err != nil {
-		return errors.Wrap(err, "failed to get topic metadata")
+		return nil, errors.Wrap(err, "failed to get topic metadata")
 	}
+	return topicMeta, nil
+}
+
+// assignPartition calculates the partition of a message and assigns its messageID
+func (s *messageManagerImpl) assignPartition(msg *model.Message, topicMeta *model.TopicMeta) {
 	msg.Partition = s.calculatePartition(msg.Key, topicMeta.PartitionNum)
 	if msg.MessageID == "" {
 		msg.MessageID = uuid.New().String()
 	}
-	return nil
 }
 
 func (s *messageManagerImpl) SaveMessage(ctx context.Context, msg *model.Message) (string, error) {
-	klog.V(4).Infof("Saving message to topic %s, key: %s", msg.Topic, msg.Key)
-
 	if err := s.prepareMessage(msg); err != nil {
 		return "", err
 	}
-	klog.V(4).Infof("Calculated partition %d for message", msg.Partition)
+	s.logger.Debug("Saving message", "topic", msg.Topic, "key", msg.Key, "partition", msg.Partition)
 
+	err := s.insertOne(msg)
+	// The table is repaired after the transaction is rolled back, so that the DDL does not wait on its
+	// metadata lock, and the message is inserted again in a new transaction
+	if err != nil && IsMissingMessageTable(err) {
+		if err := EnsureMessageTable(ctx, s.db, s.getMessageTableName(msg.Topic, msg.Partition), err); err != nil {
+			return "", err
+		}
+		err = s.insertOne(msg)
+	}
+	if err != nil {
+		return "", err
+	}
+	s.logger.Debug("Successfully saved message", "topic", msg.Topic, "messageId", msg.MessageID)
+	return msg.MessageID, nil
+}
+
+// insertOne writes a message in its own transaction, rolled back when the insert fails
+func (s *messageManagerImpl) insertOne(msg *model.Message) error {
 	tx, err := s.db.Begin()
 	if err != nil {
-		return "", errors.Wrap(err, "failed to begin transaction")
+		return errors.Wrap(err, "failed to begin transaction")
 	}
 	defer tx.Rollback()
 
-	err = s.insertMessage(tx, msg)
+	if err := s.insertMessage(tx, msg); err != nil {
+		return errors.Wrap(err, "failed to insert message")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+	return nil
+}
+
+// SaveMessages saves a batch of messages of one topic atomically.
+// Messages are grouped per partition, keeping their relative order, and each partition
+// is written with a single multi-row insert. Missing partition tables are created
+// outside the transaction and the batch is retried.
+func (s *messageManagerImpl) SaveMessages(ctx context.Context, msgs []*model.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	topic := msgs[0].Topic
+	topicMeta, err := s.getTopicMeta(topic)
 	if err != nil {
-		if strings.Contains(err.Error(), "doesn't exist") {
-			if err := s.createMessageTable(msg.Topic, msg.Partition); err != nil {
-				return "", errors.Wrap(err, "failed to create message table")
-			}
-			err = s.insertMessage(tx, msg)
+		return err
+	}
+
+	var partitions []int
+	byPartition := make(map[int][]*model.Message)
+	for _, msg := range msgs {
+		if msg.Topic != topic {
+			return fmt.Errorf("batch mixes topics %s and %s", topic, msg.Topic)
 		}
-		if err != nil {
-			return "", errors.Wrap(err, "failed to insert message")
+		s.assignPartition(msg, topicMeta)
+		if _, ok := byPartition[msg.Partition]; !ok {
+			partitions = append(partitions, msg.Partition)
 		}
+		byPartition[msg.Partition] = append(byPartition[msg.Partition], msg)
 	}
+	s.logger.Debug("Saving batch of messages", "topic", topic, "count", len(msgs), "partitions", len(partitions))
 
-	if err = tx.Commit(); err != nil {
-		return "", errors.Wrap(err, "failed to commit transaction")
+	// Each attempt can discover at most one missing table
+	for attempt := 0; ; attempt++ {
+		partition, err := s.insertBatch(ctx, topic, partitions, byPartition)
+		if err == nil {
+			return nil
+		}
+		// A table may need creating and then, on a later attempt, no further repair
+		if !IsMissingMessageTable(err) || attempt >= len(partitions) {
+			return errors.Wrap(err, "failed to insert messages")
+		}
+		if err := EnsureMessageTable(ctx, s.db, s.getMessageTableName(topic, partition), err); err != nil {
+			return err
+		}
 	}
-	klog.V(4).Infof("Successfully saved message with ID %s", msg.MessageID)
-	return msg.MessageID, nil
+}
+
+// insertBatch writes the messages of each partition in one transaction.
+// On failure it returns the partition whose insert failed.
+func (s *messageManagerImpl) insertBatch(ctx context.Context, topic string, partitions []int, byPartition map[int][]*model.Message) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	for _, partition := range partitions {
+		batch := byPartition[partition]
+		rows := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*7)
+		for _, msg := range batch {
+			rows = append(rows, "(?, ?, ?, ?, ?, ?, ?)")
+			args = append(args, msg.MessageID, msg.Tag, msg.Key, msg.Body, msg.BornTime, msg.RetryCount, model.EncodeHeaders(msg.Headers))
+		}
+		query := fmt.Sprintf(template.InsertMessagesTemplate, s.getMessageTableName(topic, partition), strings.Join(rows, ", "))
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return partition, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, errors.Wrap(err, "failed to commit transaction")
+	}
+	return -1, nil
 }
 
 // SaveMessageWithTx saves a message using a caller-managed transaction.
@@ -107,9 +225,9 @@ func (s *messageManagerImpl) SaveMessageWithTx(ctx context.Context, tx *sql.Tx,
 }
 
 func (s *messageManagerImpl) GetMessages(ctx context.Context, topic string, group string, partition int, offset int64, size int) ([]*model.Message, error) {
-	klog.V(4).Infof("Getting messages from topic %s, partition %d, offset %d, size %d", topic, partition, offset, size)
 	messages := make([]*model.Message, 0)
-	rows, err := s.db.Query(fmt.Sprintf(template.SelectMessagesTemplate, s.getMessageTableName(topic, partition)), offset, size)
+	tableName := s.getMessageTableName(topic, partition)
+	rows, err := s.queryMessages(ctx, tableName, fmt.Sprintf(template.SelectMessagesTemplate, tableName), offset, size)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to query messages")
 	}
@@ -119,24 +237,24 @@ func (s *messageManagerImpl) GetMessages(ctx context.Context, topic string, grou
 		var message model.Message
 		message.Partition = partition
 		message.Topic = topic
-		err = rows.Scan(&message.MessageID, &message.Tag, &message.Key, &message.Body, &message.BornTime, &message.Offset, &message.RetryCount)
+		var headers sql.NullString
+		err = rows.Scan(&message.MessageID, &message.Tag, &message.Key, &message.Body, &message.BornTime, &message.Offset, &message.RetryCount, &headers)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to scan message row")
 		}
+		message.Headers = model.DecodeHeaders(headers)
 		messages = append(messages, &message)
 	}
-	klog.V(4).Infof("Retrieved %d messages", len(messages))
+	s.logger.Debug("Retrieved messages", "topic", topic, "partition", partition, "offset", offset, "count", len(messages))
 	return messages, nil
 }
 
 func (s *messageManagerImpl) GetMaxOffset(ctx context.Context, topic string, partition int) (int64, error) {
-	klog.V(4).Infof("Getting max offset for topic %s, partition %d", topic, partition)
 	var maxOffset int64
 	err := s.db.QueryRow(fmt.Sprintf(template.SelectMaxOffsetTemplate, s.getMessageTableName(topic, partition))).Scan(&maxOffset)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to get max offset")
 	}
-	klog.V(4).Infof("Max offset is %d", maxOffset)
 	return maxOffset, nil
 }
 
@@ -153,48 +271,37 @@ func (s *messageManagerImpl) GetPartitionStat(ctx context.Context, topic string,
 	return &stat, nil
 }
 
-func (s *messageManagerImpl) QueryMessageForPage(ctx context.Context, topic string, partition int, messageID string, tag string, pageNo int, pageSize int) (int, []*model.Message, error) {
-	tableName := s.getMessageTableName(topic, partition)
-	offset := (pageNo - 1) * pageSize
-	limit := pageSize
-	sql, err := templatex.Rander(template.SelectMessages2Template, map[string]interface{}{
-		"TableName": tableName,
-		"MessageID": messageID,
-		"Tag":       tag,
-	})
+// GetOffsetByTime returns the offset of the first message of a partition born at or after t, 0 when there is none
+func (s *messageManagerImpl) GetOffsetByTime(ctx context.Context, topic string, partition int, t time.Time) (int64, error) {
+	var offset int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(template.SelectOffsetByTimeTemplate, s.getMessageTableName(topic, partition)), t).Scan(&offset)
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "failed to template sql")
-	}
-
-	args := []any{}
-	if messageID != "" {
-		args = append(args, messageID)
-	}
-	if tag != "" {
-		args = append(args, tag)
-	}
-	args = append(args, limit, offset)
-
-	rows, err := s.db.Query(sql, args...)
-
-	if err != nil && strings.Contains(err.Error(), "doesn't exist") {
-		return 0, nil, nil
+		if strings.Contains(err.Error(), "doesn't exist") {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "failed to get offset by time")
 	}
+	return offset, nil
+}
 
+// UpdateHeaders replaces the headers of stored messages of a single topic, found by partition and offset, in one transaction
+func (s *messageManagerImpl) UpdateHeaders(ctx context.Context, msgs []*model.Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, nil, errors.Wrap(err, "failed to query messages")
+		return errors.Wrap(err, "failed to begin transaction")
 	}
-	defer rows.Close()
-	messages := make([]*model.Message, 0)
-	for rows.Next() {
-		var message model.Message
-		err = rows.Scan(&message.MessageID, &message.Tag, &message.Key, &message.Body, &message.BornTime, &message.Offset, &message.RetryCount)
-		if err != nil {
-			return 0, nil, errors.Wrap(err, "failed to scan message row")
+	defer tx.Rollback()
+
+	for _, msg := range msgs {
+		query := fmt.Sprintf(template.UpdateMessageHeadersTemplate, s.getMessageTableName(msg.Topic, msg.Partition))
+		if _, err := tx.ExecContext(ctx, query, model.EncodeHeaders(msg.Headers), msg.Offset); err != nil {
+			return errors.Wrap(err, "failed to update message headers")
 		}
-		messages = append(messages, &message)
 	}
-	return len(messages), messages, nil
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+	return nil
 }
 
 // getMessageTableName returns the table name for a given topic
@@ -214,17 +321,85 @@ func (t *messageManagerImpl) calculatePartition(key string, partitionNum int) in
 	return abs(hash) % partitionNum
 }
 
-// createMessageTable creates a new message table for a topic. Must be called outside a transaction (DDL causes implicit commit).
-func (t *messageManagerImpl) createMessageTable(topic string, partition int) error {
-	klog.V(4).Infof("Creating message table for topic %s, partition %d", topic, partition)
-	_, err := t.db.Exec(fmt.Sprintf(template.CreateMessageTableTemplate, t.getMessageTableName(topic, partition)))
+// queryMessages runs a query reading the headers of a partition table, adding the column once
+// to a table created by an earlier version
+func (s *messageManagerImpl) queryMessages(ctx context.Context, tableName string, query string, args ...any) (*sql.Rows, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil && isMissingHeaders(err) {
+		if err := AddHeadersColumn(ctx, s.db, tableName); err != nil {
+			return nil, err
+		}
+		rows, err = s.db.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+// IsMissingMessageTable reports whether a statement failed because its partition table doesn't
+// exist yet or was created before messages had headers
+func IsMissingMessageTable(err error) bool {
+	return strings.Contains(err.Error(), "doesn't exist") || isMissingHeaders(err)
+}
+
+// EnsureMessageTable repairs the partition table a statement failed on with cause: it adds the headers
+// column to a table created by an earlier version and creates any other missing table.
+// Must be called outside a transaction (DDL causes implicit commit).
+func EnsureMessageTable(ctx context.Context, db *sql.DB, tableName string, cause error) error {
+	if isMissingHeaders(cause) {
+		return AddHeadersColumn(ctx, db, tableName)
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(template.CreateMessageTableTemplate, tableName)); err != nil {
+		return errors.Wrapf(err, "failed to create message table %s", tableName)
+	}
+	return nil
+}
+
+// AddHeadersColumn adds the headers column to a table created before messages had headers.
+// It does nothing when the column exists, so it is safe to run on every start.
+func AddHeadersColumn(ctx context.Context, db *sql.DB, tableName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(template.AddHeadersColumnTemplate, tableName))
+	if err != nil && !strings.Contains(err.Error(), "Duplicate column") {
+		return errors.Wrapf(err, "failed to add headers column to %s", tableName)
+	}
+	return nil
+}
+
+// addSearchIndexes adds the key and born time indexes to the partition tables created before
+// they were part of the table. Each index is added on its own, as another instance may be adding them too.
+func (s *messageManagerImpl) addSearchIndexes(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, template.SelectTablesWithoutSearchIndexes)
 	if err != nil {
-		return errors.Wrap(err, "failed to create message table")
+		return errors.Wrap(err, "failed to list message tables without search indexes")
+	}
+	var tableNames []string
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			rows.Close()
+			return err
+		}
+		tableNames = append(tableNames, tableName)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, tableName := range tableNames {
+		s.logger.Info("Adding search indexes to message table", "table", tableName)
+		for _, index := range []string{template.AddKeyIndexTemplate, template.AddBornTimeIndexTemplate} {
+			_, err := s.db.ExecContext(ctx, fmt.Sprintf(index, tableName))
+			if err != nil && !strings.Contains(err.Error(), "Duplicate key name") && !strings.Contains(err.Error(), "doesn't exist") {
+				return errors.Wrapf(err, "failed to add search index to %s", tableName)
+			}
+		}
 	}
-	klog.V(4).Info("Message table created successfully")
 	return nil
 }
 
+func isMissingHeaders(err error) bool {
+	return strings.Contains(err.Error(), "Unknown column 'headers'")
+}
+
 // insertMessage inserts a message into the database
 func (s *messageManagerImpl) insertMessage(tx *sql.Tx, msg *model.Message) error {
 	stmt, err := tx.Prepare(fmt.Sprintf(template.InsertMessageTemplate, s.getMessageTableName(msg.Topic, msg.Partition)))
@@ -233,7 +408,7 @@ func (s *messageManagerImpl) insertMessage(tx *sql.Tx, msg *model.Message) error
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(msg.MessageID, msg.Tag, msg.Key, msg.Body, msg.BornTime, msg.RetryCount)
+	result, err := stmt.Exec(msg.MessageID, msg.Tag, msg.Key, msg.Body, msg.BornTime, msg.RetryCount, model.EncodeHeaders(msg.Headers))
 	if err != nil {
 		return err
 	}
@@ -263,13 +438,3 @@ func abs(n int) int {
 	}
 	return n
 }
-
-// isValidTopicName checks if topic name contains only alphanumeric and underscore characters
-func isValidTopicName(topic string) bool {
-	for _, c := range topic {
-		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-') {
-			return false
-		}
-	}
-	return true
-}
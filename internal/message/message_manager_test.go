@@ -2,6 +2,7 @@ package message
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -9,7 +10,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/metrics"
 	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+	"github.com/wenzuojing/mqx/internal/tracing"
 )
 
 // MockFactory implements interfaces.Factory for testing
@@ -47,6 +52,48 @@ func (m *MockFactory) GetClearManager() interfaces.ClearManager {
 	return args.Get(0).(interfaces.ClearManager)
 }
 
+func (m *MockFactory) GetTransactionManager() interfaces.TransactionManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.TransactionManager)
+}
+
+func (m *MockFactory) GetReplyManager() interfaces.ReplyManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ReplyManager)
+}
+
+func (m *MockFactory) GetMetrics() *metrics.Metrics {
+	return nil
+}
+
+func (m *MockFactory) GetTracer() *tracing.Tracer {
+	return nil
+}
+
+func (m *MockFactory) GetLogger() logging.Logger {
+	return logging.Discard()
+}
+
+func (m *MockFactory) GetTraceManager() *msgtrace.Manager {
+	return nil
+}
+
+func (m *MockFactory) GetHealthChecker() interfaces.HealthChecker {
+	return nil
+}
+
+func (m *MockFactory) GetAuditManager() interfaces.AuditManager {
+	return nil
+}
+
+func (m *MockFactory) GetReplayManager() interfaces.ReplayManager {
+	return nil
+}
+
+func (m *MockFactory) GetWebhookManager() interfaces.WebhookManager {
+	return nil
+}
+
 // MockTopicManager implements interfaces.TopicManager for testing
 type MockTopicManager struct {
 	mock.Mock
@@ -57,6 +104,12 @@ func (m *MockTopicManager) GetTopicMeta(ctx context.Context, topic string) (*mod
 	return args.Get(0).(*model.TopicMeta), args.Error(1)
 }
 
+func (m *MockTopicManager) FindTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	args := m.Called(ctx, topic)
+	meta, _ := args.Get(0).(*model.TopicMeta)
+	return meta, args.Error(1)
+}
+
 func (m *MockTopicManager) GetAllTopicMeta(ctx context.Context) ([]model.TopicMeta, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]model.TopicMeta), args.Error(1)
@@ -97,6 +150,7 @@ func TestMessageManager_SaveMessage(t *testing.T) {
 	mockFactory.On("GetTopicManager").Return(mockTopicManager)
 
 	mm := &messageManagerImpl{
+		logger:  logging.Discard(),
 		db:      db,
 		factory: mockFactory,
 	}
@@ -125,6 +179,7 @@ func TestMessageManager_SaveMessage(t *testing.T) {
 			[]byte("test message"),
 			sqlmock.AnyArg(), // born_time
 			sqlmock.AnyArg(), // retry_count
+			sqlmock.AnyArg(), // headers
 		).WillReturnResult(sqlmock.NewResult(1, 1))
 	smock.ExpectCommit()
 
@@ -137,13 +192,41 @@ func TestMessageManager_SaveMessage(t *testing.T) {
 	mockTopicManager.AssertExpectations(t)
 }
 
+func TestMessageManager_SaveMessage_MissingTable(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mockFactory := new(MockFactory)
+	mockTopicManager := new(MockTopicManager)
+	mockFactory.On("GetTopicManager").Return(mockTopicManager)
+	mockTopicManager.On("GetTopicMeta", mock.Anything, "test-topic").Return(&model.TopicMeta{Topic: "test-topic", PartitionNum: 1}, nil)
+	mm := &messageManagerImpl{logger: logging.Discard(), db: db, factory: mockFactory}
+
+	// The failed transaction is rolled back before the table is created, then the insert is retried in a new one
+	smock.ExpectBegin()
+	smock.ExpectPrepare("INSERT INTO `mqx_messages_test-topic_0`").
+		WillReturnError(errors.New("Error 1146: Table 'mqx.mqx_messages_test-topic_0' doesn't exist"))
+	smock.ExpectRollback()
+	smock.ExpectExec("CREATE TABLE IF NOT EXISTS `mqx_messages_test-topic_0`").WillReturnResult(sqlmock.NewResult(0, 0))
+	smock.ExpectBegin()
+	smock.ExpectPrepare("INSERT INTO `mqx_messages_test-topic_0`").ExpectExec().WillReturnResult(sqlmock.NewResult(1, 1))
+	smock.ExpectCommit()
+
+	id, err := mm.SaveMessage(context.Background(), &model.Message{Topic: "test-topic", Body: []byte("test message"), BornTime: time.Now()})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
 func TestMessageManager_GetMessages(t *testing.T) {
 	db, smock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
 	mm := &messageManagerImpl{
-		db: db,
+		logger: logging.Discard(),
+		db:     db,
 	}
 
 	now := time.Now()
@@ -152,9 +235,9 @@ func TestMessageManager_GetMessages(t *testing.T) {
 	smock.ExpectQuery("SELECT").
 		WithArgs(int64(0), 10).
 		WillReturnRows(sqlmock.NewRows([]string{
-			"message_id", "tag", "key", "body", "born_time", "offset", "retry_count",
+			"message_id", "tag", "key", "body", "born_time", "offset", "retry_count", "headers",
 		}).AddRow(
-			"msg-1", "", "test-key", []byte("test message"), now, 1, 0,
+			"msg-1", "", "test-key", []byte("test message"), now, 1, 0, nil,
 		))
 
 	messages, err := mm.GetMessages(context.Background(), "test-topic", "test-group", 0, 0, 10)
@@ -163,6 +246,20 @@ func TestMessageManager_GetMessages(t *testing.T) {
 	assert.Equal(t, "msg-1", messages[0].MessageID)
 	assert.Equal(t, "test-key", messages[0].Key)
 
+	// A partition table created before messages had headers is upgraded and read again
+	smock.ExpectQuery("SELECT").
+		WillReturnError(errors.New("Error 1054: Unknown column 'headers' in 'field list'"))
+	smock.ExpectExec("ALTER TABLE `mqx_messages_test-topic_0` ADD COLUMN `headers` TEXT").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	smock.ExpectQuery("SELECT").
+		WithArgs(int64(1), 10).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"message_id", "tag", "key", "body", "born_time", "offset", "retry_count", "headers",
+		}))
+	messages, err = mm.GetMessages(context.Background(), "test-topic", "test-group", 0, 1, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
 	assert.NoError(t, smock.ExpectationsWereMet())
 }
 
@@ -172,7 +269,8 @@ func TestMessageManager_GetMaxOffset(t *testing.T) {
 	defer db.Close()
 
 	mm := &messageManagerImpl{
-		db: db,
+		logger: logging.Discard(),
+		db:     db,
 	}
 
 	// Mock max offset query — actual SQL: SELECT COALESCE(MAX(`offset`), 0) as max_offset FROM `%s`
@@ -186,25 +284,114 @@ func TestMessageManager_GetMaxOffset(t *testing.T) {
 	assert.NoError(t, smock.ExpectationsWereMet())
 }
 
-func TestMessageManager_CreateMessageTable(t *testing.T) {
+func TestMessageManager_GetOffsetByTime(t *testing.T) {
 	db, smock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
 	mm := &messageManagerImpl{
-		db: db,
+		logger: logging.Discard(),
+		db:     db,
 	}
 
-	// Mock table creation
-	smock.ExpectExec("CREATE TABLE IF NOT EXISTS").
-		WillReturnResult(sqlmock.NewResult(0, 0))
+	at := time.Now().Add(-time.Hour)
+	smock.ExpectQuery("SELECT COALESCE\\(MIN\\(`offset`\\), 0\\) FROM `mqx_messages_test-topic_1` WHERE `born_time` >= \\?").
+		WithArgs(at).
+		WillReturnRows(sqlmock.NewRows([]string{"offset"}).AddRow(42))
+	offset, err := mm.GetOffsetByTime(context.Background(), "test-topic", 1, at)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), offset)
 
-	err = mm.createMessageTable("test-topic", 0)
+	// A partition without table has no message
+	smock.ExpectQuery("SELECT COALESCE").
+		WillReturnError(errors.New("Error 1146: Table 'mqx.mqx_messages_test-topic_2' doesn't exist"))
+	offset, err = mm.GetOffsetByTime(context.Background(), "test-topic", 2, at)
 	assert.NoError(t, err)
+	assert.Zero(t, offset)
 
 	assert.NoError(t, smock.ExpectationsWereMet())
 }
 
+func TestMessageManager_UpdateHeaders(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mm := &messageManagerImpl{
+		logger: logging.Discard(),
+		db:     db,
+	}
+
+	smock.ExpectBegin()
+	smock.ExpectExec("UPDATE `mqx_messages_test-topic_0` SET `headers` = \\? WHERE `offset` = \\?").
+		WithArgs(`{"a":"1"}`, int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	smock.ExpectExec("UPDATE `mqx_messages_test-topic_2` SET `headers` = \\? WHERE `offset` = \\?").
+		WithArgs(nil, int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	smock.ExpectCommit()
+	err = mm.UpdateHeaders(context.Background(), []*model.Message{
+		{Topic: "test-topic", Partition: 0, Offset: 3, Headers: map[string]string{"a": "1"}},
+		{Topic: "test-topic", Partition: 2, Offset: 9},
+	})
+	assert.NoError(t, err)
+
+	// A failed update leaves every message unchanged
+	smock.ExpectBegin()
+	smock.ExpectExec("UPDATE").WillReturnError(errors.New("lock wait timeout"))
+	smock.ExpectRollback()
+	err = mm.UpdateHeaders(context.Background(), []*model.Message{{Topic: "test-topic", Offset: 3}})
+	assert.Error(t, err)
+
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestEnsureMessageTable(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// A missing table is created
+	smock.ExpectExec("CREATE TABLE IF NOT EXISTS `mqx_messages_test-topic_0`").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = EnsureMessageTable(context.Background(), db, "mqx_messages_test-topic_0",
+		errors.New("Error 1146: Table 'mqx.mqx_messages_test-topic_0' doesn't exist"))
+	assert.NoError(t, err)
+
+	// A table of an earlier version gets the headers column
+	unknown := errors.New("Error 1054: Unknown column 'headers' in 'field list'")
+	assert.True(t, IsMissingMessageTable(unknown))
+	smock.ExpectExec("ALTER TABLE `mqx_messages_test-topic_0` ADD COLUMN `headers` TEXT").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, EnsureMessageTable(context.Background(), db, "mqx_messages_test-topic_0", unknown))
+
+	// Another instance may have added it first
+	smock.ExpectExec("ALTER TABLE").
+		WillReturnError(errors.New("Error 1060: Duplicate column name 'headers'"))
+	assert.NoError(t, AddHeadersColumn(context.Background(), db, "mqx_delay_messages"))
+
+	assert.False(t, IsMissingMessageTable(errors.New("Error 1062: Duplicate entry")))
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestMessageManager_AddSearchIndexes(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mm := &messageManagerImpl{db: db, logger: logging.Discard()}
+
+	smock.ExpectQuery("FROM information_schema.`TABLES`").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).AddRow("mqx_messages_orders_0").AddRow("mqx_messages_orders_1"))
+	smock.ExpectExec("ALTER TABLE `mqx_messages_orders_0` ADD KEY `idx_key`").WillReturnResult(sqlmock.NewResult(0, 0))
+	smock.ExpectExec("ALTER TABLE `mqx_messages_orders_0` ADD KEY `idx_born_time`").WillReturnResult(sqlmock.NewResult(0, 0))
+	// The table already had one of the indexes
+	smock.ExpectExec("ALTER TABLE `mqx_messages_orders_1` ADD KEY `idx_key`").
+		WillReturnError(errors.New("Error 1061: Duplicate key name 'idx_key'"))
+	smock.ExpectExec("ALTER TABLE `mqx_messages_orders_1` ADD KEY `idx_born_time`").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, mm.addSearchIndexes(context.Background()))
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
 func TestMessageManager_SaveMessageWithTx(t *testing.T) {
 	db, smock, err := sqlmock.New()
 	assert.NoError(t, err)
@@ -214,7 +401,7 @@ func TestMessageManager_SaveMessageWithTx(t *testing.T) {
 	mockTopicManager := new(MockTopicManager)
 	mockFactory.On("GetTopicManager").Return(mockTopicManager)
 
-	mm := &messageManagerImpl{db: db, factory: mockFactory}
+	mm := &messageManagerImpl{db: db, factory: mockFactory, logger: logging.Discard()}
 
 	msg := &model.Message{
 		MessageID:  "retry-msg-1",
@@ -234,7 +421,7 @@ func TestMessageManager_SaveMessageWithTx(t *testing.T) {
 	smock.ExpectBegin()
 	smock.ExpectPrepare("INSERT INTO `mqx_messages_test-topic_0`").
 		ExpectExec().
-		WithArgs("retry-msg-1", "tag1", "key1", []byte("retry body"), sqlmock.AnyArg(), 2).
+		WithArgs("retry-msg-1", "tag1", "key1", []byte("retry body"), sqlmock.AnyArg(), 2, sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	tx, _ := db.Begin()
@@ -244,3 +431,59 @@ func TestMessageManager_SaveMessageWithTx(t *testing.T) {
 
 	assert.NoError(t, smock.ExpectationsWereMet())
 }
+
+func TestMessageManager_SaveMessages(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mockFactory := new(MockFactory)
+	mockTopicManager := new(MockTopicManager)
+	mockFactory.On("GetTopicManager").Return(mockTopicManager)
+	mockTopicManager.On("GetTopicMeta", mock.Anything, "test-topic").Return(&model.TopicMeta{
+		Topic:        "test-topic",
+		PartitionNum: 2,
+	}, nil).Once()
+
+	mm := &messageManagerImpl{
+		logger:  logging.Discard(),
+		db:      db,
+		factory: mockFactory,
+	}
+
+	// Keys "a" and "b" hash to partitions 1 and 0
+	msgs := []*model.Message{
+		{Topic: "test-topic", Key: "a", Body: []byte("1"), BornTime: time.Now()},
+		{Topic: "test-topic", Key: "b", Body: []byte("2"), BornTime: time.Now()},
+		{Topic: "test-topic", Key: "a", Body: []byte("3"), BornTime: time.Now()},
+	}
+
+	// First attempt: partition 1 table is missing, the transaction is rolled back
+	smock.ExpectBegin()
+	smock.ExpectExec("INSERT INTO `mqx_messages_test-topic_1` .* VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?\\), \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?\\)$").
+		WillReturnError(errors.New("Table 'mqx.mqx_messages_test-topic_1' doesn't exist"))
+	smock.ExpectRollback()
+	smock.ExpectExec("CREATE TABLE IF NOT EXISTS `mqx_messages_test-topic_1`").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// Retry writes both partitions in one transaction
+	smock.ExpectBegin()
+	smock.ExpectExec("INSERT INTO `mqx_messages_test-topic_1`").
+		WithArgs(sqlmock.AnyArg(), "", "a", []byte("1"), sqlmock.AnyArg(), 0, sqlmock.AnyArg(),
+			sqlmock.AnyArg(), "", "a", []byte("3"), sqlmock.AnyArg(), 0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	smock.ExpectExec("INSERT INTO `mqx_messages_test-topic_0`").
+		WithArgs(sqlmock.AnyArg(), "", "b", []byte("2"), sqlmock.AnyArg(), 0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	smock.ExpectCommit()
+
+	err = mm.SaveMessages(context.Background(), msgs)
+	assert.NoError(t, err)
+	for _, msg := range msgs {
+		assert.NotEmpty(t, msg.MessageID)
+	}
+	assert.Equal(t, 1, msgs[0].Partition)
+	assert.Equal(t, 0, msgs[1].Partition)
+
+	assert.NoError(t, smock.ExpectationsWereMet())
+	mockTopicManager.AssertExpectations(t)
+}
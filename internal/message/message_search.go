@@ -0,0 +1,241 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/template"
+	"github.com/wenzuojing/mqx/pkg/templatex"
+)
+
+const (
+	// defaultSearchPageSize is used when a filter has no page size
+	defaultSearchPageSize = 20
+	// maxSearchConcurrency bounds the partitions searched at the same time
+	maxSearchConcurrency = 8
+)
+
+// ErrInvalidCursor is returned when a search cursor was not produced by a previous page
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidPartition is returned when a search names a partition the topic does not have
+var ErrInvalidPartition = errors.New("invalid partition")
+
+// searchCursor is the position of the last message of a page in the search order:
+// born time, then partition, then offset, all descending
+type searchCursor struct {
+	bornTime  time.Time
+	partition int
+	offset    int64
+}
+
+func encodeCursor(msg *model.Message) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d:%d", msg.BornTime.UnixNano(), msg.Partition, msg.Offset))
+}
+
+func decodeCursor(s string) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var nanos int64
+	var cursor searchCursor
+	if _, err := fmt.Sscanf(string(data), "%d:%d:%d", &nanos, &cursor.partition, &cursor.offset); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor.bornTime = time.Unix(0, nanos)
+	return &cursor, nil
+}
+
+// searchBefore reports whether a precedes b in the search order
+func searchBefore(a, b *model.Message) bool {
+	if !a.BornTime.Equal(b.BornTime) {
+		return a.BornTime.After(b.BornTime)
+	}
+	if a.Partition != b.Partition {
+		return a.Partition > b.Partition
+	}
+	return a.Offset > b.Offset
+}
+
+// SearchMessages searches the partitions of a topic in parallel and merges the results by born time, newest first.
+// Pages are chained with cursors, so a page stays consistent while new messages arrive.
+// Searching a missing topic fails with model.ErrTopicNotFound rather than creating the topic.
+func (s *messageManagerImpl) SearchMessages(ctx context.Context, filter *model.MessageFilter) (*model.MessagePage, error) {
+	topicMeta, err := s.findTopicMeta(ctx, filter.Topic)
+	if err != nil {
+		return nil, err
+	}
+	var partitions []int
+	if filter.Partition != nil {
+		if *filter.Partition < 0 || *filter.Partition >= topicMeta.PartitionNum {
+			return nil, ErrInvalidPartition
+		}
+		partitions = []int{*filter.Partition}
+	} else {
+		for partition := 0; partition < topicMeta.PartitionNum; partition++ {
+			partitions = append(partitions, partition)
+		}
+	}
+	var cursor *searchCursor
+	if filter.Cursor != "" {
+		if cursor, err = decodeCursor(filter.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	pageSize := filter.PageSize
+	if pageSize < 1 {
+		pageSize = defaultSearchPageSize
+	}
+
+	results := make([][]*model.Message, len(partitions))
+	counts := make([]int64, len(partitions))
+	errs := make([]error, len(partitions))
+	sem := make(chan struct{}, maxSearchConcurrency)
+	var wg sync.WaitGroup
+	for i, partition := range partitions {
+		wg.Add(1)
+		go func(i, partition int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			// One extra message tells whether there is a next page
+			if results[i], errs[i] = s.searchPartition(ctx, filter, partition, cursor, pageSize+1); errs[i] != nil {
+				return
+			}
+			if cursor == nil {
+				counts[i], errs[i] = s.countPartition(ctx, filter, partition)
+			}
+		}(i, partition)
+	}
+	wg.Wait()
+
+	page := &model.MessagePage{Messages: make([]*model.Message, 0, pageSize)}
+	var merged []*model.Message
+	var total int64
+	for i := range partitions {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		merged = append(merged, results[i]...)
+		total += counts[i]
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return searchBefore(merged[i], merged[j])
+	})
+	if len(merged) > pageSize {
+		merged = merged[:pageSize]
+		page.NextCursor = encodeCursor(merged[pageSize-1])
+	}
+	page.Messages = append(page.Messages, merged...)
+	if cursor == nil {
+		page.Total = &total
+	}
+	return page, nil
+}
+
+// searchConditions returns the template data and arguments of the filter conditions
+func searchConditions(filter *model.MessageFilter, tableName string) (map[string]any, []any) {
+	data := map[string]any{
+		"TableName":  tableName,
+		"MessageID":  filter.MessageID,
+		"Tag":        filter.Tag,
+		"Key":        filter.Key,
+		"HasFrom":    !filter.From.IsZero(),
+		"HasTo":      !filter.To.IsZero(),
+		"FromOffset": filter.FromOffset > 0,
+		"ToOffset":   filter.ToOffset > 0,
+	}
+	var args []any
+	for _, value := range []string{filter.MessageID, filter.Tag, filter.Key} {
+		if value != "" {
+			args = append(args, value)
+		}
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+	}
+	if filter.FromOffset > 0 {
+		args = append(args, filter.FromOffset)
+	}
+	if filter.ToOffset > 0 {
+		args = append(args, filter.ToOffset)
+	}
+	return data, args
+}
+
+// searchPartition returns up to limit matching messages of a partition after the cursor
+func (s *messageManagerImpl) searchPartition(ctx context.Context, filter *model.MessageFilter, partition int, cursor *searchCursor, limit int) ([]*model.Message, error) {
+	tableName := s.getMessageTableName(filter.Topic, partition)
+	data, args := searchConditions(filter, tableName)
+	if cursor != nil {
+		// At the cursor's born time the lower partitions come after the cursor and the higher
+		// ones before it, while its own partition continues after its offset
+		data["HasCursor"] = true
+		switch {
+		case partition < cursor.partition:
+			data["CursorCmp"] = "<="
+			args = append(args, cursor.bornTime)
+		case partition == cursor.partition:
+			data["CursorCmp"] = "<"
+			data["CursorOffset"] = true
+			args = append(args, cursor.bornTime, cursor.bornTime, cursor.offset)
+		default:
+			data["CursorCmp"] = "<"
+			args = append(args, cursor.bornTime)
+		}
+	}
+	query, err := templatex.Rander(template.SearchMessagesTemplate, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to template sql")
+	}
+
+	rows, err := s.queryMessages(ctx, tableName, query, append(args, limit)...)
+	if err != nil {
+		// The table of a partition is created by its first message
+		if strings.Contains(err.Error(), "doesn't exist") {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to search messages")
+	}
+	defer rows.Close()
+	var messages []*model.Message
+	for rows.Next() {
+		message := model.Message{Topic: filter.Topic, Partition: partition}
+		var headers sql.NullString
+		if err := rows.Scan(&message.MessageID, &message.Tag, &message.Key, &message.Body, &message.BornTime, &message.Offset, &message.RetryCount, &headers); err != nil {
+			return nil, errors.Wrap(err, "failed to scan message row")
+		}
+		message.Headers = model.DecodeHeaders(headers)
+		messages = append(messages, &message)
+	}
+	return messages, rows.Err()
+}
+
+// countPartition returns the number of matching messages of a partition
+func (s *messageManagerImpl) countPartition(ctx context.Context, filter *model.MessageFilter, partition int) (int64, error) {
+	data, args := searchConditions(filter, s.getMessageTableName(filter.Topic, partition))
+	query, err := templatex.Rander(template.CountMessagesTemplate, data)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to template sql")
+	}
+	var count int64
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		if strings.Contains(err.Error(), "doesn't exist") {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "failed to count messages")
+	}
+	return count, nil
+}
@@ -0,0 +1,110 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+var searchColumns = []string{"message_id", "tag", "key", "body", "born_time", "offset", "retry_count", "headers"}
+
+func newSearchManager(t *testing.T, partitionNum int) (*messageManagerImpl, sqlmock.Sqlmock) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	// Partitions are searched in parallel
+	smock.MatchExpectationsInOrder(false)
+
+	mockFactory := new(MockFactory)
+	mockTopicManager := new(MockTopicManager)
+	mockFactory.On("GetTopicManager").Return(mockTopicManager)
+	mockTopicManager.On("FindTopicMeta", mock.Anything, "orders").Return(&model.TopicMeta{Topic: "orders", PartitionNum: partitionNum}, nil)
+	mockTopicManager.On("FindTopicMeta", mock.Anything, "missing").Return(nil, model.ErrTopicNotFound)
+	return &messageManagerImpl{logger: logging.Discard(), db: db, factory: mockFactory}, smock
+}
+
+func TestMessageManager_SearchMessages(t *testing.T) {
+	mm, smock := newSearchManager(t, 3)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	from := base.Add(-time.Hour)
+
+	smock.ExpectQuery("FROM `mqx_messages_orders_0`\\s+WHERE 1 = 1\\s+AND `key` = \\?\\s+AND `born_time` >= \\?\\s+ORDER BY `born_time` DESC, `offset` DESC").
+		WithArgs("order-1", from, 3).
+		WillReturnRows(sqlmock.NewRows(searchColumns).
+			AddRow("m1", "", "order-1", []byte("a"), base.Add(2*time.Second), 8, 0, nil).
+			AddRow("m2", "", "order-1", []byte("b"), base, 7, 0, nil))
+	smock.ExpectQuery("FROM `mqx_messages_orders_1`").
+		WithArgs("order-1", from, 3).
+		WillReturnRows(sqlmock.NewRows(searchColumns).
+			AddRow("m3", "", "order-1", []byte("c"), base.Add(time.Second), 4, 0, nil).
+			AddRow("m4", "", "order-1", []byte("d"), base, 3, 0, nil))
+	smock.ExpectQuery("FROM `mqx_messages_orders_2`").
+		WithArgs("order-1", from, 3).
+		WillReturnError(errors.New("Error 1146: Table 'mqx.mqx_messages_orders_2' doesn't exist"))
+	for _, table := range []string{"mqx_messages_orders_0", "mqx_messages_orders_1"} {
+		smock.ExpectQuery("SELECT COUNT\\(\\*\\)\\s+FROM `"+table+"`").
+			WithArgs("order-1", from).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	}
+	smock.ExpectQuery("SELECT COUNT\\(\\*\\)\\s+FROM `mqx_messages_orders_2`").
+		WillReturnError(errors.New("Error 1146: Table 'mqx.mqx_messages_orders_2' doesn't exist"))
+
+	page, err := mm.SearchMessages(context.Background(), &model.MessageFilter{Topic: "orders", Key: "order-1", From: from, PageSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), *page.Total)
+	if assert.Len(t, page.Messages, 2) {
+		assert.Equal(t, "m1", page.Messages[0].MessageID)
+		assert.Equal(t, "m3", page.Messages[1].MessageID)
+		assert.Equal(t, 1, page.Messages[1].Partition)
+	}
+	assert.NoError(t, smock.ExpectationsWereMet())
+
+	// The next page continues after m3 (partition 1, offset 4) without counting again
+	smock.ExpectQuery("FROM `mqx_messages_orders_0`.*AND \\(`born_time` <= \\?\\)").
+		WithArgs("order-1", from, base.Add(time.Second), 3).
+		WillReturnRows(sqlmock.NewRows(searchColumns).
+			AddRow("m2", "", "order-1", []byte("b"), base, 7, 0, nil))
+	smock.ExpectQuery("FROM `mqx_messages_orders_1`.*AND \\(`born_time` < \\? OR \\(`born_time` = \\? AND `offset` < \\?\\)\\)").
+		WithArgs("order-1", from, base.Add(time.Second), base.Add(time.Second), int64(4), 3).
+		WillReturnRows(sqlmock.NewRows(searchColumns).
+			AddRow("m4", "", "order-1", []byte("d"), base, 3, 0, nil))
+	smock.ExpectQuery("FROM `mqx_messages_orders_2`.*AND \\(`born_time` < \\?\\)").
+		WithArgs("order-1", from, base.Add(time.Second), 3).
+		WillReturnRows(sqlmock.NewRows(searchColumns))
+
+	page, err = mm.SearchMessages(context.Background(), &model.MessageFilter{Topic: "orders", Key: "order-1", From: from, PageSize: 2, Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Nil(t, page.Total)
+	assert.Empty(t, page.NextCursor)
+	if assert.Len(t, page.Messages, 2) {
+		assert.Equal(t, "m4", page.Messages[0].MessageID)
+		assert.Equal(t, "m2", page.Messages[1].MessageID)
+	}
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestMessageManager_SearchMessages_InvalidInput(t *testing.T) {
+	mm, smock := newSearchManager(t, 2)
+
+	partition := 2
+	_, err := mm.SearchMessages(context.Background(), &model.MessageFilter{Topic: "orders", Partition: &partition})
+	assert.ErrorIs(t, err, ErrInvalidPartition)
+
+	_, err = mm.SearchMessages(context.Background(), &model.MessageFilter{Topic: "orders", Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = mm.SearchMessages(context.Background(), &model.MessageFilter{Topic: "orders`x"})
+	assert.ErrorIs(t, err, model.ErrInvalidTopic)
+
+	// Searching does not create the topic
+	_, err = mm.SearchMessages(context.Background(), &model.MessageFilter{Topic: "missing"})
+	assert.ErrorIs(t, err, model.ErrTopicNotFound)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
@@ -0,0 +1,69 @@
+package message
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// TailBatchSize is the maximum number of messages read from a partition per poll
+const TailBatchSize = 100
+
+// Tail reads the messages written to the partitions of a topic after it was created.
+// It reads the partition tables directly, so no consumer group is created and no offset is moved.
+type Tail struct {
+	messages interfaces.MessageManager
+	topic    string
+	tag      string
+	key      string
+	offsets  []int64 // Last offset read per partition
+}
+
+// NewTail starts a tail at the current end of every partition, reading the messages with tag and key
+// when they are set
+func NewTail(ctx context.Context, messages interfaces.MessageManager, meta *model.TopicMeta, tag string, key string) (*Tail, error) {
+	t := &Tail{
+		messages: messages,
+		topic:    meta.Topic,
+		tag:      tag,
+		key:      key,
+		offsets:  make([]int64, meta.PartitionNum),
+	}
+	for partition := range t.offsets {
+		stat, err := messages.GetPartitionStat(ctx, meta.Topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		t.offsets[partition] = stat.MaxOffset
+	}
+	return t, nil
+}
+
+// Poll returns the matching messages written since the previous poll, ordered by born time.
+// On failure it also returns the messages read before it, which the next poll does not return again.
+func (t *Tail) Poll(ctx context.Context) ([]*model.Message, error) {
+	var matched []*model.Message
+	for partition, offset := range t.offsets {
+		msgs, err := t.messages.GetMessages(ctx, t.topic, "", partition, offset, TailBatchSize)
+		if err != nil {
+			// The table of a partition is created by its first message
+			if strings.Contains(err.Error(), "doesn't exist") {
+				continue
+			}
+			return matched, err
+		}
+		for _, msg := range msgs {
+			t.offsets[partition] = msg.Offset
+			if (t.tag == "" || msg.Tag == t.tag) && (t.key == "" || msg.Key == t.key) {
+				matched = append(matched, msg)
+			}
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].BornTime.Before(matched[j].BornTime)
+	})
+	return matched, nil
+}
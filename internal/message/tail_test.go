@@ -0,0 +1,73 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func TestTail_Poll(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mm := &messageManagerImpl{logger: logging.Discard(), db: db}
+	now := time.Now()
+	messageColumns := []string{"message_id", "tag", "key", "body", "born_time", "offset", "retry_count", "headers"}
+
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_messages_orders_0`").
+		WillReturnRows(sqlmock.NewRows([]string{"max_offset", "min_offset", "total"}).AddRow(10, 1, 10))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_messages_orders_1`").
+		WillReturnError(errors.New("Error 1146: Table 'mqx.mqx_messages_orders_1' doesn't exist"))
+	tail, err := NewTail(context.Background(), mm, &model.TopicMeta{Topic: "orders", PartitionNum: 2}, "paid", "")
+	assert.NoError(t, err)
+
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_messages_orders_0`").WithArgs(int64(10), TailBatchSize).
+		WillReturnRows(sqlmock.NewRows(messageColumns).
+			AddRow("a", "paid", "", []byte("a"), now.Add(2*time.Second), 11, 0, nil).
+			AddRow("b", "created", "", []byte("b"), now.Add(3*time.Second), 12, 0, nil))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_messages_orders_1`").WithArgs(int64(0), TailBatchSize).
+		WillReturnRows(sqlmock.NewRows(messageColumns).AddRow("c", "paid", "", []byte("c"), now, 1, 0, nil))
+	msgs, err := tail.Poll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "c", msgs[0].MessageID)
+	assert.Equal(t, "a", msgs[1].MessageID)
+
+	// The next poll continues after the filtered out message; a missing table is skipped
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_messages_orders_0`").WithArgs(int64(12), TailBatchSize).
+		WillReturnRows(sqlmock.NewRows(messageColumns))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_messages_orders_1`").WithArgs(int64(1), TailBatchSize).
+		WillReturnError(errors.New("Error 1146: Table 'mqx.mqx_messages_orders_1' doesn't exist"))
+	msgs, err = tail.Poll(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestTail_Poll_Error(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mm := &messageManagerImpl{logger: logging.Discard(), db: db}
+	now := time.Now()
+	messageColumns := []string{"message_id", "tag", "key", "body", "born_time", "offset", "retry_count", "headers"}
+	tail := &Tail{messages: mm, topic: "orders", offsets: []int64{3, 5}}
+
+	// The messages of the partitions read before a failure are returned with the error, and
+	// the next poll continues after them
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_messages_orders_0`").WithArgs(int64(3), TailBatchSize).
+		WillReturnRows(sqlmock.NewRows(messageColumns).AddRow("a", "", "", []byte("a"), now, 4, 0, nil))
+	smock.ExpectQuery("SELECT (.+) FROM `mqx_messages_orders_1`").WithArgs(int64(5), TailBatchSize).
+		WillReturnError(errors.New("connection reset"))
+	msgs, err := tail.Poll(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, []int64{4, 5}, tail.offsets)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
@@ -3,19 +3,25 @@ package internal
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
+	"github.com/wenzuojing/mqx/internal/auth"
 	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/console"
 	"github.com/wenzuojing/mqx/internal/factory"
+	"github.com/wenzuojing/mqx/internal/gateway"
+	"github.com/wenzuojing/mqx/internal/grpcserver"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/metrics"
 	"github.com/wenzuojing/mqx/internal/model"
-	"k8s.io/klog/v2"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
 )
 
-type MessageHandler func(msg *model.Message) error
+type MessageHandler func(ctx context.Context, msg *model.Message) error
 
 type MessageService interface {
 	Start(ctx context.Context) error
@@ -24,13 +30,26 @@ type MessageService interface {
 	SendAsync(ctx context.Context, msg *model.Message, callback func(string, error)) error
 	GroupSubscribe(ctx context.Context, topic string, group string, handler MessageHandler) error
 	BroadcastSubscribe(ctx context.Context, topic string, handler MessageHandler) error
+	PrepareSend(ctx context.Context, msg *model.Message) (string, error)
+	Commit(ctx context.Context, messageID string) error
+	Rollback(ctx context.Context, messageID string) error
+	RegisterTransactionChecker(topic string, checker model.TransactionChecker)
+	Request(ctx context.Context, msg *model.Message) (*model.Message, error)
+	Reply(ctx context.Context, request *model.Message, reply *model.Message) (string, error)
+	Metrics() *metrics.Metrics
+	TraceMessage(ctx context.Context, messageID string) ([]*model.TraceEvent, error)
+	Health(ctx context.Context) *model.HealthReport
+	WebhookSubscribe(ctx context.Context, sub *model.WebhookSubscription) error
+	WebhookUnsubscribe(ctx context.Context, topic string, group string) error
+	WebhookSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error)
 }
 
 func NewMessageService(cfg *config.Config) (MessageService, error) {
-	klog.V(4).Info("Creating new message service")
+	logger := logging.OrDefault(cfg.Logger)
+	logger.Debug("Creating new message service")
 	db, err := sql.Open("mysql", cfg.DSN)
 	if err != nil {
-		klog.Errorf("Failed to open database connection: %v", err)
+		logger.Error("Failed to open database connection", "error", err)
 		return nil, err
 	}
 	// 设置最大连接数
@@ -43,19 +62,45 @@ func NewMessageService(cfg *config.Config) (MessageService, error) {
 	db.SetConnMaxIdleTime(time.Hour)
 	// Ping database to verify connection
 	if err := db.Ping(); err != nil {
-		klog.Errorf("Failed to ping database: %v", err)
+		logger.Error("Failed to ping database", "error", err)
 		return nil, err
 	}
 
 	factory, err := factory.NewFactory(db, cfg)
 	if err != nil {
-		klog.Errorf("Failed to create factory: %v", err)
+		logger.Error("Failed to create factory", "error", err)
 		return nil, err
 	}
 
-	consoleServer := console.NewConsoleServer(cfg, factory)
+	consoleServer, err := console.NewConsoleServer(cfg, factory)
+	if err != nil {
+		logger.Error("Failed to create console server", "error", err)
+		return nil, err
+	}
+
+	var gw *gateway.Gateway
+	if cfg.EnableGateway {
+		if gw, err = gateway.New(cfg, factory); err != nil {
+			logger.Error("Failed to create gateway", "error", err)
+			return nil, err
+		}
+		if !gw.Standalone() {
+			if !cfg.EnableConsole {
+				return nil, errors.New("the gateway needs an address when the console is disabled")
+			}
+			consoleServer.Mount("/gateway/v1", auth.RoleOperator, gw.Register)
+		}
+	}
+
+	var grpcServer *grpcserver.Server
+	if cfg.EnableGRPC {
+		if grpcServer, err = grpcserver.New(cfg, factory); err != nil {
+			logger.Error("Failed to create gRPC server", "error", err)
+			return nil, err
+		}
+	}
 
-	klog.V(4).Info("Message service created successfully")
+	logger.Debug("Message service created successfully")
 	return &messageServiceImpl{
 		topicManager:    factory.GetTopicManager(),
 		messageManager:  factory.GetMessageManager(),
@@ -63,9 +108,19 @@ func NewMessageService(cfg *config.Config) (MessageService, error) {
 		producerManager: factory.GetProducerManager(),
 		delayManager:    factory.GetDelayManager(),
 		clearManager:    factory.GetClearManager(),
+		txManager:       factory.GetTransactionManager(),
+		replyManager:    factory.GetReplyManager(),
+		auditManager:    factory.GetAuditManager(),
+		webhookManager:  factory.GetWebhookManager(),
+		metrics:         factory.GetMetrics(),
+		traceManager:    factory.GetTraceManager(),
+		healthChecker:   factory.GetHealthChecker(),
 		db:              db,
 		consoleServer:   consoleServer,
+		gateway:         gw,
+		grpcServer:      grpcServer,
 		cfg:             cfg,
+		logger:          factory.GetLogger(),
 	}, nil
 }
 
@@ -76,128 +131,200 @@ type messageServiceImpl struct {
 	producerManager interfaces.ProducerManager
 	delayManager    interfaces.DelayManager
 	clearManager    interfaces.ClearManager
+	txManager       interfaces.TransactionManager
+	replyManager    interfaces.ReplyManager
+	auditManager    interfaces.AuditManager
+	webhookManager  interfaces.WebhookManager
+	metrics         *metrics.Metrics
+	traceManager    *msgtrace.Manager
+	healthChecker   interfaces.HealthChecker
 	db              *sql.DB
 	consoleServer   *console.ConsoleServer
+	gateway         *gateway.Gateway   // nil when the gateway is disabled
+	grpcServer      *grpcserver.Server // nil when the gRPC server is disabled
 	cfg             *config.Config
+	logger          logging.Logger
 }
 
 func (s *messageServiceImpl) Start(ctx context.Context) error {
-	klog.Info("Starting message service components...")
+	s.logger.Info("Starting message service components")
 
-	// Start in dependency order: topic -> message -> consumer/producer/delay/clear
+	// Start in dependency order: topic -> message -> trace/audit -> consumer/producer/delay/clear/transaction/reply -> webhook
 	if err := s.topicManager.Start(ctx); err != nil {
-		klog.Errorf("Failed to start topic manager: %v", err)
+		s.logger.Error("Failed to start topic manager", "error", err)
 		return err
 	}
 	if err := s.messageManager.Start(ctx); err != nil {
-		klog.Errorf("Failed to start message manager: %v", err)
+		s.logger.Error("Failed to start message manager", "error", err)
+		return err
+	}
+	if err := s.traceManager.Start(ctx); err != nil {
+		s.logger.Error("Failed to start message trace manager", "error", err)
+		return err
+	}
+	if err := s.auditManager.Start(ctx); err != nil {
+		s.logger.Error("Failed to start audit manager", "error", err)
 		return err
 	}
 	if err := s.consumerManager.Start(ctx); err != nil {
-		klog.Errorf("Failed to start consumer manager: %v", err)
+		s.logger.Error("Failed to start consumer manager", "error", err)
 		return err
 	}
 	if err := s.producerManager.Start(ctx); err != nil {
-		klog.Errorf("Failed to start producer manager: %v", err)
+		s.logger.Error("Failed to start producer manager", "error", err)
 		return err
 	}
 	if err := s.delayManager.Start(ctx); err != nil {
-		klog.Errorf("Failed to start delay manager: %v", err)
+		s.logger.Error("Failed to start delay manager", "error", err)
 		return err
 	}
 	if err := s.clearManager.Start(ctx); err != nil {
-		klog.Errorf("Failed to start clear manager: %v", err)
+		s.logger.Error("Failed to start clear manager", "error", err)
+		return err
+	}
+	if err := s.txManager.Start(ctx); err != nil {
+		s.logger.Error("Failed to start transaction manager", "error", err)
+		return err
+	}
+	if err := s.replyManager.Start(ctx); err != nil {
+		s.logger.Error("Failed to start reply manager", "error", err)
+		return err
+	}
+	if err := s.webhookManager.Start(ctx); err != nil {
+		s.logger.Error("Failed to start webhook manager", "error", err)
 		return err
 	}
 
+	if s.gateway != nil {
+		if err := s.gateway.Start(ctx); err != nil {
+			s.logger.Error("Failed to start gateway", "error", err)
+			return err
+		}
+	}
+	if s.grpcServer != nil {
+		if err := s.grpcServer.Start(ctx); err != nil {
+			s.logger.Error("Failed to start gRPC server", "error", err)
+			return err
+		}
+	}
 	if s.cfg.EnableConsole {
 		if err := s.consoleServer.Start(ctx); err != nil {
-			klog.Errorf("Failed to start console server: %v", err)
+			s.logger.Error("Failed to start console server", "error", err)
 			return err
 		}
 	}
 
-	klog.Info("All message service components started successfully")
+	s.logger.Info("All message service components started successfully")
 	return nil
 }
 
+// Stop shuts the service down gracefully. Consumers stop fetching and drain their in-flight
+// handlers, committing final offsets and leaving their groups; pending async sends complete;
+// the console stops serving. All of this waits at most until the ctx deadline, and whatever
+// is still running then is abandoned and reported in the returned error. The database is
+// closed last.
 func (s *messageServiceImpl) Stop(ctx context.Context) error {
-	klog.Info("Stopping message service components...")
+	s.logger.Info("Stopping message service components")
 
-	// Stop in reverse dependency order: consumer -> clear/delay -> producer -> message -> topic
-	var firstErr error
+	// Stop in reverse dependency order: gRPC/gateway -> webhook -> consumer -> reply/transaction/clear/delay -> producer -> trace -> console -> audit -> message -> topic
+	var errs []error
 
-	if err := s.consumerManager.Stop(ctx); err != nil {
-		klog.Errorf("Failed to stop consumer manager: %v", err)
-		if firstErr == nil {
-			firstErr = err
+	if s.grpcServer != nil {
+		if err := s.grpcServer.Stop(ctx); err != nil {
+			s.logger.Error("Failed to stop gRPC server", "error", err)
+			errs = append(errs, err)
 		}
 	}
-	if err := s.clearManager.Stop(ctx); err != nil {
-		klog.Errorf("Failed to stop clear manager: %v", err)
-		if firstErr == nil {
-			firstErr = err
+	if s.gateway != nil {
+		if err := s.gateway.Stop(ctx); err != nil {
+			s.logger.Error("Failed to stop gateway", "error", err)
+			errs = append(errs, err)
 		}
 	}
+	if err := s.webhookManager.Stop(ctx); err != nil {
+		s.logger.Error("Failed to stop webhook manager", "error", err)
+		errs = append(errs, err)
+	}
+
+	if err := s.consumerManager.Stop(ctx); err != nil {
+		s.logger.Error("Failed to stop consumer manager", "error", err)
+		errs = append(errs, err)
+	}
+	if err := s.replyManager.Stop(ctx); err != nil {
+		s.logger.Error("Failed to stop reply manager", "error", err)
+		errs = append(errs, err)
+	}
+	if err := s.txManager.Stop(ctx); err != nil {
+		s.logger.Error("Failed to stop transaction manager", "error", err)
+		errs = append(errs, err)
+	}
+	if err := s.clearManager.Stop(ctx); err != nil {
+		s.logger.Error("Failed to stop clear manager", "error", err)
+		errs = append(errs, err)
+	}
 	if err := s.delayManager.Stop(ctx); err != nil {
-		klog.Errorf("Failed to stop delay manager: %v", err)
-		if firstErr == nil {
-			firstErr = err
-		}
+		s.logger.Error("Failed to stop delay manager", "error", err)
+		errs = append(errs, err)
 	}
 	if err := s.producerManager.Stop(ctx); err != nil {
-		klog.Errorf("Failed to stop producer manager: %v", err)
-		if firstErr == nil {
-			firstErr = err
+		s.logger.Error("Failed to stop producer manager", "error", err)
+		errs = append(errs, err)
+	}
+	if err := s.traceManager.Stop(ctx); err != nil {
+		s.logger.Error("Failed to stop message trace manager", "error", err)
+		errs = append(errs, err)
+	}
+	if s.cfg.EnableConsole {
+		if err := s.consoleServer.Stop(ctx); err != nil {
+			s.logger.Error("Failed to stop console server", "error", err)
+			errs = append(errs, err)
 		}
 	}
+	if err := s.auditManager.Stop(ctx); err != nil {
+		s.logger.Error("Failed to stop audit manager", "error", err)
+		errs = append(errs, err)
+	}
 	if err := s.messageManager.Stop(ctx); err != nil {
-		klog.Errorf("Failed to stop message manager: %v", err)
-		if firstErr == nil {
-			firstErr = err
-		}
+		s.logger.Error("Failed to stop message manager", "error", err)
+		errs = append(errs, err)
 	}
 	if err := s.topicManager.Stop(ctx); err != nil {
-		klog.Errorf("Failed to stop topic manager: %v", err)
-		if firstErr == nil {
-			firstErr = err
-		}
+		s.logger.Error("Failed to stop topic manager", "error", err)
+		errs = append(errs, err)
 	}
 
 	if err := s.db.Close(); err != nil {
-		klog.Errorf("Failed to close database connection: %v", err)
-		if firstErr == nil {
-			firstErr = err
-		}
+		s.logger.Error("Failed to close database connection", "error", err)
+		errs = append(errs, err)
 	}
 
-	if firstErr != nil {
-		klog.Errorf("Failed to stop message service: %v", firstErr)
-		return firstErr
+	if err := errors.Join(errs...); err != nil {
+		s.logger.Error("Message service stopped with errors", "error", err)
+		return err
 	}
 
-	klog.Info("All message service components stopped successfully")
+	s.logger.Info("All message service components stopped successfully")
 	return nil
 }
 
 func (s *messageServiceImpl) SendSync(ctx context.Context, msg *model.Message) (string, error) {
-	klog.V(4).Infof("Sending sync message to topic %s with key %s", msg.Topic, msg.Key)
+	s.logger.Debug("Sending sync message", "topic", msg.Topic, "key", msg.Key)
 	id, err := s.producerManager.SendSync(ctx, msg)
 	if err != nil {
-		klog.Errorf("Failed to send sync message: %v", err)
+		s.logger.Error("Failed to send sync message", "topic", msg.Topic, "error", err)
 		return "", err
 	}
-	klog.V(4).Infof("Successfully sent sync message with ID %s", id)
+	s.logger.Debug("Successfully sent sync message", "topic", msg.Topic, "messageId", id)
 	return id, nil
 }
 
 func (s *messageServiceImpl) SendAsync(ctx context.Context, msg *model.Message, callback func(string, error)) error {
-	klog.V(4).Infof("Sending async message to topic %s with key %s", msg.Topic, msg.Key)
+	s.logger.Debug("Sending async message", "topic", msg.Topic, "key", msg.Key)
 	wrappedCallback := func(id string, err error) {
 		if err != nil {
-			klog.Errorf("Async message send failed: %v", err)
+			s.logger.Error("Async message send failed", "topic", msg.Topic, "error", err)
 		} else {
-			klog.V(4).Infof("Successfully sent async message with ID %s", id)
+			s.logger.Debug("Successfully sent async message", "topic", msg.Topic, "messageId", id)
 		}
 		if callback != nil {
 			callback(id, err)
@@ -207,24 +334,90 @@ func (s *messageServiceImpl) SendAsync(ctx context.Context, msg *model.Message,
 }
 
 func (s *messageServiceImpl) GroupSubscribe(ctx context.Context, topic string, group string, handler MessageHandler) error {
-	klog.Infof("Setting up group subscription for topic %s, group %s", topic, group)
+	s.logger.Info("Setting up group subscription", "topic", topic, "group", group)
 	err := s.consumerManager.Consume(ctx, topic, group, handler)
 	if err != nil {
-		klog.Errorf("Failed to set up group subscription: %v", err)
+		s.logger.Error("Failed to set up group subscription", "topic", topic, "group", group, "error", err)
 		return err
 	}
-	klog.Infof("Successfully set up group subscription for topic %s, group %s", topic, group)
+	s.logger.Info("Successfully set up group subscription", "topic", topic, "group", group)
 	return nil
 }
 
 func (s *messageServiceImpl) BroadcastSubscribe(ctx context.Context, topic string, handler MessageHandler) error {
 	broadcastGroup := "__broadcast__" + uuid.New().String()
-	klog.Infof("Setting up broadcast subscription for topic %s with group %s", topic, broadcastGroup)
+	s.logger.Info("Setting up broadcast subscription", "topic", topic, "group", broadcastGroup)
 	err := s.consumerManager.Consume(ctx, topic, broadcastGroup, handler)
 	if err != nil {
-		klog.Errorf("Failed to set up broadcast subscription: %v", err)
+		s.logger.Error("Failed to set up broadcast subscription", "topic", topic, "error", err)
 		return err
 	}
-	klog.Infof("Successfully set up broadcast subscription for topic %s", topic)
+	s.logger.Info("Successfully set up broadcast subscription", "topic", topic, "group", broadcastGroup)
 	return nil
 }
+
+func (s *messageServiceImpl) PrepareSend(ctx context.Context, msg *model.Message) (string, error) {
+	s.logger.Debug("Preparing half message", "topic", msg.Topic, "key", msg.Key)
+	id, err := s.txManager.Prepare(ctx, msg)
+	if err != nil {
+		s.logger.Error("Failed to prepare half message", "topic", msg.Topic, "error", err)
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *messageServiceImpl) Commit(ctx context.Context, messageID string) error {
+	s.logger.Debug("Committing half message", "messageId", messageID)
+	return s.txManager.Commit(ctx, messageID)
+}
+
+func (s *messageServiceImpl) Rollback(ctx context.Context, messageID string) error {
+	s.logger.Debug("Rolling back half message", "messageId", messageID)
+	return s.txManager.Rollback(ctx, messageID)
+}
+
+func (s *messageServiceImpl) RegisterTransactionChecker(topic string, checker model.TransactionChecker) {
+	s.logger.Info("Registering transaction checker", "topic", topic)
+	s.txManager.RegisterChecker(topic, checker)
+}
+
+func (s *messageServiceImpl) Request(ctx context.Context, msg *model.Message) (*model.Message, error) {
+	s.logger.Debug("Sending request", "topic", msg.Topic, "key", msg.Key)
+	reply, err := s.replyManager.Request(ctx, msg)
+	if err != nil {
+		s.logger.Error("Request failed", "topic", msg.Topic, "error", err)
+		return reply, err
+	}
+	return reply, nil
+}
+
+func (s *messageServiceImpl) Reply(ctx context.Context, request *model.Message, reply *model.Message) (string, error) {
+	s.logger.Debug("Replying to request", "messageId", request.MessageID)
+	return s.replyManager.Reply(ctx, request, reply)
+}
+
+func (s *messageServiceImpl) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+func (s *messageServiceImpl) TraceMessage(ctx context.Context, messageID string) ([]*model.TraceEvent, error) {
+	return s.traceManager.GetTrace(ctx, messageID)
+}
+
+func (s *messageServiceImpl) Health(ctx context.Context) *model.HealthReport {
+	return s.healthChecker.Check(ctx)
+}
+
+func (s *messageServiceImpl) WebhookSubscribe(ctx context.Context, sub *model.WebhookSubscription) error {
+	s.logger.Debug("Subscribing webhook", "topic", sub.Topic, "group", sub.Group)
+	return s.webhookManager.Subscribe(ctx, sub)
+}
+
+func (s *messageServiceImpl) WebhookUnsubscribe(ctx context.Context, topic string, group string) error {
+	s.logger.Debug("Unsubscribing webhook", "topic", topic, "group", group)
+	return s.webhookManager.Unsubscribe(ctx, topic, group)
+}
+
+func (s *messageServiceImpl) WebhookSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error) {
+	return s.webhookManager.GetSubscriptions(ctx)
+}
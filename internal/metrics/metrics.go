@@ -0,0 +1,340 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+const namespace = "mqx"
+
+// Handler results recorded by HandlerDone
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// scrapeTimeout bounds the database queries run while collecting scrape-time metrics
+const scrapeTimeout = time.Second * 5
+
+// OffsetReader reads the newest offset of a partition, used to compute consumer lag
+type OffsetReader interface {
+	GetMaxOffset(ctx context.Context, topic string, partition int) (int64, error)
+}
+
+// DelayQueueReader reads the state of the delay queue
+type DelayQueueReader interface {
+	GetQueueStat(ctx context.Context) (*model.DelayQueueStat, error)
+}
+
+// Metrics holds the Prometheus collectors of one MQX instance.
+// All methods are safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	sendDuration    *prometheus.HistogramVec
+	sendErrors      *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	handled         *prometheus.CounterVec
+	retries         *prometheus.CounterVec
+	deadLetters     *prometheus.CounterVec
+	committedOffset *prometheus.GaugeVec
+	rebalances      *prometheus.CounterVec
+	clearedMessages *prometheus.CounterVec
+	clearedInstance prometheus.Counter
+	state           *stateCollector
+}
+
+// New creates the collectors and registers them, together with the Go and process
+// collectors, into a registry private to this instance. Scrape-time query failures are
+// logged to logger at debug level.
+func New(offsets OffsetReader, delays DelayQueueReader, logger logging.Logger) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		sendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "producer",
+			Name:      "send_duration_seconds",
+			Help:      "Time taken to store a sent message, from send (or async enqueue) to write.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic"}),
+		sendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "producer",
+			Name:      "send_errors_total",
+			Help:      "Number of messages that failed to be stored.",
+		}, []string{"topic"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "handler_duration_seconds",
+			Help:      "Time taken by message handlers.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic", "group"}),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "handled_total",
+			Help:      "Number of handled messages by result (success or failure).",
+		}, []string{"topic", "group", "result"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "retries_total",
+			Help:      "Number of failed messages scheduled for retry.",
+		}, []string{"topic", "group"}),
+		deadLetters: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "dead_letters_total",
+			Help:      "Number of messages sent to the dead letter queue.",
+		}, []string{"topic", "group"}),
+		committedOffset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "committed_offset",
+			Help:      "Last committed offset of the partitions consumed by this instance.",
+		}, []string{"topic", "group", "partition"}),
+		rebalances: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "rebalances_total",
+			Help:      "Number of partition assignment changes written by this instance.",
+		}, []string{"topic", "group"}),
+		clearedMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "clear",
+			Name:      "deleted_messages_total",
+			Help:      "Number of expired messages deleted.",
+		}, []string{"topic"}),
+		clearedInstance: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "clear",
+			Name:      "deleted_consumer_instances_total",
+			Help:      "Number of inactive consumer instances deleted.",
+		}),
+	}
+	m.state = newStateCollector(offsets, delays, logging.OrDefault(logger))
+	m.registry.MustRegister(m.Collectors()...)
+	m.registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// Collectors returns the MQX collectors, without the Go and process collectors
+func (m *Metrics) Collectors() []prometheus.Collector {
+	if m == nil {
+		return nil
+	}
+	return []prometheus.Collector{
+		m.sendDuration, m.sendErrors, m.handlerDuration, m.handled, m.retries, m.deadLetters,
+		m.committedOffset, m.rebalances, m.clearedMessages, m.clearedInstance, m.state,
+	}
+}
+
+// Register registers the MQX collectors into an application registry
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	var errs []error
+	for _, c := range m.Collectors() {
+		if err := reg.Register(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Handler serves the private registry in the Prometheus exposition format, or 404 when metrics are not collected
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// SendDone records the outcome of storing a message
+func (m *Metrics) SendDone(topic string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.sendDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.sendErrors.WithLabelValues(topic).Inc()
+	}
+}
+
+// HandlerDone records the outcome of a handler invocation
+func (m *Metrics) HandlerDone(topic string, group string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.handlerDuration.WithLabelValues(topic, group).Observe(time.Since(start).Seconds())
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	m.handled.WithLabelValues(topic, group, result).Inc()
+}
+
+// Retried records a failed message scheduled for retry
+func (m *Metrics) Retried(topic string, group string) {
+	if m == nil {
+		return
+	}
+	m.retries.WithLabelValues(topic, group).Inc()
+}
+
+// DeadLettered records a message sent to the dead letter queue
+func (m *Metrics) DeadLettered(topic string, group string) {
+	if m == nil {
+		return
+	}
+	m.deadLetters.WithLabelValues(topic, group).Inc()
+}
+
+// OffsetCommitted records the committed offset of a partition consumed by this instance, as read
+// by its partition consumer or written by a commit; the partition is tracked for lag from then on
+func (m *Metrics) OffsetCommitted(topic string, group string, partition int, offset int64) {
+	if m == nil {
+		return
+	}
+	m.committedOffset.WithLabelValues(topic, group, strconv.Itoa(partition)).Set(float64(offset))
+	m.state.track(topic, group, partition, offset)
+}
+
+// PartitionReleased drops the offset and lag series of a partition no longer consumed by this instance
+func (m *Metrics) PartitionReleased(topic string, group string, partition int) {
+	if m == nil {
+		return
+	}
+	m.committedOffset.DeleteLabelValues(topic, group, strconv.Itoa(partition))
+	m.state.untrack(topic, group, partition)
+}
+
+// Rebalanced records a partition assignment change
+func (m *Metrics) Rebalanced(topic string, group string) {
+	if m == nil {
+		return
+	}
+	m.rebalances.WithLabelValues(topic, group).Inc()
+}
+
+// MessagesCleared records expired messages deleted from a topic
+func (m *Metrics) MessagesCleared(topic string, count int64) {
+	if m == nil || count <= 0 {
+		return
+	}
+	m.clearedMessages.WithLabelValues(topic).Add(float64(count))
+}
+
+// ConsumerInstancesCleared records inactive consumer instances deleted
+func (m *Metrics) ConsumerInstancesCleared(count int64) {
+	if m == nil || count <= 0 {
+		return
+	}
+	m.clearedInstance.Add(float64(count))
+}
+
+type partitionKey struct {
+	topic     string
+	group     string
+	partition int
+}
+
+// stateCollector computes consumer lag and delay queue state from the database at scrape time
+type stateCollector struct {
+	offsets OffsetReader
+	delays  DelayQueueReader
+	logger  logging.Logger
+
+	mu        sync.Mutex
+	committed map[partitionKey]int64
+
+	lag          *prometheus.Desc
+	delayDepth   *prometheus.Desc
+	delayOverdue *prometheus.Desc
+}
+
+func newStateCollector(offsets OffsetReader, delays DelayQueueReader, logger logging.Logger) *stateCollector {
+	return &stateCollector{
+		offsets:   offsets,
+		delays:    delays,
+		logger:    logger,
+		committed: make(map[partitionKey]int64),
+		lag: prometheus.NewDesc(prometheus.BuildFQName(namespace, "consumer", "lag"),
+			"Number of messages between the newest offset and the committed offset of the partitions consumed by this instance.",
+			[]string{"topic", "group", "partition"}, nil),
+		delayDepth: prometheus.NewDesc(prometheus.BuildFQName(namespace, "delay", "queue_depth"),
+			"Number of messages waiting in the delay queue, including retries.", nil, nil),
+		delayOverdue: prometheus.NewDesc(prometheus.BuildFQName(namespace, "delay", "overdue_seconds"),
+			"Age of the oldest delayed message that is due but not yet delivered.", nil, nil),
+	}
+}
+
+func (s *stateCollector) track(topic string, group string, partition int, offset int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed[partitionKey{topic, group, partition}] = offset
+}
+
+func (s *stateCollector) untrack(topic string, group string, partition int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.committed, partitionKey{topic, group, partition})
+}
+
+func (s *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.lag
+	ch <- s.delayDepth
+	ch <- s.delayOverdue
+}
+
+func (s *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	s.mu.Lock()
+	committed := make(map[partitionKey]int64, len(s.committed))
+	for k, v := range s.committed {
+		committed[k] = v
+	}
+	s.mu.Unlock()
+
+	if s.offsets != nil {
+		for k, offset := range committed {
+			maxOffset, err := s.offsets.GetMaxOffset(ctx, k.topic, k.partition)
+			if err != nil {
+				s.logger.Debug("Failed to get max offset for lag metric", "topic", k.topic, "partition", k.partition, "error", err)
+				continue
+			}
+			lag := maxOffset - offset
+			if lag < 0 {
+				lag = 0
+			}
+			ch <- prometheus.MustNewConstMetric(s.lag, prometheus.GaugeValue, float64(lag), k.topic, k.group, strconv.Itoa(k.partition))
+		}
+	}
+
+	if s.delays != nil {
+		stat, err := s.delays.GetQueueStat(ctx)
+		if err != nil {
+			s.logger.Debug("Failed to get delay queue stat for metrics", "error", err)
+			return
+		}
+		overdue := 0.0
+		if !stat.OldestDelayTime.IsZero() {
+			if age := time.Since(stat.OldestDelayTime); age > 0 {
+				overdue = age.Seconds()
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(s.delayDepth, prometheus.GaugeValue, float64(stat.Depth))
+		ch <- prometheus.MustNewConstMetric(s.delayOverdue, prometheus.GaugeValue, overdue)
+	}
+}
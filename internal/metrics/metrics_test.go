@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+type fakeOffsetReader map[int]int64
+
+func (f fakeOffsetReader) GetMaxOffset(ctx context.Context, topic string, partition int) (int64, error) {
+	return f[partition], nil
+}
+
+type fakeDelayQueueReader struct {
+	stat *model.DelayQueueStat
+}
+
+func (f fakeDelayQueueReader) GetQueueStat(ctx context.Context) (*model.DelayQueueStat, error) {
+	return f.stat, nil
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+	m.SendDone("topic", time.Now(), nil)
+	m.HandlerDone("topic", "group", time.Now(), errors.New("failed"))
+	m.Retried("topic", "group")
+	m.DeadLettered("topic", "group")
+	m.OffsetCommitted("topic", "group", 0, 1)
+	m.PartitionReleased("topic", "group", 0)
+	m.Rebalanced("topic", "group")
+	m.MessagesCleared("topic", 1)
+	m.ConsumerInstancesCleared(1)
+	assert.NoError(t, m.Register(prometheus.NewRegistry()))
+}
+
+func TestMetrics_Counters(t *testing.T) {
+	m := New(nil, nil, nil)
+
+	m.SendDone("orders", time.Now(), nil)
+	m.SendDone("orders", time.Now(), errors.New("failed"))
+	m.HandlerDone("orders", "billing", time.Now(), nil)
+	m.HandlerDone("orders", "billing", time.Now(), errors.New("failed"))
+	m.HandlerDone("orders", "billing", time.Now(), errors.New("failed"))
+	m.Retried("orders", "billing")
+	m.DeadLettered("orders", "billing")
+	m.MessagesCleared("orders", 5)
+	m.ConsumerInstancesCleared(2)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.sendErrors.WithLabelValues("orders")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.handled.WithLabelValues("orders", "billing", ResultSuccess)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.handled.WithLabelValues("orders", "billing", ResultFailure)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.retries.WithLabelValues("orders", "billing")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.deadLetters.WithLabelValues("orders", "billing")))
+	assert.Equal(t, 5.0, testutil.ToFloat64(m.clearedMessages.WithLabelValues("orders")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.clearedInstance))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.sendDuration))
+}
+
+func TestMetrics_LagAndDelayQueue(t *testing.T) {
+	m := New(fakeOffsetReader{0: 10, 1: 3}, fakeDelayQueueReader{stat: &model.DelayQueueStat{Depth: 4}}, nil)
+
+	m.OffsetCommitted("orders", "billing", 0, 7)
+	m.OffsetCommitted("orders", "billing", 1, 3)
+
+	expected := `
+# HELP mqx_consumer_lag Number of messages between the newest offset and the committed offset of the partitions consumed by this instance.
+# TYPE mqx_consumer_lag gauge
+mqx_consumer_lag{group="billing",partition="0",topic="orders"} 3
+mqx_consumer_lag{group="billing",partition="1",topic="orders"} 0
+# HELP mqx_delay_queue_depth Number of messages waiting in the delay queue, including retries.
+# TYPE mqx_delay_queue_depth gauge
+mqx_delay_queue_depth 4
+# HELP mqx_delay_overdue_seconds Age of the oldest delayed message that is due but not yet delivered.
+# TYPE mqx_delay_overdue_seconds gauge
+mqx_delay_overdue_seconds 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(m.state, strings.NewReader(expected)))
+
+	m.PartitionReleased("orders", "billing", 1)
+	assert.Equal(t, 3, testutil.CollectAndCount(m.state))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.committedOffset))
+}
+
+func TestMetrics_Register(t *testing.T) {
+	m := New(nil, nil, nil)
+	reg := prometheus.NewRegistry()
+
+	assert.NoError(t, m.Register(reg))
+	// Registering twice reports the duplicates
+	assert.Error(t, m.Register(reg))
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Results of an audited action
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// AuditEntry records a mutating console action
+type AuditEntry struct {
+	ID       int64     `json:"id"`
+	User     string    `json:"user"`
+	Role     string    `json:"role"`
+	Action   string    `json:"action"`           // e.g. topic.create, message.send
+	Target   string    `json:"target"`           // The topic or group acted on
+	Before   string    `json:"before,omitempty"` // JSON state before the action
+	After    string    `json:"after,omitempty"`  // JSON state requested by the action
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+	ClientIP string    `json:"clientIp"`
+	Time     time.Time `json:"time"`
+}
+
+// AuditFilter selects audit entries; empty fields match everything
+type AuditFilter struct {
+	User     string
+	Action   string
+	Target   string
+	From     time.Time // Inclusive
+	To       time.Time // Exclusive
+	PageNo   int
+	PageSize int
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type ConsumerOffset struct {
 	Group      string `json:"group"`
 	Topic      string `json:"topic"`
@@ -7,3 +9,36 @@ type ConsumerOffset struct {
 	Offset     int64  `json:"offset"`
 	InstanceID string `json:"instanceId"`
 }
+
+// OffsetResetTarget is the position an offset reset moves a consumer group to
+type OffsetResetTarget string
+
+const (
+	// OffsetResetEarliest moves before the oldest stored message
+	OffsetResetEarliest OffsetResetTarget = "earliest"
+	// OffsetResetLatest moves after the newest stored message, skipping the backlog
+	OffsetResetLatest OffsetResetTarget = "latest"
+	// OffsetResetOffset moves before the message at Offset, which is consumed next
+	OffsetResetOffset OffsetResetTarget = "offset"
+	// OffsetResetTime moves before the first message born at or after Time. The born time is set by
+	// the producer, so a message of a producer with a late clock may be stored after that position.
+	OffsetResetTime OffsetResetTarget = "time"
+)
+
+// OffsetReset moves the committed offsets of a consumer group of a topic
+type OffsetReset struct {
+	Topic     string            `json:"topic"`
+	Group     string            `json:"group"`
+	Partition *int              `json:"partition,omitempty"` // nil for all partitions
+	Target    OffsetResetTarget `json:"target"`
+	Offset    int64             `json:"offset,omitempty"` // Next offset consumed, for OffsetResetOffset
+	Time      time.Time         `json:"time,omitempty"`   // Born time, for OffsetResetTime
+	DryRun    bool              `json:"dryRun,omitempty"` // Only compute the new offsets
+}
+
+// OffsetResetResult is the committed offset of a partition before and after a reset
+type OffsetResetResult struct {
+	Partition int   `json:"partition"`
+	Before    int64 `json:"before"`
+	After     int64 `json:"after"`
+}
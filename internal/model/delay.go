@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// DelayQueueStat describes the content of the delay queue
+type DelayQueueStat struct {
+	Depth           int64     `json:"depth"`           // Number of waiting messages, including retries
+	OldestDelayTime time.Time `json:"oldestDelayTime"` // Earliest delivery time, zero when the queue is empty
+}
+
+// DelayFilter selects waiting delayed and retry messages; empty fields match everything
+type DelayFilter struct {
+	Topic    string
+	PageNo   int
+	PageSize int
+}
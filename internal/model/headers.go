@@ -0,0 +1,56 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// ReservedHeaderPrefix starts the names of the headers set by mqx itself
+const ReservedHeaderPrefix = "mqx-"
+
+// Well-known message headers
+const (
+	HeaderCorrelationID = "mqx-correlation-id"
+	HeaderReplyTo       = "mqx-reply-to"
+	HeaderReplyError    = "mqx-reply-error"
+	HeaderContentType   = "mqx-content-type"
+	// HeaderTargetGroup limits the delivery of a message to one consumer group, the other groups skip it
+	HeaderTargetGroup = "mqx-target-group"
+	// HeaderReplayOf holds the ID of the message a resent or replayed message is a copy of
+	HeaderReplayOf = "mqx-replay-of"
+	// HeaderDeadLetterGroup holds the consumer group that failed a dead lettered message
+	HeaderDeadLetterGroup = "mqx-dead-letter-group"
+	// HeaderRedrivenAt holds the time, in RFC 3339, a dead lettered message was published to its topic again
+	HeaderRedrivenAt = "mqx-redriven-at"
+)
+
+// IsReservedHeader reports whether a header name belongs to mqx. Clients of the gateway may not set them,
+// since they change how a message is routed, e.g. to a single consumer group or to a reply topic.
+func IsReservedHeader(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), ReservedHeaderPrefix)
+}
+
+// EncodeHeaders serializes message headers for storage, returning NULL for empty headers
+func EncodeHeaders(headers map[string]string) sql.NullString {
+	if len(headers) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(headers)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// DecodeHeaders deserializes stored message headers, tolerating NULL and malformed values
+func DecodeHeaders(value sql.NullString) map[string]string {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(value.String), &headers); err != nil {
+		return nil
+	}
+	return headers
+}
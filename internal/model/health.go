@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// Health statuses
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+// HealthCheck is the result of one health check
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PartitionHealth is the consumption status of a partition assigned to this instance
+type PartitionHealth struct {
+	Partition int       `json:"partition"`
+	LastPoll  time.Time `json:"lastPoll"` // Last successful fetch, zero before the first one
+}
+
+// SubscriptionHealth is the status of a subscription of this instance
+type SubscriptionHealth struct {
+	Topic         string            `json:"topic"`
+	Group         string            `json:"group"`
+	Status        string            `json:"status"`
+	LastHeartbeat time.Time         `json:"lastHeartbeat"` // Last successful heartbeat of this instance in the group
+	Partitions    []PartitionHealth `json:"partitions"`    // Partitions currently assigned to this instance
+}
+
+// HealthReport is the health of an MQX instance.
+// Live is false when a background loop is wedged and only a restart helps;
+// Ready is false when any check or subscription is down.
+type HealthReport struct {
+	Status        string               `json:"status"`
+	Live          bool                 `json:"live"`
+	Ready         bool                 `json:"ready"`
+	Checks        []HealthCheck        `json:"checks"`
+	Subscriptions []SubscriptionHealth `json:"subscriptions"`
+	Time          time.Time            `json:"time"`
+}
@@ -1,24 +1,68 @@
 package model
 
-import "time"
+import (
+	"encoding/base64"
+	"time"
+	"unicode/utf8"
+)
 
 type Message struct {
-	MessageID string        `json:"messageId"`
-	BornTime  time.Time     `json:"bornTime"`
-	Topic     string        `json:"topic"`
-	Key       string        `json:"key"`
-	Tag       string        `json:"tag"`
-	Body      []byte        `json:"body"`
-	Partition int           `json:"partition"`
-	Offset     int64         `json:"offset"`
-	Delay      time.Duration `json:"delay"`
-	RetryCount int           `json:"retryCount"`
+	MessageID  string            `json:"messageId"`
+	BornTime   time.Time         `json:"bornTime"`
+	Topic      string            `json:"topic"`
+	Key        string            `json:"key"`
+	Tag        string            `json:"tag"`
+	Body       []byte            `json:"body"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Partition  int               `json:"partition"`
+	Offset     int64             `json:"offset"`
+	Delay      time.Duration     `json:"delay"`
+	RetryCount int               `json:"retryCount"`
+}
+
+// HTTPMessage is a message as exchanged with HTTP clients, by the gateway and the webhooks
+type HTTPMessage struct {
+	MessageID string            `json:"messageId"`
+	Topic     string            `json:"topic"`
+	Partition int               `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Key       string            `json:"key,omitempty"`
+	Tag       string            `json:"tag,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	// Body holds a UTF-8 body; any other body is base64 encoded in BodyBase64
+	Body       string    `json:"body,omitempty"`
+	BodyBase64 string    `json:"bodyBase64,omitempty"`
+	BornTime   time.Time `json:"bornTime"`
+	RetryCount int       `json:"retryCount"`
+}
+
+// NewHTTPMessage converts a stored message for the HTTP clients
+func NewHTTPMessage(msg *Message) *HTTPMessage {
+	m := &HTTPMessage{
+		MessageID:  msg.MessageID,
+		Topic:      msg.Topic,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		Key:        msg.Key,
+		Tag:        msg.Tag,
+		Headers:    msg.Headers,
+		BornTime:   msg.BornTime,
+		RetryCount: msg.RetryCount,
+	}
+	if utf8.Valid(msg.Body) {
+		m.Body = string(msg.Body)
+	} else {
+		m.BodyBase64 = base64.StdEncoding.EncodeToString(msg.Body)
+	}
+	return m
 }
 
 type DelayMessage struct {
 	ID int64 `json:"id"`
 	Message
 	RetryCount int `json:"retryCount"`
+	// DelayTime is when the message is delivered to its topic
+	DelayTime time.Time `json:"delayTime"`
 }
 
 type RetryMessage struct {
@@ -26,3 +70,27 @@ type RetryMessage struct {
 	RetryCount int
 	Delay      time.Duration
 }
+
+// MessageFilter selects the messages of a topic for a search
+type MessageFilter struct {
+	Topic      string
+	Partition  *int // nil to search all partitions
+	MessageID  string
+	Tag        string
+	Key        string
+	From       time.Time // Inclusive lower bound of the born time, zero for none
+	To         time.Time // Exclusive upper bound of the born time, zero for none
+	FromOffset int64     // Inclusive lower bound of the offset, 0 for none
+	ToOffset   int64     // Inclusive upper bound of the offset, 0 for none
+	Cursor     string    // NextCursor of the previous page, empty for the first page
+	PageSize   int
+}
+
+// MessagePage is one page of a message search, newest first
+type MessagePage struct {
+	Messages []*Message `json:"messages"`
+	// Total is the number of matching messages, counted for the first page only
+	Total *int64 `json:"total,omitempty"`
+	// NextCursor continues the search after this page, empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// ReplayRequest selects stored messages of a topic to publish again to one consumer group.
+// It needs an offset range, which also needs a partition, or a born time window.
+type ReplayRequest struct {
+	Topic      string    `json:"topic"`
+	Group      string    `json:"group"`
+	Partition  *int      `json:"partition,omitempty"`  // nil for all partitions
+	FromOffset int64     `json:"fromOffset,omitempty"` // Inclusive, 0 for none
+	ToOffset   int64     `json:"toOffset,omitempty"`   // Inclusive, 0 for none
+	From       time.Time `json:"from,omitempty"`       // Inclusive lower bound of the born time
+	To         time.Time `json:"to,omitempty"`         // Exclusive upper bound of the born time
+	DryRun     bool      `json:"dryRun,omitempty"`     // Only count the selected messages
+}
+
+// ReplayResult is the outcome of a replay
+type ReplayResult struct {
+	Matched  int64 `json:"matched"`           // Number of messages selected
+	Replayed int64 `json:"replayed"`          // Number of copies published, 0 for a dry run
+	Skipped  int64 `json:"skipped,omitempty"` // Number of selected dead letters left out as redriven before
+	DryRun   bool  `json:"dryRun"`
+}
+
+// RedriveRequest selects dead lettered messages of a topic to publish to the topic again.
+// Without selection it takes the whole dead letter queue.
+type RedriveRequest struct {
+	Topic      string    `json:"topic"`                // The topic, not its dead letter queue
+	Group      string    `json:"group,omitempty"`      // Only the messages dead lettered by this group, empty for all
+	MessageIDs []string  `json:"messageIds,omitempty"` // Only these messages, empty for all
+	From       time.Time `json:"from,omitempty"`       // Inclusive lower bound of the born time
+	To         time.Time `json:"to,omitempty"`         // Exclusive upper bound of the born time
+	DryRun     bool      `json:"dryRun,omitempty"`     // Only count the selected messages
+}
@@ -1,7 +1,48 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTopic is wrapped by the errors of topic names that cannot be used
+var ErrInvalidTopic = errors.New("invalid topic name")
+
+// ErrTopicNotFound is wrapped by the errors of lookups of topics that do not exist
+var ErrTopicNotFound = errors.New("topic not found")
+
+// MaxTopicLength is the maximum length of a topic name
+const MaxTopicLength = 256
+
+// ValidateTopic checks that a topic name only holds letters, digits, underscores and
+// hyphens, which are safe in the name of its message table, and is not too long
+func ValidateTopic(topic string) error {
+	for _, c := range topic {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-') {
+			return ErrInvalidTopic
+		}
+	}
+	if len(topic) > MaxTopicLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidTopic, topic, MaxTopicLength)
+	}
+	return nil
+}
+
 type TopicMeta struct {
 	Topic         string `json:"topic"`
 	PartitionNum  int    `json:"partitionNum"`
 	RetentionDays int    `json:"retentionDays"`
 }
+
+// DeadLetterTopic returns the topic holding the messages of a topic that failed all their retries
+func DeadLetterTopic(topic string) string {
+	return topic + "_dead"
+}
+
+// Reply topics are created by each instance for the replies to its requests. The instance
+// keeps a heartbeat under ReplyGroup on its reply topic, so the topic can be deleted once
+// the instance is gone.
+const (
+	ReplyTopicPrefix = "mqx_reply_"
+	ReplyGroup       = "mqx-reply"
+)
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// TraceEventType is a step in the lifecycle of a message
+type TraceEventType string
+
+const (
+	TraceProduced       TraceEventType = "produced"        // Stored in a partition of its topic
+	TraceDelayScheduled TraceEventType = "delay_scheduled" // Stored in the delay queue
+	TraceDelayDelivered TraceEventType = "delay_delivered" // Moved from the delay queue to its topic
+	TraceConsumed       TraceEventType = "consumed"        // Handled by a consumer group, successfully or not
+	TraceRetryScheduled TraceEventType = "retry_scheduled" // Put back in the delay queue after a failed delivery
+	TraceDeadLettered   TraceEventType = "dead_lettered"   // Stored in the dead letter topic
+)
+
+// Results of a consumed event
+const (
+	TraceResultSuccess = "success"
+	TraceResultFailure = "failure"
+)
+
+// TraceEvent records one step in the lifecycle of a message
+type TraceEvent struct {
+	ID         int64          `json:"id"`
+	MessageID  string         `json:"messageId"`
+	Topic      string         `json:"topic"`
+	Event      TraceEventType `json:"event"`
+	Group      string         `json:"group,omitempty"`
+	InstanceID string         `json:"instanceId,omitempty"`
+	Partition  int            `json:"partition"`
+	Offset     int64          `json:"offset"`
+	RetryCount int            `json:"retryCount"`
+	Result     string         `json:"result,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	DelayTime  time.Time      `json:"delayTime,omitempty"` // Delivery time of delay and retry events
+	Time       time.Time      `json:"time"`
+}
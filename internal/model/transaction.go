@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// TransactionState is the resolution reported for a half message
+type TransactionState int
+
+const (
+	TransactionUnknown TransactionState = iota
+	TransactionCommit
+	TransactionRollback
+)
+
+type HalfMessage struct {
+	ID int64 `json:"id"`
+	Message
+	CheckTime  time.Time `json:"checkTime"`
+	CheckTimes int       `json:"checkTimes"`
+}
+
+// TransactionChecker resolves a half message left unresolved past the transaction timeout
+type TransactionChecker func(topic string, messageID string) TransactionState
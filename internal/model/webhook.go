@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// WebhookSubscription pushes the messages of a consumer group of a topic to a URL
+type WebhookSubscription struct {
+	Topic string `json:"topic"`
+	Group string `json:"group"`
+	URL   string `json:"url"`
+	// Secret is the HMAC key signing the deliveries; it is never returned
+	Secret string `json:"-"`
+	// Concurrency caps the deliveries in flight, divided among the instances running the subscription
+	// with at least one each, 0 for no limit. A partition delivers one message at a time, so an instance
+	// never has more deliveries in flight than partitions assigned.
+	Concurrency int `json:"concurrency"`
+	// RateLimit caps the deliveries per second, divided among the instances running the subscription, 0 for no limit
+	RateLimit float64 `json:"rateLimit"`
+	// TimeoutMs bounds a delivery, 0 for the configured default
+	TimeoutMs   int64     `json:"timeoutMs"`
+	CreatedTime time.Time `json:"createdTime"`
+	UpdatedTime time.Time `json:"updatedTime"`
+}
@@ -0,0 +1,208 @@
+package msgtrace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/template"
+)
+
+// ErrDisabled is returned when querying message traces while message tracing is disabled
+var ErrDisabled = errors.New("message trace is disabled")
+
+const (
+	bufferSize = 10000
+	batchSize  = 100
+	linger     = time.Millisecond * 200
+)
+
+// Manager records the lifecycle of messages in the message trace table.
+// Events are written in batches by a background writer so recording never blocks
+// producers or consumers; events are dropped when the buffer is full.
+// All methods are safe to call on a nil *Manager, which records nothing.
+type Manager struct {
+	db     *sql.DB
+	logger logging.Logger
+
+	// mu guards closed and buffer against Record calls racing with Stop
+	mu     sync.RWMutex
+	closed bool
+	buffer chan *model.TraceEvent
+	// done is closed when the writer has flushed the buffer and exited
+	done chan struct{}
+}
+
+// New creates a message trace manager
+func New(db *sql.DB, logger logging.Logger) *Manager {
+	return &Manager{db: db, logger: logging.OrDefault(logger)}
+}
+
+// NewEvent creates an event of a message, filling the fields known from the message
+func NewEvent(msg *model.Message, event model.TraceEventType) *model.TraceEvent {
+	return &model.TraceEvent{
+		MessageID:  msg.MessageID,
+		Topic:      msg.Topic,
+		Event:      event,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		RetryCount: msg.RetryCount,
+		Time:       time.Now(),
+	}
+}
+
+// Start creates the trace table and starts the writer
+func (m *Manager) Start(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	if _, err := m.db.ExecContext(ctx, template.CreateMessageTraceTable); err != nil {
+		return fmt.Errorf("failed to create message trace table: %w", err)
+	}
+	m.mu.Lock()
+	m.buffer = make(chan *model.TraceEvent, bufferSize)
+	m.done = make(chan struct{})
+	m.mu.Unlock()
+	go m.write()
+	return nil
+}
+
+// Stop rejects new events and waits for the buffered ones to be written up to the ctx deadline
+func (m *Manager) Stop(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	if m.closed || m.buffer == nil {
+		m.closed = true
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.buffer)
+	m.mu.Unlock()
+
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("abandoned %d buffered message trace events: %w", len(m.buffer), ctx.Err())
+	}
+}
+
+// Record queues an event for writing
+func (m *Manager) Record(event *model.TraceEvent) {
+	if m == nil {
+		return
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed || m.buffer == nil {
+		return
+	}
+	select {
+	case m.buffer <- event:
+	default:
+		m.logger.Debug("Message trace buffer is full, dropping event", "messageId", event.MessageID, "event", event.Event)
+	}
+}
+
+// GetTrace returns the events of a message in chronological order
+func (m *Manager) GetTrace(ctx context.Context, messageID string) ([]*model.TraceEvent, error) {
+	if m == nil {
+		return nil, ErrDisabled
+	}
+	rows, err := m.db.QueryContext(ctx, template.GetMessageTraces, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message trace: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]*model.TraceEvent, 0)
+	for rows.Next() {
+		var event model.TraceEvent
+		var errText sql.NullString
+		var delayTime sql.NullTime
+		if err := rows.Scan(&event.ID, &event.MessageID, &event.Topic, &event.Event, &event.Group, &event.InstanceID,
+			&event.Partition, &event.Offset, &event.RetryCount, &event.Result, &errText, &delayTime, &event.Time); err != nil {
+			return nil, fmt.Errorf("failed to scan message trace row: %w", err)
+		}
+		event.Error = errText.String
+		if delayTime.Valid {
+			event.DelayTime = delayTime.Time
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteBefore deletes the events recorded before a time and returns how many were deleted
+func (m *Manager) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+	result, err := m.db.ExecContext(ctx, template.DeleteMessageTraces, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// write collects buffered events into batches, writing a batch when it is full or
+// its oldest event has waited for the linger time
+func (m *Manager) write() {
+	defer close(m.done)
+	errLog := logging.NewThrottle(m.logger, 0)
+	batch := make([]*model.TraceEvent, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := m.insert(batch); err != nil {
+			errLog.Error("Failed to write message trace events", "count", len(batch), "error", err)
+		} else {
+			errLog.Reset()
+		}
+		batch = batch[:0]
+	}
+
+	ticker := time.NewTicker(linger)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-m.buffer:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (m *Manager) insert(events []*model.TraceEvent) error {
+	rows := make([]string, len(events))
+	args := make([]any, 0, len(events)*12)
+	for i, event := range events {
+		rows[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		var delayTime sql.NullTime
+		if !event.DelayTime.IsZero() {
+			delayTime = sql.NullTime{Time: event.DelayTime, Valid: true}
+		}
+		args = append(args, event.MessageID, event.Topic, string(event.Event), event.Group, event.InstanceID,
+			event.Partition, event.Offset, event.RetryCount, event.Result, event.Error, delayTime, event.Time)
+	}
+	_, err := m.db.Exec(fmt.Sprintf(template.InsertMessageTraces, strings.Join(rows, ", ")), args...)
+	return err
+}
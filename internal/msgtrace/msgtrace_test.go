@@ -0,0 +1,94 @@
+package msgtrace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func TestManager_RecordFlushesOnStop(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	m := New(db, logging.Discard())
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS mqx_message_traces").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, m.Start(context.Background()))
+
+	msg := &model.Message{MessageID: "msg-1", Topic: "test-topic", Partition: 2, Offset: 7}
+	consumed := NewEvent(msg, model.TraceConsumed)
+	consumed.Group = "group-1"
+	consumed.Result = model.TraceResultFailure
+	consumed.Error = "boom"
+	mock.ExpectExec("INSERT INTO mqx_message_traces").
+		WithArgs(
+			"msg-1", "test-topic", "produced", "", "", 2, int64(7), 0, "", "", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			"msg-1", "test-topic", "consumed", "group-1", "", 2, int64(7), 0, "failure", "boom", sqlmock.AnyArg(), sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+
+	m.Record(NewEvent(msg, model.TraceProduced))
+	m.Record(consumed)
+	assert.NoError(t, m.Stop(context.Background()))
+
+	// Events recorded after Stop are dropped
+	m.Record(NewEvent(msg, model.TraceProduced))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_GetTrace(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	m := New(db, logging.Discard())
+	produced := time.Now().Add(-time.Minute)
+	delayTime := time.Now().Add(time.Minute)
+	rows := sqlmock.NewRows([]string{"id", "message_id", "topic", "event", "group_name", "instance_id",
+		"partition_num", "offset", "retry_count", "result", "error", "delay_time", "event_time"}).
+		AddRow(1, "msg-1", "test-topic", "produced", "", "", 0, 0, 0, "", nil, nil, produced).
+		AddRow(2, "msg-1", "test-topic", "retry_scheduled", "group-1", "instance-1", 0, 3, 1, "", nil, delayTime, time.Now())
+	mock.ExpectQuery("SELECT (.+) FROM mqx_message_traces").WithArgs("msg-1").WillReturnRows(rows)
+
+	events, err := m.GetTrace(context.Background(), "msg-1")
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, model.TraceProduced, events[0].Event)
+	assert.True(t, events[0].DelayTime.IsZero())
+	assert.Equal(t, model.TraceRetryScheduled, events[1].Event)
+	assert.Equal(t, "group-1", events[1].Group)
+	assert.Equal(t, 1, events[1].RetryCount)
+	assert.True(t, events[1].DelayTime.Equal(delayTime))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_DeleteBefore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	m := New(db, logging.Discard())
+	before := time.Now().Add(-time.Hour * 24)
+	mock.ExpectExec("DELETE FROM mqx_message_traces").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 5))
+
+	deleted, err := m.DeleteBefore(context.Background(), before)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_Nil(t *testing.T) {
+	var m *Manager
+	m.Record(&model.TraceEvent{MessageID: "msg-1"})
+	assert.NoError(t, m.Start(context.Background()))
+	assert.NoError(t, m.Stop(context.Background()))
+
+	_, err := m.GetTrace(context.Background(), "msg-1")
+	assert.True(t, errors.Is(err, ErrDisabled))
+}
@@ -2,43 +2,327 @@ package producer
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
+	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
 	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+	"github.com/wenzuojing/mqx/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrProducerClosed is returned when sending asynchronously after the producer stopped
+	ErrProducerClosed = errors.New("producer is closed")
+	// ErrBufferFull is returned by SendAsync in fail-fast mode when the send buffer is full
+	ErrBufferFull = errors.New("async send buffer is full")
+)
+
+// Defaults used when the async settings are left unset
+const (
+	defaultAsyncBufferSize = 10000
+	defaultAsyncBatchSize  = 100
+	defaultAsyncLinger     = time.Millisecond * 10
 )
 
 // ProducerManager handles message production and sending operations
-func NewProducerManager(factory interfaces.Factory) (interfaces.ProducerManager, error) {
+func NewProducerManager(cfg *config.Config, factory interfaces.Factory) (interfaces.ProducerManager, error) {
 	return &producerManagerImpl{
+		cfg:     cfg,
 		factory: factory,
 	}, nil
 }
 
+// asyncSend is a message waiting in the async send buffer
+type asyncSend struct {
+	ctx      context.Context
+	msg      *model.Message
+	callback func(string, error)
+	enqueued time.Time
+	span     trace.Span
+}
+
 type producerManagerImpl struct {
+	cfg     *config.Config
 	factory interfaces.Factory
+	// mu guards closed and buffer against SendAsync calls racing with Stop. It is not held
+	// while waiting for room in the buffer, so that Stop is not held up by blocked senders.
+	mu     sync.RWMutex
+	closed bool
+	buffer chan *asyncSend
+	// closing is closed by Stop to release the blocked senders and have the dispatcher flush the buffer
+	closing chan struct{}
+	// senders counts the SendAsync calls that got past the closed check and may still add to the buffer
+	senders sync.WaitGroup
+	// callbacks runs the callbacks apart from the dispatcher, so that a callback sending
+	// again cannot block the only goroutine draining the buffer
+	callbacks *callbackQueue
+	// done is closed once the dispatcher has flushed the buffer and every callback has run
+	done chan struct{}
 }
 
 // SendSync sends a message synchronously, using delay queue if delay is set
-func (p *producerManagerImpl) SendSync(ctx context.Context, msg *model.Message) (string, error) {
+func (p *producerManagerImpl) SendSync(ctx context.Context, msg *model.Message) (id string, err error) {
+	start := time.Now()
+	ctx, span := p.factory.GetTracer().StartSend(ctx, msg)
+	defer func() {
+		p.factory.GetTracer().SendDone(span, msg, err)
+		p.factory.GetMetrics().SendDone(msg.Topic, start, err)
+	}()
+	return p.send(ctx, msg)
+}
+
+// send stores a message, using delay queue if delay is set
+func (p *producerManagerImpl) send(ctx context.Context, msg *model.Message) (string, error) {
 	if msg.Delay > 0 {
 		return p.factory.GetDelayManager().Add(ctx, msg)
 	}
-	return p.factory.GetMessageManager().SaveMessage(ctx, msg)
+	id, err := p.factory.GetMessageManager().SaveMessage(ctx, msg)
+	if err == nil {
+		p.factory.GetTraceManager().Record(msgtrace.NewEvent(msg, model.TraceProduced))
+	}
+	return id, err
 }
 
-// SendAsync sends a message asynchronously and invokes callback with the result
+// SendAsync buffers a message and invokes callback once its batch has been written.
+// When the buffer is full it blocks until there is room or ctx is done, or fails with
+// ErrBufferFull right away in fail-fast mode.
 func (p *producerManagerImpl) SendAsync(ctx context.Context, msg *model.Message, callback func(string, error)) error {
-	go func() {
-		id, err := p.SendSync(context.WithoutCancel(ctx), msg)
-		callback(id, err)
-	}()
-	return nil
+	p.mu.RLock()
+	if p.closed || p.buffer == nil {
+		p.mu.RUnlock()
+		return ErrProducerClosed
+	}
+	buffer, closing := p.buffer, p.closing
+	p.senders.Add(1)
+	p.mu.RUnlock()
+	defer p.senders.Done()
+
+	// The producer span covers the time spent in the buffer and ends once the batch is written
+	spanCtx, span := p.factory.GetTracer().StartSend(ctx, msg)
+	item := &asyncSend{ctx: context.WithoutCancel(spanCtx), msg: msg, callback: callback, enqueued: time.Now(), span: span}
+	if p.cfg.AsyncFailFast {
+		select {
+		case buffer <- item:
+			return nil
+		case <-closing:
+			tracing.End(span, ErrProducerClosed)
+			return ErrProducerClosed
+		default:
+			tracing.End(span, ErrBufferFull)
+			return ErrBufferFull
+		}
+	}
+	select {
+	case buffer <- item:
+		return nil
+	case <-closing:
+		tracing.End(span, ErrProducerClosed)
+		return ErrProducerClosed
+	case <-ctx.Done():
+		tracing.End(span, ctx.Err())
+		return ctx.Err()
+	}
 }
 
 func (p *producerManagerImpl) Start(ctx context.Context) error {
+	bufferSize := p.cfg.AsyncBufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultAsyncBufferSize
+	}
+	p.mu.Lock()
+	p.buffer = make(chan *asyncSend, bufferSize)
+	p.closing = make(chan struct{})
+	p.done = make(chan struct{})
+	p.callbacks = newCallbackQueue()
+	p.mu.Unlock()
+	go p.dispatch()
+	go p.callbacks.run(p.done)
 	return nil
 }
 
+// Stop rejects new async sends and waits for the buffered ones to be flushed up to the ctx deadline
 func (p *producerManagerImpl) Stop(ctx context.Context) error {
-	return nil
+	p.mu.Lock()
+	if p.closed || p.buffer == nil {
+		p.closed = true
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closing)
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("abandoned %d buffered async sends: %w", len(p.buffer), ctx.Err())
+	}
+}
+
+// dispatch collects buffered messages into per-topic batches and writes a batch when it
+// reaches the batch size or its oldest message has waited for the linger time
+func (p *producerManagerImpl) dispatch() {
+	defer p.callbacks.close()
+	batchSize := p.cfg.AsyncBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultAsyncBatchSize
+	}
+	linger := p.cfg.AsyncLinger
+	if linger <= 0 {
+		linger = defaultAsyncLinger
+	}
+
+	batches := make(map[string][]*asyncSend)
+	flushAll := func() {
+		for topic, batch := range batches {
+			p.flush(batch)
+			delete(batches, topic)
+		}
+	}
+	ticker := time.NewTicker(linger)
+	defer ticker.Stop()
+	for {
+		select {
+		case item := <-p.buffer:
+			p.collect(batches, item, batchSize)
+		case <-ticker.C:
+			flushAll()
+		case <-p.closing:
+			p.drain(batches, batchSize)
+			flushAll()
+			return
+		}
+	}
+}
+
+// collect adds a message to the batch of its topic, writing the batch once it is full
+func (p *producerManagerImpl) collect(batches map[string][]*asyncSend, item *asyncSend, batchSize int) {
+	// Delayed messages go through the delay queue one by one
+	if item.msg.Delay > 0 {
+		id, err := p.send(item.ctx, item.msg)
+		p.sent(item, err)
+		p.callbacks.push(item.callback, id, err)
+		return
+	}
+	topic := item.msg.Topic
+	batches[topic] = append(batches[topic], item)
+	if len(batches[topic]) >= batchSize {
+		p.flush(batches[topic])
+		delete(batches, topic)
+	}
+}
+
+// drain collects the messages left in the buffer after Stop. The senders that got past the closed
+// check may still add to the buffer, so it keeps reading until every one of them has returned.
+func (p *producerManagerImpl) drain(batches map[string][]*asyncSend, batchSize int) {
+	sendersDone := make(chan struct{})
+	go func() {
+		p.senders.Wait()
+		close(sendersDone)
+	}()
+	for {
+		select {
+		case item := <-p.buffer:
+			p.collect(batches, item, batchSize)
+		case <-sendersDone:
+			for {
+				select {
+				case item := <-p.buffer:
+					p.collect(batches, item, batchSize)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes a batch of messages of one topic and reports the result to every callback.
+// The batch is written in the context of its first message, which carries that message's span.
+func (p *producerManagerImpl) flush(batch []*asyncSend) {
+	msgs := make([]*model.Message, len(batch))
+	for i, item := range batch {
+		msgs[i] = item.msg
+	}
+	err := p.factory.GetMessageManager().SaveMessages(batch[0].ctx, msgs)
+	if err != nil {
+		p.factory.GetLogger().Error("Failed to write batch of messages", "topic", msgs[0].Topic, "count", len(msgs), "error", err)
+	}
+	for _, item := range batch {
+		p.sent(item, err)
+		if err != nil {
+			p.callbacks.push(item.callback, "", err)
+		} else {
+			p.factory.GetTraceManager().Record(msgtrace.NewEvent(item.msg, model.TraceProduced))
+			p.callbacks.push(item.callback, item.msg.MessageID, nil)
+		}
+	}
+}
+
+// sent records the outcome of an async send
+func (p *producerManagerImpl) sent(item *asyncSend, err error) {
+	p.factory.GetTracer().SendDone(item.span, item.msg, err)
+	p.factory.GetMetrics().SendDone(item.msg.Topic, item.enqueued, err)
+}
+
+// callbackQueue is an unbounded FIFO of send results run by a single goroutine, so callbacks
+// see the results in the order the messages were written
+type callbackQueue struct {
+	mu      sync.Mutex
+	pending []func()
+	closed  bool
+	// signal wakes the runner after a push or close
+	signal chan struct{}
+}
+
+func newCallbackQueue() *callbackQueue {
+	return &callbackQueue{signal: make(chan struct{}, 1)}
+}
+
+func (q *callbackQueue) push(callback func(string, error), id string, err error) {
+	q.mu.Lock()
+	q.pending = append(q.pending, func() { callback(id, err) })
+	q.mu.Unlock()
+	q.wake()
+}
+
+// close lets the runner exit once the pending callbacks have run
+func (q *callbackQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.wake()
+}
+
+func (q *callbackQueue) wake() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run calls the callbacks until the queue is closed and drained, then closes done
+func (q *callbackQueue) run(done chan struct{}) {
+	defer close(done)
+	for {
+		q.mu.Lock()
+		pending, closed := q.pending, q.closed
+		q.pending = nil
+		q.mu.Unlock()
+		for _, callback := range pending {
+			callback()
+		}
+		if closed && len(pending) == 0 {
+			return
+		}
+		if len(pending) == 0 {
+			<-q.signal
+		}
+	}
 }
@@ -3,13 +3,20 @@ package producer
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
 	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/metrics"
 	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+	"github.com/wenzuojing/mqx/internal/tracing"
 )
 
 // MockFactory implements interfaces.Factory for testing
@@ -47,6 +54,48 @@ func (m *MockFactory) GetClearManager() interfaces.ClearManager {
 	return args.Get(0).(interfaces.ClearManager)
 }
 
+func (m *MockFactory) GetTransactionManager() interfaces.TransactionManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.TransactionManager)
+}
+
+func (m *MockFactory) GetReplyManager() interfaces.ReplyManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ReplyManager)
+}
+
+func (m *MockFactory) GetMetrics() *metrics.Metrics {
+	return nil
+}
+
+func (m *MockFactory) GetTracer() *tracing.Tracer {
+	return nil
+}
+
+func (m *MockFactory) GetLogger() logging.Logger {
+	return logging.Discard()
+}
+
+func (m *MockFactory) GetTraceManager() *msgtrace.Manager {
+	return nil
+}
+
+func (m *MockFactory) GetHealthChecker() interfaces.HealthChecker {
+	return nil
+}
+
+func (m *MockFactory) GetAuditManager() interfaces.AuditManager {
+	return nil
+}
+
+func (m *MockFactory) GetReplayManager() interfaces.ReplayManager {
+	return nil
+}
+
+func (m *MockFactory) GetWebhookManager() interfaces.WebhookManager {
+	return nil
+}
+
 // MockMessageManager implements interfaces.MessageManager for testing
 type MockMessageManager struct {
 	mock.Mock
@@ -57,6 +106,11 @@ func (m *MockMessageManager) SaveMessage(ctx context.Context, msg *model.Message
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockMessageManager) SaveMessages(ctx context.Context, msgs []*model.Message) error {
+	args := m.Called(ctx, msgs)
+	return args.Error(0)
+}
+
 func (m *MockMessageManager) GetMessages(ctx context.Context, topic string, group string, partition int, offset int64, size int) ([]*model.Message, error) {
 	args := m.Called(ctx, topic, group, partition, offset, size)
 	return args.Get(0).([]*model.Message), args.Error(1)
@@ -82,14 +136,24 @@ func (m *MockMessageManager) GetPartitionStat(ctx context.Context, topic string,
 	return args.Get(0).(*interfaces.PartitionStat), args.Error(1)
 }
 
+func (m *MockMessageManager) UpdateHeaders(ctx context.Context, msgs []*model.Message) error {
+	args := m.Called(ctx, msgs)
+	return args.Error(0)
+}
+
+func (m *MockMessageManager) GetOffsetByTime(ctx context.Context, topic string, partition int, t time.Time) (int64, error) {
+	args := m.Called(ctx, topic, partition, t)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *MockMessageManager) DeleteMessages(ctx context.Context, topic string, partition int) error {
 	args := m.Called(ctx, topic, partition)
 	return args.Error(0)
 }
 
-func (m *MockMessageManager) QueryMessageForPage(ctx context.Context, topic string, partition int, messageID string, tag string, pageNo int, pageSize int) (int, []*model.Message, error) {
-	args := m.Called(ctx, topic, partition, messageID, tag, pageNo, pageSize)
-	return args.Int(0), args.Get(1).([]*model.Message), args.Error(2)
+func (m *MockMessageManager) SearchMessages(ctx context.Context, filter *model.MessageFilter) (*model.MessagePage, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(*model.MessagePage), args.Error(1)
 }
 
 func (m *MockMessageManager) SaveMessageWithTx(ctx context.Context, tx *sql.Tx, msg *model.Message) error {
@@ -127,6 +191,27 @@ func (m *MockDelayManager) DeleteMessagesByTopic(ctx context.Context, topic stri
 	return args.Error(0)
 }
 
+func (m *MockDelayManager) GetQueueStat(ctx context.Context) (*model.DelayQueueStat, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*model.DelayQueueStat), args.Error(1)
+}
+
+func (m *MockDelayManager) Query(ctx context.Context, filter *model.DelayFilter) (int64, []*model.DelayMessage, error) {
+	args := m.Called(ctx, filter)
+	msgs, _ := args.Get(1).([]*model.DelayMessage)
+	return args.Get(0).(int64), msgs, args.Error(2)
+}
+
+func (m *MockDelayManager) Cancel(ctx context.Context, messageID string) error {
+	args := m.Called(ctx, messageID)
+	return args.Error(0)
+}
+
+func (m *MockDelayManager) LastCycleTime() time.Time {
+	args := m.Called()
+	return args.Get(0).(time.Time)
+}
+
 func TestProducerManager_SendSync_Normal(t *testing.T) {
 	mockFactory := new(MockFactory)
 	mockMsgManager := new(MockMessageManager)
@@ -188,23 +273,26 @@ func TestProducerManager_SendAsync(t *testing.T) {
 	mockFactory.On("GetMessageManager").Return(mockMsgManager)
 
 	pm := &producerManagerImpl{
+		cfg:     &config.Config{AsyncLinger: time.Millisecond * 10},
 		factory: mockFactory,
 	}
+	assert.NoError(t, pm.Start(context.Background()))
+	defer pm.Stop(context.Background())
 
 	msg := &model.Message{
-		Topic:    "test-topic",
-		Key:      "test-key",
-		Body:     []byte("test message"),
-		BornTime: time.Now(),
+		Topic:     "test-topic",
+		Key:       "test-key",
+		Body:      []byte("test message"),
+		BornTime:  time.Now(),
+		MessageID: "msg-1",
 	}
 
-	expectedID := "msg-1"
-	mockMsgManager.On("SaveMessage", mock.Anything, msg).Return(expectedID, nil)
+	mockMsgManager.On("SaveMessages", mock.Anything, []*model.Message{msg}).Return(nil)
 
 	callbackCalled := make(chan struct{})
 	callback := func(id string, err error) {
 		assert.NoError(t, err)
-		assert.Equal(t, expectedID, id)
+		assert.Equal(t, "msg-1", id)
 		close(callbackCalled)
 	}
 
@@ -222,8 +310,139 @@ func TestProducerManager_SendAsync(t *testing.T) {
 	mockMsgManager.AssertExpectations(t)
 }
 
+func TestProducerManager_SendAsync_BatchesPerTopic(t *testing.T) {
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+
+	pm := &producerManagerImpl{
+		cfg:     &config.Config{AsyncBatchSize: 3, AsyncLinger: time.Hour},
+		factory: mockFactory,
+	}
+	assert.NoError(t, pm.Start(context.Background()))
+
+	var batches [][]*model.Message
+	mockMsgManager.On("SaveMessages", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		batches = append(batches, args.Get(1).([]*model.Message))
+	}).Return(nil)
+
+	var sent atomic.Int32
+	for i := 0; i < 4; i++ {
+		msg := &model.Message{Topic: "test-topic", Body: []byte("test message")}
+		assert.NoError(t, pm.SendAsync(context.Background(), msg, func(id string, err error) {
+			assert.NoError(t, err)
+			sent.Add(1)
+		}))
+	}
+
+	// The first three fill a batch; the fourth is flushed by Stop
+	assert.NoError(t, pm.Stop(context.Background()))
+	assert.Equal(t, int32(4), sent.Load())
+	if assert.Len(t, batches, 2) {
+		assert.Len(t, batches[0], 3)
+		assert.Len(t, batches[1], 1)
+	}
+}
+
+func TestProducerManager_SendAsync_BatchFailure(t *testing.T) {
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+
+	pm := &producerManagerImpl{
+		cfg:     &config.Config{AsyncLinger: time.Millisecond * 10},
+		factory: mockFactory,
+	}
+	assert.NoError(t, pm.Start(context.Background()))
+
+	mockMsgManager.On("SaveMessages", mock.Anything, mock.Anything).Return(errors.New("insert failed"))
+
+	var failed atomic.Int32
+	for i := 0; i < 2; i++ {
+		msg := &model.Message{Topic: "test-topic", Body: []byte("test message")}
+		assert.NoError(t, pm.SendAsync(context.Background(), msg, func(id string, err error) {
+			assert.EqualError(t, err, "insert failed")
+			assert.Empty(t, id)
+			failed.Add(1)
+		}))
+	}
+
+	assert.NoError(t, pm.Stop(context.Background()))
+	assert.Equal(t, int32(2), failed.Load())
+}
+
+func TestProducerManager_SendAsync_FailFast(t *testing.T) {
+	pm := &producerManagerImpl{
+		cfg:     &config.Config{AsyncFailFast: true},
+		factory: new(MockFactory),
+		buffer:  make(chan *asyncSend, 1),
+	}
+
+	msg := &model.Message{Topic: "test-topic", Body: []byte("test message")}
+	assert.NoError(t, pm.SendAsync(context.Background(), msg, func(string, error) {}))
+	assert.Equal(t, ErrBufferFull, pm.SendAsync(context.Background(), msg, func(string, error) {}))
+}
+
+func TestProducerManager_SendAsync_Backpressure(t *testing.T) {
+	pm := &producerManagerImpl{
+		cfg:     &config.Config{},
+		factory: new(MockFactory),
+		buffer:  make(chan *asyncSend, 1),
+	}
+
+	msg := &model.Message{Topic: "test-topic", Body: []byte("test message")}
+	assert.NoError(t, pm.SendAsync(context.Background(), msg, func(string, error) {}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	err := pm.SendAsync(ctx, msg, func(string, error) {})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestProducerManager_Stop_ReleasesBlockedSenders(t *testing.T) {
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+	// The database is slow, so the buffer stays full
+	written := make(chan struct{})
+	mockMsgManager.On("SaveMessages", mock.Anything, mock.Anything).Run(func(mock.Arguments) { <-written }).Return(nil)
+
+	pm := &producerManagerImpl{
+		cfg:     &config.Config{AsyncBufferSize: 1, AsyncBatchSize: 1},
+		factory: mockFactory,
+	}
+	assert.NoError(t, pm.Start(context.Background()))
+	msg := &model.Message{Topic: "test-topic", Body: []byte("test message")}
+	var results atomic.Int32
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, pm.SendAsync(context.Background(), msg, func(string, error) { results.Add(1) }))
+		// Let the dispatcher take the first message into a batch
+		time.Sleep(10 * time.Millisecond)
+	}
+	blocked := make(chan error)
+	go func() {
+		blocked <- pm.SendAsync(context.Background(), msg, func(string, error) { results.Add(1) })
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, pm.Stop(ctx), context.DeadlineExceeded)
+	select {
+	case err := <-blocked:
+		assert.Equal(t, ErrProducerClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not release the blocked sender")
+	}
+
+	// The buffered messages are still written once the database catches up
+	close(written)
+	assert.Eventually(t, func() bool { return results.Load() == 2 }, time.Second, 10*time.Millisecond)
+}
+
 func TestProducerManager_Lifecycle(t *testing.T) {
 	pm := &producerManagerImpl{
+		cfg:     &config.Config{},
 		factory: new(MockFactory),
 	}
 
@@ -232,4 +451,72 @@ func TestProducerManager_Lifecycle(t *testing.T) {
 
 	err = pm.Stop(context.Background())
 	assert.NoError(t, err)
+
+	msg := &model.Message{Topic: "test-topic", Body: []byte("test message")}
+	err = pm.SendAsync(context.Background(), msg, func(string, error) {})
+	assert.Equal(t, ErrProducerClosed, err)
+}
+
+func TestProducerManager_Stop_ReportsAbandonedSends(t *testing.T) {
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+
+	pm := &producerManagerImpl{
+		cfg:     &config.Config{AsyncBatchSize: 1},
+		factory: mockFactory,
+	}
+	assert.NoError(t, pm.Start(context.Background()))
+
+	mockMsgManager.On("SaveMessages", mock.Anything, mock.Anything).After(time.Millisecond * 200).Return(nil)
+
+	for i := 0; i < 2; i++ {
+		msg := &model.Message{Topic: "test-topic", Body: []byte("test message")}
+		assert.NoError(t, pm.SendAsync(context.Background(), msg, func(string, error) {}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := pm.Stop(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "abandoned 1 buffered async sends")
+}
+
+func TestProducerManager_SendAsync_FromCallback(t *testing.T) {
+	mockFactory := new(MockFactory)
+	mockMsgManager := new(MockMessageManager)
+	mockFactory.On("GetMessageManager").Return(mockMsgManager)
+
+	pm := &producerManagerImpl{
+		cfg:     &config.Config{AsyncBufferSize: 1, AsyncBatchSize: 1},
+		factory: mockFactory,
+	}
+	assert.NoError(t, pm.Start(context.Background()))
+
+	type ctxKey struct{}
+	mockMsgManager.On("SaveMessages", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		// The batch is written in the context of the sender
+		assert.Equal(t, "request-1", args.Get(0).(context.Context).Value(ctxKey{}))
+	}).Return(nil)
+
+	// The callback of the first message sends more than the buffer holds
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request-1")
+	var sent atomic.Int32
+	resent := make(chan struct{})
+	msg := &model.Message{Topic: "test-topic", Body: []byte("first")}
+	assert.NoError(t, pm.SendAsync(ctx, msg, func(string, error) {
+		for i := 0; i < 3; i++ {
+			next := &model.Message{Topic: "test-topic", Body: []byte("next")}
+			assert.NoError(t, pm.SendAsync(ctx, next, func(string, error) { sent.Add(1) }))
+		}
+		close(resent)
+	}))
+
+	select {
+	case <-resent:
+	case <-time.After(time.Second):
+		t.Fatal("Sending from a callback blocked the dispatcher")
+	}
+	assert.NoError(t, pm.Stop(context.Background()))
+	assert.Equal(t, int32(3), sent.Load())
 }
@@ -0,0 +1,111 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// Redrive publishes copies of dead lettered messages to their topic, oldest first. Each copy goes to the
+// group that dead lettered the message, or to the whole topic for the messages dead lettered before the
+// group was recorded. The dead letters are kept until the retention of the dead letter queue, marked with
+// HeaderRedrivenAt once their copies are written, and left out of later redrives. A failure between the
+// write of a batch of copies and its marks leaves that batch to be redriven again.
+func (r *replayManagerImpl) Redrive(ctx context.Context, req *model.RedriveRequest) (*model.ReplayResult, error) {
+	if req.Topic == "" {
+		return nil, fmt.Errorf("%w: topic is required", ErrInvalidReplay)
+	}
+	if len(req.MessageIDs) > MaxReplayMessages {
+		return nil, fmt.Errorf("%w: %d messages selected, at most %d allowed", ErrReplayTooLarge, len(req.MessageIDs), MaxReplayMessages)
+	}
+	filter := &model.MessageFilter{
+		Topic:    model.DeadLetterTopic(req.Topic),
+		From:     req.From,
+		To:       req.To,
+		PageSize: replayBatchSize,
+	}
+
+	var selected []*model.Message
+	if len(req.MessageIDs) > 0 {
+		for _, id := range req.MessageIDs {
+			filter.MessageID = id
+			page, err := r.factory.GetMessageManager().SearchMessages(ctx, filter)
+			if err != nil {
+				return nil, err
+			}
+			if len(page.Messages) == 0 {
+				return nil, fmt.Errorf("%w: %s is not in the dead letter queue of %s", ErrMessageNotFound, id, req.Topic)
+			}
+			// A message failed by several groups is dead lettered once per group
+			selected = append(selected, page.Messages...)
+		}
+	} else {
+		page, err := r.factory.GetMessageManager().SearchMessages(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if *page.Total > MaxReplayMessages {
+			return nil, fmt.Errorf("%w: %d messages selected, at most %d allowed", ErrReplayTooLarge, *page.Total, MaxReplayMessages)
+		}
+		// The search returns the newest messages first
+		if selected, err = r.readPages(ctx, filter, page); err != nil {
+			return nil, err
+		}
+		slices.Reverse(selected)
+	}
+	if req.Group != "" {
+		selected = slices.DeleteFunc(selected, func(msg *model.Message) bool {
+			return msg.Headers[model.HeaderDeadLetterGroup] != req.Group
+		})
+	}
+
+	count := len(selected)
+	selected = slices.DeleteFunc(selected, func(msg *model.Message) bool {
+		return msg.Headers[model.HeaderRedrivenAt] != ""
+	})
+
+	result := &model.ReplayResult{Matched: int64(len(selected)), Skipped: int64(count - len(selected)), DryRun: req.DryRun}
+	if req.DryRun || result.Matched == 0 {
+		return result, nil
+	}
+	for start := 0; start < len(selected); start += replayBatchSize {
+		batch := selected[start:min(start+replayBatchSize, len(selected))]
+		copies := make([]*model.Message, len(batch))
+		for i, msg := range batch {
+			copies[i] = copyMessage(msg, msg.Headers[model.HeaderDeadLetterGroup])
+			copies[i].Topic = req.Topic
+			delete(copies[i].Headers, model.HeaderRedrivenAt)
+			delete(copies[i].Headers, model.HeaderDeadLetterGroup)
+		}
+		published, err := r.publish(ctx, copies)
+		result.Replayed += published
+		if err == nil {
+			err = r.markRedriven(ctx, batch)
+		}
+		if err != nil {
+			r.logger.Error("Redrive stopped by a failed write", "topic", req.Topic, "group", req.Group, "redriven", result.Replayed, "error", err)
+			return result, err
+		}
+	}
+	r.logger.Info("Redrove dead lettered messages", "topic", req.Topic, "group", req.Group, "redriven", result.Replayed, "skipped", result.Skipped)
+	return result, nil
+}
+
+// markRedriven records on dead letters that their copies have been published
+func (r *replayManagerImpl) markRedriven(ctx context.Context, deadLetters []*model.Message) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	marked := make([]*model.Message, len(deadLetters))
+	for i, msg := range deadLetters {
+		headers := maps.Clone(msg.Headers)
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[model.HeaderRedrivenAt] = now
+		marked[i] = &model.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset, Headers: headers}
+	}
+	return r.factory.GetMessageManager().UpdateHeaders(ctx, marked)
+}
@@ -0,0 +1,118 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func deadLetter(id string, group string, born time.Time) *model.Message {
+	offset, _ := strconv.ParseInt(strings.TrimPrefix(id, "m"), 10, 64)
+	headers := map[string]string{"traceparent": "00-abc"}
+	if group != "" {
+		headers[model.HeaderDeadLetterGroup] = group
+	}
+	return &model.Message{MessageID: id, Topic: "orders_dead", Offset: offset, Body: []byte(id), Headers: headers, BornTime: born}
+}
+
+func TestReplayManager_Redrive(t *testing.T) {
+	rm, mocks := newTestManager()
+	now := time.Now()
+	// Pages come newest first
+	mocks.messages.On("SearchMessages", mock.Anything, mock.MatchedBy(func(f *model.MessageFilter) bool {
+		return f.Topic == "orders_dead" && f.MessageID == "" && f.Cursor == ""
+	})).Return(&model.MessagePage{
+		Messages: []*model.Message{
+			deadLetter("m3", "billing", now),
+			deadLetter("m2", "audit", now.Add(-time.Second)),
+			deadLetter("m1", "", now.Add(-2*time.Second)),
+		},
+		Total: total(3),
+	}, nil)
+	mocks.messages.On("SaveMessages", mock.Anything, mock.MatchedBy(func(msgs []*model.Message) bool {
+		return len(msgs) == 3 &&
+			msgs[0].Topic == "orders" && msgs[0].Headers[model.HeaderReplayOf] == "m1" &&
+			msgs[0].Headers[model.HeaderTargetGroup] == "" &&
+			msgs[1].Headers[model.HeaderTargetGroup] == "audit" &&
+			msgs[2].Headers[model.HeaderTargetGroup] == "billing" &&
+			msgs[2].Headers["traceparent"] == "00-abc" &&
+			msgs[2].Headers[model.HeaderDeadLetterGroup] == ""
+	})).Return(nil).Once()
+	// The dead letters are marked after their copies are written
+	mocks.messages.On("UpdateHeaders", mock.Anything, mock.MatchedBy(func(msgs []*model.Message) bool {
+		return len(msgs) == 3 && msgs[0].Offset == 1 && msgs[2].Offset == 3 &&
+			msgs[0].Topic == "orders_dead" && msgs[0].Headers[model.HeaderRedrivenAt] != "" &&
+			msgs[2].Headers[model.HeaderDeadLetterGroup] == "billing"
+	})).Return(nil).Once()
+
+	result, err := rm.Redrive(context.Background(), &model.RedriveRequest{Topic: "orders", DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ReplayResult{Matched: 3, DryRun: true}, result)
+
+	result, err = rm.Redrive(context.Background(), &model.RedriveRequest{Topic: "orders"})
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ReplayResult{Matched: 3, Replayed: 3}, result)
+
+	// Only the dead letters of a group
+	mocks.messages.On("SaveMessages", mock.Anything, mock.MatchedBy(func(msgs []*model.Message) bool {
+		return len(msgs) == 1 && msgs[0].Headers[model.HeaderReplayOf] == "m2"
+	})).Return(nil).Once()
+	mocks.messages.On("UpdateHeaders", mock.Anything, mock.MatchedBy(func(msgs []*model.Message) bool {
+		return len(msgs) == 1 && msgs[0].Offset == 2
+	})).Return(nil).Once()
+	result, err = rm.Redrive(context.Background(), &model.RedriveRequest{Topic: "orders", Group: "audit"})
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ReplayResult{Matched: 1, Replayed: 1}, result)
+	mocks.messages.AssertExpectations(t)
+}
+
+func TestReplayManager_Redrive_MessageIDs(t *testing.T) {
+	rm, mocks := newTestManager()
+	mocks.messages.On("SearchMessages", mock.Anything, mock.MatchedBy(func(f *model.MessageFilter) bool {
+		return f.Topic == "orders_dead" && f.MessageID == "m1"
+	})).Return(&model.MessagePage{Messages: []*model.Message{deadLetter("m1", "billing", time.Now())}}, nil)
+	mocks.messages.On("SearchMessages", mock.Anything, mock.MatchedBy(func(f *model.MessageFilter) bool {
+		return f.MessageID == "missing"
+	})).Return(&model.MessagePage{}, nil)
+
+	_, err := rm.Redrive(context.Background(), &model.RedriveRequest{Topic: "orders", MessageIDs: []string{"m1", "missing"}})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, err = rm.Redrive(context.Background(), &model.RedriveRequest{})
+	assert.ErrorIs(t, err, ErrInvalidReplay)
+	mocks.messages.AssertNotCalled(t, "SaveMessages", mock.Anything, mock.Anything)
+
+	result, err := rm.Redrive(context.Background(), &model.RedriveRequest{Topic: "orders", MessageIDs: []string{"m1"}, DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.Matched)
+}
+
+func TestReplayManager_Redrive_SkipsRedriven(t *testing.T) {
+	rm, mocks := newTestManager()
+	now := time.Now()
+	redriven := deadLetter("m2", "billing", now)
+	redriven.Headers[model.HeaderRedrivenAt] = now.UTC().Format(time.RFC3339)
+	mocks.messages.On("SearchMessages", mock.Anything, mock.Anything).Return(&model.MessagePage{
+		Messages: []*model.Message{redriven, deadLetter("m1", "billing", now.Add(-time.Second))},
+		Total:    total(2),
+	}, nil)
+	mocks.messages.On("SaveMessages", mock.Anything, mock.MatchedBy(func(msgs []*model.Message) bool {
+		return len(msgs) == 1 && msgs[0].Headers[model.HeaderReplayOf] == "m1" && msgs[0].Headers[model.HeaderRedrivenAt] == ""
+	})).Return(nil)
+	mocks.messages.On("UpdateHeaders", mock.Anything, mock.Anything).Return(errors.New("connection reset")).Once()
+
+	// A failed mark is reported after the copies were written
+	result, err := rm.Redrive(context.Background(), &model.RedriveRequest{Topic: "orders"})
+	assert.Error(t, err)
+	assert.Equal(t, &model.ReplayResult{Matched: 1, Replayed: 1, Skipped: 1}, result)
+
+	result, err = rm.Redrive(context.Background(), &model.RedriveRequest{Topic: "orders", DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ReplayResult{Matched: 1, Skipped: 1, DryRun: true}, result)
+}
@@ -0,0 +1,194 @@
+package replay
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+)
+
+const (
+	// MaxReplayMessages is the largest number of messages a single replay may select
+	MaxReplayMessages = 10000
+	// replayBatchSize is the number of messages read and written at a time
+	replayBatchSize = 500
+)
+
+var (
+	// ErrMessageNotFound is returned when the message to resend is not stored in its topic
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrUnknownGroup is returned when the target group has never consumed the topic
+	ErrUnknownGroup = errors.New("unknown consumer group")
+	// ErrInvalidReplay is returned when a replay request does not select a bounded set of messages
+	ErrInvalidReplay = errors.New("invalid replay request")
+	// ErrReplayTooLarge is returned when a replay selects more than MaxReplayMessages messages
+	ErrReplayTooLarge = errors.New("replay selects too many messages")
+)
+
+// NewReplayManager creates the manager publishing copies of stored messages
+func NewReplayManager(cfg *config.Config, factory interfaces.Factory) (interfaces.ReplayManager, error) {
+	return &replayManagerImpl{cfg: cfg, factory: factory, logger: factory.GetLogger()}, nil
+}
+
+type replayManagerImpl struct {
+	cfg     *config.Config
+	factory interfaces.Factory
+	logger  logging.Logger
+}
+
+// Resend publishes a copy of a stored message, to the whole topic or to one group
+func (r *replayManagerImpl) Resend(ctx context.Context, topic string, messageID string, group string) (string, error) {
+	if group != "" {
+		if err := r.checkGroup(ctx, topic, group); err != nil {
+			return "", err
+		}
+	}
+	page, err := r.factory.GetMessageManager().SearchMessages(ctx, &model.MessageFilter{Topic: topic, MessageID: messageID, PageSize: 1})
+	if err != nil {
+		return "", err
+	}
+	if len(page.Messages) == 0 {
+		return "", ErrMessageNotFound
+	}
+	id, err := r.factory.GetProducerManager().SendSync(ctx, copyMessage(page.Messages[0], group))
+	if err != nil {
+		return "", err
+	}
+	r.logger.Info("Resent message", "topic", topic, "messageId", messageID, "group", group, "copyId", id)
+	return id, nil
+}
+
+// Replay publishes copies of the messages selected by a request to its group, oldest first
+func (r *replayManagerImpl) Replay(ctx context.Context, req *model.ReplayRequest) (*model.ReplayResult, error) {
+	if req.Group == "" {
+		return nil, fmt.Errorf("%w: group is required", ErrInvalidReplay)
+	}
+	hasOffsets := req.FromOffset > 0 || req.ToOffset > 0
+	if hasOffsets && req.Partition == nil {
+		return nil, fmt.Errorf("%w: an offset range needs a partition", ErrInvalidReplay)
+	}
+	if !hasOffsets && req.From.IsZero() && req.To.IsZero() {
+		return nil, fmt.Errorf("%w: an offset range or a time window is required", ErrInvalidReplay)
+	}
+	if err := r.checkGroup(ctx, req.Topic, req.Group); err != nil {
+		return nil, err
+	}
+
+	filter := &model.MessageFilter{
+		Topic:      req.Topic,
+		Partition:  req.Partition,
+		From:       req.From,
+		To:         req.To,
+		FromOffset: req.FromOffset,
+		ToOffset:   req.ToOffset,
+		PageSize:   replayBatchSize,
+	}
+	page, err := r.factory.GetMessageManager().SearchMessages(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.ReplayResult{Matched: *page.Total, DryRun: req.DryRun}
+	if req.DryRun || result.Matched == 0 {
+		return result, nil
+	}
+	if result.Matched > MaxReplayMessages {
+		return nil, fmt.Errorf("%w: %d messages selected, at most %d allowed", ErrReplayTooLarge, result.Matched, MaxReplayMessages)
+	}
+
+	selected, err := r.readPages(ctx, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	// The search orders by born time, which the producers set, so the messages of a
+	// partition are sorted by offset to replay them in the order they were stored
+	slices.SortFunc(selected, func(a, b *model.Message) int {
+		return cmp.Or(cmp.Compare(a.Partition, b.Partition), cmp.Compare(a.Offset, b.Offset))
+	})
+
+	copies := make([]*model.Message, len(selected))
+	for i, msg := range selected {
+		copies[i] = copyMessage(msg, req.Group)
+	}
+	if result.Replayed, err = r.publish(ctx, copies); err != nil {
+		r.logger.Error("Replay stopped by a failed write", "topic", req.Topic, "group", req.Group, "replayed", result.Replayed, "error", err)
+		return result, err
+	}
+	r.logger.Info("Replayed messages", "topic", req.Topic, "group", req.Group, "replayed", result.Replayed)
+	return result, nil
+}
+
+// readPages returns the messages of the first page of a search followed by those of the next pages
+func (r *replayManagerImpl) readPages(ctx context.Context, filter *model.MessageFilter, page *model.MessagePage) ([]*model.Message, error) {
+	selected := slices.Clone(page.Messages)
+	for page.NextCursor != "" {
+		filter.Cursor = page.NextCursor
+		var err error
+		if page, err = r.factory.GetMessageManager().SearchMessages(ctx, filter); err != nil {
+			return nil, err
+		}
+		selected = append(selected, page.Messages...)
+	}
+	return selected, nil
+}
+
+// publish writes copies of a single topic in order, a batch at a time, and returns how many were written
+func (r *replayManagerImpl) publish(ctx context.Context, copies []*model.Message) (int64, error) {
+	var published int64
+	for start := 0; start < len(copies); start += replayBatchSize {
+		batch := copies[start:min(start+replayBatchSize, len(copies))]
+		if err := r.factory.GetMessageManager().SaveMessages(ctx, batch); err != nil {
+			return published, err
+		}
+		for _, msg := range batch {
+			r.factory.GetTraceManager().Record(msgtrace.NewEvent(msg, model.TraceProduced))
+		}
+		published += int64(len(batch))
+	}
+	return published, nil
+}
+
+// checkGroup makes sure a group has consumed a topic, so a mistyped group does not swallow the copies
+func (r *replayManagerImpl) checkGroup(ctx context.Context, topic string, group string) error {
+	if strings.HasPrefix(group, "__broadcast__") {
+		return fmt.Errorf("%w: broadcast groups cannot be targeted", ErrUnknownGroup)
+	}
+	offsets, err := r.factory.GetConsumerManager().GetConsumerOffsets(ctx, topic, group)
+	if err != nil {
+		return err
+	}
+	if len(offsets) == 0 {
+		return fmt.Errorf("%w: %s has no offsets for topic %s", ErrUnknownGroup, group, topic)
+	}
+	return nil
+}
+
+// copyMessage creates a new message with the content of a stored one, delivered only to group when set
+func copyMessage(msg *model.Message, group string) *model.Message {
+	headers := maps.Clone(msg.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[model.HeaderReplayOf] = msg.MessageID
+	delete(headers, model.HeaderTargetGroup)
+	if group != "" {
+		headers[model.HeaderTargetGroup] = group
+	}
+	return &model.Message{
+		Topic:    msg.Topic,
+		Key:      msg.Key,
+		Tag:      msg.Tag,
+		Body:     msg.Body,
+		Headers:  headers,
+		BornTime: time.Now(),
+	}
+}
@@ -0,0 +1,201 @@
+package replay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+)
+
+// MockFactory implements interfaces.Factory for testing
+type MockFactory struct {
+	mock.Mock
+	interfaces.Factory
+}
+
+func (m *MockFactory) GetMessageManager() interfaces.MessageManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.MessageManager)
+}
+
+func (m *MockFactory) GetConsumerManager() interfaces.ConsumerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ConsumerManager)
+}
+
+func (m *MockFactory) GetProducerManager() interfaces.ProducerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ProducerManager)
+}
+
+func (m *MockFactory) GetLogger() logging.Logger {
+	return logging.Discard()
+}
+
+func (m *MockFactory) GetTraceManager() *msgtrace.Manager {
+	return nil
+}
+
+// MockMessageManager implements interfaces.MessageManager for testing
+type MockMessageManager struct {
+	mock.Mock
+	interfaces.MessageManager
+}
+
+func (m *MockMessageManager) SearchMessages(ctx context.Context, filter *model.MessageFilter) (*model.MessagePage, error) {
+	args := m.Called(ctx, filter)
+	page, _ := args.Get(0).(*model.MessagePage)
+	return page, args.Error(1)
+}
+
+func (m *MockMessageManager) SaveMessages(ctx context.Context, msgs []*model.Message) error {
+	args := m.Called(ctx, msgs)
+	return args.Error(0)
+}
+
+func (m *MockMessageManager) UpdateHeaders(ctx context.Context, msgs []*model.Message) error {
+	args := m.Called(ctx, msgs)
+	return args.Error(0)
+}
+
+// MockConsumerManager implements interfaces.ConsumerManager for testing
+type MockConsumerManager struct {
+	mock.Mock
+	interfaces.ConsumerManager
+}
+
+func (m *MockConsumerManager) GetConsumerOffsets(ctx context.Context, topic string, group string) ([]model.ConsumerOffset, error) {
+	args := m.Called(ctx, topic, group)
+	offsets, _ := args.Get(0).([]model.ConsumerOffset)
+	return offsets, args.Error(1)
+}
+
+// MockProducerManager implements interfaces.ProducerManager for testing
+type MockProducerManager struct {
+	mock.Mock
+	interfaces.ProducerManager
+}
+
+func (m *MockProducerManager) SendSync(ctx context.Context, msg *model.Message) (string, error) {
+	args := m.Called(ctx, msg)
+	return args.String(0), args.Error(1)
+}
+
+type testMocks struct {
+	factory   *MockFactory
+	messages  *MockMessageManager
+	consumers *MockConsumerManager
+	producer  *MockProducerManager
+}
+
+func newTestManager() (*replayManagerImpl, *testMocks) {
+	mocks := &testMocks{
+		factory:   new(MockFactory),
+		messages:  new(MockMessageManager),
+		consumers: new(MockConsumerManager),
+		producer:  new(MockProducerManager),
+	}
+	mocks.factory.On("GetMessageManager").Return(mocks.messages)
+	mocks.factory.On("GetConsumerManager").Return(mocks.consumers)
+	mocks.factory.On("GetProducerManager").Return(mocks.producer)
+	mocks.consumers.On("GetConsumerOffsets", mock.Anything, "orders", "billing").
+		Return([]model.ConsumerOffset{{Topic: "orders", Group: "billing"}}, nil)
+	mocks.consumers.On("GetConsumerOffsets", mock.Anything, "orders", mock.Anything).Return(nil, nil)
+	return &replayManagerImpl{cfg: &config.Config{}, factory: mocks.factory, logger: logging.Discard()}, mocks
+}
+
+func total(n int64) *int64 {
+	return &n
+}
+
+func TestReplayManager_Resend(t *testing.T) {
+	rm, mocks := newTestManager()
+	stored := &model.Message{MessageID: "msg-1", Topic: "orders", Key: "order-1", Body: []byte("paid"),
+		Headers: map[string]string{"traceparent": "00-abc"}}
+	mocks.messages.On("SearchMessages", mock.Anything, &model.MessageFilter{Topic: "orders", MessageID: "msg-1", PageSize: 1}).
+		Return(&model.MessagePage{Messages: []*model.Message{stored}, Total: total(1)}, nil)
+	mocks.producer.On("SendSync", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool {
+		return msg.Topic == "orders" && msg.Key == "order-1" && string(msg.Body) == "paid" && msg.MessageID == "" &&
+			msg.Headers[model.HeaderReplayOf] == "msg-1" &&
+			msg.Headers[model.HeaderTargetGroup] == "billing" &&
+			msg.Headers["traceparent"] == "00-abc"
+	})).Return("copy-1", nil)
+
+	id, err := rm.Resend(context.Background(), "orders", "msg-1", "billing")
+	assert.NoError(t, err)
+	assert.Equal(t, "copy-1", id)
+	// The stored message is left untouched
+	assert.NotContains(t, stored.Headers, model.HeaderReplayOf)
+
+	_, err = rm.Resend(context.Background(), "orders", "msg-1", "biling")
+	assert.ErrorIs(t, err, ErrUnknownGroup)
+	mocks.producer.AssertNumberOfCalls(t, "SendSync", 1)
+}
+
+func TestReplayManager_Resend_NotFound(t *testing.T) {
+	rm, mocks := newTestManager()
+	mocks.messages.On("SearchMessages", mock.Anything, mock.Anything).Return(&model.MessagePage{Total: total(0)}, nil)
+
+	_, err := rm.Resend(context.Background(), "orders", "missing", "")
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+}
+
+func TestReplayManager_Replay(t *testing.T) {
+	rm, mocks := newTestManager()
+	partition := 1
+	now := time.Now()
+	// Pages come newest first by born time, which the clock of a producer put ahead of m12 for m11
+	mocks.messages.On("SearchMessages", mock.Anything, mock.MatchedBy(func(f *model.MessageFilter) bool {
+		return f.Cursor == "" && *f.Partition == 1 && f.FromOffset == 10 && f.ToOffset == 12
+	})).Return(&model.MessagePage{
+		Messages:   []*model.Message{{MessageID: "m11", Offset: 11, BornTime: now.Add(time.Second)}, {MessageID: "m12", Offset: 12, BornTime: now}},
+		Total:      total(3),
+		NextCursor: "next",
+	}, nil)
+	mocks.messages.On("SearchMessages", mock.Anything, mock.MatchedBy(func(f *model.MessageFilter) bool {
+		return f.Cursor == "next"
+	})).Return(&model.MessagePage{Messages: []*model.Message{{MessageID: "m10", Offset: 10, BornTime: now}}}, nil)
+	mocks.messages.On("SaveMessages", mock.Anything, mock.MatchedBy(func(msgs []*model.Message) bool {
+		return len(msgs) == 3 &&
+			msgs[0].Headers[model.HeaderReplayOf] == "m10" &&
+			msgs[1].Headers[model.HeaderReplayOf] == "m11" &&
+			msgs[2].Headers[model.HeaderReplayOf] == "m12" &&
+			msgs[2].Headers[model.HeaderTargetGroup] == "billing"
+	})).Return(nil)
+
+	req := &model.ReplayRequest{Topic: "orders", Group: "billing", Partition: &partition, FromOffset: 10, ToOffset: 12, DryRun: true}
+	result, err := rm.Replay(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ReplayResult{Matched: 3, DryRun: true}, result)
+	mocks.messages.AssertNotCalled(t, "SaveMessages", mock.Anything, mock.Anything)
+
+	req.DryRun = false
+	result, err = rm.Replay(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ReplayResult{Matched: 3, Replayed: 3}, result)
+	mocks.messages.AssertExpectations(t)
+}
+
+func TestReplayManager_Replay_InvalidRequest(t *testing.T) {
+	rm, mocks := newTestManager()
+	mocks.messages.On("SearchMessages", mock.Anything, mock.Anything).
+		Return(&model.MessagePage{Total: total(MaxReplayMessages + 1)}, nil)
+
+	_, err := rm.Replay(context.Background(), &model.ReplayRequest{Topic: "orders", From: time.Now().Add(-time.Hour)})
+	assert.ErrorIs(t, err, ErrInvalidReplay)
+	_, err = rm.Replay(context.Background(), &model.ReplayRequest{Topic: "orders", Group: "billing"})
+	assert.ErrorIs(t, err, ErrInvalidReplay)
+	_, err = rm.Replay(context.Background(), &model.ReplayRequest{Topic: "orders", Group: "billing", FromOffset: 10})
+	assert.ErrorIs(t, err, ErrInvalidReplay)
+	_, err = rm.Replay(context.Background(), &model.ReplayRequest{Topic: "orders", Group: "__broadcast__x", From: time.Now().Add(-time.Hour)})
+	assert.ErrorIs(t, err, ErrUnknownGroup)
+	_, err = rm.Replay(context.Background(), &model.ReplayRequest{Topic: "orders", Group: "billing", From: time.Now().Add(-time.Hour)})
+	assert.ErrorIs(t, err, ErrReplayTooLarge)
+}
@@ -0,0 +1,263 @@
+package reply
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/template"
+)
+
+// ErrNoReplyTo is returned when replying to a message that was not sent as a request
+var ErrNoReplyTo = errors.New("message has no reply-to header")
+
+// NewReplyManager creates a new reply manager instance
+func NewReplyManager(db *sql.DB, cfg *config.Config, factory interfaces.Factory) (interfaces.ReplyManager, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	replyTopic := model.ReplyTopicPrefix + strings.ReplaceAll(uuid.NewString(), "-", "")
+	return &replyManagerImpl{
+		db:         db,
+		cfg:        cfg,
+		factory:    factory,
+		hostname:   hostname,
+		replyTopic: replyTopic,
+		pending:    make(map[string]chan *model.Message),
+		stopChan:   make(chan struct{}),
+		logger:     factory.GetLogger().With("topic", replyTopic),
+	}, nil
+}
+
+// replyManagerImpl publishes requests and collects replies from a reply topic owned by this instance.
+// The reply topic has a single partition and is read like a broadcast subscription: no consumer
+// group, no committed offsets, starting from the latest offset when the topic is first used.
+// While the topic is in use the instance heartbeats on it, and the clear manager deletes
+// the reply topics left without a live heartbeat by instances that did not stop cleanly.
+type replyManagerImpl struct {
+	db         *sql.DB
+	cfg        *config.Config
+	factory    interfaces.Factory
+	hostname   string
+	replyTopic string
+	pending    map[string]chan *model.Message
+	offset     int64
+	ready      bool
+	mu         sync.Mutex
+	stopChan   chan struct{}
+	// logger carries the reply topic field
+	logger logging.Logger
+}
+
+func (r *replyManagerImpl) Start(ctx context.Context) error {
+	go r.poll(context.Background())
+	return nil
+}
+
+func (r *replyManagerImpl) Stop(ctx context.Context) error {
+	close(r.stopChan)
+	r.mu.Lock()
+	ready := r.ready
+	r.mu.Unlock()
+	if !ready {
+		return nil
+	}
+	// The reply topic is private to this instance and useless once it stops
+	if _, err := r.db.ExecContext(ctx, template.DeleteGroupInstances, model.ReplyGroup, r.replyTopic); err != nil {
+		r.logger.Warn("Failed to delete reply topic heartbeat", "error", err)
+	}
+	if err := r.factory.GetTopicManager().DeleteTopic(ctx, r.replyTopic); err != nil {
+		r.logger.Warn("Failed to delete reply topic", "error", err)
+	}
+	return nil
+}
+
+func (r *replyManagerImpl) Request(ctx context.Context, msg *model.Message) (*model.Message, error) {
+	if err := r.ensureReplyTopic(ctx); err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok && r.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.RequestTimeout)
+		defer cancel()
+	}
+
+	correlationID := uuid.NewString()
+	headers := make(map[string]string, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[model.HeaderCorrelationID] = correlationID
+	headers[model.HeaderReplyTo] = r.replyTopic
+	msg.Headers = headers
+
+	replyChan := make(chan *model.Message, 1)
+	r.mu.Lock()
+	r.pending[correlationID] = replyChan
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, correlationID)
+		r.mu.Unlock()
+	}()
+
+	if _, err := r.factory.GetProducerManager().SendSync(ctx, msg); err != nil {
+		return nil, errors.Wrap(err, "failed to send request")
+	}
+	r.logger.Debug("Sent request, waiting for reply", "correlationId", correlationID, "requestTopic", msg.Topic)
+
+	select {
+	case reply := <-replyChan:
+		if errText, ok := reply.Headers[model.HeaderReplyError]; ok {
+			return reply, errors.Errorf("request %s failed: %s", correlationID, errText)
+		}
+		return reply, nil
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "request %s timed out waiting for reply", correlationID)
+	case <-r.stopChan:
+		return nil, errors.New("reply manager stopped")
+	}
+}
+
+func (r *replyManagerImpl) Reply(ctx context.Context, request *model.Message, reply *model.Message) (string, error) {
+	replyTo := request.Headers[model.HeaderReplyTo]
+	if replyTo == "" {
+		return "", ErrNoReplyTo
+	}
+	headers := make(map[string]string, len(reply.Headers)+1)
+	for k, v := range reply.Headers {
+		headers[k] = v
+	}
+	headers[model.HeaderCorrelationID] = request.Headers[model.HeaderCorrelationID]
+	reply.Headers = headers
+	reply.Topic = replyTo
+	reply.Delay = 0
+	if reply.BornTime.IsZero() {
+		reply.BornTime = time.Now()
+	}
+	return r.factory.GetProducerManager().SendSync(ctx, reply)
+}
+
+// ensureReplyTopic creates the single-partition reply topic on first use and
+// positions the reader at its current end.
+func (r *replyManagerImpl) ensureReplyTopic(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ready {
+		return nil
+	}
+	// The heartbeat comes first so the topic is never seen without one
+	if _, err := r.heartbeat(ctx); err != nil {
+		return errors.Wrap(err, "failed to register reply topic heartbeat")
+	}
+	err := r.factory.GetTopicManager().CreateTopic(ctx, &model.TopicMeta{
+		Topic:         r.replyTopic,
+		PartitionNum:  1,
+		RetentionDays: 1,
+	})
+	if err != nil && !strings.Contains(err.Error(), "Duplicate entry") {
+		return errors.Wrap(err, "failed to create reply topic")
+	}
+	offset, err := r.factory.GetMessageManager().GetMaxOffset(ctx, r.replyTopic, 0)
+	if err != nil && !strings.Contains(err.Error(), "doesn't exist") {
+		return errors.Wrap(err, "failed to get reply topic offset")
+	}
+	r.offset = offset
+	r.ready = true
+	r.logger.Debug("Using reply topic")
+	return nil
+}
+
+// heartbeat keeps the reply topic alive, reporting whether an existing heartbeat was refreshed.
+// It registers a new one otherwise.
+func (r *replyManagerImpl) heartbeat(ctx context.Context) (bool, error) {
+	instanceID := strings.TrimPrefix(r.replyTopic, model.ReplyTopicPrefix)
+	result, err := r.db.ExecContext(ctx, template.UpdateConsumerInstanceHeartbeat, model.ReplyGroup, r.replyTopic, instanceID)
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected > 0 {
+		return true, nil
+	}
+	_, err = r.db.ExecContext(ctx, template.InsertConsumerInstanceHeartbeat, model.ReplyGroup, r.replyTopic, instanceID, r.hostname)
+	if err != nil && strings.Contains(err.Error(), "Duplicate entry") {
+		// Refreshed within the same second, the row is unchanged
+		return true, nil
+	}
+	return false, err
+}
+
+// keepAlive refreshes the heartbeat of a reply topic in use. A heartbeat that had to be registered
+// again was missed long enough for the topic to be deleted, so the topic is created anew on the next request.
+func (r *replyManagerImpl) keepAlive(ctx context.Context, errLog *logging.Throttle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.ready {
+		return
+	}
+	refreshed, err := r.heartbeat(ctx)
+	if err != nil {
+		errLog.Error("Failed to refresh reply topic heartbeat", "error", err)
+		return
+	}
+	if !refreshed {
+		r.logger.Warn("Reply topic heartbeat was lost, recreating the topic on the next request")
+		r.ready = false
+	}
+}
+
+// poll reads the reply topic while requests are outstanding and hands replies to their waiters
+func (r *replyManagerImpl) poll(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ReplyPollingInterval)
+	defer ticker.Stop()
+	heartbeat := time.NewTicker(r.cfg.HeartbeatInterval)
+	defer heartbeat.Stop()
+	errLog := logging.NewThrottle(r.logger, 0)
+	heartbeatErrLog := logging.NewThrottle(r.logger, 0)
+
+	for {
+		select {
+		case <-r.stopChan:
+			return
+		case <-heartbeat.C:
+			r.keepAlive(ctx, heartbeatErrLog)
+		case <-ticker.C:
+			r.mu.Lock()
+			idle := !r.ready || len(r.pending) == 0
+			offset := r.offset
+			r.mu.Unlock()
+			if idle {
+				continue
+			}
+
+			msgs, err := r.factory.GetMessageManager().GetMessages(ctx, r.replyTopic, "", 0, offset, r.cfg.PullingSize)
+			if err != nil {
+				if !strings.Contains(err.Error(), "doesn't exist") {
+					errLog.Error("Failed to get replies", "error", err)
+				}
+				continue
+			}
+			errLog.Reset()
+
+			r.mu.Lock()
+			for _, msg := range msgs {
+				r.offset = msg.Offset
+				if replyChan, ok := r.pending[msg.Headers[model.HeaderCorrelationID]]; ok {
+					replyChan <- msg
+					delete(r.pending, msg.Headers[model.HeaderCorrelationID])
+				}
+			}
+			r.mu.Unlock()
+		}
+	}
+}
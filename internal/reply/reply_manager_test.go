@@ -0,0 +1,106 @@
+package reply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// MockFactory implements interfaces.Factory for testing
+type MockFactory struct {
+	mock.Mock
+	interfaces.Factory
+}
+
+func (m *MockFactory) GetProducerManager() interfaces.ProducerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ProducerManager)
+}
+
+// MockProducerManager implements interfaces.ProducerManager for testing
+type MockProducerManager struct {
+	mock.Mock
+}
+
+func (m *MockProducerManager) SendSync(ctx context.Context, msg *model.Message) (string, error) {
+	args := m.Called(ctx, msg)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockProducerManager) SendAsync(ctx context.Context, msg *model.Message, callback func(string, error)) error {
+	args := m.Called(ctx, msg, callback)
+	return args.Error(0)
+}
+
+func (m *MockProducerManager) Start(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockProducerManager) Stop(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func TestReplyManager_Reply(t *testing.T) {
+	mockFactory := new(MockFactory)
+	mockProducer := new(MockProducerManager)
+	mockFactory.On("GetProducerManager").Return(mockProducer)
+
+	mockProducer.On("SendSync", mock.Anything, mock.MatchedBy(func(msg *model.Message) bool {
+		return msg.Topic == "mqx_reply_abc" &&
+			msg.Headers[model.HeaderCorrelationID] == "corr-1" &&
+			string(msg.Body) == "pong"
+	})).Return("reply-1", nil)
+
+	rm := &replyManagerImpl{cfg: &config.Config{}, factory: mockFactory, logger: logging.Discard()}
+	request := &model.Message{Headers: map[string]string{
+		model.HeaderCorrelationID: "corr-1",
+		model.HeaderReplyTo:       "mqx_reply_abc",
+	}}
+
+	id, err := rm.Reply(context.Background(), request, &model.Message{Body: []byte("pong")})
+	assert.NoError(t, err)
+	assert.Equal(t, "reply-1", id)
+	mockProducer.AssertExpectations(t)
+}
+
+func TestReplyManager_Reply_NoReplyTo(t *testing.T) {
+	rm := &replyManagerImpl{cfg: &config.Config{}, logger: logging.Discard()}
+
+	_, err := rm.Reply(context.Background(), &model.Message{}, &model.Message{Body: []byte("pong")})
+	assert.Equal(t, ErrNoReplyTo, err)
+}
+
+func TestReplyManager_KeepAlive(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rm := &replyManagerImpl{db: db, cfg: &config.Config{}, hostname: "host-1", replyTopic: "mqx_reply_abc", ready: true, logger: logging.Discard()}
+	errLog := logging.NewThrottle(rm.logger, 0)
+
+	smock.ExpectExec("UPDATE mqx_consumer_instances").
+		WithArgs(model.ReplyGroup, "mqx_reply_abc", "abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	rm.keepAlive(context.Background(), errLog)
+	assert.True(t, rm.ready)
+
+	// The heartbeat was deleted with the topic by the clear manager
+	smock.ExpectExec("UPDATE mqx_consumer_instances").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	smock.ExpectExec("INSERT INTO mqx_consumer_instances").
+		WithArgs(model.ReplyGroup, "mqx_reply_abc", "abc", "host-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	rm.keepAlive(context.Background(), errLog)
+	assert.False(t, rm.ready)
+
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
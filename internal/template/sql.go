@@ -56,12 +56,21 @@ var DeleteUnactiveConsumerInstance string
 //go:embed sql/consumer/delete_consumer_offsets.sql
 var DeleteConsumerOffsets string
 
+//go:embed sql/consumer/delete_group_offsets.sql
+var DeleteGroupOffsets string
+
+//go:embed sql/consumer/delete_group_instances.sql
+var DeleteGroupInstances string
+
 //go:embed sql/consumer/select_consumer_offsets.sql
 var SelectConsumerOffsets string
 
 //go:embed sql/consumer/select_consumer_instances.sql
 var SelectConsumerInstances string
 
+//go:embed sql/consumer/reset_consumer_offset.sql
+var ResetConsumerOffset string
+
 // Delay message related SQL statements
 //
 //go:embed sql/delay/create_delay_message_table.sql
@@ -79,6 +88,18 @@ var DeleteDelayMessage string
 //go:embed sql/delay/delete_delay_messages_by_topic.sql
 var DeleteDelayMessagesByTopic string
 
+//go:embed sql/delay/get_delay_queue_stat.sql
+var GetDelayQueueStat string
+
+//go:embed sql/delay/select_delay_messages.sql
+var SelectDelayMessages string
+
+//go:embed sql/delay/count_delay_messages.sql
+var CountDelayMessages string
+
+//go:embed sql/delay/delete_delay_message_by_message_id.sql
+var DeleteDelayMessageByMessageID string
+
 //go:embed sql/lock/get_lock.sql
 var GetLock string
 
@@ -90,12 +111,22 @@ var ReleaseLock string
 //go:embed sql/message/create_message_table.sql
 var CreateMessageTableTemplate string
 
+// AddHeadersColumnTemplate upgrades a message, delay or half message table created before messages had headers
+//
+//go:embed sql/message/add_headers_column.sql
+var AddHeadersColumnTemplate string
+
 //go:embed sql/message/drop_message_table.sql
 var DropMessageTableTemplate string
 
 //go:embed sql/message/insert_message.sql
 var InsertMessageTemplate string
 
+// InsertMessagesTemplate takes the table name and the comma separated value rows
+//
+//go:embed sql/message/insert_messages.sql
+var InsertMessagesTemplate string
+
 //go:embed sql/message/select_messages.sql
 var SelectMessagesTemplate string
 
@@ -108,5 +139,107 @@ var DeleteMessages string
 //go:embed sql/message/select_partition_stat.sql
 var SelectPartitionStatTemplate string
 
-//go:embed sql/message/select_messages2.sql
-var SelectMessages2Template string
+//go:embed sql/message/search_messages.sql
+var SearchMessagesTemplate string
+
+//go:embed sql/message/count_messages.sql
+var CountMessagesTemplate string
+
+//go:embed sql/message/select_offset_by_time.sql
+var SelectOffsetByTimeTemplate string
+
+//go:embed sql/message/update_message_headers.sql
+var UpdateMessageHeadersTemplate string
+
+// SelectTablesWithoutSearchIndexes lists the partition tables created before they had the key and born time indexes
+//
+//go:embed sql/message/select_tables_without_search_indexes.sql
+var SelectTablesWithoutSearchIndexes string
+
+//go:embed sql/message/add_key_index.sql
+var AddKeyIndexTemplate string
+
+//go:embed sql/message/add_born_time_index.sql
+var AddBornTimeIndexTemplate string
+
+// Transaction (half) message related SQL statements
+//
+//go:embed sql/transaction/create_half_message_table.sql
+var CreateHalfMessageTable string
+
+//go:embed sql/transaction/insert_half_message.sql
+var InsertHalfMessage string
+
+//go:embed sql/transaction/get_half_message.sql
+var GetHalfMessage string
+
+//go:embed sql/transaction/get_unresolved_half_messages.sql
+var GetUnresolvedHalfMessages string
+
+//go:embed sql/transaction/claim_half_message_check.sql
+var ClaimHalfMessageCheck string
+
+//go:embed sql/transaction/delete_half_message.sql
+var DeleteHalfMessage string
+
+//go:embed sql/transaction/delete_half_messages_by_topic.sql
+var DeleteHalfMessagesByTopic string
+
+// Message trace related SQL statements
+//
+//go:embed sql/trace/create_message_trace_table.sql
+var CreateMessageTraceTable string
+
+// InsertMessageTraces takes the comma separated value rows
+//
+//go:embed sql/trace/insert_message_traces.sql
+var InsertMessageTraces string
+
+//go:embed sql/trace/get_message_traces.sql
+var GetMessageTraces string
+
+//go:embed sql/trace/delete_message_traces.sql
+var DeleteMessageTraces string
+
+// Health check related SQL statements
+//
+//go:embed sql/health/get_system_tables.sql
+var GetSystemTables string
+
+// Audit log related SQL statements
+//
+//go:embed sql/audit/create_audit_log_table.sql
+var CreateAuditLogTable string
+
+//go:embed sql/audit/insert_audit_log.sql
+var InsertAuditLog string
+
+// SelectAuditLog is a templatex template taking the filter fields
+//
+//go:embed sql/audit/select_audit_log.sql
+var SelectAuditLog string
+
+// CountAuditLog is a templatex template taking the filter fields
+//
+//go:embed sql/audit/count_audit_log.sql
+var CountAuditLog string
+
+//go:embed sql/audit/delete_audit_log.sql
+var DeleteAuditLog string
+
+// Webhook subscription related SQL statements
+//
+//go:embed sql/webhook/create_webhook_subscriptions_table.sql
+var CreateWebhookSubscriptionsTable string
+
+//go:embed sql/webhook/upsert_webhook_subscription.sql
+var UpsertWebhookSubscription string
+
+//go:embed sql/webhook/select_webhook_subscriptions.sql
+var SelectWebhookSubscriptions string
+
+//go:embed sql/webhook/get_webhook_subscription.sql
+var GetWebhookSubscription string
+
+//go:embed sql/webhook/delete_webhook_subscription.sql
+var DeleteWebhookSubscription string
@@ -0,0 +1,18 @@
+SELECT COUNT(*)
+FROM `mqx_audit_log`
+WHERE 1 = 1
+{{if .User}}
+    AND `user` = ?
+{{end}}
+{{if .Action}}
+    AND `action` = ?
+{{end}}
+{{if .Target}}
+    AND `target` = ?
+{{end}}
+{{if .HasFrom}}
+    AND `time` >= ?
+{{end}}
+{{if .HasTo}}
+    AND `time` < ?
+{{end}}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS mqx_audit_log (
+    `id` BIGINT AUTO_INCREMENT PRIMARY KEY,
+    `user` VARCHAR(255) NOT NULL,
+    `role` VARCHAR(32) NOT NULL,
+    `action` VARCHAR(64) NOT NULL,
+    `target` VARCHAR(255) NOT NULL,
+    `before` TEXT NULL,
+    `after` TEXT NULL,
+    `result` VARCHAR(16) NOT NULL,
+    `error` TEXT NULL,
+    `client_ip` VARCHAR(64) NOT NULL,
+    `time` DATETIME(3) NOT NULL,
+    INDEX `idx_time` (`time`),
+    INDEX `idx_user_time` (`user`, `time`),
+    INDEX `idx_action_time` (`action`, `time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+DELETE FROM mqx_audit_log WHERE `time` < ?
@@ -0,0 +1,2 @@
+INSERT INTO mqx_audit_log (`user`, `role`, `action`, `target`, `before`, `after`, `result`, `error`, `client_ip`, `time`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
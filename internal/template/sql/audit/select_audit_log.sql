@@ -0,0 +1,20 @@
+SELECT `id`, `user`, `role`, `action`, `target`, `before`, `after`, `result`, `error`, `client_ip`, `time`
+FROM `mqx_audit_log`
+WHERE 1 = 1
+{{if .User}}
+    AND `user` = ?
+{{end}}
+{{if .Action}}
+    AND `action` = ?
+{{end}}
+{{if .Target}}
+    AND `target` = ?
+{{end}}
+{{if .HasFrom}}
+    AND `time` >= ?
+{{end}}
+{{if .HasTo}}
+    AND `time` < ?
+{{end}}
+ORDER BY `time` DESC, `id` DESC
+LIMIT ? OFFSET ?
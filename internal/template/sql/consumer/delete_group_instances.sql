@@ -0,0 +1 @@
+DELETE FROM `mqx_consumer_instances` WHERE `group` = ? AND `topic` = ?
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM `mqx_consumer_offsets` WHERE `group` = ? AND `topic` = ?
\ No newline at end of file
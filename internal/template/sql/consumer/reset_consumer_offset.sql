@@ -0,0 +1 @@
+UPDATE mqx_consumer_offsets SET `offset` = ? WHERE `group` = ? AND `topic` = ? AND `partition` = ?
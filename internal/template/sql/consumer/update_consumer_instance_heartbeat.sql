@@ -1,4 +1,3 @@
 UPDATE mqx_consumer_instances 
-SET heartbeat = NOW(), active = TRUE
-WHERE `group` = ? AND `topic` = ? AND instance_id = ?
-
+SET heartbeat = NOW()
+WHERE `group` = ? AND `topic` = ? AND instance_id = ? AND active = TRUE
@@ -0,0 +1,6 @@
+SELECT COUNT(*)
+FROM mqx_delay_messages
+WHERE 1 = 1
+{{if .Topic}}
+    AND `topic` = ?
+{{end}}
@@ -8,5 +8,6 @@ CREATE TABLE IF NOT EXISTS mqx_delay_messages (
     `born_time` DATETIME NOT NULL,
     `delay_time` DATETIME NOT NULL,
     `retry_count` INT NOT NULL DEFAULT 0,
+    `headers` TEXT,
     INDEX `idx_delay_time` (`delay_time`)
 ) ENGINE=InnoDB;
@@ -0,0 +1 @@
+DELETE FROM mqx_delay_messages WHERE `message_id` = ?
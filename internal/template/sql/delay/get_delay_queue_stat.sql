@@ -0,0 +1,4 @@
+SELECT
+    COUNT(*),
+    MIN(`delay_time`)
+FROM mqx_delay_messages;
@@ -7,7 +7,8 @@ SELECT
     `body`,
     `born_time`,
     `delay_time`,
-    `retry_count`
+    `retry_count`,
+    `headers`
 FROM mqx_delay_messages
 WHERE `delay_time` <= ?
 ORDER BY `born_time` ASC
@@ -6,7 +6,8 @@ INSERT INTO mqx_delay_messages (
     `body`,
     `born_time`,
     `delay_time`,
-    `retry_count`
+    `retry_count`,
+    `headers`
 ) VALUES (
     ?,
     ?,
@@ -15,5 +16,6 @@ INSERT INTO mqx_delay_messages (
     ?,
     ?,
     ?,
+    ?,
     ?
 );
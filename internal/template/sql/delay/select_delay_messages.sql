@@ -0,0 +1,18 @@
+SELECT
+    `id`,
+    `message_id`,
+    `topic`,
+    `key`,
+    `tag`,
+    `body`,
+    `born_time`,
+    `delay_time`,
+    `retry_count`,
+    `headers`
+FROM mqx_delay_messages
+WHERE 1 = 1
+{{if .Topic}}
+    AND `topic` = ?
+{{end}}
+ORDER BY `delay_time` ASC, `id` ASC
+LIMIT ? OFFSET ?
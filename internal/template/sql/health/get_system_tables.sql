@@ -0,0 +1,3 @@
+SELECT `table_name`
+FROM `information_schema`.`tables`
+WHERE `table_schema` = DATABASE() AND `table_name` LIKE 'mqx\_%'
@@ -0,0 +1 @@
+ALTER TABLE `%s` ADD KEY `idx_born_time` (`born_time`)
@@ -0,0 +1 @@
+ALTER TABLE `%s` ADD COLUMN `headers` TEXT
@@ -0,0 +1 @@
+ALTER TABLE `%s` ADD KEY `idx_key` (`key`)
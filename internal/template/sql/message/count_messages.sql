@@ -0,0 +1,24 @@
+SELECT COUNT(*)
+FROM `{{.TableName}}`
+WHERE 1 = 1
+{{if .MessageID}}
+    AND `message_id` = ?
+{{end}}
+{{if .Tag}}
+    AND `tag` = ?
+{{end}}
+{{if .Key}}
+    AND `key` = ?
+{{end}}
+{{if .HasFrom}}
+    AND `born_time` >= ?
+{{end}}
+{{if .HasTo}}
+    AND `born_time` < ?
+{{end}}
+{{if .FromOffset}}
+    AND `offset` >= ?
+{{end}}
+{{if .ToOffset}}
+    AND `offset` <= ?
+{{end}}
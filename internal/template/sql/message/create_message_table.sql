@@ -6,6 +6,9 @@ CREATE TABLE IF NOT EXISTS `%s` (
     `body` BLOB,
     `born_time` DATETIME NOT NULL,
     `retry_count` INT NOT NULL DEFAULT 0,
+    `headers` TEXT,
     KEY `idx_message_id` (`message_id`),
-    KEY `idx_tag` (`tag`)
+    KEY `idx_tag` (`tag`),
+    KEY `idx_key` (`key`),
+    KEY `idx_born_time` (`born_time`)
 ) ENGINE = InnoDB
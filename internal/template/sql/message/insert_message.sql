@@ -4,12 +4,14 @@ INSERT INTO `%s` (
     `key`,
     `body`,
     `born_time`,
-    `retry_count`
+    `retry_count`,
+    `headers`
 ) VALUES (
     ?,
     ?,
     ?,
     ?,
     ?,
+    ?,
     ?
 )
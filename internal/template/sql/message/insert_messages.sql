@@ -0,0 +1,9 @@
+INSERT INTO `%s` (
+    `message_id`,
+    `tag`,
+    `key`,
+    `body`,
+    `born_time`,
+    `retry_count`,
+    `headers`
+) VALUES %s
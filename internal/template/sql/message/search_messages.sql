@@ -0,0 +1,37 @@
+SELECT
+    `message_id`,
+    `tag`,
+    `key`,
+    `body`,
+    `born_time`,
+    `offset`,
+    `retry_count`,
+    `headers`
+FROM `{{.TableName}}`
+WHERE 1 = 1
+{{if .MessageID}}
+    AND `message_id` = ?
+{{end}}
+{{if .Tag}}
+    AND `tag` = ?
+{{end}}
+{{if .Key}}
+    AND `key` = ?
+{{end}}
+{{if .HasFrom}}
+    AND `born_time` >= ?
+{{end}}
+{{if .HasTo}}
+    AND `born_time` < ?
+{{end}}
+{{if .FromOffset}}
+    AND `offset` >= ?
+{{end}}
+{{if .ToOffset}}
+    AND `offset` <= ?
+{{end}}
+{{if .HasCursor}}
+    AND (`born_time` {{.CursorCmp}} ?{{if .CursorOffset}} OR (`born_time` = ? AND `offset` < ?){{end}})
+{{end}}
+ORDER BY `born_time` DESC, `offset` DESC
+LIMIT ?
@@ -5,7 +5,8 @@ SELECT
     `body`,
     `born_time`,
     `offset`,
-    `retry_count`
+    `retry_count`,
+    `headers`
 FROM `%s`
 WHERE `offset` > ?
 ORDER BY `offset` ASC
@@ -0,0 +1 @@
+SELECT COALESCE(MIN(`offset`), 0) FROM `%s` WHERE `born_time` >= ?
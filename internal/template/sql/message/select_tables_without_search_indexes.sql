@@ -0,0 +1,9 @@
+SELECT t.`TABLE_NAME`
+FROM information_schema.`TABLES` t
+WHERE t.`TABLE_SCHEMA` = DATABASE()
+  AND t.`TABLE_NAME` LIKE 'mqx\_messages\_%'
+  AND (SELECT COUNT(DISTINCT s.`INDEX_NAME`)
+       FROM information_schema.`STATISTICS` s
+       WHERE s.`TABLE_SCHEMA` = t.`TABLE_SCHEMA`
+         AND s.`TABLE_NAME` = t.`TABLE_NAME`
+         AND s.`INDEX_NAME` IN ('idx_key', 'idx_born_time')) < 2
@@ -0,0 +1 @@
+UPDATE `%s` SET `headers` = ? WHERE `offset` = ?
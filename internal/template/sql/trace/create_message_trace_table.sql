@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS mqx_message_traces (
+    `id` BIGINT PRIMARY KEY AUTO_INCREMENT,
+    `message_id` VARCHAR(64) NOT NULL,
+    `topic` VARCHAR(256) NOT NULL,
+    `event` VARCHAR(32) NOT NULL,
+    `group_name` VARCHAR(256) NOT NULL DEFAULT '',
+    `instance_id` VARCHAR(64) NOT NULL DEFAULT '',
+    `partition_num` INT NOT NULL DEFAULT 0,
+    `offset` BIGINT NOT NULL DEFAULT 0,
+    `retry_count` INT NOT NULL DEFAULT 0,
+    `result` VARCHAR(16) NOT NULL DEFAULT '',
+    `error` TEXT,
+    `delay_time` DATETIME(3) NULL,
+    `event_time` DATETIME(3) NOT NULL,
+    INDEX `idx_message_id` (`message_id`),
+    INDEX `idx_event_time` (`event_time`)
+) ENGINE=InnoDB;
@@ -0,0 +1 @@
+DELETE FROM mqx_message_traces WHERE `event_time` < ?
\ No newline at end of file
@@ -0,0 +1,5 @@
+SELECT `id`, `message_id`, `topic`, `event`, `group_name`, `instance_id`, `partition_num`, `offset`,
+    `retry_count`, `result`, `error`, `delay_time`, `event_time`
+FROM mqx_message_traces
+WHERE `message_id` = ?
+ORDER BY `event_time`, `id`
@@ -0,0 +1,14 @@
+INSERT INTO mqx_message_traces (
+    `message_id`,
+    `topic`,
+    `event`,
+    `group_name`,
+    `instance_id`,
+    `partition_num`,
+    `offset`,
+    `retry_count`,
+    `result`,
+    `error`,
+    `delay_time`,
+    `event_time`
+) VALUES %s
@@ -0,0 +1,3 @@
+UPDATE mqx_half_messages
+SET `check_time` = ?, `check_times` = `check_times` + 1
+WHERE `id` = ? AND `check_times` = ?
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS mqx_half_messages (
+    `id` BIGINT PRIMARY KEY AUTO_INCREMENT,
+    `message_id` VARCHAR(64) NOT NULL,
+    `topic` VARCHAR(256) NOT NULL,
+    `key` VARCHAR(256),
+    `tag` VARCHAR(256),
+    `body` BLOB NOT NULL,
+    `born_time` DATETIME NOT NULL,
+    `headers` TEXT,
+    `delay` BIGINT NOT NULL DEFAULT 0,
+    `check_time` DATETIME NOT NULL,
+    `check_times` INT NOT NULL DEFAULT 0,
+    UNIQUE KEY `uk_message_id` (`message_id`),
+    INDEX `idx_topic_check_time` (`topic`, `check_time`)
+) ENGINE=InnoDB;
@@ -0,0 +1 @@
+DELETE FROM mqx_half_messages WHERE `message_id` = ?
\ No newline at end of file
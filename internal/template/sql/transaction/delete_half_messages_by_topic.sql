@@ -0,0 +1 @@
+DELETE FROM mqx_half_messages WHERE `topic` = ?
@@ -0,0 +1,14 @@
+SELECT
+    `id`,
+    `message_id`,
+    `topic`,
+    `key`,
+    `tag`,
+    `body`,
+    `born_time`,
+    `headers`,
+    `delay`,
+    `check_time`,
+    `check_times`
+FROM mqx_half_messages
+WHERE `message_id` = ?
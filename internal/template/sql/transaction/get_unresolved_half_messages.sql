@@ -0,0 +1,16 @@
+SELECT
+    `id`,
+    `message_id`,
+    `topic`,
+    `key`,
+    `tag`,
+    `body`,
+    `born_time`,
+    `headers`,
+    `delay`,
+    `check_time`,
+    `check_times`
+FROM mqx_half_messages
+WHERE `topic` = ? AND `check_time` <= ?
+ORDER BY `id` ASC
+LIMIT 100;
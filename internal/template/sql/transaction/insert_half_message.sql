@@ -0,0 +1,21 @@
+INSERT INTO mqx_half_messages (
+    `message_id`,
+    `topic`,
+    `key`,
+    `tag`,
+    `body`,
+    `born_time`,
+    `headers`,
+    `delay`,
+    `check_time`
+) VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS mqx_webhook_subscriptions (
+    `topic` VARCHAR(255) NOT NULL,
+    `group` VARCHAR(255) NOT NULL,
+    `url` VARCHAR(2048) NOT NULL,
+    `secret` VARCHAR(255) NOT NULL,
+    `concurrency` INT NOT NULL,
+    `rate_limit` DOUBLE NOT NULL,
+    `timeout_ms` BIGINT NOT NULL,
+    `created_time` DATETIME(3) NOT NULL,
+    `updated_time` DATETIME(3) NOT NULL,
+    PRIMARY KEY(`topic`, `group`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+DELETE FROM mqx_webhook_subscriptions WHERE `topic` = ? AND `group` = ?
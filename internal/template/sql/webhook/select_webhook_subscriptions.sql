@@ -0,0 +1,3 @@
+SELECT `topic`, `group`, `url`, `secret`, `concurrency`, `rate_limit`, `timeout_ms`, `created_time`, `updated_time`
+FROM mqx_webhook_subscriptions
+ORDER BY `topic`, `group`
@@ -0,0 +1,4 @@
+INSERT INTO mqx_webhook_subscriptions (`topic`, `group`, `url`, `secret`, `concurrency`, `rate_limit`, `timeout_ms`, `created_time`, `updated_time`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE `url` = VALUES(`url`), `secret` = VALUES(`secret`), `concurrency` = VALUES(`concurrency`),
+    `rate_limit` = VALUES(`rate_limit`), `timeout_ms` = VALUES(`timeout_ms`), `updated_time` = VALUES(`updated_time`)
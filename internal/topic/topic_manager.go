@@ -10,7 +10,6 @@ import (
 	"github.com/wenzuojing/mqx/internal/interfaces"
 	"github.com/wenzuojing/mqx/internal/model"
 	"github.com/wenzuojing/mqx/internal/template"
-	"k8s.io/klog/v2"
 )
 
 // NewTopicManager creates a new topic manager with default partition settings
@@ -26,10 +25,10 @@ type topicManager struct {
 
 func (t *topicManager) Start(ctx context.Context) error {
 	if _, err := t.db.Exec(template.CreateTopicMetaTable); err != nil {
-		klog.Errorf("Failed to create topic_metas table: %v", err)
+		t.factory.GetLogger().Error("Failed to create topic_metas table", "error", err)
 		return err
 	}
-	klog.V(2).Info("Created/verified topic_metas table")
+	t.factory.GetLogger().Debug("Created/verified topic_metas table")
 	return nil
 }
 
@@ -38,6 +37,21 @@ func (t *topicManager) Stop(ctx context.Context) error {
 }
 
 func (s *topicManager) GetTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	meta, err := s.FindTopicMeta(ctx, topic)
+	if errors.Is(err, model.ErrTopicNotFound) {
+		meta = &model.TopicMeta{Topic: topic, PartitionNum: s.cfg.DefaultPartitionNum, RetentionDays: s.cfg.RetentionDays}
+		if err := s.CreateTopic(ctx, meta); err != nil {
+			return nil, err
+		}
+		return meta, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func (s *topicManager) FindTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
 	stmt, err := s.db.Prepare(template.GetTopicMeta)
 
 	if err != nil {
@@ -48,10 +62,7 @@ func (s *topicManager) GetTopicMeta(ctx context.Context, topic string) (*model.T
 	var meta model.TopicMeta
 	err = stmt.QueryRow(topic).Scan(&meta.Topic, &meta.PartitionNum, &meta.RetentionDays)
 	if err == sql.ErrNoRows {
-		if err := s.CreateTopic(ctx, &model.TopicMeta{Topic: topic, PartitionNum: s.cfg.DefaultPartitionNum, RetentionDays: s.cfg.RetentionDays}); err != nil {
-			return nil, err
-		}
-		return &model.TopicMeta{Topic: topic, PartitionNum: s.cfg.DefaultPartitionNum, RetentionDays: s.cfg.RetentionDays}, nil
+		return nil, fmt.Errorf("%w: %s", model.ErrTopicNotFound, topic)
 	}
 	if err != nil {
 		return nil, err
@@ -136,7 +147,11 @@ func (t *topicManager) DeleteTopic(ctx context.Context, topic string) error {
 	t.factory.GetConsumerManager().DeleteConsumerOffsets(ctx, topicMeta.Topic)
 	//delete delay messages
 	if err := t.factory.GetDelayManager().DeleteMessagesByTopic(ctx, topicMeta.Topic); err != nil {
-		klog.Warningf("Failed to delete delay messages for topic %s: %v", topicMeta.Topic, err)
+		t.factory.GetLogger().Warn("Failed to delete delay messages", "topic", topicMeta.Topic, "error", err)
+	}
+	//delete half messages
+	if err := t.factory.GetTransactionManager().DeleteMessagesByTopic(ctx, topicMeta.Topic); err != nil {
+		t.factory.GetLogger().Warn("Failed to delete half messages", "topic", topicMeta.Topic, "error", err)
 	}
 
 	_, err = t.db.ExecContext(ctx, template.DeleteTopicMeta, topic)
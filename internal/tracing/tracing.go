@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wenzuojing/mqx/internal/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/wenzuojing/mqx"
+
+// Span attribute keys, following the OpenTelemetry messaging conventions where they exist
+const (
+	AttrSystem      = attribute.Key("messaging.system")
+	AttrOperation   = attribute.Key("messaging.operation.type")
+	AttrDestination = attribute.Key("messaging.destination.name")
+	AttrPartition   = attribute.Key("messaging.destination.partition.id")
+	AttrMessageID   = attribute.Key("messaging.message.id")
+	AttrGroup       = attribute.Key("messaging.consumer.group.name")
+	AttrOffset      = attribute.Key("messaging.mqx.offset")
+	AttrRetryCount  = attribute.Key("messaging.mqx.retry_count")
+	AttrDelay       = attribute.Key("messaging.mqx.delay_ms")
+)
+
+// Tracer creates the spans of one MQX instance and carries trace context in message headers.
+// All methods are safe to call on a nil *Tracer, which creates no spans.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates a tracer. A nil provider falls back to the global OpenTelemetry provider,
+// and a nil propagator to W3C trace context.
+func New(provider trace.TracerProvider, propagator propagation.TextMapPropagator) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+	return &Tracer{tracer: provider.Tracer(instrumentationName), propagator: propagator}
+}
+
+// StartSend starts the producer span of a message and injects its context into the message headers
+func (t *Tracer) StartSend(ctx context.Context, msg *model.Message) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, noop.Span{}
+	}
+	attrs := []attribute.KeyValue{
+		AttrSystem.String("mqx"),
+		AttrOperation.String("publish"),
+		AttrDestination.String(msg.Topic),
+	}
+	if msg.Delay > 0 {
+		attrs = append(attrs, AttrDelay.Int64(msg.Delay.Milliseconds()))
+	}
+	ctx, span := t.tracer.Start(ctx, fmt.Sprintf("%s publish", msg.Topic),
+		trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attrs...))
+	t.inject(ctx, msg)
+	return ctx, span
+}
+
+// SendDone sets the attributes known once the message is stored and ends the producer span
+func (t *Tracer) SendDone(span trace.Span, msg *model.Message, err error) {
+	if t == nil {
+		return
+	}
+	span.SetAttributes(AttrMessageID.String(msg.MessageID), AttrPartition.String(fmt.Sprint(msg.Partition)))
+	End(span, err)
+}
+
+// StartDeliver starts the span moving a delayed or retried message back to its topic,
+// as a child of the context stored with the message, and stores the new context in its place
+func (t *Tracer) StartDeliver(ctx context.Context, msg *model.Message) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, noop.Span{}
+	}
+	ctx = t.extract(ctx, msg)
+	ctx, span := t.tracer.Start(ctx, fmt.Sprintf("%s deliver", msg.Topic),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			AttrSystem.String("mqx"),
+			AttrDestination.String(msg.Topic),
+			AttrMessageID.String(msg.MessageID),
+			AttrRetryCount.Int(msg.RetryCount),
+		))
+	t.inject(ctx, msg)
+	return ctx, span
+}
+
+// StartProcess starts the consumer span around a handler invocation.
+// The span is linked to the span whose context is stored with the message.
+func (t *Tracer) StartProcess(ctx context.Context, msg *model.Message, group string) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, noop.Span{}
+	}
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			AttrSystem.String("mqx"),
+			AttrOperation.String("process"),
+			AttrDestination.String(msg.Topic),
+			AttrPartition.String(fmt.Sprint(msg.Partition)),
+			AttrOffset.Int64(msg.Offset),
+			AttrGroup.String(group),
+			AttrMessageID.String(msg.MessageID),
+			AttrRetryCount.Int(msg.RetryCount),
+		),
+	}
+	if producer := trace.SpanContextFromContext(t.extract(context.Background(), msg)); producer.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+	}
+	return t.tracer.Start(ctx, fmt.Sprintf("%s process", msg.Topic), opts...)
+}
+
+// Inject stores the trace context of ctx in the message headers, replacing any previous one
+func (t *Tracer) Inject(ctx context.Context, msg *model.Message) {
+	if t == nil {
+		return
+	}
+	t.inject(ctx, msg)
+}
+
+func (t *Tracer) inject(ctx context.Context, msg *model.Message) {
+	// Copy the headers so a message reused by the caller is never mutated concurrently
+	headers := make(map[string]string, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	for _, field := range t.propagator.Fields() {
+		delete(headers, field)
+	}
+	t.propagator.Inject(ctx, propagation.MapCarrier(headers))
+	if len(headers) == 0 {
+		headers = nil
+	}
+	msg.Headers = headers
+}
+
+func (t *Tracer) extract(ctx context.Context, msg *model.Message) context.Context {
+	if len(msg.Headers) == 0 {
+		return ctx
+	}
+	return t.propagator.Extract(ctx, propagation.MapCarrier(msg.Headers))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
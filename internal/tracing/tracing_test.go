@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracer() (*Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return New(provider, nil), exporter
+}
+
+func attrValue(attrs []attribute.KeyValue, key attribute.Key) attribute.Value {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracer_SendInjectsTraceContext(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	headers := map[string]string{"app": "1"}
+	msg := &model.Message{Topic: "orders", Headers: headers}
+
+	_, span := tracer.StartSend(context.Background(), msg)
+	msg.MessageID = "msg-1"
+	msg.Partition = 2
+	tracer.SendDone(span, msg, nil)
+
+	assert.NotEmpty(t, msg.Headers["traceparent"])
+	assert.Equal(t, "1", msg.Headers["app"])
+	// The caller's map is left untouched
+	assert.NotContains(t, headers, "traceparent")
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "orders publish", spans[0].Name)
+		assert.Equal(t, trace.SpanKindProducer, spans[0].SpanKind)
+		assert.Equal(t, "orders", attrValue(spans[0].Attributes, AttrDestination).AsString())
+		assert.Equal(t, "msg-1", attrValue(spans[0].Attributes, AttrMessageID).AsString())
+		assert.Equal(t, "2", attrValue(spans[0].Attributes, AttrPartition).AsString())
+	}
+}
+
+func TestTracer_DeliverAndProcessFollowProducer(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	msg := &model.Message{Topic: "orders", MessageID: "msg-1"}
+
+	_, sendSpan := tracer.StartSend(context.Background(), msg)
+	tracer.SendDone(sendSpan, msg, nil)
+
+	// Delay queue hands the message back to its topic
+	_, deliverSpan := tracer.StartDeliver(context.Background(), msg)
+	End(deliverSpan, nil)
+
+	// Consumer picks it up from partition 1 at offset 42 on its second attempt
+	msg.Partition = 1
+	msg.Offset = 42
+	msg.RetryCount = 1
+	ctx, processSpan := tracer.StartProcess(context.Background(), msg, "billing")
+	assert.True(t, trace.SpanContextFromContext(ctx).IsValid())
+	End(processSpan, errors.New("boom"))
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	send, deliver, process := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, send.SpanContext.TraceID(), deliver.Parent.TraceID())
+	assert.Equal(t, send.SpanContext.SpanID(), deliver.Parent.SpanID())
+
+	assert.Equal(t, "orders process", process.Name)
+	assert.Equal(t, trace.SpanKindConsumer, process.SpanKind)
+	if assert.Len(t, process.Links, 1) {
+		assert.Equal(t, deliver.SpanContext.SpanID(), process.Links[0].SpanContext.SpanID())
+	}
+	assert.Equal(t, "billing", attrValue(process.Attributes, AttrGroup).AsString())
+	assert.Equal(t, "1", attrValue(process.Attributes, AttrPartition).AsString())
+	assert.Equal(t, int64(42), attrValue(process.Attributes, AttrOffset).AsInt64())
+	assert.Equal(t, int64(1), attrValue(process.Attributes, AttrRetryCount).AsInt64())
+	assert.Equal(t, codes.Error, process.Status.Code)
+}
+
+func TestTracer_ProcessWithoutTraceContext(t *testing.T) {
+	tracer, exporter := newTestTracer()
+
+	_, span := tracer.StartProcess(context.Background(), &model.Message{Topic: "orders"}, "billing")
+	End(span, nil)
+
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		assert.Empty(t, spans[0].Links)
+	}
+}
+
+func TestTracer_NilIsNoop(t *testing.T) {
+	var tracer *Tracer
+	msg := &model.Message{Topic: "orders"}
+
+	ctx, span := tracer.StartSend(context.Background(), msg)
+	tracer.SendDone(span, msg, nil)
+	tracer.Inject(ctx, msg)
+	_, span = tracer.StartProcess(ctx, msg, "billing")
+	End(span, errors.New("boom"))
+
+	assert.Nil(t, msg.Headers)
+}
@@ -0,0 +1,348 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/message"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+	"github.com/wenzuojing/mqx/internal/template"
+)
+
+// ErrHalfMessageNotFound is returned when a half message has already been resolved or never existed
+var ErrHalfMessageNotFound = errors.New("half message not found")
+
+// NewTransactionManager creates a new transaction manager instance
+func NewTransactionManager(db *sql.DB, cfg *config.Config, factory interfaces.Factory) (interfaces.TransactionManager, error) {
+	return &transactionManagerImpl{
+		db:           db,
+		cfg:          cfg,
+		factory:      factory,
+		checkers:     make(map[string]model.TransactionChecker),
+		stopChan:     make(chan struct{}),
+		logger:       factory.GetLogger(),
+		traceManager: factory.GetTraceManager(),
+	}, nil
+}
+
+type transactionManagerImpl struct {
+	db           *sql.DB
+	cfg          *config.Config
+	factory      interfaces.Factory
+	checkers     map[string]model.TransactionChecker
+	mu           sync.RWMutex
+	stopChan     chan struct{}
+	logger       logging.Logger
+	traceManager *msgtrace.Manager
+}
+
+func (t *transactionManagerImpl) Start(ctx context.Context) error {
+	t.logger.Info("Starting transaction manager service")
+	if _, err := t.db.Exec(template.CreateHalfMessageTable); err != nil {
+		t.logger.Error("Failed to create half messages table", "error", err)
+		return err
+	}
+	if err := message.AddHeadersColumn(ctx, t.db, "mqx_half_messages"); err != nil {
+		t.logger.Error("Failed to upgrade half messages table", "error", err)
+		return err
+	}
+	t.logger.Debug("Created/verified half messages table")
+
+	go t.checkLoop(context.Background())
+	t.logger.Info("Transaction manager service started successfully")
+	return nil
+}
+
+func (t *transactionManagerImpl) Stop(ctx context.Context) error {
+	t.logger.Info("Stopping transaction manager service")
+	close(t.stopChan)
+	return nil
+}
+
+func (t *transactionManagerImpl) RegisterChecker(topic string, checker model.TransactionChecker) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checkers[topic] = checker
+}
+
+func (t *transactionManagerImpl) Prepare(ctx context.Context, msg *model.Message) (string, error) {
+	t.logger.Debug("Preparing half message", "topic", msg.Topic)
+	// Checked now rather than when the message is committed or checked back
+	if err := model.ValidateTopic(msg.Topic); err != nil {
+		return "", err
+	}
+	if msg.MessageID == "" {
+		msg.MessageID = uuid.New().String()
+	}
+	_, err := t.db.ExecContext(ctx, template.InsertHalfMessage,
+		msg.MessageID,
+		msg.Topic,
+		msg.Key,
+		msg.Tag,
+		msg.Body,
+		msg.BornTime,
+		model.EncodeHeaders(msg.Headers),
+		msg.Delay.Milliseconds(),
+		msg.BornTime.Add(t.cfg.TransactionTimeout),
+	)
+	if err != nil {
+		t.logger.Error("Failed to insert half message", "topic", msg.Topic, "error", err)
+		return "", err
+	}
+	t.logger.Debug("Successfully prepared half message", "topic", msg.Topic, "messageId", msg.MessageID)
+	return msg.MessageID, nil
+}
+
+func (t *transactionManagerImpl) Commit(ctx context.Context, messageID string) error {
+	msg, err := t.getHalfMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	return t.commit(ctx, msg)
+}
+
+func (t *transactionManagerImpl) Rollback(ctx context.Context, messageID string) error {
+	result, err := t.db.ExecContext(ctx, template.DeleteHalfMessage, messageID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete half message")
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrHalfMessageNotFound
+	}
+	t.logger.Debug("Rolled back half message", "messageId", messageID)
+	return nil
+}
+
+func (t *transactionManagerImpl) DeleteMessagesByTopic(ctx context.Context, topic string) error {
+	t.logger.Info("Deleting half messages", "topic", topic)
+	_, err := t.db.ExecContext(ctx, template.DeleteHalfMessagesByTopic, topic)
+	return err
+}
+
+// commit moves a half message to its topic (or to the delay queue) and removes it
+// from the half message table in the same transaction.
+func (t *transactionManagerImpl) commit(ctx context.Context, msg *model.HalfMessage) error {
+	err := t.transfer(ctx, msg)
+	if err != nil && message.IsMissingMessageTable(err) {
+		// DDL causes implicit commit in MySQL — must repair the table outside tx.
+		// SaveMessageWithTx has already resolved the partition at this point.
+		tableName := fmt.Sprintf("mqx_messages_%s_%d", msg.Topic, msg.Partition)
+		if createErr := message.EnsureMessageTable(ctx, t.db, tableName, err); createErr != nil {
+			return createErr
+		}
+		err = t.transfer(ctx, msg)
+	}
+	if err != nil {
+		return err
+	}
+	t.logger.Debug("Committed half message", "topic", msg.Topic, "messageId", msg.MessageID)
+	return nil
+}
+
+func (t *transactionManagerImpl) transfer(ctx context.Context, msg *model.HalfMessage) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(template.DeleteHalfMessage, msg.MessageID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete half message")
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// Resolved concurrently by another caller or checker
+		return ErrHalfMessageNotFound
+	}
+
+	var event *model.TraceEvent
+	if msg.Delay > 0 {
+		delayTime := time.Now().Add(msg.Delay)
+		_, err = tx.Exec(template.InsertDelayMessage,
+			msg.MessageID,
+			msg.Topic,
+			msg.Key,
+			msg.Tag,
+			msg.Body,
+			msg.BornTime,
+			delayTime,
+			0,
+			model.EncodeHeaders(msg.Headers),
+		)
+		event = msgtrace.NewEvent(&msg.Message, model.TraceDelayScheduled)
+		event.DelayTime = delayTime
+	} else {
+		err = t.factory.GetMessageManager().SaveMessageWithTx(ctx, tx, &msg.Message)
+		event = msgtrace.NewEvent(&msg.Message, model.TraceProduced)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	t.traceManager.Record(event)
+	return nil
+}
+
+func (t *transactionManagerImpl) getHalfMessage(ctx context.Context, messageID string) (*model.HalfMessage, error) {
+	row := t.db.QueryRowContext(ctx, template.GetHalfMessage, messageID)
+	msg, err := scanHalfMessage(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrHalfMessageNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get half message")
+	}
+	return msg, nil
+}
+
+// checkLoop periodically asks registered checkers to resolve half messages
+// left unresolved past the transaction timeout.
+func (t *transactionManagerImpl) checkLoop(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.TransactionCheckInterval)
+	defer ticker.Stop()
+	errLog := logging.NewThrottle(t.logger, 0)
+
+	for {
+		select {
+		case <-t.stopChan:
+			t.logger.Info("Stopping transaction check-back")
+			return
+		case <-ticker.C:
+			t.mu.RLock()
+			checkers := make(map[string]model.TransactionChecker, len(t.checkers))
+			for topic, checker := range t.checkers {
+				checkers[topic] = checker
+			}
+			t.mu.RUnlock()
+
+			// Only topics with a checker in this process are checked here, so an instance
+			// without a checker never burns the check-back budget of another one.
+			for topic, checker := range checkers {
+				if err := t.checkTopic(ctx, topic, checker); err != nil {
+					errLog.Error("Failed to check half messages", "topic", topic, "error", err)
+				} else {
+					errLog.Reset()
+				}
+			}
+		}
+	}
+}
+
+func (t *transactionManagerImpl) checkTopic(ctx context.Context, topic string, checker model.TransactionChecker) error {
+	rows, err := t.db.QueryContext(ctx, template.GetUnresolvedHalfMessages, topic, time.Now())
+	if err != nil {
+		return err
+	}
+	var messages []*model.HalfMessage
+	for rows.Next() {
+		msg, err := scanHalfMessage(rows)
+		if err != nil {
+			t.logger.Warn("Failed to scan half message", "topic", topic, "error", err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+
+	for _, msg := range messages {
+		claimed, err := t.claimCheck(ctx, msg)
+		if err != nil {
+			t.logger.Error("Failed to claim half message for check-back", "topic", topic, "messageId", msg.MessageID, "error", err)
+			continue
+		}
+		if !claimed {
+			// Another instance is checking this message
+			continue
+		}
+		t.resolve(ctx, msg, checker)
+	}
+	return nil
+}
+
+// claimCheck pushes the next check time forward and bumps the check counter.
+// The update only succeeds for the instance that observed the current counter.
+func (t *transactionManagerImpl) claimCheck(ctx context.Context, msg *model.HalfMessage) (bool, error) {
+	result, err := t.db.ExecContext(ctx, template.ClaimHalfMessageCheck,
+		time.Now().Add(t.cfg.TransactionCheckInterval), msg.ID, msg.CheckTimes)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+	msg.CheckTimes++
+	return true, nil
+}
+
+func (t *transactionManagerImpl) resolve(ctx context.Context, msg *model.HalfMessage, checker model.TransactionChecker) {
+	state := t.callChecker(checker, msg.Topic, msg.MessageID)
+	switch state {
+	case model.TransactionCommit:
+		if err := t.commit(ctx, msg); err != nil && err != ErrHalfMessageNotFound {
+			t.logger.Error("Failed to commit checked half message", "topic", msg.Topic, "messageId", msg.MessageID, "error", err)
+		}
+	case model.TransactionRollback:
+		if err := t.Rollback(ctx, msg.MessageID); err != nil && err != ErrHalfMessageNotFound {
+			t.logger.Error("Failed to roll back checked half message", "topic", msg.Topic, "messageId", msg.MessageID, "error", err)
+		}
+	default:
+		if msg.CheckTimes >= t.cfg.TransactionCheckMaxTimes {
+			t.logger.Warn("Half message still unresolved, rolling back", "topic", msg.Topic, "messageId", msg.MessageID, "checkTimes", msg.CheckTimes)
+			if err := t.Rollback(ctx, msg.MessageID); err != nil && err != ErrHalfMessageNotFound {
+				t.logger.Error("Failed to roll back half message", "topic", msg.Topic, "messageId", msg.MessageID, "error", err)
+			}
+		}
+	}
+}
+
+// callChecker invokes the checker, treating a panic as an unknown state
+func (t *transactionManagerImpl) callChecker(checker model.TransactionChecker, topic string, messageID string) (state model.TransactionState) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.logger.Error("Transaction checker panicked", "topic", topic, "messageId", messageID, "panic", r)
+			state = model.TransactionUnknown
+		}
+	}()
+	return checker(topic, messageID)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanHalfMessage(row rowScanner) (*model.HalfMessage, error) {
+	var msg model.HalfMessage
+	var headers sql.NullString
+	var delay int64
+	err := row.Scan(&msg.ID, &msg.MessageID, &msg.Topic, &msg.Key, &msg.Tag, &msg.Body, &msg.BornTime, &headers, &delay,
+		&msg.CheckTime, &msg.CheckTimes)
+	if err != nil {
+		return nil, err
+	}
+	msg.Headers = model.DecodeHeaders(headers)
+	msg.Delay = time.Duration(delay) * time.Millisecond
+	return &msg, nil
+}
@@ -0,0 +1,105 @@
+package transaction
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func TestTransactionManager_Prepare(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tm := &transactionManagerImpl{db: db, cfg: &config.Config{TransactionTimeout: time.Minute}, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	bornTime := time.Now()
+	mock.ExpectExec("INSERT INTO mqx_half_messages").
+		WithArgs("half-1", "test-topic", "key1", "tag1", []byte("body"), bornTime, sqlmock.AnyArg(), int64(0), bornTime.Add(time.Minute)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	msgID, err := tm.Prepare(context.Background(), &model.Message{
+		MessageID: "half-1",
+		Topic:     "test-topic",
+		Key:       "key1",
+		Tag:       "tag1",
+		Body:      []byte("body"),
+		BornTime:  bornTime,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "half-1", msgID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionManager_Prepare_InvalidTopic(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tm := &transactionManagerImpl{db: db, cfg: &config.Config{TransactionTimeout: time.Minute}, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	// Nothing is stored for a topic the message can never be committed to
+	_, err = tm.Prepare(context.Background(), &model.Message{Topic: "test topic", Body: []byte("body"), BornTime: time.Now()})
+	assert.ErrorIs(t, err, model.ErrInvalidTopic)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionManager_Rollback_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tm := &transactionManagerImpl{db: db, cfg: &config.Config{}, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	mock.ExpectExec("DELETE FROM mqx_half_messages").
+		WithArgs("half-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = tm.Rollback(context.Background(), "half-1")
+	assert.Equal(t, ErrHalfMessageNotFound, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionManager_Commit_DelayedMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tm := &transactionManagerImpl{db: db, cfg: &config.Config{}, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	rows := sqlmock.NewRows([]string{"id", "message_id", "topic", "key", "tag", "body", "born_time", "headers", "delay", "check_time", "check_times"}).
+		AddRow(1, "half-1", "test-topic", "key1", "tag1", []byte("body"), time.Now(), nil, int64(5000), time.Now(), 0)
+	mock.ExpectQuery("SELECT (.+) FROM mqx_half_messages").WithArgs("half-1").WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM mqx_half_messages").WithArgs("half-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO mqx_delay_messages").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = tm.Commit(context.Background(), "half-1")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionManager_Resolve_MaxCheckTimesRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tm := &transactionManagerImpl{db: db, cfg: &config.Config{TransactionCheckMaxTimes: 3}, stopChan: make(chan struct{}), logger: logging.Discard()}
+
+	mock.ExpectExec("DELETE FROM mqx_half_messages").
+		WithArgs("half-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	msg := &model.HalfMessage{ID: 1, Message: model.Message{MessageID: "half-1", Topic: "test-topic"}, CheckTimes: 3}
+	tm.resolve(context.Background(), msg, func(topic string, messageID string) model.TransactionState {
+		return model.TransactionUnknown
+	})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/model"
+	"golang.org/x/time/rate"
+)
+
+// Headers of a delivery, next to the message JSON in the body
+const (
+	HeaderMessageID = "Mqx-Message-Id"
+	HeaderTopic     = "Mqx-Topic"
+	HeaderGroup     = "Mqx-Group"
+	// HeaderAttempt counts the deliveries of the message, from 1
+	HeaderAttempt = "Mqx-Delivery-Attempt"
+	// HeaderTimestamp holds the unix time of the delivery in seconds, signed with the body
+	HeaderTimestamp = "Mqx-Timestamp"
+	// HeaderSignature holds "sha256=" and the hex HMAC-SHA256 of the timestamp, a dot and the body,
+	// keyed with the secret of the subscription
+	HeaderSignature = "Mqx-Signature"
+)
+
+// signaturePrefix names the algorithm of the signature header
+const signaturePrefix = "sha256="
+
+// maxResponseBody is the part of a response body read so that the connection can be reused
+const maxResponseBody = 64 << 10
+
+// Sign returns the signature header of a delivery
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature header of a delivery
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// runner runs a subscription on this instance
+type runner struct {
+	client       *http.Client
+	subscription interfaces.Subscription
+	settings     atomic.Pointer[settings]
+}
+
+// settings are the delivery settings of a subscription. Changed settings replace the limits of the
+// deliveries that follow; those in flight keep the previous ones.
+type settings struct {
+	sub     *model.WebhookSubscription
+	timeout time.Duration
+	// instances is the number of instances running the subscription, which share its limits
+	instances int
+	// slots holds a token per delivery in flight, nil for no limit
+	slots chan struct{}
+	// limiter spaces the deliveries out, nil for no limit
+	limiter *rate.Limiter
+}
+
+// update applies the settings of a subscription unless they are unchanged. The limits are divided
+// among the instances running it, at least one delivery in flight each; instances is 0 when unknown,
+// keeping the current share.
+func (r *runner) update(sub *model.WebhookSubscription, defaultTimeout time.Duration, instances int) {
+	current := r.settings.Load()
+	if instances <= 0 {
+		instances = 1
+		if current != nil {
+			instances = current.instances
+		}
+	}
+	if current != nil && current.sub.UpdatedTime.Equal(sub.UpdatedTime) && current.instances == instances {
+		return
+	}
+	s := &settings{sub: sub, timeout: defaultTimeout, instances: instances}
+	if sub.TimeoutMs > 0 {
+		s.timeout = time.Duration(sub.TimeoutMs) * time.Millisecond
+	}
+	if sub.Concurrency > 0 {
+		s.slots = make(chan struct{}, max(1, sub.Concurrency/instances))
+	}
+	if sub.RateLimit > 0 {
+		s.limiter = rate.NewLimiter(rate.Limit(sub.RateLimit/float64(instances)), 1)
+	}
+	r.settings.Store(s)
+}
+
+// deliver is the handler of the subscription: it waits for the concurrency and rate limits and POSTs
+// the message. An error response or a timeout fails the handler, which retries the message later.
+func (r *runner) deliver(ctx context.Context, msg *model.Message) error {
+	s := r.settings.Load()
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if s.limiter != nil {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(model.NewHTTPMessage(msg))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderMessageID, msg.MessageID)
+	req.Header.Set(HeaderTopic, s.sub.Topic)
+	req.Header.Set(HeaderGroup, s.sub.Group)
+	req.Header.Set(HeaderAttempt, strconv.Itoa(msg.RetryCount+1))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(s.sub.Secret, timestamp, body))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+func newTestRunner(sub *model.WebhookSubscription) *runner {
+	r := &runner{client: &http.Client{}}
+	r.update(sub, time.Second, 1)
+	return r
+}
+
+func TestRunner_Deliver(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer target.Close()
+	r := newTestRunner(&model.WebhookSubscription{Topic: "orders", Group: "billing", URL: target.URL, Secret: "s3cret"})
+
+	msg := &model.Message{MessageID: "m1", Topic: "orders", Partition: 1, Offset: 3, Body: []byte(`{"id":1}`), RetryCount: 2}
+	require.NoError(t, r.deliver(context.Background(), msg))
+	assert.Equal(t, http.MethodPost, received.Method)
+	assert.Equal(t, "m1", received.Header.Get(HeaderMessageID))
+	assert.Equal(t, "billing", received.Header.Get(HeaderGroup))
+	assert.Equal(t, "3", received.Header.Get(HeaderAttempt))
+	timestamp := received.Header.Get(HeaderTimestamp)
+	assert.True(t, Verify("s3cret", timestamp, body, received.Header.Get(HeaderSignature)))
+	assert.False(t, Verify("other", timestamp, body, received.Header.Get(HeaderSignature)))
+
+	var delivered model.HTTPMessage
+	require.NoError(t, json.Unmarshal(body, &delivered))
+	assert.Equal(t, `{"id":1}`, delivered.Body)
+	assert.Equal(t, int64(3), delivered.Offset)
+}
+
+func TestRunner_Deliver_Failures(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	hang := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status.Load() == 0 {
+			<-hang
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer target.Close()
+	defer close(hang)
+	r := newTestRunner(&model.WebhookSubscription{URL: target.URL, Secret: "s", TimeoutMs: 50})
+	msg := &model.Message{MessageID: "m1"}
+
+	// A non-2xx response fails the handler so that the message is retried
+	assert.ErrorContains(t, r.deliver(context.Background(), msg), "status 503")
+	status.Store(http.StatusBadRequest)
+	assert.ErrorContains(t, r.deliver(context.Background(), msg), "status 400")
+
+	// So does a timeout
+	status.Store(0)
+	start := time.Now()
+	assert.ErrorIs(t, r.deliver(context.Background(), msg), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRunner_Deliver_Limits(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+	}))
+	defer target.Close()
+	r := newTestRunner(&model.WebhookSubscription{URL: target.URL, Secret: "s", Concurrency: 2})
+
+	done := make(chan error, 4)
+	for range 4 {
+		go func() { done <- r.deliver(context.Background(), &model.Message{}) }()
+	}
+	assert.Eventually(t, func() bool { return inFlight.Load() == 2 }, time.Second, 5*time.Millisecond)
+	close(release)
+	for range 4 {
+		assert.NoError(t, <-done)
+	}
+	assert.Equal(t, int32(2), maxInFlight.Load())
+
+	// The rate limit spaces the deliveries out
+	r = newTestRunner(&model.WebhookSubscription{URL: target.URL, Secret: "s", RateLimit: 20})
+	start := time.Now()
+	for range 3 {
+		require.NoError(t, r.deliver(context.Background(), &model.Message{}))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
@@ -0,0 +1,309 @@
+// Package webhook stores the webhook subscriptions and runs them. Every instance with webhooks enabled
+// joins the consumer group of each subscription and POSTs its share of the messages to the subscription
+// URL; a failed delivery is retried and dead lettered like a failed handler. The concurrency and rate
+// limits of a subscription are divided among its instances, counted again at every refresh.
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/template"
+)
+
+const (
+	defaultTimeout         = 10 * time.Second
+	defaultRefreshInterval = 30 * time.Second
+)
+
+// ErrSubscriptionNotFound is returned for a topic and group without webhook subscription
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+// ErrInvalidSubscription is wrapped by the errors of a subscription that cannot be stored
+var ErrInvalidSubscription = errors.New("invalid webhook subscription")
+
+// NewWebhookManager creates the manager of the webhook subscriptions
+func NewWebhookManager(db *sql.DB, cfg *config.Config, factory interfaces.Factory) (interfaces.WebhookManager, error) {
+	timeout := cfg.WebhookTimeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	refreshInterval := cfg.WebhookRefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+	return &webhookManagerImpl{
+		db:              db,
+		cfg:             cfg,
+		factory:         factory,
+		logger:          factory.GetLogger(),
+		client:          &http.Client{},
+		timeout:         timeout,
+		refreshInterval: refreshInterval,
+		runners:         make(map[string]*runner),
+		stopChan:        make(chan struct{}),
+	}, nil
+}
+
+type webhookManagerImpl struct {
+	db      *sql.DB
+	cfg     *config.Config
+	factory interfaces.Factory
+	logger  logging.Logger
+	client  *http.Client
+	// timeout bounds the deliveries of the subscriptions without timeout of their own
+	timeout         time.Duration
+	refreshInterval time.Duration
+	// mu serializes the refreshes and guards runners, the running subscriptions by topic and group
+	mu       sync.Mutex
+	runners  map[string]*runner
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func (w *webhookManagerImpl) Start(ctx context.Context) error {
+	if _, err := w.db.ExecContext(ctx, template.CreateWebhookSubscriptionsTable); err != nil {
+		w.logger.Error("Failed to create webhook subscriptions table", "error", err)
+		return err
+	}
+	if !w.cfg.EnableWebhooks {
+		return nil
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.refreshLoop()
+	}()
+	return nil
+}
+
+// Stop stops reloading the subscriptions and closes the running ones, waiting for their deliveries
+// up to the ctx deadline
+func (w *webhookManagerImpl) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stopChan) })
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	errs := make([]error, 0, len(w.runners))
+	for key, r := range w.runners {
+		errs = append(errs, r.subscription.Close(ctx))
+		delete(w.runners, key)
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe validates and stores a subscription, then runs it on this instance right away.
+// The other instances run it at their next refresh.
+func (w *webhookManagerImpl) Subscribe(ctx context.Context, sub *model.WebhookSubscription) error {
+	if err := validate(sub); err != nil {
+		return err
+	}
+	if err := w.topicExists(ctx, sub.Topic); err != nil {
+		return err
+	}
+	existing, err := w.GetSubscription(ctx, sub.Topic, sub.Group)
+	if err != nil && !errors.Is(err, ErrSubscriptionNotFound) {
+		return err
+	}
+	now := time.Now()
+	sub.CreatedTime, sub.UpdatedTime = now, now
+	if existing != nil {
+		sub.CreatedTime = existing.CreatedTime
+		if sub.Secret == "" {
+			sub.Secret = existing.Secret
+		}
+	}
+	if sub.Secret == "" {
+		return fmt.Errorf("%w: a secret is required to sign the deliveries", ErrInvalidSubscription)
+	}
+
+	if _, err := w.db.ExecContext(ctx, template.UpsertWebhookSubscription, sub.Topic, sub.Group, sub.URL, sub.Secret,
+		sub.Concurrency, sub.RateLimit, sub.TimeoutMs, sub.CreatedTime, sub.UpdatedTime); err != nil {
+		return fmt.Errorf("failed to save webhook subscription: %w", err)
+	}
+	w.refresh(ctx)
+	return nil
+}
+
+// Unsubscribe deletes a subscription and stops running it on this instance.
+// The other instances stop at their next refresh.
+func (w *webhookManagerImpl) Unsubscribe(ctx context.Context, topic string, group string) error {
+	result, err := w.db.ExecContext(ctx, template.DeleteWebhookSubscription, topic, group)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrSubscriptionNotFound
+	}
+	w.refresh(ctx)
+	return nil
+}
+
+func (w *webhookManagerImpl) GetSubscription(ctx context.Context, topic string, group string) (*model.WebhookSubscription, error) {
+	sub, err := scanSubscription(w.db.QueryRowContext(ctx, template.GetWebhookSubscription, topic, group))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	return sub, nil
+}
+
+func (w *webhookManagerImpl) GetSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error) {
+	rows, err := w.db.QueryContext(ctx, template.SelectWebhookSubscriptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := make([]*model.WebhookSubscription, 0)
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func scanSubscription(row interface{ Scan(dest ...any) error }) (*model.WebhookSubscription, error) {
+	var sub model.WebhookSubscription
+	if err := row.Scan(&sub.Topic, &sub.Group, &sub.URL, &sub.Secret, &sub.Concurrency, &sub.RateLimit,
+		&sub.TimeoutMs, &sub.CreatedTime, &sub.UpdatedTime); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// validate checks the fields of a subscription
+func validate(sub *model.WebhookSubscription) error {
+	if sub.Topic == "" || sub.Group == "" {
+		return fmt.Errorf("%w: topic and group are required", ErrInvalidSubscription)
+	}
+	if err := model.ValidateTopic(sub.Topic); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSubscription, err)
+	}
+	if u, err := url.Parse(sub.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidSubscription)
+	}
+	if sub.Concurrency < 0 || sub.RateLimit < 0 || sub.TimeoutMs < 0 {
+		return fmt.Errorf("%w: concurrency, rate limit and timeout must not be negative", ErrInvalidSubscription)
+	}
+	return nil
+}
+
+// topicExists checks that the topic of a subscription exists, so that running the subscription
+// does not create it. The error of a missing topic wraps ErrInvalidSubscription.
+func (w *webhookManagerImpl) topicExists(ctx context.Context, topic string) error {
+	_, err := w.factory.GetTopicManager().FindTopicMeta(ctx, topic)
+	if errors.Is(err, model.ErrTopicNotFound) {
+		return fmt.Errorf("%w: %w", ErrInvalidSubscription, err)
+	}
+	return err
+}
+
+// refreshLoop reloads the subscriptions every refresh interval until Stop
+func (w *webhookManagerImpl) refreshLoop() {
+	ticker := time.NewTicker(w.refreshInterval)
+	defer ticker.Stop()
+	for {
+		w.refresh(context.Background())
+		select {
+		case <-w.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh runs the stored subscriptions on this instance: it starts the new ones, applies the changed
+// settings and closes the deleted ones. Failures are logged and retried at the next refresh.
+func (w *webhookManagerImpl) refresh(ctx context.Context) {
+	if !w.cfg.EnableWebhooks {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.stopChan:
+		return
+	default:
+	}
+
+	subs, err := w.GetSubscriptions(ctx)
+	if err != nil {
+		w.logger.Error("Failed to load webhook subscriptions", "error", err)
+		return
+	}
+	wanted := make(map[string]*model.WebhookSubscription, len(subs))
+	for _, sub := range subs {
+		wanted[sub.Topic+"/"+sub.Group] = sub
+	}
+
+	for key, r := range w.runners {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		delete(w.runners, key)
+		if err := r.subscription.Close(ctx); err != nil {
+			w.logger.Error("Failed to close webhook subscription", "subscription", key, "error", err)
+		}
+	}
+	for key, sub := range wanted {
+		if r, ok := w.runners[key]; ok {
+			r.update(sub, w.timeout, w.instances(ctx, sub, r.subscription.InstanceID()))
+			continue
+		}
+		// Subscriptions stored before the checks were added are not run either
+		if err := validate(sub); err != nil {
+			w.logger.Error("Skipping invalid webhook subscription", "subscription", key, "error", err)
+			continue
+		}
+		if err := w.topicExists(ctx, sub.Topic); err != nil {
+			w.logger.Error("Skipping webhook subscription", "subscription", key, "error", err)
+			continue
+		}
+		r := &runner{client: w.client}
+		r.update(sub, w.timeout, w.instances(ctx, sub, ""))
+		subscription, err := w.factory.GetConsumerManager().Subscribe(ctx, sub.Topic, sub.Group, r.deliver)
+		if err != nil {
+			w.logger.Error("Failed to run webhook subscription", "subscription", key, "error", err)
+			continue
+		}
+		r.subscription = subscription
+		w.runners[key] = r
+	}
+}
+
+// instances counts the instances running a subscription, including this one whose instance is self
+// and may not have joined the group yet. It returns 0 when the count is unknown.
+func (w *webhookManagerImpl) instances(ctx context.Context, sub *model.WebhookSubscription, self string) int {
+	heartbeatTimeoutSeconds := int(w.cfg.HeartbeatInterval.Seconds()) * 3
+	active, err := w.factory.GetConsumerManager().GetActiveConsumerInstances(ctx, sub.Topic, sub.Group, heartbeatTimeoutSeconds)
+	if err != nil {
+		w.logger.Error("Failed to count webhook subscription instances", "topic", sub.Topic, "group", sub.Group, "error", err)
+		return 0
+	}
+	joined := slices.ContainsFunc(active, func(instance model.ConsumerInstance) bool { return instance.InstanceID == self })
+	if !joined {
+		return len(active) + 1
+	}
+	return len(active)
+}
@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wenzuojing/mqx/internal/config"
+	"github.com/wenzuojing/mqx/internal/interfaces"
+	"github.com/wenzuojing/mqx/internal/logging"
+	"github.com/wenzuojing/mqx/internal/model"
+	"golang.org/x/time/rate"
+)
+
+// MockFactory implements interfaces.Factory for testing
+type MockFactory struct {
+	mock.Mock
+	interfaces.Factory
+}
+
+func (m *MockFactory) GetConsumerManager() interfaces.ConsumerManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.ConsumerManager)
+}
+
+func (m *MockFactory) GetTopicManager() interfaces.TopicManager {
+	args := m.Called()
+	return args.Get(0).(interfaces.TopicManager)
+}
+
+func (m *MockFactory) GetLogger() logging.Logger {
+	return logging.Discard()
+}
+
+// MockTopicManager implements interfaces.TopicManager for testing
+type MockTopicManager struct {
+	mock.Mock
+	interfaces.TopicManager
+}
+
+func (m *MockTopicManager) FindTopicMeta(ctx context.Context, topic string) (*model.TopicMeta, error) {
+	args := m.Called(ctx, topic)
+	meta, _ := args.Get(0).(*model.TopicMeta)
+	return meta, args.Error(1)
+}
+
+// newTestTopicManager knows the orders topic only
+func newTestTopicManager() *MockTopicManager {
+	topics := new(MockTopicManager)
+	topics.On("FindTopicMeta", mock.Anything, "orders").Return(&model.TopicMeta{Topic: "orders", PartitionNum: 1}, nil)
+	topics.On("FindTopicMeta", mock.Anything, mock.Anything).Return(nil, model.ErrTopicNotFound)
+	return topics
+}
+
+// MockConsumerManager implements interfaces.ConsumerManager for testing
+type MockConsumerManager struct {
+	mock.Mock
+	interfaces.ConsumerManager
+}
+
+func (m *MockConsumerManager) Subscribe(ctx context.Context, topic string, group string, handler func(ctx context.Context, msg *model.Message) error) (interfaces.Subscription, error) {
+	args := m.Called(ctx, topic, group, handler)
+	subscription, _ := args.Get(0).(interfaces.Subscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockConsumerManager) GetActiveConsumerInstances(ctx context.Context, topic string, group string, heartbeatTimeoutSeconds int) ([]model.ConsumerInstance, error) {
+	args := m.Called(ctx, topic, group, heartbeatTimeoutSeconds)
+	instances, _ := args.Get(0).([]model.ConsumerInstance)
+	return instances, args.Error(1)
+}
+
+// MockSubscription implements interfaces.Subscription for testing
+type MockSubscription struct {
+	mock.Mock
+}
+
+func (m *MockSubscription) InstanceID() string {
+	return "instance-1"
+}
+
+func (m *MockSubscription) Close(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+var subscriptionColumns = []string{"topic", "group", "url", "secret", "concurrency", "rate_limit", "timeout_ms", "created_time", "updated_time"}
+
+func newTestManager(t *testing.T, db *sql.DB, factory *MockFactory, enabled bool) *webhookManagerImpl {
+	m, err := NewWebhookManager(db, &config.Config{EnableWebhooks: enabled}, factory)
+	require.NoError(t, err)
+	return m.(*webhookManagerImpl)
+}
+
+func TestWebhookManager_Subscribe(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	created := time.Now().Add(-time.Hour)
+	factory := new(MockFactory)
+	factory.On("GetTopicManager").Return(newTestTopicManager())
+	m := newTestManager(t, db, factory, false)
+
+	// A new subscription needs a secret
+	smock.ExpectQuery("SELECT (.+) FROM mqx_webhook_subscriptions").WithArgs("orders", "billing").
+		WillReturnRows(sqlmock.NewRows(subscriptionColumns))
+	err = m.Subscribe(context.Background(), &model.WebhookSubscription{Topic: "orders", Group: "billing", URL: "https://example.com/hook"})
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+
+	// Replacing a subscription without secret keeps its secret and creation time
+	smock.ExpectQuery("SELECT (.+) FROM mqx_webhook_subscriptions").WithArgs("orders", "billing").
+		WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+			AddRow("orders", "billing", "https://example.com/old", "s3cret", 0, 0, 0, created, created))
+	smock.ExpectExec("INSERT INTO mqx_webhook_subscriptions").
+		WithArgs("orders", "billing", "https://example.com/hook", "s3cret", 4, 10.0, int64(500), created, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	sub := &model.WebhookSubscription{Topic: "orders", Group: "billing", URL: "https://example.com/hook", Concurrency: 4, RateLimit: 10, TimeoutMs: 500}
+	assert.NoError(t, m.Subscribe(context.Background(), sub))
+	assert.Equal(t, created, sub.CreatedTime)
+	assert.NoError(t, smock.ExpectationsWereMet())
+
+	for _, invalid := range []*model.WebhookSubscription{
+		{Group: "billing", URL: "https://example.com/hook", Secret: "s"},
+		{Topic: "orders`; drop table x", Group: "billing", URL: "https://example.com/hook", Secret: "s"},
+		// The topic is not created for the subscription
+		{Topic: "missing", Group: "billing", URL: "https://example.com/hook", Secret: "s"},
+		{Topic: "orders", Group: "billing", URL: "ftp://example.com", Secret: "s"},
+		{Topic: "orders", Group: "billing", URL: "/hook", Secret: "s"},
+		{Topic: "orders", Group: "billing", URL: "https://example.com/hook", Secret: "s", RateLimit: -1},
+	} {
+		assert.ErrorIs(t, m.Subscribe(context.Background(), invalid), ErrInvalidSubscription)
+	}
+}
+
+func TestWebhookManager_Unsubscribe(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	m := newTestManager(t, db, new(MockFactory), false)
+
+	smock.ExpectExec("DELETE FROM mqx_webhook_subscriptions").WithArgs("orders", "billing").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, m.Unsubscribe(context.Background(), "orders", "billing"))
+	smock.ExpectExec("DELETE FROM mqx_webhook_subscriptions").WithArgs("orders", "billing").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, m.Unsubscribe(context.Background(), "orders", "billing"), ErrSubscriptionNotFound)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
+
+func TestWebhookManager_Refresh(t *testing.T) {
+	db, smock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	billing, audit := new(MockSubscription), new(MockSubscription)
+	billing.On("Close", mock.Anything).Return(nil)
+	audit.On("Close", mock.Anything).Return(nil)
+	consumers := new(MockConsumerManager)
+	consumers.On("Subscribe", mock.Anything, "orders", "billing", mock.Anything).Return(billing, nil).Once()
+	consumers.On("Subscribe", mock.Anything, "orders", "audit", mock.Anything).Return(audit, nil).Once()
+	consumers.On("GetActiveConsumerInstances", mock.Anything, "orders", "audit", mock.Anything).Return(nil, nil)
+	// Before joining, the billing instance adds itself to the other one
+	consumers.On("GetActiveConsumerInstances", mock.Anything, "orders", "billing", mock.Anything).
+		Return([]model.ConsumerInstance{{InstanceID: "other"}}, nil).Once()
+	factory := new(MockFactory)
+	factory.On("GetConsumerManager").Return(consumers)
+	factory.On("GetTopicManager").Return(newTestTopicManager())
+	m := newTestManager(t, db, factory, true)
+	created := time.Now()
+
+	// Stored subscriptions of invalid or missing topics are skipped
+	smock.ExpectQuery("SELECT (.+) FROM mqx_webhook_subscriptions").WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+		AddRow("orders", "billing", "https://example.com/billing", "s", 0, 10, 0, created, created).
+		AddRow("orders", "audit", "https://example.com/audit", "s", 0, 0, 0, created, created).
+		AddRow("orders`; drop table x", "billing", "https://example.com/billing", "s", 0, 0, 0, created, created).
+		AddRow("missing", "billing", "https://example.com/billing", "s", 0, 0, 0, created, created))
+	m.refresh(context.Background())
+	require.Len(t, m.runners, 2)
+	// The rate limit is shared by the two instances
+	assert.Equal(t, rate.Limit(5), m.runners["orders/billing"].settings.Load().limiter.Limit())
+
+	// A changed subscription keeps running with the new settings and a deleted one is closed
+	consumers.On("GetActiveConsumerInstances", mock.Anything, "orders", "billing", mock.Anything).
+		Return([]model.ConsumerInstance{{InstanceID: "other"}, {InstanceID: "instance-1"}, {InstanceID: "third"}}, nil)
+	updated := created.Add(time.Minute)
+	smock.ExpectQuery("SELECT (.+) FROM mqx_webhook_subscriptions").WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+		AddRow("orders", "billing", "https://example.com/billing", "s", 7, 0, 0, created, updated))
+	m.refresh(context.Background())
+	require.Len(t, m.runners, 1)
+	assert.Equal(t, 2, cap(m.runners["orders/billing"].settings.Load().slots))
+	assert.Nil(t, m.runners["orders/billing"].settings.Load().limiter)
+	audit.AssertCalled(t, "Close", mock.Anything)
+	billing.AssertNotCalled(t, "Close", mock.Anything)
+
+	assert.NoError(t, m.Stop(context.Background()))
+	billing.AssertCalled(t, "Close", mock.Anything)
+	// Stopped, the manager runs no subscription
+	m.refresh(context.Background())
+	assert.Empty(t, m.runners)
+	consumers.AssertExpectations(t)
+	assert.NoError(t, smock.ExpectationsWereMet())
+}
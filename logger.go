@@ -0,0 +1,30 @@
+package mqx
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/wenzuojing/mqx/internal/logging"
+)
+
+// Logger is the structured logger used by MQX.
+// keysAndValues are alternating keys and values, as with log/slog.
+type Logger = logging.Logger
+
+// NewSlogLogger adapts a log/slog logger. A nil logger uses slog.Default(), which is also
+// the logger used when Config.Logger is unset.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return logging.NewSlog(logger)
+}
+
+// NewKlogLogger adapts k8s.io/klog/v2, for applications already routing klog output.
+// Debug entries are written at verbosity 4.
+func NewKlogLogger() Logger {
+	return logging.NewKlog()
+}
+
+// LoggerFromContext returns the client logger carried by handler and send contexts,
+// or the slog default logger for other contexts. Middlewares log through it.
+func LoggerFromContext(ctx context.Context) Logger {
+	return logging.FromContext(ctx)
+}
@@ -0,0 +1,37 @@
+package mqx
+
+import (
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/msgtrace"
+)
+
+// ErrMessageTraceDisabled is returned by TraceMessage when message tracing is not enabled
+var ErrMessageTraceDisabled = msgtrace.ErrDisabled
+
+// MessageTraceEventType is a step in the lifecycle of a message
+type MessageTraceEventType = model.TraceEventType
+
+const (
+	// MessageProduced is recorded when a message is stored in a partition of its topic
+	MessageProduced = model.TraceProduced
+	// MessageDelayScheduled is recorded when a delayed message is stored in the delay queue
+	MessageDelayScheduled = model.TraceDelayScheduled
+	// MessageDelayDelivered is recorded when a delayed or retried message is moved to its topic
+	MessageDelayDelivered = model.TraceDelayDelivered
+	// MessageConsumed is recorded for every delivery attempt to a consumer group, with its result
+	MessageConsumed = model.TraceConsumed
+	// MessageRetryScheduled is recorded when a failed delivery is put back in the delay queue
+	MessageRetryScheduled = model.TraceRetryScheduled
+	// MessageDeadLettered is recorded when a message is stored in the dead letter topic
+	MessageDeadLettered = model.TraceDeadLettered
+)
+
+// Results of a MessageConsumed event
+const (
+	MessageTraceSuccess = model.TraceResultSuccess
+	MessageTraceFailure = model.TraceResultFailure
+)
+
+// MessageTraceEvent records one step in the lifecycle of a message.
+// Group, InstanceID, Result and Error are set for consumer events; DelayTime for delay and retry events.
+type MessageTraceEvent = model.TraceEvent
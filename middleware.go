@@ -0,0 +1,111 @@
+package mqx
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// ConsumerMiddleware wraps a message handler with cross-cutting behavior
+type ConsumerMiddleware func(next MessageHandler) MessageHandler
+
+// SendFunc sends a message and returns its ID
+type SendFunc func(ctx context.Context, msg *Message) (string, error)
+
+// ProducerMiddleware wraps a send with cross-cutting behavior
+type ProducerMiddleware func(next SendFunc) SendFunc
+
+// chainConsumer wraps a handler so the first middleware is the outermost one
+func chainConsumer(middlewares []ConsumerMiddleware, handler MessageHandler) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// chainProducer wraps a send so the first middleware is the outermost one
+func chainProducer(middlewares []ProducerMiddleware, send SendFunc) SendFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		send = middlewares[i](send)
+	}
+	return send
+}
+
+// RecoveryMiddleware turns a handler panic into a handler error, so the message
+// follows the regular retry/DLQ path instead of taking the partition down.
+func RecoveryMiddleware() ConsumerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *MessageView) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					LoggerFromContext(ctx).Error("Message handler panicked", "topic", msg.Topic, "group", msg.Group,
+						"partition", msg.Partition, "messageId", msg.MessageID, "panic", r, "stack", string(debug.Stack()))
+					err = fmt.Errorf("message handler panicked: %v", r)
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// TimeoutMiddleware fails a message whose handler runs longer than timeout.
+// The handler context is cancelled when the timeout fires; a handler ignoring it
+// keeps running in the background.
+func TimeoutMiddleware(timeout time.Duration) ConsumerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *MessageView) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						done <- fmt.Errorf("message handler panicked: %v", r)
+					}
+				}()
+				done <- next(ctx, msg)
+			}()
+			select {
+			case err := <-done:
+				return err
+			case <-ctx.Done():
+				return fmt.Errorf("message handler timed out after %v: %w", timeout, ctx.Err())
+			}
+		}
+	}
+}
+
+// LoggingMiddleware logs every handled message with its outcome and duration
+func LoggingMiddleware() ConsumerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg *MessageView) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			if err != nil {
+				LoggerFromContext(ctx).Error("Message handling failed", "topic", msg.Topic, "group", msg.Group,
+					"partition", msg.Partition, "messageId", msg.MessageID, "duration", time.Since(start), "error", err)
+				return err
+			}
+			LoggerFromContext(ctx).Debug("Message handled", "topic", msg.Topic, "group", msg.Group,
+				"partition", msg.Partition, "messageId", msg.MessageID, "duration", time.Since(start))
+			return nil
+		}
+	}
+}
+
+// ProducerLoggingMiddleware logs every sent message with its outcome and duration
+func ProducerLoggingMiddleware() ProducerMiddleware {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, msg *Message) (string, error) {
+			start := time.Now()
+			id, err := next(ctx, msg)
+			if err != nil {
+				LoggerFromContext(ctx).Error("Message send failed", "topic", msg.Topic, "key", msg.Key, "duration", time.Since(start), "error", err)
+				return id, err
+			}
+			LoggerFromContext(ctx).Debug("Message sent", "topic", msg.Topic, "key", msg.Key, "messageId", id, "duration", time.Since(start))
+			return id, nil
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package mqx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainConsumer_Order(t *testing.T) {
+	var calls []string
+	trace := func(name string) ConsumerMiddleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, msg *MessageView) error {
+				calls = append(calls, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	handler := chainConsumer([]ConsumerMiddleware{trace("outer"), trace("inner")}, func(ctx context.Context, msg *MessageView) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+
+	assert.NoError(t, handler(context.Background(), &MessageView{}))
+	assert.Equal(t, []string{"outer", "inner", "handler"}, calls)
+}
+
+func TestChainProducer_Order(t *testing.T) {
+	var calls []string
+	trace := func(name string) ProducerMiddleware {
+		return func(next SendFunc) SendFunc {
+			return func(ctx context.Context, msg *Message) (string, error) {
+				calls = append(calls, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	send := chainProducer([]ProducerMiddleware{trace("outer"), trace("inner")}, func(ctx context.Context, msg *Message) (string, error) {
+		calls = append(calls, "send")
+		return "id-1", nil
+	})
+
+	id, err := send(context.Background(), NewMessage())
+	assert.NoError(t, err)
+	assert.Equal(t, "id-1", id)
+	assert.Equal(t, []string{"outer", "inner", "send"}, calls)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	handler := RecoveryMiddleware()(func(ctx context.Context, msg *MessageView) error {
+		panic("boom")
+	})
+
+	err := handler(context.Background(), &MessageView{MessageID: "msg-1"})
+	assert.EqualError(t, err, "message handler panicked: boom")
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	handler := TimeoutMiddleware(time.Millisecond * 10)(func(ctx context.Context, msg *MessageView) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Error(t, handler(context.Background(), &MessageView{}))
+
+	handlerErr := errors.New("handler error")
+	handler = TimeoutMiddleware(time.Second)(func(ctx context.Context, msg *MessageView) error {
+		return handlerErr
+	})
+	assert.Equal(t, handlerErr, handler(context.Background(), &MessageView{}))
+}
@@ -0,0 +1,5 @@
+// Package mqxpb holds the gRPC services of MQX generated from mqx.proto, for Go clients of an MQX
+// gRPC server. Clients in other languages generate theirs from the same file.
+package mqxpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mqx.proto
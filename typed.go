@@ -0,0 +1,98 @@
+package mqx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wenzuojing/mqx/internal/consumer"
+	"github.com/wenzuojing/mqx/internal/model"
+)
+
+// HeaderContentType is the header holding the content type of a typed message body
+const HeaderContentType = model.HeaderContentType
+
+// ErrDeadLetter can be wrapped by a handler error to send the message to the dead letter
+// queue immediately instead of retrying it
+var ErrDeadLetter = consumer.ErrDeadLetter
+
+// TypedProducer sends values of type T to a topic, encoded with a codec
+type TypedProducer[T any] struct {
+	mq    MQX
+	topic string
+	codec Codec
+}
+
+// NewTypedProducer creates a producer encoding values of type T with the given codec.
+// A nil codec defaults to JSONCodec.
+func NewTypedProducer[T any](mq MQX, topic string, codec Codec) *TypedProducer[T] {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &TypedProducer[T]{mq: mq, topic: topic, codec: codec}
+}
+
+// NewMessage encodes a value into a message for the producer's topic.
+// The returned message can be further customized (key, tag, delay) before sending.
+func (p *TypedProducer[T]) NewMessage(value T) (*Message, error) {
+	body, err := p.codec.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	return NewMessage().WithTopic(p.topic).WithBody(body).WithHeader(HeaderContentType, p.codec.ContentType()), nil
+}
+
+// SendSync encodes and sends a value synchronously
+func (p *TypedProducer[T]) SendSync(ctx context.Context, value T) (string, error) {
+	msg, err := p.NewMessage(value)
+	if err != nil {
+		return "", err
+	}
+	return p.mq.SendSync(ctx, msg)
+}
+
+// SendAsync encodes and sends a value asynchronously
+func (p *TypedProducer[T]) SendAsync(ctx context.Context, value T, callback func(string, error)) error {
+	msg, err := p.NewMessage(value)
+	if err != nil {
+		return err
+	}
+	return p.mq.SendAsync(ctx, msg, callback)
+}
+
+// TypedHandler processes a decoded value of type T
+type TypedHandler[T any] func(ctx context.Context, value T, msg *MessageView) error
+
+// TypedSubscribe creates a consumer group subscription decoding message bodies into T.
+// The codec is chosen by the content type stored with each message, falling back to
+// JSONCodec for messages without one. Messages that cannot be decoded go straight to
+// the dead letter queue.
+func TypedSubscribe[T any](mq MQX, topic string, group string, handler TypedHandler[T]) error {
+	return mq.GroupSubscribe(context.Background(), topic, group, typedHandler(handler))
+}
+
+// typedHandler adapts a TypedHandler into a MessageHandler
+func typedHandler[T any](handler TypedHandler[T]) MessageHandler {
+	return func(ctx context.Context, msg *MessageView) error {
+		value, err := decodeValue[T](msg)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, value, msg)
+	}
+}
+
+// decodeValue decodes the body of a message into a value of type T
+func decodeValue[T any](msg *MessageView) (T, error) {
+	var value T
+	codec := JSONCodec
+	if contentType := msg.Headers[HeaderContentType]; contentType != "" {
+		var ok bool
+		if codec, ok = lookupCodec(contentType); !ok {
+			return value, fmt.Errorf("%w: no codec registered for content type %q", ErrDeadLetter, contentType)
+		}
+	}
+	if err := codec.Unmarshal(msg.Body, &value); err != nil {
+		return value, fmt.Errorf("%w: failed to decode message %s as %T: %v", ErrDeadLetter, msg.MessageID, value, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,52 @@
+package mqx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type order struct {
+	ID     string
+	Amount int
+}
+
+func TestTypedProducer_NewMessage(t *testing.T) {
+	producer := NewTypedProducer[order](nil, "order-topic", GobCodec)
+
+	msg, err := producer.NewMessage(order{ID: "o-1", Amount: 42})
+	assert.NoError(t, err)
+	assert.Equal(t, "order-topic", msg.Topic)
+	assert.Equal(t, ContentTypeGob, msg.Headers[HeaderContentType])
+
+	value, err := decodeValue[order](&MessageView{Body: msg.Body, Headers: msg.Headers})
+	assert.NoError(t, err)
+	assert.Equal(t, order{ID: "o-1", Amount: 42}, value)
+}
+
+func TestDecodeValue_DefaultsToJSON(t *testing.T) {
+	value, err := decodeValue[order](&MessageView{Body: []byte(`{"ID":"o-1","Amount":7}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, order{ID: "o-1", Amount: 7}, value)
+}
+
+func TestDecodeValue_Protobuf(t *testing.T) {
+	producer := NewTypedProducer[*wrapperspb.StringValue](nil, "pb-topic", ProtobufCodec)
+
+	msg, err := producer.NewMessage(wrapperspb.String("hello"))
+	assert.NoError(t, err)
+
+	value, err := decodeValue[*wrapperspb.StringValue](&MessageView{Body: msg.Body, Headers: msg.Headers})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", value.GetValue())
+}
+
+func TestDecodeValue_FailureIsDeadLetter(t *testing.T) {
+	_, err := decodeValue[order](&MessageView{Body: []byte("not json")})
+	assert.True(t, errors.Is(err, ErrDeadLetter))
+
+	_, err = decodeValue[order](&MessageView{Body: []byte("{}"), Headers: map[string]string{HeaderContentType: "text/unknown"}})
+	assert.True(t, errors.Is(err, ErrDeadLetter))
+}
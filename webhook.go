@@ -0,0 +1,43 @@
+package mqx
+
+import (
+	"time"
+
+	"github.com/wenzuojing/mqx/internal/model"
+	"github.com/wenzuojing/mqx/internal/webhook"
+)
+
+// Errors of the webhook subscriptions
+var (
+	// ErrWebhookNotFound is returned for a topic and group without webhook subscription
+	ErrWebhookNotFound = webhook.ErrSubscriptionNotFound
+	// ErrInvalidWebhook is wrapped by the errors of a subscription that cannot be stored
+	ErrInvalidWebhook = webhook.ErrInvalidSubscription
+)
+
+// Headers of a webhook delivery, next to the message JSON in the body
+const (
+	WebhookHeaderMessageID = webhook.HeaderMessageID
+	WebhookHeaderTopic     = webhook.HeaderTopic
+	WebhookHeaderGroup     = webhook.HeaderGroup
+	WebhookHeaderAttempt   = webhook.HeaderAttempt
+	WebhookHeaderTimestamp = webhook.HeaderTimestamp
+	WebhookHeaderSignature = webhook.HeaderSignature
+)
+
+// WebhookOptions are the settings of a webhook subscription
+type WebhookOptions struct {
+	Secret      string        // HMAC key signing the deliveries; empty keeps the secret of the subscription replaced
+	Concurrency int           // Maximum deliveries in flight, shared by the instances running the subscription (0 for no limit)
+	RateLimit   float64       // Maximum deliveries per second, shared by the instances running the subscription (0 for no limit)
+	Timeout     time.Duration // Timeout of a delivery (0 for the WebhookTimeout of the config)
+}
+
+// WebhookSubscription is a stored webhook subscription; its secret is not returned
+type WebhookSubscription = model.WebhookSubscription
+
+// VerifyWebhookSignature reports whether the signature header of a webhook delivery matches
+// its timestamp header and body. Receivers should also reject old timestamps to prevent replays.
+func VerifyWebhookSignature(secret string, timestamp string, body []byte, signature string) bool {
+	return webhook.Verify(secret, timestamp, body, signature)
+}